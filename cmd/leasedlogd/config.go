@@ -0,0 +1,216 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"cloud.google.com/go/logging"
+	"gopkg.in/ini.v1"
+
+	"github.com/carsonoid/talk-leased-logs/internal/capture"
+	"github.com/carsonoid/talk-leased-logs/internal/leaseconfig"
+)
+
+// config is the agent configuration, loaded from an ini file.
+//   - keys in the default section map to the fields by their ini tag, including those of the embedded settings shared
+//     with the leased-logs CLI, which are named like its flags
+//   - map settings, such as the instance labels, are read from the sections named by their section tag, such as [labels]
+//   - the [severity_patterns] section holds regular expressions classifying text lines by severity
+type config struct {
+	ProjectID string `ini:"project_id"`
+	// LeaseIDs are the leases watched, combined by lease_policy, the first of which names the log
+	LeaseIDs []string `ini:"lease_id"`
+	Database string   `ini:"database"`
+
+	InitialLease time.Duration `ini:"initial_lease"`
+
+	leaseconfig.Manager `ini:",extends"`
+	leaseconfig.Capture `ini:",extends"`
+
+	// BandwidthKiB caps the KiB per second shipped to Cloud Logging, queueing bursts, disabled when zero
+	//   - kept for configs predating the [sink_bandwidth] section, which takes precedence
+	BandwidthKiB int `ini:"bandwidth_kib"`
+
+	// UpdateURL serves the release manifest checked by the agent and the upgrade command
+	UpdateURL           string        `ini:"update_url"`
+	UpdateKey           string        `ini:"update_key"`
+	UpdateService       string        `ini:"update_service"`
+	UpdateCheckInterval time.Duration `ini:"update_check_interval"`
+
+	// DebugAddr serves expvar, pprof, and the lease state at /debug/, on localhost when the host is empty
+	DebugAddr string `ini:"debug_addr"`
+
+	// StateDumpFile receives the state dumped on SIGHUP instead of stderr
+	StateDumpFile string `ini:"state_dump_file"`
+}
+
+// defaultConfig returns the configuration used for keys missing from the config file.
+//   - the shared settings default like the flags of the leased-logs CLI
+func defaultConfig() config {
+	cfg := config{
+		Database:            firestore.DefaultDatabaseID,
+		InitialLease:        5 * time.Second,
+		UpdateService:       "leasedlogd",
+		UpdateCheckInterval: 24 * time.Hour,
+	}
+	leaseconfig.Defaults(&cfg.Manager)
+	leaseconfig.Defaults(&cfg.Capture)
+	cfg.Manager.Naming, cfg.Capture.Naming = leaseconfig.Keys, leaseconfig.Keys
+	return cfg
+}
+
+// envPrefix prefixes the environment variables overriding config keys, such as LEASED_LOGS_LEASE_ID for lease_id.
+const envPrefix = "LEASED_LOGS_"
+
+// loadConfig loads the config file at path over the defaults, a missing file is only an error when required.
+//   - every key can be overridden by a LEASED_LOGS_<KEY> environment variable, and labels by LEASED_LOGS_LABELS=k=v,k2=v2
+//   - PROJECT_ID and LEASE_ID are also accepted, below their prefixed variables, so one file can be shared by several services
+//   - precedence, highest first: prefixed environment variables, unprefixed ones, the config file, the defaults
+func loadConfig(path string, required bool) (config, error) {
+	cfg := defaultConfig()
+
+	f, err := ini.Load(path)
+	switch {
+	case os.IsNotExist(err) && !required:
+		f = ini.Empty()
+	case err != nil:
+		return cfg, fmt.Errorf("failed to load config: %w", err)
+	}
+
+	if err := applyEnv(f); err != nil {
+		return cfg, err
+	}
+
+	if err := f.StrictMapTo(&cfg); err != nil {
+		return cfg, fmt.Errorf("failed to parse config: %w", err)
+	}
+	section := func(name string) (map[string]string, bool) {
+		if !f.HasSection(name) {
+			return nil, false
+		}
+		return f.Section(name).KeysHash(), true
+	}
+	if err := leaseconfig.SetSections(&cfg.Manager, section); err != nil {
+		return cfg, fmt.Errorf("failed to parse config: %w", err)
+	}
+	if f.HasSection("severity_patterns") {
+		cfg.SeverityPatterns = severityPatterns(f.Section("severity_patterns").KeysHash())
+	}
+	cfg.applyBandwidth()
+
+	if cfg.ProjectID == "" {
+		return cfg, fmt.Errorf("project_id is required")
+	}
+	if len(cfg.LeaseIDs) == 0 {
+		return cfg, fmt.Errorf("lease_id is required")
+	}
+	return cfg, nil
+}
+
+// applyEnv overrides the keys of the config file with their environment variables.
+func applyEnv(f *ini.File) error {
+	for _, legacy := range []string{"project_id", "lease_id"} {
+		if v := os.Getenv(strings.ToUpper(legacy)); v != "" {
+			f.Section("").Key(legacy).SetValue(v)
+		}
+	}
+
+	for _, key := range iniKeys(reflect.TypeOf(config{})) {
+		if v, ok := os.LookupEnv(envPrefix + strings.ToUpper(key)); ok {
+			f.Section("").Key(key).SetValue(v)
+		}
+	}
+
+	if v := os.Getenv(envPrefix + "LABELS"); v != "" {
+		labels := f.Section("labels")
+		for _, kv := range strings.Split(v, ",") {
+			k, v, ok := strings.Cut(kv, "=")
+			if !ok {
+				return fmt.Errorf("invalid label %q in %sLABELS, must be key=value", kv, envPrefix)
+			}
+			labels.Key(strings.TrimSpace(k)).SetValue(strings.TrimSpace(v))
+		}
+	}
+	return nil
+}
+
+// iniKeys returns the keys of the default section mapped to the fields of t, including those of embedded settings.
+func iniKeys(t reflect.Type) []string {
+	var keys []string
+	for i := range t.NumField() {
+		field := t.Field(i)
+		key, _, _ := strings.Cut(field.Tag.Get("ini"), ",")
+		switch {
+		case field.Anonymous:
+			keys = append(keys, iniKeys(field.Type)...)
+		case key != "" && key != "-":
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// bandwidthQueueSize is how many entries wait for bandwidth when bandwidth_kib is set, before writes block.
+const bandwidthQueueSize = 10000
+
+// applyBandwidth maps bandwidth_kib to the settings of the Cloud Logging sink, queueing bursts behind the cap so the
+// captured command does not block on a slow uplink, unless the [sink_bandwidth] section already caps it.
+func (c *config) applyBandwidth() {
+	const sink = "cloud-logging"
+	if c.BandwidthKiB <= 0 || c.SinkBandwidth[sink] > 0 {
+		return
+	}
+	if c.SinkBandwidth == nil {
+		c.SinkBandwidth = make(map[string]int)
+	}
+	c.SinkBandwidth[sink] = c.BandwidthKiB
+	if c.SinkWorkers[sink] == 0 && c.SinkMaxInFlight[sink] == 0 {
+		if c.SinkWorkers == nil {
+			c.SinkWorkers = make(map[string]int)
+		}
+		if c.SinkMaxInFlight == nil {
+			c.SinkMaxInFlight = make(map[string]int)
+		}
+		c.SinkWorkers[sink], c.SinkMaxInFlight[sink] = 1, bandwidthQueueSize
+	}
+}
+
+// severityPatterns converts the [severity_patterns] section to SEVERITY=REGEX patterns, most severe first, so lines
+// matching several patterns are classified at the highest severity.
+func severityPatterns(section map[string]string) []string {
+	severities := make([]string, 0, len(section))
+	for severity := range section {
+		severities = append(severities, severity)
+	}
+	sort.Slice(severities, func(i, j int) bool {
+		return logging.ParseSeverity(severities[i]) > logging.ParseSeverity(severities[j])
+	})
+
+	patterns := make([]string, len(severities))
+	for i, severity := range severities {
+		patterns[i] = severity + "=" + section[severity]
+	}
+	return patterns
+}
+
+// captureOptions returns how the output of the command is captured.
+//   - SIGHUP dumps the state of the agent rather than being forwarded to the command
+func (c config) captureOptions() (capture.Options, error) {
+	opts, err := c.Capture.CaptureOptions(c.ProjectID)
+	if err != nil {
+		return opts, err
+	}
+
+	for _, sig := range capture.DefaultSignals {
+		if sig != syscall.SIGHUP {
+			opts.Signals = append(opts.Signals, sig)
+		}
+	}
+	return opts, nil
+}
@@ -0,0 +1,184 @@
+// Command leasedlogd is the standalone leased logging agent.
+//
+// It runs a single command and ships its output to Cloud Logging while the lease is active, configured from an ini file
+// instead of flags, and without the demo and lease management commands of the leased-logs CLI:
+//
+//	leasedlogd -config /etc/leasedlogd/leasedlogd.ini -- my-service --port 8080
+//
+// The upgrade command replaces the agent with the latest verified release:
+//
+//	leasedlogd upgrade -config /etc/leasedlogd/leasedlogd.ini
+//
+// On SIGHUP, the agent dumps its lease states, recent lease transitions, and sink health, and flushes its sinks.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"cloud.google.com/go/logging"
+
+	"github.com/carsonoid/talk-leased-logs/internal/capture"
+	"github.com/carsonoid/talk-leased-logs/internal/leaseconfig"
+	"github.com/carsonoid/talk-leased-logs/pkg/lease"
+)
+
+// defaultConfigPath is read when -config is not set, and may be missing.
+const defaultConfigPath = "/etc/leasedlogd/leasedlogd.ini"
+
+func main() {
+	// commands to capture always follow --, so they can not be mistaken for upgrade
+	if len(os.Args) > 1 && os.Args[1] == "upgrade" {
+		if err := runUpgrade(os.Args[2:]); err != nil {
+			fmt.Fprintln(os.Stderr, "leasedlogd:", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	configPath := flag.String("config", "", "The ini config file. Defaults to "+defaultConfigPath+" if it exists.")
+	printVersion := flag.Bool("version", false, "Print the version and exit.")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [-config FILE] -- COMMAND [ARGS...]\n       %s upgrade [-config FILE] [-check]\n", os.Args[0], os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if *printVersion {
+		fmt.Println("leasedlogd", version)
+		return
+	}
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	path, required := *configPath, true
+	if path == "" {
+		path, required = defaultConfigPath, false
+	}
+	cfg, err := loadConfig(path, required)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "leasedlogd:", err)
+		os.Exit(2)
+	}
+
+	err = run(cfg, flag.Args())
+
+	// exit like the command did, so supervisors see its status
+	capture.Exit(err)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "leasedlogd:", err)
+		var usageErr *leaseconfig.UsageError
+		if errors.As(err, &usageErr) {
+			os.Exit(2)
+		}
+		os.Exit(1)
+	}
+}
+
+// run creates the clients and lease manager, and captures the command until it exits.
+func run(cfg config, args []string) error {
+	ctx := context.Background()
+
+	if err := cfg.Manager.SetDiagnostics(); err != nil {
+		return err
+	}
+	captureOpts, err := cfg.captureOptions()
+	if err != nil {
+		return err
+	}
+	opts, err := cfg.Capture.Options()
+	if err != nil {
+		return err
+	}
+
+	initCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	logClient, err := logging.NewClient(initCtx, cfg.ProjectID, cfg.ClientOptions()...)
+	if err != nil {
+		return fmt.Errorf("failed to create logging client: %w", err)
+	}
+	defer logClient.Close()
+
+	fsClient, err := firestore.NewClientWithDatabase(initCtx, cfg.ProjectID, cfg.Database)
+	if err != nil {
+		return fmt.Errorf("failed to create firestore client: %w", err)
+	}
+	defer fsClient.Close()
+
+	if cfg.UpdateURL != "" && cfg.UpdateCheckInterval > 0 {
+		updateCtx, stop := context.WithCancel(ctx)
+		defer stop()
+		go checkForUpdates(updateCtx, cfg.UpdateURL, cfg.UpdateCheckInterval)
+	}
+
+	leases := make([]*firestore.DocumentRef, len(cfg.LeaseIDs))
+	for i, id := range cfg.LeaseIDs {
+		leases[i] = fsClient.Collection("leases").Doc(id)
+	}
+	m, err := cfg.Manager.NewManager(ctx, logClient, time.Now().Add(cfg.InitialLease), cfg.ProjectID, leases, opts...)
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+
+	if cfg.DebugAddr != "" {
+		go func() {
+			if err := m.ServeDebug(cfg.DebugAddr); err != nil {
+				fmt.Fprintln(os.Stderr, "leasedlogd: failed to serve debug endpoint:", err)
+			}
+		}()
+	}
+
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+	go dumpOnHangup(hangup, m, cfg.StateDumpFile)
+
+	return capture.Run(m, captureOpts, args)
+}
+
+// dumpOnHangup dumps the state of the manager and flushes its sinks on every SIGHUP.
+//   - the state is written to path, replacing the previous dump, or to stderr when path is empty
+func dumpOnHangup(hangup <-chan os.Signal, m *lease.Manager, path string) {
+	for range hangup {
+		if err := dumpState(m, path); err != nil {
+			fmt.Fprintln(os.Stderr, "leasedlogd: failed to dump state:", err)
+		}
+		if err := m.Flush(); err != nil {
+			fmt.Fprintln(os.Stderr, "leasedlogd: failed to flush:", err)
+		}
+	}
+}
+
+// dumpState writes the state of the manager to path, or to stderr when path is empty.
+func dumpState(m *lease.Manager, path string) error {
+	if path == "" {
+		fmt.Fprintln(os.Stderr, "=== LEASEDLOGD STATE")
+		return m.DumpState(os.Stderr)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := m.DumpState(f); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	fmt.Fprintln(os.Stderr, "=== LEASEDLOGD STATE written to", path)
+	return nil
+}
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/carsonoid/talk-leased-logs/pkg/lease"
+)
+
+// version is the version of the agent, set at build time with -ldflags "-X main.version=1.2.3".
+var version = "dev"
+
+// release is the release manifest served at update_url.
+//   - binaries are keyed by GOOS-GOARCH, such as linux-amd64
+type release struct {
+	Version  string                   `json:"version"`
+	Binaries map[string]releaseBinary `json:"binaries"`
+}
+
+// releaseBinary is a single agent binary of a release.
+//   - Signature is the base64 ed25519 signature of the release statement of the binary, see releaseStatement
+type releaseBinary struct {
+	URL       string `json:"url"`
+	SHA256    string `json:"sha256"`
+	Signature string `json:"signature"`
+}
+
+// releaseStatement is the message a release binary is signed over, binding its checksum to the version and platform
+// of the release, so a signed binary can not be served as another version, such as an older vulnerable one, or for
+// another platform: "leasedlogd <version> <GOOS-GOARCH> <hex SHA-256>".
+func releaseStatement(version, platform, sha256Hex string) []byte {
+	return []byte("leasedlogd " + version + " " + platform + " " + sha256Hex)
+}
+
+// newerVersion reports whether the release version v is newer than the running version.
+//   - versions are dot-separated numbers, optionally prefixed with v and suffixed with a -prerelease, which sorts
+//     before the release itself
+//   - development builds, whose version does not parse, accept any release
+func newerVersion(v, running string) (bool, error) {
+	rv, rpre, err := parseVersion(v)
+	if err != nil {
+		return false, err
+	}
+	cv, cpre, err := parseVersion(running)
+	if err != nil {
+		return true, nil
+	}
+
+	for i := range max(len(rv), len(cv)) {
+		var a, b int
+		if i < len(rv) {
+			a = rv[i]
+		}
+		if i < len(cv) {
+			b = cv[i]
+		}
+		if a != b {
+			return a > b, nil
+		}
+	}
+	switch {
+	case rpre == cpre:
+		return false, nil
+	case rpre == "":
+		return true, nil
+	case cpre == "":
+		return false, nil
+	default:
+		return rpre > cpre, nil
+	}
+}
+
+// parseVersion splits a version such as v1.2.3-rc1 into its numbers and prerelease.
+func parseVersion(v string) ([]int, string, error) {
+	core, pre, _ := strings.Cut(strings.TrimPrefix(v, "v"), "-")
+	var nums []int
+	for _, part := range strings.Split(core, ".") {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return nil, "", fmt.Errorf("invalid release version %q", v)
+		}
+		nums = append(nums, n)
+	}
+	return nums, pre, nil
+}
+
+// platform is the key of the binary for this platform in release manifests.
+func platform() string {
+	return runtime.GOOS + "-" + runtime.GOARCH
+}
+
+// runUpgrade runs the upgrade command.
+//   - with -check it only reports whether a newer release is available
+//   - otherwise the binary is verified, swapped, and the update_service unit restarted
+func runUpgrade(args []string) error {
+	fs := flag.NewFlagSet("upgrade", flag.ExitOnError)
+	configPath := fs.String("config", "", "The ini config file. Defaults to "+defaultConfigPath+" if it exists.")
+	check := fs.Bool("check", false, "Only check whether a new release is available.")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s upgrade [-config FILE] [-check]\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	path, required := *configPath, true
+	if path == "" {
+		path, required = defaultConfigPath, false
+	}
+	cfg, err := loadConfig(path, required)
+	if err != nil {
+		return err
+	}
+	if cfg.UpdateURL == "" {
+		return errors.New("update_url is not configured")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	rel, bin, err := checkRelease(ctx, cfg.UpdateURL)
+	if err != nil {
+		return err
+	}
+	newer, err := newerVersion(rel.Version, version)
+	if err != nil {
+		return err
+	}
+	if !newer {
+		fmt.Printf("leasedlogd %s is up to date, the latest release is %s\n", version, rel.Version)
+		return nil
+	}
+	fmt.Printf("leasedlogd %s is available, running %s\n", rel.Version, version)
+	if *check {
+		return nil
+	}
+
+	if cfg.UpdateKey == "" {
+		return errors.New("update_key is required to verify releases")
+	}
+	key, err := lease.LoadTokenVerifyKey(cfg.UpdateKey)
+	if err != nil {
+		return fmt.Errorf("invalid update_key: %w", err)
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to find the agent binary: %w", err)
+	}
+	exe, err = filepath.EvalSymlinks(exe)
+	if err != nil {
+		return fmt.Errorf("failed to find the agent binary: %w", err)
+	}
+
+	if err := installRelease(ctx, rel.Version, bin, key, exe); err != nil {
+		return err
+	}
+	fmt.Printf("Upgraded %s to %s, the previous binary is kept as %s.prev\n", exe, rel.Version, exe)
+
+	if cfg.UpdateService == "" {
+		fmt.Println("No update_service configured, restart the agent to run the new version")
+		return nil
+	}
+	out, err := exec.CommandContext(ctx, "systemctl", "restart", cfg.UpdateService).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to restart %s: %w: %s", cfg.UpdateService, err, out)
+	}
+	fmt.Printf("Restarted %s\n", cfg.UpdateService)
+	return nil
+}
+
+// checkRelease fetches the release manifest and returns the binary for this platform.
+func checkRelease(ctx context.Context, url string) (release, releaseBinary, error) {
+	var rel release
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return rel, releaseBinary{}, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return rel, releaseBinary{}, fmt.Errorf("failed to check for releases: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return rel, releaseBinary{}, fmt.Errorf("failed to check for releases: %s", resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&rel); err != nil {
+		return rel, releaseBinary{}, fmt.Errorf("failed to parse release manifest: %w", err)
+	}
+
+	bin, ok := rel.Binaries[platform()]
+	if !ok {
+		return rel, releaseBinary{}, fmt.Errorf("release %s has no binary for %s", rel.Version, platform())
+	}
+	return rel, bin, nil
+}
+
+// installRelease downloads the binary of a release version next to exe, verifies it, and atomically renames it over exe.
+//   - the checksum and the signature of the release statement are verified before anything is replaced
+//   - the previous binary is hard linked to exe.prev for rollbacks
+func installRelease(ctx context.Context, version string, bin releaseBinary, key ed25519.PublicKey, exe string) error {
+	want, err := hex.DecodeString(bin.SHA256)
+	if err != nil {
+		return fmt.Errorf("malformed release checksum: %w", err)
+	}
+	sig, err := base64.StdEncoding.DecodeString(bin.Signature)
+	if err != nil {
+		return fmt.Errorf("malformed release signature: %w", err)
+	}
+	// verified before downloading, so an unsigned version or platform is never fetched
+	if !ed25519.Verify(key, releaseStatement(version, platform(), hex.EncodeToString(want)), sig) {
+		return fmt.Errorf("invalid release signature for leasedlogd %s on %s", version, platform())
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, bin.URL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to download release: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to download release: %s", resp.Status)
+	}
+
+	// the new binary is written to the same directory, so the rename is atomic
+	tmp, err := os.CreateTemp(filepath.Dir(exe), ".leasedlogd-upgrade-*")
+	if err != nil {
+		return fmt.Errorf("failed to create upgrade file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(tmp, h), resp.Body); err != nil {
+		return fmt.Errorf("failed to download release: %w", err)
+	}
+	digest := h.Sum(nil)
+	if !bytes.Equal(digest, want) {
+		return fmt.Errorf("release checksum mismatch, got %x", digest)
+	}
+
+	if err := tmp.Chmod(0o755); err != nil {
+		return fmt.Errorf("failed to install release: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		return fmt.Errorf("failed to install release: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to install release: %w", err)
+	}
+
+	prev := exe + ".prev"
+	os.Remove(prev)
+	if err := os.Link(exe, prev); err != nil {
+		fmt.Fprintln(os.Stderr, "leasedlogd: failed to keep the previous binary:", err)
+	}
+	if err := os.Rename(tmp.Name(), exe); err != nil {
+		return fmt.Errorf("failed to install release: %w", err)
+	}
+	return nil
+}
+
+// checkForUpdates reports newer releases at update_url at the given interval, until the context is canceled.
+//   - only reports, upgrades are applied with the upgrade command
+func checkForUpdates(ctx context.Context, url string, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		checkCtx, cancel := context.WithTimeout(ctx, time.Minute)
+		rel, _, err := checkRelease(checkCtx, url)
+		cancel()
+		var newer bool
+		if err == nil {
+			newer, err = newerVersion(rel.Version, version)
+		}
+		switch {
+		case err != nil:
+			fmt.Fprintln(os.Stderr, "leasedlogd:", err)
+		case newer:
+			fmt.Fprintf(os.Stderr, "=== UPDATE AVAILABLE leasedlogd %s, running %s | run: leasedlogd upgrade\n", rel.Version, version)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
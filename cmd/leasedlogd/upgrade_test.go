@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+)
+
+// signedRelease serves binary and returns a releaseBinary of it, signed with key for version on platform.
+func signedRelease(t *testing.T, binary []byte, key ed25519.PrivateKey, version, platform string, downloads *atomic.Int64) releaseBinary {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		downloads.Add(1)
+		w.Write(binary)
+	}))
+	t.Cleanup(srv.Close)
+
+	sum := sha256.Sum256(binary)
+	checksum := hex.EncodeToString(sum[:])
+	return releaseBinary{
+		URL:       srv.URL,
+		SHA256:    checksum,
+		Signature: base64.StdEncoding.EncodeToString(ed25519.Sign(key, releaseStatement(version, platform, checksum))),
+	}
+}
+
+func TestInstallRelease(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, otherPriv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	binary := []byte("new leasedlogd")
+
+	tests := []struct {
+		name          string
+		release       func(*atomic.Int64) releaseBinary
+		wantErr       bool
+		wantDownloads int64
+	}{
+		{
+			name:          "signed",
+			release:       func(d *atomic.Int64) releaseBinary { return signedRelease(t, binary, priv, "1.2.0", platform(), d) },
+			wantDownloads: 1,
+		},
+		{
+			name: "other key",
+			release: func(d *atomic.Int64) releaseBinary {
+				return signedRelease(t, binary, otherPriv, "1.2.0", platform(), d)
+			},
+			wantErr: true,
+		},
+		{
+			name:    "signed for another version",
+			release: func(d *atomic.Int64) releaseBinary { return signedRelease(t, binary, priv, "1.0.0", platform(), d) },
+			wantErr: true,
+		},
+		{
+			name:    "signed for another platform",
+			release: func(d *atomic.Int64) releaseBinary { return signedRelease(t, binary, priv, "1.2.0", "plan9-386", d) },
+			wantErr: true,
+		},
+		{
+			name: "checksum mismatch",
+			release: func(d *atomic.Int64) releaseBinary {
+				bin := signedRelease(t, binary, priv, "1.2.0", platform(), d)
+				// a signed checksum of other contents than those served
+				other := signedRelease(t, []byte("tampered"), priv, "1.2.0", platform(), d)
+				bin.URL = other.URL
+				return bin
+			},
+			wantErr:       true,
+			wantDownloads: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exe := filepath.Join(t.TempDir(), "leasedlogd")
+			if err := os.WriteFile(exe, []byte("old leasedlogd"), 0o755); err != nil {
+				t.Fatal(err)
+			}
+
+			var downloads atomic.Int64
+			err := installRelease(context.Background(), "1.2.0", tt.release(&downloads), pub, exe)
+			if tt.wantErr != (err != nil) {
+				t.Fatalf("installRelease() error = %v, want error %v", err, tt.wantErr)
+			}
+			if got := downloads.Load(); got != tt.wantDownloads {
+				t.Errorf("downloaded %d times, want %d", got, tt.wantDownloads)
+			}
+
+			want := "new leasedlogd"
+			if tt.wantErr {
+				want = "old leasedlogd"
+			}
+			got, err := os.ReadFile(exe)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != want {
+				t.Errorf("installed %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestNewerVersion(t *testing.T) {
+	tests := []struct {
+		v, running string
+		want       bool
+	}{
+		{"1.2.0", "1.1.9", true},
+		{"v1.10.0", "v1.9.0", true},
+		{"1.2", "1.2.0", false},
+		{"1.2.0", "1.2.0-rc1", true},
+		{"1.2.0-rc1", "1.2.0", false},
+		{"1.2.0-rc2", "1.2.0-rc1", true},
+		{"1.0.0", "dev", true},
+		{"1.0.0", "1.0.1", false},
+	}
+	for _, tt := range tests {
+		got, err := newerVersion(tt.v, tt.running)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("newerVersion(%q, %q) = %v, want %v", tt.v, tt.running, got, tt.want)
+		}
+	}
+
+	if _, err := newerVersion("latest", "1.0.0"); err == nil {
+		t.Error("invalid release version was accepted")
+	}
+}
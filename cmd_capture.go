@@ -2,28 +2,76 @@ package main
 
 import (
 	"context"
-	"os/exec"
+	"errors"
+	"fmt"
+	"os"
 	"time"
 
 	"cloud.google.com/go/firestore"
 	"cloud.google.com/go/logging"
 
-	"github.com/carsonoid/talk-leased-logs/internal/lease"
+	"github.com/carsonoid/talk-leased-logs/internal/capture"
+	"github.com/carsonoid/talk-leased-logs/internal/leaseconfig"
 )
 
 type Capture struct {
 	InitalLeaseDuration time.Duration `help:"The initial lease time." default:"5s"`
-	Args                []string      `arg:"" optional:""`
+
+	leaseconfig.Capture `embed:""`
+
+	Stdin     bool     `help:"Ship what is piped to stdin instead of running a command, like a leased tee."`
+	DebugAddr string   `help:"Serve expvar, pprof, and the lease state as JSON at /debug/ on this address, for diagnosing why logs are not shipping. Listens on localhost when the host is empty." placeholder:"ADDR"`
+	Args      []string `arg:"" optional:"" passthrough:"" name:"command" help:"The command to capture and its arguments. Flags after the command are passed to it, use -- before a command starting with a dash."`
+}
+
+// Validate requires a command to capture, unless --stdin is set.
+func (cmd *Capture) Validate() error {
+	// passthrough arguments keep the -- separating them from the flags of capture
+	if len(cmd.Args) > 0 && cmd.Args[0] == "--" {
+		cmd.Args = cmd.Args[1:]
+	}
+	if !cmd.Stdin && len(cmd.Args) == 0 {
+		return errors.New("missing command to capture, such as capture -- ./server --port 8080, or --stdin to ship what is piped in")
+	}
+	if cmd.Stdin && (len(cmd.Args) > 0 || cmd.TTY || cmd.SeverityFDs) {
+		return errors.New("--stdin does not run a command, and can not be combined with one or with --tty or --severity-fds")
+	}
+	_, err := capture.ParseRestartPolicy(cmd.Restart)
+	return err
 }
 
 func (cmd *Capture) Run(logClient *logging.Client, docRef *firestore.DocumentRef) error {
 	ctx := context.Background()
 
-	leaseManager := lease.NewManager(ctx, logClient.Logger("lease-"+cli.LeaseID), time.Now().Add(cmd.InitalLeaseDuration), docRef)
+	captureOpts, err := cmd.CaptureOptions(cli.ProjectID)
+	if err != nil {
+		return err
+	}
+	opts, err := cmd.Options()
+	if err != nil {
+		return err
+	}
+
+	leaseManager, err := newManager(ctx, logClient, time.Now().Add(cmd.InitalLeaseDuration), docRef, opts...)
+	if err != nil {
+		return err
+	}
+	if cmd.DebugAddr != "" {
+		go func() {
+			if err := leaseManager.ServeDebug(cmd.DebugAddr); err != nil {
+				fmt.Fprintln(os.Stderr, "Failed to serve debug endpoint:", err)
+			}
+		}()
+	}
 
-	execCmd := exec.Command(cmd.Args[0], cmd.Args[1:]...)
-	execCmd.Stdout = leaseManager.StdoutWriter()
-	execCmd.Stderr = leaseManager.StderrWriter()
+	if cmd.Stdin {
+		err = capture.Pipe(leaseManager)
+	} else {
+		err = capture.Run(leaseManager, captureOpts, cmd.Args)
+	}
 
-	return execCmd.Run()
+	if closeErr := leaseManager.Close(); err == nil {
+		err = closeErr
+	}
+	return err
 }
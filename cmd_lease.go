@@ -1,53 +1,386 @@
 package main
 
 import (
+	"bufio"
 	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"os"
+	"strings"
 	"time"
 
 	"cloud.google.com/go/firestore"
-	"github.com/carsonoid/talk-leased-logs/internal/lease"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/carsonoid/talk-leased-logs/internal/identity"
+	"github.com/carsonoid/talk-leased-logs/pkg/lease"
 )
 
 type LeaseExtendCmd struct {
-	Duration time.Duration `help:"The duration of the lease." default:"5s"`
-	User     string        `help:"The user extending the lease."`
-	Reason   string        `help:"The reason for extending the lease." arg:""`
+	Duration    time.Duration     `help:"The duration of the lease." default:"5s"`
+	Scope       string            `help:"A free-text description of the logs requested by the lease."`
+	Tags        map[string]string `help:"Tags restricting the lease to matching instances, attached to all shipped entries."`
+	FollowUpOf  string            `help:"The ID of an earlier grant this extension follows up on, linking them together."`
+	Replay      time.Duration     `help:"Also ship the entries instances did not ship over this long before the lease, from their spool or replay buffer."`
+	Wait        time.Duration     `help:"Wait up to this long for a running instance to observe the new expiry. Disabled when zero."`
+	MinSeverity string            `help:"Only ship entries at or above this severity under the lease, everything ships when empty." enum:",DEBUG,INFO,NOTICE,WARNING,ERROR,CRITICAL,ALERT,EMERGENCY" default:""`
+	Schedules   []string          `help:"Recurring windows during which the lease is also active, as a cron spec and the duration of each window. Prefix specs with CRON_TZ=<zone> for a time zone." name:"schedule" sep:"none" placeholder:"CRON=DURATION"`
+	Force       bool              `help:"Take over the lease, replacing its settings, even if it is active and owned by another user."`
+	NewSession  bool              `help:"Start a new capture session even if the lease is still active, instead of joining the current one."`
+	Reason      string            `help:"The reason for extending the lease." arg:""`
+}
+
+func (cmd *LeaseExtendCmd) Validate() error {
+	_, err := cmd.schedules()
+	return err
 }
 
-func (cmd *LeaseExtendCmd) Run(docRef *firestore.DocumentRef) error {
+// schedules returns the parsed --schedule flags.
+//   - the duration follows the last "=", as CRON_TZ prefixes contain one too
+func (cmd *LeaseExtendCmd) schedules() ([]lease.Schedule, error) {
+	schedules := make([]lease.Schedule, 0, len(cmd.Schedules))
+	for _, v := range cmd.Schedules {
+		i := strings.LastIndex(v, "=")
+		if i < 0 {
+			return nil, fmt.Errorf("invalid schedule %q, must be CRON=DURATION", v)
+		}
+
+		d, err := time.ParseDuration(v[i+1:])
+		if err != nil {
+			return nil, fmt.Errorf("invalid duration for schedule %q: %w", v, err)
+		}
+
+		s, err := lease.ParseSchedule(strings.TrimSpace(v[:i]), d)
+		if err != nil {
+			return nil, err
+		}
+		schedules = append(schedules, s)
+	}
+	return schedules, nil
+}
+
+func (cmd *LeaseExtendCmd) Run(fsClient *firestore.Client, docRef *firestore.DocumentRef, ident identity.Identity) error {
 	ctx := context.Background()
 
-	expireAt := time.Now().UTC().Add(cmd.Duration)
+	user, err := ident.User(ctx)
+	if err != nil {
+		return fmt.Errorf("Failed to resolve identity: %w", err)
+	}
+
+	// firestore stores timestamps with microsecond precision, truncate so status comparisons are exact
+	expireAt := time.Now().UTC().Add(cmd.Duration).Truncate(time.Microsecond)
+
+	// offer to link grants when picking up an investigation after the previous grant expired
+	if cmd.FollowUpOf == "" {
+		if prev, err := getLease(ctx, docRef); err == nil && prev != nil && prev.GrantID != "" && prev.ExpireAt.Before(time.Now()) {
+			fmt.Printf("Previous grant %q expired at %s, use --follow-up-of=%s to link this grant to it\n", prev.GrantID, prev.ExpireAt, prev.GrantID)
+		}
+	}
+
+	grantID, err := newGrantID()
+	if err != nil {
+		return err
+	}
+
+	schedules, err := cmd.schedules()
+	if err != nil {
+		return err
+	}
+
+	var replaySince time.Time
+	if cmd.Replay > 0 {
+		replaySince = time.Now().UTC().Add(-cmd.Replay)
+	}
+
+	// extend in a transaction so concurrent extensions never shorten each other, and every holder stays on record
+	requestedExpireAt := expireAt
+	var doc lease.Document
+	var takenOverFrom string
+	err = updateLease(ctx, fsClient, docRef, func(prev *lease.Document) (*lease.Document, *lease.HistoryEntry, error) {
+		now := time.Now().UTC()
 
-	_, err := docRef.Set(ctx, lease.Document{
-		ExpireAt: expireAt,
-		User:     cmd.User,
-		Reason:   cmd.Reason,
+		var err error
+		doc, takenOverFrom, err = mergeExtension(prev, lease.Document{
+			ExpireAt: requestedExpireAt,
+			User:     user,
+			Reason:   cmd.Reason,
+			Scope:    cmd.Scope,
+			Tags:     cmd.Tags,
+
+			GrantID:    grantID,
+			FollowUpOf: cmd.FollowUpOf,
+
+			ReplaySince: replaySince,
+
+			Schedules:   schedules,
+			MinSeverity: cmd.MinSeverity,
+		}, now, cmd.Force)
+		if err != nil {
+			return nil, nil, err
+		}
+		expireAt = doc.ExpireAt
+
+		// hosts already capturing keep their session, so their markers stay aligned
+		sessionPrev := prev
+		if cmd.NewSession {
+			sessionPrev = nil
+		}
+		if err := doc.JoinSession(sessionPrev, now); err != nil {
+			return nil, nil, err
+		}
+
+		doc.AddHolder(lease.Holder{
+			User:     user,
+			Reason:   cmd.Reason,
+			GrantID:  grantID,
+			ExpireAt: requestedExpireAt,
+		}, now)
+
+		return &doc, &lease.HistoryEntry{
+			Action:     lease.HistoryExtend,
+			User:       user,
+			Reason:     cmd.Reason,
+			Scope:      doc.Scope,
+			Tags:       doc.Tags,
+			GrantID:    grantID,
+			FollowUpOf: cmd.FollowUpOf,
+			Duration:   cmd.Duration,
+			ExpireAt:   expireAt,
+		}, nil
 	})
 	if err != nil {
 		return fmt.Errorf("Failed to set lease: %w", err)
 	}
 
 	fmt.Printf("Updated Lease %q\n", docRef.Path)
-	fmt.Printf("  Expires: %s (in %s)\n", expireAt, cmd.Duration)
-	if cmd.User != "" {
-		fmt.Printf("  User: %q\n", cmd.User)
+	fmt.Printf("  Grant: %s\n", grantID)
+	fmt.Printf("  Session: %s (started %s)\n", doc.SessionID, doc.SessionStart.Format(time.RFC3339))
+	if takenOverFrom != "" {
+		fmt.Printf("  Taken Over From: %q\n", takenOverFrom)
 	}
+	if cmd.FollowUpOf != "" {
+		fmt.Printf("  Follow Up Of: %s\n", cmd.FollowUpOf)
+	}
+	switch {
+	case expireAt.After(requestedExpireAt):
+		fmt.Printf("  Expires: %s (kept, already later than the requested %s)\n", expireAt, cmd.Duration)
+	case expireAt.Before(requestedExpireAt):
+		fmt.Printf("  Expires: %s (the end of the approved window, use lease request for a longer one)\n", expireAt)
+	default:
+		fmt.Printf("  Expires: %s (in %s)\n", expireAt, cmd.Duration)
+	}
+	fmt.Printf("  User: %q\n", user)
 	if cmd.Reason != "" {
 		fmt.Printf("  Reason: %q\n", cmd.Reason)
 	}
+	if len(doc.Holders) > 1 {
+		fmt.Println("  Holders:")
+		for _, h := range doc.Holders {
+			fmt.Printf("    %s until %s: %q\n", h.User, h.ExpireAt.Format(time.RFC3339), h.Reason)
+		}
+	}
+	if doc.Scope != "" {
+		fmt.Printf("  Scope: %q\n", doc.Scope)
+	}
+	if len(doc.Tags) > 0 {
+		fmt.Printf("  Tags: %v\n", doc.Tags)
+	}
+	if doc.MinSeverity != "" {
+		fmt.Printf("  Min Severity: %s\n", doc.MinSeverity)
+	}
+	for _, s := range doc.Schedules {
+		fmt.Printf("  Schedule: %q for %s\n", s.Cron, s.Duration)
+	}
+	if !replaySince.IsZero() {
+		fmt.Printf("  Replay Since: %s (%s ago)\n", replaySince, cmd.Replay)
+	}
+
+	if cmd.Wait > 0 {
+		return waitForObservers(ctx, docRef, expireAt, cmd.Wait)
+	}
 
 	return nil
 }
 
+// getLease reads the lease document, returning nil if it does not exist.
+func getLease(ctx context.Context, docRef *firestore.DocumentRef) (*lease.Document, error) {
+	snapshot, err := docRef.Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get lease: %w", err)
+	}
+
+	var doc lease.Document
+	if err := snapshot.DataTo(&doc); err != nil {
+		return nil, fmt.Errorf("Failed to parse lease: %w", err)
+	}
+	return &doc, nil
+}
+
+// mergeExtension returns the lease document after ext, holding the requested expiry and settings of its User, is
+// applied to prev, and the owner the lease was taken over from.
+//   - a lease still active is kept and only pushed to the later expiry, so extensions never shorten it
+//   - another user's active lease is refused with errLeaseHeld, unless force takes it over
+//   - the owner, or a user taking the lease over, replaces the settings set in ext and keeps the others
+//   - an approved lease never runs past its approved window and keeps its schedules, as extending it needs a new approval
+//   - expired, revoked, and pending leases are replaced by ext
+func mergeExtension(prev *lease.Document, ext lease.Document, now time.Time, force bool) (doc lease.Document, takenOverFrom string, err error) {
+	if prev == nil || prev.Revoked || prev.Pending {
+		ext.Owner = ext.User
+		return ext, "", nil
+	}
+	if until, _ := prev.ActiveUntil(now); !until.After(now) {
+		ext.Owner = ext.User
+		return ext, "", nil
+	}
+
+	owner, held := prev.HeldByOther(ext.User, now)
+	if held && !force {
+		return lease.Document{}, "", leaseHeldError(owner, "take it over")
+	}
+	if held {
+		takenOverFrom = owner
+	}
+
+	doc = *prev
+	if ext.ExpireAt.After(doc.ExpireAt) {
+		doc.ExpireAt = ext.ExpireAt
+	}
+	doc.User = ext.User
+	doc.Reason = ext.Reason
+	doc.GrantID = ext.GrantID
+	doc.FollowUpOf = ext.FollowUpOf
+	if !ext.ReplaySince.IsZero() {
+		doc.ReplaySince = ext.ReplaySince
+	}
+
+	doc.Owner = ext.User
+	if ext.Scope != "" {
+		doc.Scope = ext.Scope
+	}
+	if ext.Tags != nil {
+		doc.Tags = ext.Tags
+	}
+	if ext.MinSeverity != "" {
+		doc.MinSeverity = ext.MinSeverity
+	}
+	if ext.Schedules != nil && prev.ApprovedBy == "" {
+		doc.Schedules = ext.Schedules
+	}
+	if prev.ApprovedBy != "" {
+		if approvedUntil := prev.ApprovedAt.Add(prev.RequestedDuration); doc.ExpireAt.After(approvedUntil) {
+			doc.ExpireAt = approvedUntil
+		}
+	}
+	return doc, takenOverFrom, nil
+}
+
+// errLeaseHeld is returned when changing a lease that is active and owned by another user without --force.
+var errLeaseHeld = errors.New("lease is active and owned by")
+
+// leaseHeldError returns an errLeaseHeld conflict naming the owner, and how to act on the lease anyway.
+func leaseHeldError(owner, action string) error {
+	return withExitCode(exitConflict, fmt.Errorf("%w %q, use --force to %s", errLeaseHeld, owner, action))
+}
+
+// confirm asks the user a yes or no question on the terminal.
+//   - returns false without asking when stdin is not a terminal, so scripts must opt in with flags instead
+func confirm(question string) bool {
+	fi, err := os.Stdin.Stat()
+	if err != nil || fi.Mode()&os.ModeCharDevice == 0 {
+		return false
+	}
+
+	fmt.Fprintf(os.Stderr, "%s [y/N] ", question)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+// newGrantID returns a random ID for a lease grant.
+func newGrantID() (string, error) {
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("Failed to generate grant ID: %w", err)
+	}
+	return "g-" + hex.EncodeToString(b), nil
+}
+
+// waitForObservers blocks until at least one instance reports observing a lease expiry at or after expireAt.
+//   - prints every instance that has picked up the expiry once the first one does
+func waitForObservers(ctx context.Context, docRef *firestore.DocumentRef, expireAt time.Time, timeout time.Duration) error {
+	fmt.Printf("Waiting up to %s for an instance to observe the lease\n", timeout)
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	iter := lease.StatusCollection(docRef).Where("ObservedExpireAt", ">=", expireAt).Snapshots(ctx)
+	defer iter.Stop()
+	for {
+		snapshot, err := iter.Next()
+		switch {
+		case errors.Is(err, context.DeadlineExceeded), status.Code(err) == codes.DeadlineExceeded:
+			return withExitCode(exitTimeout, fmt.Errorf("No instance observed the lease within %s", timeout))
+		case err != nil:
+			return fmt.Errorf("Failed to watch lease status: %w", err)
+		}
+
+		docs, err := snapshot.Documents.GetAll()
+		if err != nil {
+			return fmt.Errorf("Failed to read lease status: %w", err)
+		}
+		if len(docs) == 0 {
+			continue
+		}
+
+		fmt.Println("Lease observed by:")
+		for _, doc := range docs {
+			var st lease.Status
+			if err := doc.DataTo(&st); err != nil {
+				return fmt.Errorf("Failed to parse lease status: %w", err)
+			}
+			fmt.Printf("  %s (host=%s pid=%d) at %s\n", st.Instance, st.Host, st.PID, st.UpdatedAt)
+		}
+		return nil
+	}
+}
+
 type LeaseExpire struct {
+	Force  bool   `help:"Expire the lease without confirmation even if it is active and owned by another user."`
+	Reason string `help:"The reason for expiring the lease." arg:"" optional:""`
 }
 
-func (cmd *LeaseExpire) Run(docRef *firestore.DocumentRef) error {
+func (cmd *LeaseExpire) Run(fsClient *firestore.Client, docRef *firestore.DocumentRef, ident identity.Identity) error {
 	ctx := context.Background()
 
-	_, err := docRef.Delete(ctx)
+	user, err := ident.User(ctx)
+	if err != nil {
+		return fmt.Errorf("Failed to resolve identity: %w", err)
+	}
+
+	var grantID string
+	if prev, err := getLease(ctx, docRef); err == nil && prev != nil {
+		grantID = prev.GrantID
+
+		if owner, held := prev.HeldByOther(user, time.Now()); held && !cmd.Force {
+			fmt.Fprintf(os.Stderr, "Warning: the lease is active and owned by %q, expiring it stops their investigation\n", owner)
+			if !confirm("Expire it anyway?") {
+				return leaseHeldError(owner, "expire it")
+			}
+		}
+	}
+
+	err = writeLease(ctx, fsClient, docRef, nil, &lease.HistoryEntry{
+		Action:  lease.HistoryExpire,
+		User:    user,
+		Reason:  cmd.Reason,
+		GrantID: grantID,
+	})
 	if err != nil {
 		return fmt.Errorf("Failed to delete lease: %w", err)
 	}
@@ -58,6 +391,17 @@ func (cmd *LeaseExpire) Run(docRef *firestore.DocumentRef) error {
 }
 
 type LeaseCmd struct {
-	Extend LeaseExtendCmd `cmd:"extend" help:"Extend a lease for a time."`
-	Expire LeaseExpire    `cmd:"expire" help:"Expire a lease immediately."`
+	Extend  LeaseExtendCmd  `cmd:"extend" help:"Extend a lease for a time."`
+	Expire  LeaseExpire     `cmd:"expire" help:"Expire a lease immediately."`
+	Revoke  LeaseRevokeCmd  `cmd:"revoke" help:"Revoke a lease, stopping shipping immediately even during guaranteed windows."`
+	Watch   LeaseWatchCmd   `cmd:"watch" help:"Follow a lease and print every transition."`
+	List    LeaseListCmd    `cmd:"list" help:"List all leases."`
+	Renew   LeaseRenewCmd   `cmd:"renew" help:"Keep renewing a lease until interrupted."`
+	History LeaseHistoryCmd `cmd:"history" help:"List who changed a lease, when, and why."`
+	Request LeaseRequestCmd `cmd:"request" help:"Request a lease that only becomes active once approved by a second user."`
+	Approve LeaseApproveCmd `cmd:"approve" help:"Approve a requested lease."`
+
+	Query       LeaseQueryCmd       `cmd:"query" help:"Print a Cloud Logging, Loki, or Elasticsearch query for the entries shipped under the lease."`
+	Token       LeaseTokenCmd       `cmd:"token" help:"Issue a signed token pre-authorizing the lease for instances that can not reach Firestore."`
+	VerifyChain LeaseVerifyChainCmd `cmd:"verify-chain" help:"Verify the hash chains of a file sink against the heads recorded in the lease status."`
 }
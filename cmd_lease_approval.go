@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/carsonoid/talk-leased-logs/internal/identity"
+	"github.com/carsonoid/talk-leased-logs/pkg/lease"
+)
+
+// approversCollection holds one document per user allowed to approve lease requests, keyed by their identity.
+const approversCollection = "lease-approvers"
+
+type LeaseRequestCmd struct {
+	Duration    time.Duration     `help:"The duration of the lease once approved." default:"5m"`
+	Scope       string            `help:"A free-text description of the logs requested by the lease."`
+	Tags        map[string]string `help:"Tags restricting the lease to matching instances, attached to all shipped entries."`
+	MinSeverity string            `help:"Only ship entries at or above this severity under the lease, everything ships when empty." enum:",DEBUG,INFO,NOTICE,WARNING,ERROR,CRITICAL,ALERT,EMERGENCY" default:""`
+	Force       bool              `help:"Replace the lease even if it is active and owned by another user."`
+	Reason      string            `help:"The reason for requesting the lease." arg:""`
+}
+
+// Run writes a pending lease, which stays inactive until a second user approves it with lease approve.
+//   - the requester must use a verified identity, so the approver can not be the requester under another name
+//   - a lease active and owned by another user is only replaced with --force, as the pending lease deactivates it
+func (cmd *LeaseRequestCmd) Run(fsClient *firestore.Client, docRef *firestore.DocumentRef, ident identity.Identity) error {
+	ctx := context.Background()
+
+	if !identity.Verified(ident) {
+		return withExitCode(exitAuth, errors.New("requesting leases requires a verified identity, use --identity=oidc"))
+	}
+
+	user, err := ident.User(ctx)
+	if err != nil {
+		return fmt.Errorf("Failed to resolve identity: %w", err)
+	}
+
+	grantID, err := newGrantID()
+	if err != nil {
+		return err
+	}
+
+	err = updateLease(ctx, fsClient, docRef, func(prev *lease.Document) (*lease.Document, *lease.HistoryEntry, error) {
+		if prev != nil {
+			if owner, held := prev.HeldByOther(user, time.Now()); held && !cmd.Force {
+				return nil, nil, leaseHeldError(owner, "replace it")
+			}
+		}
+
+		return &lease.Document{
+			User:        user,
+			Reason:      cmd.Reason,
+			Scope:       cmd.Scope,
+			Tags:        cmd.Tags,
+			GrantID:     grantID,
+			MinSeverity: cmd.MinSeverity,
+			Owner:       user,
+
+			Pending:           true,
+			RequestedDuration: cmd.Duration,
+			RequestedBy:       user,
+		}, &lease.HistoryEntry{
+			Action:   lease.HistoryRequest,
+			User:     user,
+			Reason:   cmd.Reason,
+			Scope:    cmd.Scope,
+			Tags:     cmd.Tags,
+			GrantID:  grantID,
+			Duration: cmd.Duration,
+		}, nil
+	})
+	if err != nil {
+		return fmt.Errorf("Failed to request lease: %w", err)
+	}
+
+	fmt.Printf("Requested Lease %q, waiting for approval\n", docRef.Path)
+	fmt.Printf("  Grant: %s\n", grantID)
+	fmt.Printf("  Duration: %s\n", cmd.Duration)
+	fmt.Printf("  User: %q\n", user)
+	fmt.Printf("  Reason: %q\n", cmd.Reason)
+	fmt.Printf("Approve it with: lease approve -l %s\n", docRef.ID)
+
+	return nil
+}
+
+type LeaseApproveCmd struct{}
+
+// Run approves a pending lease, activating it for its requested duration from now.
+//   - the approver must be listed in the approvers collection and must not be the requester, see approveLease
+//   - the approver must use a verified identity, as an asserted one could approve their own request under another name
+func (cmd *LeaseApproveCmd) Run(fsClient *firestore.Client, docRef *firestore.DocumentRef, ident identity.Identity) error {
+	ctx := context.Background()
+
+	if !identity.Verified(ident) {
+		return withExitCode(exitAuth, errors.New("approving leases requires a verified identity, use --identity=oidc"))
+	}
+
+	user, err := ident.User(ctx)
+	if err != nil {
+		return fmt.Errorf("Failed to resolve identity: %w", err)
+	}
+
+	_, err = fsClient.Collection(approversCollection).Doc(user).Get(ctx)
+	switch {
+	case status.Code(err) == codes.NotFound:
+		return withExitCode(exitAuth, fmt.Errorf("%q is not allowed to approve leases", user))
+	case err != nil:
+		return fmt.Errorf("Failed to check approval rights: %w", err)
+	}
+
+	var approved lease.Document
+	err = updateLease(ctx, fsClient, docRef, func(prev *lease.Document) (*lease.Document, *lease.HistoryEntry, error) {
+		doc, err := approveLease(prev, user, time.Now())
+		if err != nil {
+			return nil, nil, err
+		}
+		approved = *doc
+
+		return &approved, &lease.HistoryEntry{
+			Action:     lease.HistoryApprove,
+			User:       user,
+			Reason:     approved.Reason,
+			Scope:      approved.Scope,
+			Tags:       approved.Tags,
+			GrantID:    approved.GrantID,
+			FollowUpOf: approved.FollowUpOf,
+			Duration:   approved.RequestedDuration,
+			ExpireAt:   approved.ExpireAt,
+		}, nil
+	})
+	if err != nil {
+		return fmt.Errorf("Failed to approve lease: %w", err)
+	}
+
+	fmt.Printf("Approved Lease %q\n", docRef.Path)
+	fmt.Printf("  Grant: %s\n", approved.GrantID)
+	fmt.Printf("  Session: %s (started %s)\n", approved.SessionID, approved.SessionStart.Format(time.RFC3339))
+	fmt.Printf("  Expires: %s (in %s)\n", approved.ExpireAt, approved.RequestedDuration)
+	fmt.Printf("  Requested By: %q\n", approved.User)
+	fmt.Printf("  Approved By: %q\n", user)
+
+	return nil
+}
+
+// approveLease returns prev approved by user, active for its requested duration from now.
+//   - only pending leases requested with a verified identity can be approved, and never by their requester
+//   - the requester keeps ownership of the approved lease
+func approveLease(prev *lease.Document, user string, now time.Time) (*lease.Document, error) {
+	if prev == nil {
+		return nil, withExitCode(exitNotFound, errors.New("lease does not exist"))
+	}
+	approved := *prev
+
+	if !approved.Pending {
+		return nil, withExitCode(exitConflict, errors.New("lease is not awaiting approval"))
+	}
+	if approved.RequestedBy == "" {
+		return nil, withExitCode(exitAuth, errors.New("lease was not requested with a verified identity, request it again"))
+	}
+	if approved.RequestedBy == user {
+		return nil, withExitCode(exitAuth, errors.New("leases must be approved by someone other than the requester"))
+	}
+
+	now = now.UTC().Truncate(time.Microsecond)
+	approved.Pending = false
+	approved.ApprovedBy = user
+	approved.ApprovedAt = now
+	approved.ExpireAt = now.Add(approved.RequestedDuration)
+	approved.Owner = approved.RequestedBy
+	if err := approved.JoinSession(nil, now); err != nil {
+		return nil, err
+	}
+	return &approved, nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/carsonoid/talk-leased-logs/pkg/lease"
+)
+
+func TestApproveLease(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	pending := lease.Document{
+		User:              "alice",
+		Pending:           true,
+		RequestedDuration: 30 * time.Minute,
+		RequestedBy:       "alice@example.com",
+	}
+
+	tests := []struct {
+		name string
+		prev *lease.Document
+		user string
+		code int
+	}{
+		{name: "missing", prev: nil, user: "bob@example.com", code: exitNotFound},
+		{name: "not pending", prev: &lease.Document{User: "alice", RequestedBy: "alice@example.com"}, user: "bob@example.com", code: exitConflict},
+		{name: "requester", prev: &pending, user: "alice@example.com", code: exitAuth},
+		{
+			// the user is asserted, only the verified requester counts
+			name: "asserted user",
+			prev: &lease.Document{User: "mallory", Pending: true, RequestedBy: "bob@example.com"},
+			user: "bob@example.com",
+			code: exitAuth,
+		},
+		{name: "unverified request", prev: &lease.Document{User: "alice", Pending: true}, user: "bob@example.com", code: exitAuth},
+		{name: "other user", prev: &pending, user: "bob@example.com"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := approveLease(tt.prev, tt.user, now)
+			if tt.code != 0 {
+				if err == nil || exitCode(err) != tt.code {
+					t.Fatalf("approveLease() error = %v (exit code %d), want exit code %d", err, exitCode(err), tt.code)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got.Pending || got.ApprovedBy != tt.user || !got.ApprovedAt.Equal(now) {
+				t.Errorf("approveLease() = %+v, want approved by %q at %s", got, tt.user, now)
+			}
+			if want := now.Add(30 * time.Minute); !got.ExpireAt.Equal(want) {
+				t.Errorf("ExpireAt = %s, want %s", got.ExpireAt, want)
+			}
+			if got.Owner != "alice@example.com" {
+				t.Errorf("Owner = %q, want the requester", got.Owner)
+			}
+			if got.SessionID == "" {
+				t.Error("approved lease has no session")
+			}
+			if tt.prev.ApprovedBy != "" {
+				t.Error("approveLease() modified the previous document")
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"cloud.google.com/go/pubsub"
+
+	"github.com/carsonoid/talk-leased-logs/contrib/leasepubsub"
+	"github.com/carsonoid/talk-leased-logs/pkg/lease"
+)
+
+// leaseEvent is the message published to --events-topic for every recorded lease change.
+type leaseEvent struct {
+	LeaseID    string            `json:"leaseId"`
+	Action     string            `json:"action"`
+	User       string            `json:"user,omitempty"`
+	Reason     string            `json:"reason,omitempty"`
+	Scope      string            `json:"scope,omitempty"`
+	Tags       map[string]string `json:"tags,omitempty"`
+	GrantID    string            `json:"grantId,omitempty"`
+	FollowUpOf string            `json:"followUpOf,omitempty"`
+	Duration   string            `json:"duration,omitempty"`
+	ExpireAt   *time.Time        `json:"expireAt,omitempty"`
+	At         time.Time         `json:"at"`
+}
+
+// publishLeaseEvent publishes a committed history entry to --events-topic, if set.
+//   - the action and lease ID are also set as attributes, for subscription filters
+//   - lease transitions, such as leases running out, are published by the manager of shipping commands instead, see
+//     leasepubsub.Notifier
+//   - failures are only reported, the lease change itself already succeeded
+func publishLeaseEvent(ctx context.Context, docRef *firestore.DocumentRef, entry lease.HistoryEntry) {
+	if cli.EventsTopic == "" {
+		return
+	}
+
+	event := leaseEvent{
+		LeaseID:    docRef.ID,
+		Action:     entry.Action,
+		User:       entry.User,
+		Reason:     entry.Reason,
+		Scope:      entry.Scope,
+		Tags:       entry.Tags,
+		GrantID:    entry.GrantID,
+		FollowUpOf: entry.FollowUpOf,
+		At:         entry.At,
+	}
+	if entry.Duration > 0 {
+		event.Duration = entry.Duration.String()
+	}
+	if !entry.ExpireAt.IsZero() {
+		event.ExpireAt = &entry.ExpireAt
+	}
+
+	if err := publish(ctx, cli.EventsTopic, event); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to publish lease event to %q: %v\n", cli.EventsTopic, err)
+	}
+}
+
+// publish sends an event to a topic, either a topic ID in --project-id or a full projects/PROJECT/topics/TOPIC name.
+func publish(ctx context.Context, topicName string, event leaseEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode event: %w", err)
+	}
+
+	projectID, topicID, err := leasepubsub.ParseTopic(cli.ProjectID, topicName)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	client, err := pubsub.NewClient(ctx, projectID)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	topic := client.Topic(topicID)
+	defer topic.Stop()
+
+	_, err = topic.Publish(ctx, &pubsub.Message{
+		Data: data,
+		Attributes: map[string]string{
+			"action":   event.Action,
+			"lease_id": event.LeaseID,
+		},
+	}).Get(ctx)
+	return err
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/carsonoid/talk-leased-logs/pkg/lease"
+)
+
+type LeaseHistoryCmd struct {
+	Limit int  `help:"The maximum number of entries to print, newest first. Unlimited when zero." default:"20"`
+	JSON  bool `help:"Print history entries as JSON." name:"json"`
+}
+
+func (cmd *LeaseHistoryCmd) Run(docRef *firestore.DocumentRef) error {
+	ctx := context.Background()
+
+	q := lease.HistoryCollection(docRef).OrderBy("At", firestore.Desc)
+	if cmd.Limit > 0 {
+		q = q.Limit(cmd.Limit)
+	}
+
+	docs, err := q.Documents(ctx).GetAll()
+	if err != nil {
+		return fmt.Errorf("Failed to get lease history: %w", err)
+	}
+
+	entries := make([]lease.HistoryEntry, 0, len(docs))
+	for _, doc := range docs {
+		var entry lease.HistoryEntry
+		if err := doc.DataTo(&entry); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to parse history entry %q: %v\n", doc.Ref.ID, err)
+			continue
+		}
+		entries = append(entries, entry)
+	}
+
+	if cmd.JSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(entries)
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "AT\tACTION\tUSER\tDURATION\tGRANT\tREASON")
+	for _, entry := range entries {
+		duration := "-"
+		if entry.Duration > 0 {
+			duration = entry.Duration.String()
+		}
+		grant := "-"
+		if entry.GrantID != "" {
+			grant = entry.GrantID
+		}
+		if entry.FollowUpOf != "" {
+			grant += " (follows " + entry.FollowUpOf + ")"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", entry.At.Format(time.RFC3339), entry.Action, entry.User, duration, grant, entry.Reason)
+	}
+	return tw.Flush()
+}
+
+// writeLease sets, or deletes when doc is nil, the lease document and records entry in its history in one transaction.
+//   - a nil entry changes the lease without recording history
+func writeLease(ctx context.Context, fsClient *firestore.Client, docRef *firestore.DocumentRef, doc *lease.Document, entry *lease.HistoryEntry) error {
+	return updateLease(ctx, fsClient, docRef, func(*lease.Document) (*lease.Document, *lease.HistoryEntry, error) {
+		return doc, entry, nil
+	})
+}
+
+// updateLease is writeLease for changes that depend on the current lease.
+//   - update is called with the current lease, or nil if there is none, and returns the lease and history entry to write
+//   - update may be called again if the transaction is retried, so it must not have side effects
+//   - once committed, the history entry is also published to --events-topic and posted to --slack-webhook
+func updateLease(ctx context.Context, fsClient *firestore.Client, docRef *firestore.DocumentRef, update func(prev *lease.Document) (*lease.Document, *lease.HistoryEntry, error)) error {
+	var committed *lease.HistoryEntry
+	err := fsClient.RunTransaction(ctx, func(_ context.Context, tx *firestore.Transaction) error {
+		var prev *lease.Document
+		snapshot, err := tx.Get(docRef)
+		switch {
+		case status.Code(err) == codes.NotFound:
+		case err != nil:
+			return err
+		default:
+			prev = &lease.Document{}
+			if err := snapshot.DataTo(prev); err != nil {
+				return err
+			}
+		}
+
+		doc, entry, err := update(prev)
+		if err != nil {
+			return err
+		}
+
+		if doc == nil {
+			err = tx.Delete(docRef)
+		} else {
+			err = tx.Set(docRef, *doc)
+		}
+		if err != nil {
+			return err
+		}
+
+		committed = entry
+		if entry == nil {
+			return nil
+		}
+		entry.At = time.Now().UTC()
+		return tx.Create(lease.HistoryCollection(docRef).NewDoc(), *entry)
+	})
+	if err != nil {
+		return err
+	}
+
+	if committed != nil {
+		publishLeaseEvent(ctx, docRef, *committed)
+		postLeaseToSlack(ctx, docRef, *committed)
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"cloud.google.com/go/firestore"
+
+	"github.com/carsonoid/talk-leased-logs/pkg/lease"
+)
+
+type LeaseListCmd struct {
+	ActiveOnly bool `help:"Only list leases that have not expired."`
+	JSON       bool `help:"Print leases as JSON." name:"json"`
+}
+
+// leaseListItem is a lease as printed by lease list.
+type leaseListItem struct {
+	ID        string            `json:"id"`
+	Active    bool              `json:"active"`
+	Revoked   bool              `json:"revoked,omitempty"`
+	Pending   bool              `json:"pending,omitempty"`
+	ExpireAt  time.Time         `json:"expireAt"`
+	Remaining string            `json:"remaining,omitempty"`
+	User      string            `json:"user,omitempty"`
+	Reason    string            `json:"reason,omitempty"`
+	Scope     string            `json:"scope,omitempty"`
+	Tags      map[string]string `json:"tags,omitempty"`
+	GrantID   string            `json:"grantId,omitempty"`
+	SessionID string            `json:"sessionId,omitempty"`
+	Holders   []lease.Holder    `json:"holders,omitempty"`
+}
+
+func (cmd *LeaseListCmd) Run(fsClient *firestore.Client) error {
+	ctx := context.Background()
+
+	docs, err := fsClient.Collection(leasesCollection).Documents(ctx).GetAll()
+	if err != nil {
+		return fmt.Errorf("Failed to list leases: %w", err)
+	}
+
+	now := time.Now()
+	items := make([]leaseListItem, 0, len(docs))
+	for _, doc := range docs {
+		var l lease.Document
+		if err := doc.DataTo(&l); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to parse lease %q: %v\n", doc.Ref.ID, err)
+			continue
+		}
+
+		// scheduled windows keep a lease active past its expiry
+		activeUntil, _ := l.ActiveUntil(now)
+
+		item := leaseListItem{
+			ID:        doc.Ref.ID,
+			Active:    !l.Revoked && !l.Pending && activeUntil.After(now),
+			Revoked:   l.Revoked,
+			Pending:   l.Pending,
+			ExpireAt:  l.ExpireAt,
+			User:      l.User,
+			Reason:    l.Reason,
+			Scope:     l.Scope,
+			Tags:      l.Tags,
+			GrantID:   l.GrantID,
+			SessionID: l.SessionID,
+			Holders:   l.Holders,
+		}
+		if item.Active {
+			item.Remaining = activeUntil.Sub(now).Round(time.Second).String()
+		}
+		if cmd.ActiveOnly && !item.Active {
+			continue
+		}
+		items = append(items, item)
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].ID < items[j].ID
+	})
+
+	if cmd.JSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(items)
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tSTATE\tUSER\tREASON\tREMAINING")
+	for _, item := range items {
+		state := "expired"
+		remaining := "-"
+		if item.Revoked {
+			state = "revoked"
+		}
+		if item.Pending {
+			state = "pending"
+		}
+		if item.Active {
+			state = "active"
+			remaining = item.Remaining
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", item.ID, state, item.User, item.Reason, remaining)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"cloud.google.com/go/logging"
+
+	"github.com/carsonoid/talk-leased-logs/pkg/leasequery"
+)
+
+type LeaseQueryCmd struct {
+	Since       time.Duration `help:"Select entries shipped within this long before now." default:"1h"`
+	Until       time.Duration `help:"Select entries shipped until this long before now, up to now when zero."`
+	Grant       string        `help:"Only select entries shipped under this grant."`
+	Session     string        `help:"Only select entries shipped in this capture session."`
+	MinSeverity string        `help:"Only select entries at or above this severity." enum:",DEBUG,INFO,NOTICE,WARNING,ERROR,CRITICAL,ALERT,EMERGENCY" default:""`
+	Format      string        `help:"The query language to print." enum:"cloud-logging,logql,elasticsearch" default:"cloud-logging"`
+}
+
+// Run prints a query selecting the entries shipped under the lease, for Cloud Logging, Loki, or Elasticsearch.
+func (cmd *LeaseQueryCmd) Run(docRef *firestore.DocumentRef) error {
+	now := time.Now()
+	q := leasequery.Query{
+		LeaseID:   docRef.ID,
+		Start:     now.Add(-cmd.Since),
+		GrantID:   cmd.Grant,
+		SessionID: cmd.Session,
+	}
+	if cmd.Until > 0 {
+		q.End = now.Add(-cmd.Until)
+	}
+	if cmd.MinSeverity != "" {
+		q.MinSeverity = logging.ParseSeverity(cmd.MinSeverity)
+	}
+
+	switch cmd.Format {
+	case "logql":
+		fmt.Println(q.LogQL())
+	case "elasticsearch":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(q.Elasticsearch())
+	default:
+		fmt.Println(q.CloudLoggingFilter())
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"cloud.google.com/go/firestore"
+
+	"github.com/carsonoid/talk-leased-logs/internal/identity"
+	"github.com/carsonoid/talk-leased-logs/pkg/lease"
+)
+
+type LeaseRenewCmd struct {
+	Every    time.Duration     `help:"How often to renew the lease." default:"1m"`
+	Duration time.Duration     `help:"How long the lease lasts after each renewal." default:"5m"`
+	Scope    string            `help:"A free-text description of the logs requested by the lease."`
+	Tags     map[string]string `help:"Tags restricting the lease to matching instances, attached to all shipped entries."`
+	Force    bool              `help:"Take over the lease, replacing its settings, even if it is active and owned by another user."`
+	Reason   string            `help:"The reason for renewing the lease." arg:""`
+}
+
+func (cmd *LeaseRenewCmd) Validate() error {
+	if cmd.Every >= cmd.Duration {
+		return errors.New("--every must be shorter than --duration, or the lease expires between renewals")
+	}
+	return nil
+}
+
+func (cmd *LeaseRenewCmd) Run(fsClient *firestore.Client, docRef *firestore.DocumentRef, ident identity.Identity) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	user, err := ident.User(ctx)
+	if err != nil {
+		return fmt.Errorf("Failed to resolve identity: %w", err)
+	}
+
+	// every renewal belongs to the same grant
+	grantID, err := newGrantID()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Renewing lease %q every %s for %s, press Ctrl+C to stop\n", docRef.Path, cmd.Every, cmd.Duration)
+	fmt.Printf("  Grant: %s\n", grantID)
+	fmt.Printf("  User: %q\n", user)
+
+	t := time.NewTicker(cmd.Every)
+	defer t.Stop()
+
+	var expireAt time.Time
+	for {
+		next := time.Now().UTC().Add(cmd.Duration).Truncate(time.Microsecond)
+
+		// only the first renewal is recorded, later ones continue the same grant
+		var entry *lease.HistoryEntry
+		if expireAt.IsZero() {
+			entry = &lease.HistoryEntry{
+				Action:   lease.HistoryRenew,
+				User:     user,
+				Reason:   cmd.Reason,
+				Scope:    cmd.Scope,
+				Tags:     cmd.Tags,
+				GrantID:  grantID,
+				Duration: cmd.Duration,
+				ExpireAt: next,
+			}
+		}
+
+		// only the first renewal may take the lease over, renewing stops once someone else owns it
+		force := cmd.Force && expireAt.IsZero()
+		var doc lease.Document
+		err := updateLease(ctx, fsClient, docRef, func(prev *lease.Document) (*lease.Document, *lease.HistoryEntry, error) {
+			now := time.Now().UTC()
+			var err error
+			doc, _, err = mergeExtension(prev, lease.Document{
+				ExpireAt: next,
+				User:     user,
+				Reason:   cmd.Reason,
+				Scope:    cmd.Scope,
+				Tags:     cmd.Tags,
+				GrantID:  grantID,
+			}, now, force)
+			if err != nil {
+				return nil, nil, err
+			}
+			if err := doc.JoinSession(prev, now); err != nil {
+				return nil, nil, err
+			}
+			doc.AddHolder(lease.Holder{
+				User:     user,
+				Reason:   cmd.Reason,
+				GrantID:  grantID,
+				ExpireAt: next,
+			}, now)
+			if entry != nil {
+				entry.ExpireAt = doc.ExpireAt
+			}
+			return &doc, entry, nil
+		})
+		switch {
+		case ctx.Err() != nil:
+			// interrupted mid-renewal, fall through to the final report
+		case errors.Is(err, errLeaseHeld):
+			return fmt.Errorf("Failed to renew lease: %w", err)
+		case err != nil:
+			// keep trying until the lease actually lapses, a single failed renewal is not fatal
+			fmt.Fprintf(os.Stderr, "%s Failed to renew lease: %v\n", time.Now().UTC().Format(time.RFC3339), err)
+		default:
+			expireAt = doc.ExpireAt
+			fmt.Printf("%s RENEWED expires=%s\n", time.Now().UTC().Format(time.RFC3339), expireAt.Format(time.RFC3339))
+		}
+
+		select {
+		case <-ctx.Done():
+			if !expireAt.IsZero() {
+				fmt.Printf("Stopped renewing, the lease expires at %s\n", expireAt.Format(time.RFC3339))
+			}
+			return nil
+		case <-t.C:
+		}
+	}
+}
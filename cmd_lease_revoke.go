@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/carsonoid/talk-leased-logs/internal/identity"
+	"github.com/carsonoid/talk-leased-logs/pkg/lease"
+)
+
+type LeaseRevokeCmd struct {
+	Wait   time.Duration `help:"Wait up to this long for every instance that was shipping to acknowledge it stopped. Disabled when zero."`
+	Reason string        `help:"The reason for revoking the lease." arg:"" optional:""`
+}
+
+// Run replaces the lease with a revoked tombstone, which stops shipping immediately on every instance.
+//   - unlike lease expire, the tombstone keeps the revocation visible, and also overrides guaranteed shipping windows
+func (cmd *LeaseRevokeCmd) Run(fsClient *firestore.Client, docRef *firestore.DocumentRef, ident identity.Identity) error {
+	ctx := context.Background()
+
+	user, err := ident.User(ctx)
+	if err != nil {
+		return fmt.Errorf("Failed to resolve identity: %w", err)
+	}
+
+	var grantID string
+	if prev, err := getLease(ctx, docRef); err == nil && prev != nil {
+		grantID = prev.GrantID
+	}
+
+	// find the instances that must acknowledge before the revocation is written, so none are missed
+	var shipping []string
+	if cmd.Wait > 0 {
+		shipping, err = shippingInstances(ctx, docRef)
+		if err != nil {
+			return err
+		}
+	}
+
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	err = writeLease(ctx, fsClient, docRef, &lease.Document{
+		ExpireAt:  now,
+		User:      user,
+		Reason:    cmd.Reason,
+		GrantID:   grantID,
+		Revoked:   true,
+		RevokedAt: now,
+	}, &lease.HistoryEntry{
+		Action:   lease.HistoryRevoke,
+		User:     user,
+		Reason:   cmd.Reason,
+		GrantID:  grantID,
+		ExpireAt: now,
+	})
+	if err != nil {
+		return fmt.Errorf("Failed to revoke lease: %w", err)
+	}
+
+	fmt.Printf("Lease at %q revoked\n", docRef.Path)
+	fmt.Printf("  User: %q\n", user)
+	if cmd.Reason != "" {
+		fmt.Printf("  Reason: %q\n", cmd.Reason)
+	}
+
+	if cmd.Wait > 0 {
+		return waitForRevocation(ctx, docRef, shipping, now, cmd.Wait)
+	}
+
+	return nil
+}
+
+// shippingInstances returns the instances whose last reported status was shipping under the lease.
+func shippingInstances(ctx context.Context, docRef *firestore.DocumentRef) ([]string, error) {
+	docs, err := lease.StatusCollection(docRef).Where("Active", "==", true).Documents(ctx).GetAll()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read lease status: %w", err)
+	}
+
+	instances := make([]string, 0, len(docs))
+	for _, doc := range docs {
+		instances = append(instances, doc.Ref.ID)
+	}
+	return instances, nil
+}
+
+// waitForRevocation blocks until every given instance reports it observed the revocation and stopped shipping.
+//   - instances that never acknowledge, for example because they crashed, are listed when the timeout passes
+func waitForRevocation(ctx context.Context, docRef *firestore.DocumentRef, instances []string, revokedAt time.Time, timeout time.Duration) error {
+	if len(instances) == 0 {
+		fmt.Println("No instances were shipping under the lease")
+		return nil
+	}
+
+	fmt.Printf("Waiting up to %s for %d instance(s) to stop shipping\n", timeout, len(instances))
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	pending := make(map[string]bool, len(instances))
+	for _, id := range instances {
+		pending[id] = true
+	}
+
+	iter := lease.StatusCollection(docRef).Snapshots(ctx)
+	defer iter.Stop()
+	for {
+		snapshot, err := iter.Next()
+		switch {
+		case errors.Is(err, context.DeadlineExceeded), status.Code(err) == codes.DeadlineExceeded:
+			var missing []string
+			for id := range pending {
+				missing = append(missing, id)
+			}
+			slices.Sort(missing)
+			return withExitCode(exitTimeout, fmt.Errorf("Instances did not acknowledge the revocation within %s: %s", timeout, strings.Join(missing, ", ")))
+		case err != nil:
+			return fmt.Errorf("Failed to watch lease status: %w", err)
+		}
+
+		docs, err := snapshot.Documents.GetAll()
+		if err != nil {
+			return fmt.Errorf("Failed to read lease status: %w", err)
+		}
+
+		for _, doc := range docs {
+			if !pending[doc.Ref.ID] {
+				continue
+			}
+
+			var st lease.Status
+			if err := doc.DataTo(&st); err != nil {
+				return fmt.Errorf("Failed to parse lease status: %w", err)
+			}
+
+			// the revocation reports its own time as the observed expiry
+			if st.Active || st.ObservedExpireAt.Before(revokedAt) {
+				continue
+			}
+
+			delete(pending, doc.Ref.ID)
+			fmt.Printf("  %s (host=%s pid=%d) stopped at %s\n", st.Instance, st.Host, st.PID, st.UpdatedAt)
+		}
+
+		if len(pending) == 0 {
+			fmt.Println("Every instance stopped shipping")
+			return nil
+		}
+	}
+}
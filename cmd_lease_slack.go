@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"cloud.google.com/go/firestore"
+
+	"github.com/carsonoid/talk-leased-logs/pkg/lease"
+)
+
+// postLeaseToSlack posts a committed history entry to --slack-webhook, if set.
+//   - failures are only reported, the lease change itself already succeeded
+//   - lease transitions, such as leases running out, are posted by the manager of shipping commands instead, see
+//     lease.SlackNotifier
+func postLeaseToSlack(ctx context.Context, docRef *firestore.DocumentRef, entry lease.HistoryEntry) {
+	if cli.SlackWebhook == "" {
+		return
+	}
+
+	if err := lease.NewSlackNotifier(cli.SlackWebhook).Post(ctx, slackMessage(docRef.ID, entry)); err != nil {
+		fmt.Fprintln(os.Stderr, "Warning: failed to post to Slack:", err)
+	}
+}
+
+// slackMessage describes a lease change for humans, such as
+// "Verbose logging enabled for `checkout` by alice for 30m0s: investigating 500s".
+//   - every field taken from the lease or its users is escaped, see lease.SlackEscape
+func slackMessage(leaseID string, entry lease.HistoryEntry) string {
+	target := lease.SlackTarget(leaseID, entry.Tags)
+	user := lease.SlackEscape(entry.User)
+
+	var msg string
+	switch entry.Action {
+	case lease.HistoryExtend:
+		msg = fmt.Sprintf("Verbose logging enabled for %s by %s for %s", target, user, entry.Duration)
+	case lease.HistoryRenew:
+		msg = fmt.Sprintf("Verbose logging enabled for %s by %s for %s at a time, renewed until stopped", target, user, entry.Duration)
+	case lease.HistoryExpire:
+		msg = fmt.Sprintf("Verbose logging for %s expired early by %s", target, user)
+	case lease.HistoryRevoke:
+		msg = fmt.Sprintf(":rotating_light: Verbose logging for %s revoked by %s", target, user)
+	case lease.HistoryRequest:
+		msg = fmt.Sprintf("%s requested verbose logging for %s for %s, approve with `lease approve -l %s`", user, target, entry.Duration, lease.SlackEscape(leaseID))
+	case lease.HistoryApprove:
+		msg = fmt.Sprintf("Verbose logging enabled for %s, approved by %s for %s", target, user, entry.Duration)
+	default:
+		msg = fmt.Sprintf("Lease %s changed (%s) by %s", target, lease.SlackEscape(entry.Action), user)
+	}
+
+	if entry.Reason != "" {
+		msg += ": " + lease.SlackEscape(entry.Reason)
+	}
+	return msg
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/carsonoid/talk-leased-logs/pkg/lease"
+)
+
+func TestMergeExtension(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	active := lease.Document{
+		ExpireAt: now.Add(time.Hour),
+		User:     "alice",
+		Reason:   "checkout errors",
+		Scope:    "checkout",
+		GrantID:  "g1",
+		Owner:    "alice",
+	}
+	approved := active
+	approved.ApprovedBy = "carol"
+	approved.ApprovedAt = now.Add(-30 * time.Minute)
+	approved.RequestedDuration = 90 * time.Minute
+
+	tests := []struct {
+		name  string
+		prev  *lease.Document
+		ext   lease.Document
+		force bool
+
+		want          lease.Document
+		takenOverFrom string
+		held          bool
+	}{
+		{
+			name: "new lease",
+			ext:  lease.Document{ExpireAt: now.Add(time.Minute), User: "bob", GrantID: "g2"},
+			want: lease.Document{ExpireAt: now.Add(time.Minute), User: "bob", GrantID: "g2", Owner: "bob"},
+		},
+		{
+			name: "expired lease is replaced",
+			prev: &lease.Document{ExpireAt: now.Add(-time.Minute), User: "alice", Scope: "checkout", Owner: "alice"},
+			ext:  lease.Document{ExpireAt: now.Add(time.Minute), User: "bob", GrantID: "g2"},
+			want: lease.Document{ExpireAt: now.Add(time.Minute), User: "bob", GrantID: "g2", Owner: "bob"},
+		},
+		{
+			name: "owner never shortens",
+			prev: &active,
+			ext:  lease.Document{ExpireAt: now.Add(time.Minute), User: "alice", Reason: "still looking", GrantID: "g2"},
+			want: lease.Document{ExpireAt: now.Add(time.Hour), User: "alice", Reason: "still looking", Scope: "checkout", GrantID: "g2", Owner: "alice"},
+		},
+		{
+			name: "owner replaces the settings it sets",
+			prev: &active,
+			ext:  lease.Document{ExpireAt: now.Add(2 * time.Hour), User: "alice", Scope: "payments", GrantID: "g2"},
+			want: lease.Document{ExpireAt: now.Add(2 * time.Hour), User: "alice", Scope: "payments", GrantID: "g2", Owner: "alice"},
+		},
+		{
+			name: "held by another user",
+			prev: &active,
+			ext:  lease.Document{ExpireAt: now.Add(2 * time.Hour), User: "bob", GrantID: "g2"},
+			held: true,
+		},
+		{
+			name:          "taken over with force",
+			prev:          &active,
+			ext:           lease.Document{ExpireAt: now.Add(2 * time.Hour), User: "bob", Reason: "mine now", GrantID: "g2"},
+			force:         true,
+			want:          lease.Document{ExpireAt: now.Add(2 * time.Hour), User: "bob", Reason: "mine now", Scope: "checkout", GrantID: "g2", Owner: "bob"},
+			takenOverFrom: "alice",
+		},
+		{
+			name: "approved lease is capped at its approved window",
+			prev: &approved,
+			ext:  lease.Document{ExpireAt: now.Add(24 * time.Hour), User: "alice", GrantID: "g2"},
+			want: lease.Document{ExpireAt: now.Add(time.Hour), User: "alice", Scope: "checkout", GrantID: "g2", Owner: "alice"},
+		},
+		{
+			name:          "approved lease taken over is capped too",
+			prev:          &approved,
+			ext:           lease.Document{ExpireAt: now.Add(24 * time.Hour), User: "bob", GrantID: "g2"},
+			force:         true,
+			want:          lease.Document{ExpireAt: now.Add(time.Hour), User: "bob", Scope: "checkout", GrantID: "g2", Owner: "bob"},
+			takenOverFrom: "alice",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, takenOverFrom, err := mergeExtension(tt.prev, tt.ext, now, tt.force)
+			if tt.held {
+				if !errors.Is(err, errLeaseHeld) {
+					t.Fatalf("mergeExtension() error = %v, want %v", err, errLeaseHeld)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !got.ExpireAt.Equal(tt.want.ExpireAt) {
+				t.Errorf("ExpireAt = %s, want %s", got.ExpireAt, tt.want.ExpireAt)
+			}
+			if got.User != tt.want.User || got.Owner != tt.want.Owner || got.Reason != tt.want.Reason {
+				t.Errorf("User, Owner, Reason = %q, %q, %q, want %q, %q, %q", got.User, got.Owner, got.Reason, tt.want.User, tt.want.Owner, tt.want.Reason)
+			}
+			if got.Scope != tt.want.Scope || got.GrantID != tt.want.GrantID {
+				t.Errorf("Scope, GrantID = %q, %q, want %q, %q", got.Scope, got.GrantID, tt.want.Scope, tt.want.GrantID)
+			}
+			if takenOverFrom != tt.takenOverFrom {
+				t.Errorf("takenOverFrom = %q, want %q", takenOverFrom, tt.takenOverFrom)
+			}
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"cloud.google.com/go/firestore"
+
+	"github.com/carsonoid/talk-leased-logs/internal/identity"
+	"github.com/carsonoid/talk-leased-logs/pkg/lease"
+)
+
+type LeaseTokenCmd struct {
+	Key      string            `help:"The ed25519 private key PEM file to sign the token with." type:"existingfile" required:""`
+	Duration time.Duration     `help:"How long the token pre-authorizes shipping." default:"1h"`
+	Delay    time.Duration     `help:"Start the validity window this long from now, for tokens handed out ahead of a maintenance window."`
+	Tags     map[string]string `help:"Tags restricting the token to matching instances."`
+	Reason   string            `help:"The reason for issuing the token." arg:""`
+}
+
+// Run prints a signed token pre-authorizing the lease, for instances that can not reach Firestore.
+//   - the token is not recorded anywhere, hand it to instances out-of-band with --lease-token or --lease-token-file
+func (cmd *LeaseTokenCmd) Run(docRef *firestore.DocumentRef, ident identity.Identity) error {
+	ctx := context.Background()
+
+	user, err := ident.User(ctx)
+	if err != nil {
+		return fmt.Errorf("Failed to resolve identity: %w", err)
+	}
+
+	key, err := lease.LoadTokenSigningKey(cmd.Key)
+	if err != nil {
+		return err
+	}
+
+	grantID, err := newGrantID()
+	if err != nil {
+		return err
+	}
+
+	notBefore := time.Now().UTC().Add(cmd.Delay).Truncate(time.Second)
+	t := lease.Token{
+		ID:        grantID,
+		LeaseID:   docRef.ID,
+		User:      user,
+		Reason:    cmd.Reason,
+		Tags:      cmd.Tags,
+		NotBefore: notBefore,
+		ExpireAt:  notBefore.Add(cmd.Duration),
+	}
+	token, err := lease.SignToken(t, key)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "Issued Token for Lease %q\n", docRef.Path)
+	fmt.Fprintf(os.Stderr, "  Grant: %s\n", grantID)
+	fmt.Fprintf(os.Stderr, "  Valid: %s to %s\n", t.NotBefore.Format(time.RFC3339), t.ExpireAt.Format(time.RFC3339))
+	fmt.Fprintf(os.Stderr, "  User: %q\n", user)
+	if len(cmd.Tags) > 0 {
+		fmt.Fprintf(os.Stderr, "  Tags: %v\n", cmd.Tags)
+	}
+	// only the token goes to stdout, so it can be redirected to a file
+	fmt.Println(token)
+
+	return nil
+}
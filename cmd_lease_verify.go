@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"cloud.google.com/go/firestore"
+
+	"github.com/carsonoid/talk-leased-logs/pkg/lease"
+)
+
+type LeaseVerifyChainCmd struct {
+	File string `help:"A file written by --file-sink from instances running with --hash-chain." arg:"" type:"existingfile"`
+}
+
+// Run verifies the hash chains in a file sink, and compares their heads to the heads recorded in the lease status.
+//   - a chain shorter than its recorded head was truncated, one with a different hash at the same length was altered
+func (cmd *LeaseVerifyChainCmd) Run(docRef *firestore.DocumentRef) error {
+	ctx := context.Background()
+
+	f, err := os.Open(cmd.File)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	heads, err := lease.VerifyChainFile(f)
+	if err != nil {
+		return withExitCode(exitConflict, fmt.Errorf("Hash chain broken: %w", err))
+	}
+	if len(heads) == 0 {
+		return fmt.Errorf("No chained entries in %q", cmd.File)
+	}
+
+	docs, err := lease.StatusCollection(docRef).Documents(ctx).GetAll()
+	if err != nil {
+		return fmt.Errorf("Failed to read lease status: %w", err)
+	}
+	recorded := make(map[string]lease.Status)
+	for _, doc := range docs {
+		var st lease.Status
+		if err := doc.DataTo(&st); err != nil {
+			return fmt.Errorf("Failed to parse lease status: %w", err)
+		}
+		if st.Chain != nil {
+			recorded[st.Chain.Session] = st
+		}
+	}
+
+	var mismatched bool
+	for _, head := range heads {
+		st, ok := recorded[head.Session]
+		switch {
+		case !ok:
+			fmt.Printf("%s: %d entries intact, no recorded head, the instance has started a newer session since\n", head.Session, head.Seq)
+		case st.Chain.Seq == head.Seq && st.Chain.Hash == head.Hash:
+			fmt.Printf("%s: %d entries intact, matching the head recorded by %s at %s\n", head.Session, head.Seq, st.Instance, st.UpdatedAt)
+		case st.Chain.Seq > head.Seq:
+			// the head is recorded periodically, so it may also trail the file, but never lead it
+			mismatched = true
+			fmt.Printf("%s: %d entries intact, but %s recorded %d, entries were removed from the end\n", head.Session, head.Seq, st.Instance, st.Chain.Seq)
+		case st.Chain.Seq == head.Seq:
+			mismatched = true
+			fmt.Printf("%s: %d entries, but their head differs from the one recorded by %s\n", head.Session, head.Seq, st.Instance)
+		default:
+			fmt.Printf("%s: %d entries intact, %d of them covered by the head recorded by %s\n", head.Session, head.Seq, st.Chain.Seq, st.Instance)
+		}
+	}
+
+	if mismatched {
+		return withExitCode(exitConflict, fmt.Errorf("Hash chain does not match the recorded head"))
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/carsonoid/talk-leased-logs/pkg/lease"
+)
+
+type LeaseWatchCmd struct{}
+
+// leaseSnapshot is a lease document as observed by lease watch, nil when the document does not exist.
+type leaseSnapshot struct {
+	doc *lease.Document
+	err error
+}
+
+func (cmd *LeaseWatchCmd) Run(docRef *firestore.DocumentRef) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	snapshots := make(chan leaseSnapshot)
+	go watchLeaseDocument(ctx, docRef, snapshots)
+
+	fmt.Printf("Watching lease %q, press Ctrl+C to stop\n", docRef.Path)
+
+	var (
+		current     *lease.Document
+		initialized bool
+		expired     bool
+	)
+	expireTimer := time.NewTimer(0)
+	<-expireTimer.C
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+
+		case <-expireTimer.C:
+			expired = true
+			printTransition("EXPIRED", current)
+
+		case snap := <-snapshots:
+			if snap.err != nil {
+				return snap.err
+			}
+
+			next := snap.doc
+			switch {
+			case !initialized && next == nil:
+				printTransition("ABSENT", nil)
+			case !initialized:
+				printTransition("CURRENT", next)
+			case current != nil && next == nil:
+				printTransition("DELETED", current)
+			case next != nil && next.Revoked:
+				printTransition("REVOKED", next)
+			case next != nil && next.Pending:
+				printTransition("REQUESTED", next)
+			case current != nil && current.Pending && next.ApprovedBy != "":
+				printTransition("APPROVED", next)
+			case current == nil:
+				printTransition("CREATED", next)
+			case next.ExpireAt.After(current.ExpireAt):
+				printTransition("EXTENDED", next)
+			case next.ExpireAt.Before(current.ExpireAt):
+				printTransition("SHORTENED", next)
+			default:
+				printTransition("UPDATED", next)
+			}
+			initialized = true
+
+			// reset the expiry timer to the new expiry
+			if !expireTimer.Stop() {
+				select {
+				case <-expireTimer.C:
+				default:
+				}
+			}
+			current = next
+			if current == nil || current.Revoked || current.Pending {
+				continue
+			}
+
+			until := time.Until(current.ExpireAt)
+			switch {
+			case until > 0:
+				expired = false
+				expireTimer.Reset(until)
+			case !expired:
+				expired = true
+				printTransition("EXPIRED", current)
+			}
+		}
+	}
+}
+
+// watchLeaseDocument sends every snapshot of the lease document until the context is canceled.
+func watchLeaseDocument(ctx context.Context, docRef *firestore.DocumentRef, snapshots chan<- leaseSnapshot) {
+	iter := docRef.Snapshots(ctx)
+	defer iter.Stop()
+
+	for {
+		snapshot, err := iter.Next()
+		switch {
+		case errors.Is(err, context.Canceled), status.Code(err) == codes.Canceled:
+			return
+		case err != nil:
+			sendSnapshot(ctx, snapshots, leaseSnapshot{err: fmt.Errorf("Failed to watch lease: %w", err)})
+			return
+		}
+
+		if !snapshot.Exists() {
+			sendSnapshot(ctx, snapshots, leaseSnapshot{})
+			continue
+		}
+
+		var doc lease.Document
+		if err := snapshot.DataTo(&doc); err != nil {
+			sendSnapshot(ctx, snapshots, leaseSnapshot{err: fmt.Errorf("Failed to parse lease: %w", err)})
+			return
+		}
+		sendSnapshot(ctx, snapshots, leaseSnapshot{doc: &doc})
+	}
+}
+
+// sendSnapshot sends a snapshot unless the context is canceled first.
+func sendSnapshot(ctx context.Context, snapshots chan<- leaseSnapshot, snap leaseSnapshot) {
+	select {
+	case snapshots <- snap:
+	case <-ctx.Done():
+	}
+}
+
+// printTransition prints a lease transition with the current time and the lease details.
+func printTransition(transition string, doc *lease.Document) {
+	now := time.Now().UTC()
+	if doc == nil {
+		fmt.Printf("%s %-9s\n", now.Format(time.RFC3339), transition)
+		return
+	}
+
+	remaining := "expired"
+	if until := doc.ExpireAt.Sub(now); until > 0 {
+		remaining = "in " + until.Round(time.Second).String()
+	}
+	fmt.Printf("%s %-9s expires=%s (%s) user=%q reason=%q grant=%q\n",
+		now.Format(time.RFC3339), transition, doc.ExpireAt.Format(time.RFC3339), remaining, doc.User, doc.Reason, doc.GrantID)
+}
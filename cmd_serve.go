@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"cloud.google.com/go/logging"
+)
+
+// serveShutdownTimeout bounds how long serve waits for requests in flight once it is asked to stop.
+const serveShutdownTimeout = 10 * time.Second
+
+type Serve struct {
+	InitalLeaseDuration time.Duration `help:"The initial lease Duration." default:"5s"`
+	Listen              string        `help:"Serve the control API on this address. Listens on localhost when the host is empty." default:":7070"`
+	DebugAddr           string        `help:"Serve expvar, pprof, and the lease state as JSON at /debug/ on this address, for diagnosing why logs are not shipping. Listens on localhost when the host is empty." placeholder:"ADDR"`
+}
+
+// Run watches the lease once and serves the control API until SIGINT or SIGTERM, so processes on the host can query
+// the lease and ship entries without each opening their own Firestore snapshot stream.
+func (cmd *Serve) Run(logClient *logging.Client, docRef *firestore.DocumentRef) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	leaseManager, err := newManager(ctx, logClient, time.Now().Add(cmd.InitalLeaseDuration), docRef)
+	if err != nil {
+		return err
+	}
+	if cmd.DebugAddr != "" {
+		go func() {
+			if err := leaseManager.ServeDebug(cmd.DebugAddr); err != nil {
+				fmt.Fprintln(os.Stderr, "Failed to serve debug endpoint:", err)
+			}
+		}()
+	}
+
+	// the API is not authenticated, so it is only exposed beyond localhost when asked for explicitly
+	addr := cmd.Listen
+	if host, port, err := net.SplitHostPort(addr); err == nil && host == "" {
+		addr = net.JoinHostPort("localhost", port)
+	}
+	srv := &http.Server{Addr: addr, Handler: leaseManager.ControlHandler()}
+
+	served := make(chan error, 1)
+	go func() {
+		served <- srv.ListenAndServe()
+	}()
+	fmt.Fprintf(os.Stderr, "Serving the control API on %s, press Ctrl+C to stop\n", addr)
+
+	select {
+	case err = <-served:
+		err = fmt.Errorf("failed to serve control API: %w", err)
+	case <-ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), serveShutdownTimeout)
+		defer cancel()
+		if err = srv.Shutdown(shutdownCtx); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			err = fmt.Errorf("failed to stop control API: %w", err)
+		} else {
+			err = nil
+		}
+	}
+
+	return errors.Join(err, leaseManager.Close())
+}
@@ -3,11 +3,13 @@ package main
 import (
 	"context"
 	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"cloud.google.com/go/firestore"
 	"cloud.google.com/go/logging"
-	"github.com/carsonoid/talk-leased-logs/internal/lease"
 )
 
 type SlogDemo struct {
@@ -17,9 +19,14 @@ type SlogDemo struct {
 }
 
 func (cmd *SlogDemo) Run(logClient *logging.Client, docRef *firestore.DocumentRef) error {
-	ctx := context.Background()
+	// stop the demo early on SIGINT or SIGTERM, still flushing what was logged
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	leaseManager := lease.NewManager(ctx, logClient.Logger("lease-"+cli.LeaseID), time.Now().Add(cmd.InitalLeaseDuration), docRef)
+	leaseManager, err := newManager(ctx, logClient, time.Now().Add(cmd.InitalLeaseDuration), docRef)
+	if err != nil {
+		return err
+	}
 
 	slog.SetDefault(leaseManager.SlogLogger())
 
@@ -28,7 +35,7 @@ func (cmd *SlogDemo) Run(logClient *logging.Client, docRef *firestore.DocumentRe
 
 	generateLogs(ctx, cmd.DemoLogInterval)
 
-	return nil
+	return leaseManager.Close()
 }
 
 func generateLogs(ctx context.Context, dur time.Duration) {
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"cloud.google.com/go/logging"
+	"github.com/rs/zerolog"
+
+	"github.com/carsonoid/talk-leased-logs/contrib/leasezerolog"
+)
+
+type ZerologDemo struct {
+	InitalLeaseDuration time.Duration `help:"The initial lease Duration." default:"5s"`
+	DemoLogInterval     time.Duration `help:"The interval between logs." default:"1s"`
+	DemoDuration        time.Duration `help:"The duration of the demo." default:"1m"`
+}
+
+func (cmd *ZerologDemo) Run(logClient *logging.Client, docRef *firestore.DocumentRef) error {
+	// stop the demo early on SIGINT or SIGTERM, still flushing what was logged
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	leaseManager, err := newManager(ctx, logClient, time.Now().Add(cmd.InitalLeaseDuration), docRef)
+	if err != nil {
+		return err
+	}
+
+	logger := zerolog.New(leasezerolog.Writer(leaseManager)).With().Timestamp().Logger()
+
+	ctx, cancel := context.WithTimeout(ctx, cmd.DemoDuration)
+	defer cancel()
+
+	t := time.NewTicker(cmd.DemoLogInterval)
+	defer t.Stop()
+
+	for {
+		logger.Info().Str("string", "value").Msg("This is an info log.")
+		logger.Warn().Int("int", 42).Msg("This is a warning log.")
+		logger.Error().Err(errors.New("something broke")).Msg("This is an error log.")
+
+		select {
+		case <-ctx.Done():
+			return leaseManager.Close()
+		case <-t.C:
+		}
+	}
+}
@@ -0,0 +1,61 @@
+// Package leasecompress provides the compressors of lease.WithCompressedReplayBuffer, kept out of package lease so the
+// library does not depend on compression libraries.
+package leasecompress
+
+import (
+	"fmt"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/pierrec/lz4/v4"
+
+	"github.com/carsonoid/talk-leased-logs/pkg/lease"
+)
+
+// Snappy compresses blocks with snappy, favoring speed.
+type Snappy struct{}
+
+// Compress compresses src with snappy.
+func (Snappy) Compress(src []byte) []byte {
+	return snappy.Encode(nil, src)
+}
+
+// Decompress decompresses a snappy block.
+func (Snappy) Decompress(src []byte, rawLen int) ([]byte, error) {
+	return snappy.Decode(make([]byte, rawLen), src)
+}
+
+// LZ4 compresses blocks with lz4, favoring decompression speed.
+type LZ4 struct{}
+
+// Compress compresses src with lz4.
+func (LZ4) Compress(src []byte) []byte {
+	var c lz4.Compressor
+	dst := make([]byte, lz4.CompressBlockBound(len(src)))
+	n, err := c.CompressBlock(src, dst)
+	if err != nil || n == 0 {
+		return nil
+	}
+	return dst[:n]
+}
+
+// Decompress decompresses an lz4 block.
+func (LZ4) Decompress(src []byte, rawLen int) ([]byte, error) {
+	dst := make([]byte, rawLen)
+	n, err := lz4.UncompressBlock(src, dst)
+	if err != nil {
+		return nil, err
+	}
+	return dst[:n], nil
+}
+
+// Parse converts "snappy" or "lz4" to a lease.Compressor.
+func Parse(s string) (lease.Compressor, error) {
+	switch s {
+	case "snappy":
+		return Snappy{}, nil
+	case "lz4":
+		return LZ4{}, nil
+	default:
+		return nil, fmt.Errorf("unknown compression %q, must be snappy or lz4", s)
+	}
+}
@@ -0,0 +1,93 @@
+// Package leaseenrich adds geographic and device fields to entries, kept out of package lease so the library does not
+// depend on GeoIP databases and user agent parsing.
+package leaseenrich
+
+import (
+	"fmt"
+	"net"
+
+	"cloud.google.com/go/logging"
+	"github.com/mssola/useragent"
+	"github.com/oschwald/geoip2-golang"
+
+	"github.com/carsonoid/talk-leased-logs/pkg/lease"
+)
+
+// GeoIP is a lease.Processor that adds a structured "geo" field for the IP address in a configured field.
+type GeoIP struct {
+	db    *geoip2.Reader
+	field string
+}
+
+// NewGeoIP opens a MaxMind GeoIP2 or GeoLite2 City database for enriching the IP addresses in field.
+func NewGeoIP(dbPath, field string) (*GeoIP, error) {
+	db, err := geoip2.Open(dbPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open geoip database: %w", err)
+	}
+	return &GeoIP{db: db, field: field}, nil
+}
+
+// Process adds the country, city, and location of the IP address to the entry.
+//   - entries without the field, or with addresses not in the database, are left untouched
+func (g *GeoIP) Process(e *logging.Entry) bool {
+	v, ok := lease.FieldValue(e, g.field)
+	if !ok {
+		return true
+	}
+
+	ip := net.ParseIP(v)
+	if ip == nil {
+		return true
+	}
+
+	city, err := g.db.City(ip)
+	if err != nil || city.Country.IsoCode == "" {
+		return true
+	}
+
+	geo := map[string]any{
+		"country": city.Country.IsoCode,
+	}
+	if name := city.City.Names["en"]; name != "" {
+		geo["city"] = name
+	}
+	if len(city.Subdivisions) > 0 && city.Subdivisions[0].IsoCode != "" {
+		geo["region"] = city.Subdivisions[0].IsoCode
+	}
+	if city.Location.Latitude != 0 || city.Location.Longitude != 0 {
+		geo["latitude"] = city.Location.Latitude
+		geo["longitude"] = city.Location.Longitude
+	}
+	lease.SetStructuredField(e, "geo", geo)
+
+	return true
+}
+
+// Close closes the database.
+func (g *GeoIP) Close() error {
+	return g.db.Close()
+}
+
+// UserAgent returns a lease.Processor that adds a structured "device" field for the user agent in a configured field.
+func UserAgent(field string) lease.Processor {
+	return lease.ProcessorFunc(func(e *logging.Entry) bool {
+		v, ok := lease.FieldValue(e, field)
+		if !ok || v == "" {
+			return true
+		}
+
+		ua := useragent.New(v)
+		browser, version := ua.Browser()
+		lease.SetStructuredField(e, "device", map[string]any{
+			"browser":        browser,
+			"browserVersion": version,
+			"os":             ua.OS(),
+			"platform":       ua.Platform(),
+			"mobile":         ua.Mobile(),
+			"bot":            ua.Bot(),
+		})
+
+		return true
+	})
+}
@@ -0,0 +1,78 @@
+// Package leaselogrus ships logrus entries through a lease manager, kept out of package lease so the library does not
+// depend on logrus.
+package leaselogrus
+
+import (
+	"fmt"
+
+	"cloud.google.com/go/logging"
+	"github.com/sirupsen/logrus"
+
+	"github.com/carsonoid/talk-leased-logs/pkg/lease"
+)
+
+// hook is a logrus.Hook that ships entries through the manager, leaving local output to the logrus logger.
+type hook struct {
+	m *lease.Manager
+}
+
+// Hook returns a logrus.Hook that ships entries like the slog handler returned by Manager.SlogLogger.
+//   - entries are still written locally by the logrus logger itself
+//   - entries are shipped when the lease ships their severity, during the startup window, or at ERROR level and above
+//   - fields become labels, errors by their message
+//   - fatal and panic entries flush the sinks, as logrus exits or panics right after the hooks run
+func Hook(m *lease.Manager) logrus.Hook {
+	return &hook{m: m}
+}
+
+// Levels returns every level, so the hook sees every entry.
+func (h *hook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire ships an entry when the lease allows it.
+func (h *hook) Fire(e *logrus.Entry) error {
+	labels := make(map[string]string, len(e.Data))
+	for k, v := range e.Data {
+		if err, ok := v.(error); ok {
+			labels[k] = err.Error()
+			continue
+		}
+		labels[k] = fmt.Sprint(v)
+	}
+
+	severity := getSeverity(e.Level)
+	h.m.Log(logging.Entry{
+		Timestamp: e.Time,
+		Severity:  severity,
+		Payload:   e.Message,
+		Labels:    labels,
+	}, h.m.Ships(severity))
+
+	if e.Level <= logrus.FatalLevel {
+		if err := h.m.Flush(); err != nil {
+			lease.Diagnostics().Error("failed to flush sinks", "error", err)
+		}
+	}
+	return nil
+}
+
+// getSeverity converts a logrus.Level to a logging.Severity.
+func getSeverity(l logrus.Level) logging.Severity {
+	switch l {
+	case logrus.TraceLevel, logrus.DebugLevel:
+		return logging.Debug
+	case logrus.InfoLevel:
+		return logging.Info
+	case logrus.WarnLevel:
+		return logging.Warning
+	case logrus.ErrorLevel:
+		return logging.Error
+	case logrus.FatalLevel:
+		return logging.Critical
+	case logrus.PanicLevel:
+		return logging.Alert
+	default:
+		return logging.Default
+	}
+}
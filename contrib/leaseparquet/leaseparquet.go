@@ -0,0 +1,192 @@
+// Package leaseparquet writes leased entries as Parquet files, kept out of package lease so the library does not
+// depend on Parquet.
+package leaseparquet
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"cloud.google.com/go/logging"
+	"github.com/parquet-go/parquet-go"
+
+	"github.com/carsonoid/talk-leased-logs/pkg/lease"
+)
+
+// row is the stable schema of the files written by Sink.
+//   - payload holds string payloads as is, and structured payloads as JSON with payload_json set
+type row struct {
+	Timestamp   time.Time         `parquet:"timestamp,timestamp(microsecond)"`
+	Severity    string            `parquet:"severity"`
+	LogName     string            `parquet:"log_name"`
+	Labels      map[string]string `parquet:"labels"`
+	Payload     string            `parquet:"payload"`
+	PayloadJSON bool              `parquet:"payload_json"`
+	Trace       string            `parquet:"trace,optional"`
+	SpanID      string            `parquet:"span_id,optional"`
+}
+
+// maxRows is the number of rows buffered, across hours and uploads in flight, before entries are dropped.
+const maxRows = 100_000
+
+// errBufferFull is returned by Sink.Log for the entries dropped while maxRows rows are buffered.
+var errBufferFull = errors.New("parquet buffer is full")
+
+// Sink is a lease.Sink that accumulates entries and writes them to a lease.ObjectStore as one Parquet file per hour.
+//   - files are partitioned as dt=YYYY-MM-DD/hour=HH/, by the UTC hour of the timestamp of each entry, for external
+//     tables
+//   - hours are written in the background once they have passed, Log never waits for the store
+//   - Flush writes every hour early, so an hour may be split over several files
+//   - while the store is unavailable rows are kept for the next attempt, up to maxRows, after which entries are dropped,
+//     returned as errors and counted by Dropped
+type Sink struct {
+	store lease.ObjectStore
+
+	mu    sync.Mutex
+	hours map[time.Time][]row
+	// rows counts the rows of hours and of uploads in flight
+	rows int
+
+	// uploadMu serializes uploads, so Flush also waits for the one in flight
+	uploadMu sync.Mutex
+
+	dropped atomic.Int64
+}
+
+// NewSink creates a Sink writing to store, which writes each hour once it has passed until ctx is done.
+func NewSink(ctx context.Context, store lease.ObjectStore) *Sink {
+	s := &Sink{store: store, hours: make(map[time.Time][]row)}
+	go s.run(ctx)
+	return s
+}
+
+// Log adds the entry to the file of its hour.
+func (s *Sink) Log(e logging.Entry) error {
+	r := row{
+		Timestamp: e.Timestamp,
+		Severity:  strings.ToUpper(e.Severity.String()),
+		LogName:   e.LogName,
+		Labels:    e.Labels,
+		Trace:     e.Trace,
+		SpanID:    e.SpanID,
+	}
+	if r.Timestamp.IsZero() {
+		r.Timestamp = time.Now()
+	}
+	switch p := e.Payload.(type) {
+	case string:
+		r.Payload = p
+	case nil:
+	default:
+		b, err := json.Marshal(p)
+		if err != nil {
+			return &lease.RejectedError{Reason: fmt.Sprintf("payload can not be encoded: %v", err)}
+		}
+		r.Payload, r.PayloadJSON = string(b), true
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.rows >= maxRows {
+		s.dropped.Add(1)
+		return errBufferFull
+	}
+	hour := r.Timestamp.UTC().Truncate(time.Hour)
+	s.hours[hour] = append(s.hours[hour], r)
+	s.rows++
+	return nil
+}
+
+// Flush writes the entries of every hour, waiting for the upload in flight.
+func (s *Sink) Flush() error {
+	s.uploadMu.Lock()
+	defer s.uploadMu.Unlock()
+	return s.upload(s.take(time.Time{}))
+}
+
+// Dropped returns the number of entries dropped because maxRows rows were buffered.
+func (s *Sink) Dropped() int64 {
+	return s.dropped.Load()
+}
+
+// run writes the hours that have passed, even if no more entries arrive.
+func (s *Sink) run(ctx context.Context) {
+	t := time.NewTicker(time.Minute)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-t.C:
+			s.uploadMu.Lock()
+			if err := s.upload(s.take(now.UTC().Truncate(time.Hour))); err != nil {
+				lease.Diagnostics().Error("failed to write parquet file", "error", err)
+			}
+			s.uploadMu.Unlock()
+		}
+	}
+}
+
+// take removes the rows of the hours before until, or of every hour when until is zero, for upload.
+func (s *Sink) take(until time.Time) map[time.Time][]row {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	taken := make(map[time.Time][]row)
+	for hour, rows := range s.hours {
+		if until.IsZero() || hour.Before(until) {
+			taken[hour] = rows
+			delete(s.hours, hour)
+		}
+	}
+	return taken
+}
+
+// upload writes the rows of each hour as a Parquet file, s.uploadMu must be held.
+//   - rows are returned to their hour for the next attempt if the file can not be stored
+func (s *Sink) upload(hours map[time.Time][]row) error {
+	var errs []error
+	for hour, rows := range hours {
+		err := s.write(hour, rows)
+
+		s.mu.Lock()
+		if err != nil {
+			s.hours[hour] = append(rows, s.hours[hour]...)
+			errs = append(errs, err)
+		} else {
+			s.rows -= len(rows)
+		}
+		s.mu.Unlock()
+	}
+	return errors.Join(errs...)
+}
+
+// write writes rows as a Parquet file of their hour.
+func (s *Sink) write(hour time.Time, rows []row) error {
+	var buf bytes.Buffer
+	if err := parquet.Write(&buf, rows); err != nil {
+		return fmt.Errorf("failed to encode parquet file: %w", err)
+	}
+
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s/%d-%s.parquet", hour.Format("dt=2006-01-02/hour=15"), time.Now().UnixNano(), hex.EncodeToString(suffix))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	if err := s.store.Put(ctx, name, buf.Bytes()); err != nil {
+		return fmt.Errorf("failed to store parquet file %q: %w", name, err)
+	}
+	return nil
+}
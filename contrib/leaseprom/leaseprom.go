@@ -0,0 +1,93 @@
+// Package leaseprom exposes the state of a lease manager as Prometheus metrics, kept out of package lease so the
+// library does not depend on the Prometheus client.
+package leaseprom
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/carsonoid/talk-leased-logs/pkg/lease"
+)
+
+var (
+	leaseActiveDesc = prometheus.NewDesc("leased_logs_lease_active",
+		"Whether each watched lease is active on this instance.", []string{"lease_id"}, nil)
+	watchReconnectsDesc = prometheus.NewDesc("leased_logs_watch_reconnects_total",
+		"Times the watch of each lease failed and was restarted.", []string{"lease_id"}, nil)
+	shippedDesc = prometheus.NewDesc("leased_logs_entries_shipped_total",
+		"Entries shipped to leased sinks.", nil, nil)
+	suppressedDesc = prometheus.NewDesc("leased_logs_entries_suppressed_total",
+		"Entries not shipped to leased sinks because no lease allowed them.", nil, nil)
+	quarantinedDesc = prometheus.NewDesc("leased_logs_entries_quarantined_total",
+		"Entries rejected by sinks and quarantined.", nil, nil)
+	droppedDesc = prometheus.NewDesc("leased_logs_entries_dropped_total",
+		"Entries dropped because the queue between logging and shipping was full.", nil, nil)
+	queuedDesc = prometheus.NewDesc("leased_logs_queued_entries",
+		"Entries queued or being shipped by the shipping goroutine.", nil, nil)
+	rateLimitedDesc = prometheus.NewDesc("leased_logs_entries_rate_limited_total",
+		"Entries dropped for being over the rate limit.", nil, nil)
+	sinkErrorsDesc = prometheus.NewDesc("leased_logs_sink_errors_total",
+		"Errors sinks failed to ship entries with, including asynchronous ones.", nil, nil)
+	bufferBytesDesc = prometheus.NewDesc("leased_logs_buffer_bytes",
+		"Estimated bytes of unshipped entries held by the replay and shutdown buffers.", []string{"buffer"}, nil)
+)
+
+// collector is a prometheus.Collector reading the state of a manager at scrape time.
+type collector struct {
+	m *lease.Manager
+}
+
+// Collector returns a prometheus.Collector for the lease state and shipping counters of the manager, to register
+// with the registry the host application already serves.
+//   - leased_logs_lease_active and leased_logs_watch_reconnects_total are labeled with each watched lease
+//   - leased_logs_entries_shipped_total, leased_logs_entries_suppressed_total, and leased_logs_entries_quarantined_total
+//     count entries since the start, alert on suppression volumes or lease flapping with them
+//   - leased_logs_entries_dropped_total and leased_logs_queued_entries cover the queue of lease.WithQueue
+//   - leased_logs_entries_rate_limited_total counts the entries dropped by lease.WithRateLimit
+//   - leased_logs_sink_errors_total counts the errors sinks failed to ship entries with, see Manager.HandleError
+//   - leased_logs_buffer_bytes estimates the size of the replay and shutdown buffers, zero when they are disabled
+func Collector(m *lease.Manager) prometheus.Collector {
+	return collector{m: m}
+}
+
+// Handler returns an http.Handler serving the metrics of Collector and the Go runtime, for processes without a
+// registry of their own.
+func Handler(m *lease.Manager) http.Handler {
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(Collector(m), collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+	return promhttp.HandlerFor(reg, promhttp.HandlerOpts{})
+}
+
+// Describe sends the descriptors of every metric.
+func (c collector) Describe(ch chan<- *prometheus.Desc) {
+	for _, d := range []*prometheus.Desc{leaseActiveDesc, watchReconnectsDesc, shippedDesc, suppressedDesc, quarantinedDesc, droppedDesc, queuedDesc, rateLimitedDesc, sinkErrorsDesc, bufferBytesDesc} {
+		ch <- d
+	}
+}
+
+// Collect sends the current value of every metric.
+func (c collector) Collect(ch chan<- prometheus.Metric) {
+	state, stats := c.m.State(), c.m.Stats()
+	for _, l := range state.Leases {
+		active := 0.0
+		if l.Active {
+			active = 1
+		}
+		ch <- prometheus.MustNewConstMetric(leaseActiveDesc, prometheus.GaugeValue, active, l.ID)
+		ch <- prometheus.MustNewConstMetric(watchReconnectsDesc, prometheus.CounterValue, float64(l.Reconnects), l.ID)
+	}
+
+	ch <- prometheus.MustNewConstMetric(shippedDesc, prometheus.CounterValue, float64(stats.Shipped))
+	ch <- prometheus.MustNewConstMetric(suppressedDesc, prometheus.CounterValue, float64(stats.Suppressed))
+	ch <- prometheus.MustNewConstMetric(quarantinedDesc, prometheus.CounterValue, float64(stats.Quarantined))
+	ch <- prometheus.MustNewConstMetric(droppedDesc, prometheus.CounterValue, float64(stats.Dropped))
+	ch <- prometheus.MustNewConstMetric(queuedDesc, prometheus.GaugeValue, float64(state.Queued))
+	ch <- prometheus.MustNewConstMetric(rateLimitedDesc, prometheus.CounterValue, float64(stats.RateLimited))
+	ch <- prometheus.MustNewConstMetric(sinkErrorsDesc, prometheus.CounterValue, float64(stats.SinkErrors))
+
+	ch <- prometheus.MustNewConstMetric(bufferBytesDesc, prometheus.GaugeValue, float64(state.ReplayBufferBytes), "replay")
+	ch <- prometheus.MustNewConstMetric(bufferBytesDesc, prometheus.GaugeValue, float64(state.ShutdownBufferBytes), "shutdown")
+}
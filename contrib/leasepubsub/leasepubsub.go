@@ -0,0 +1,79 @@
+// Package leasepubsub publishes lease transitions to Pub/Sub, kept out of package lease so the library does not
+// depend on the Pub/Sub client.
+package leasepubsub
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/pubsub"
+
+	"github.com/carsonoid/talk-leased-logs/pkg/lease"
+)
+
+// publishTimeout bounds how long a single publish waits for Pub/Sub.
+const publishTimeout = 10 * time.Second
+
+// ParseTopic splits a topic, either a topic ID in projectID or a full projects/PROJECT/topics/TOPIC name, into the
+// project and topic IDs.
+func ParseTopic(projectID, name string) (project, topic string, err error) {
+	rest, ok := strings.CutPrefix(name, "projects/")
+	if !ok {
+		return projectID, name, nil
+	}
+	project, topic, found := strings.Cut(rest, "/topics/")
+	if !found {
+		return "", "", fmt.Errorf("invalid topic name %q, must be a topic ID or projects/PROJECT/topics/TOPIC", name)
+	}
+	return project, topic, nil
+}
+
+// Notifier is a lease.Notifier publishing notifications as JSON messages to a topic.
+//   - the event and lease ID are also set as event and lease_id attributes, for subscription filters
+type Notifier struct {
+	client *pubsub.Client
+	topic  *pubsub.Topic
+}
+
+// NewNotifier creates a Notifier publishing to a topic, either a topic ID in projectID or a full
+// projects/PROJECT/topics/TOPIC name. Close it once the manager using it is closed.
+func NewNotifier(ctx context.Context, projectID, topicName string) (*Notifier, error) {
+	project, topicID, err := ParseTopic(projectID, topicName)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := pubsub.NewClient(ctx, project)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Pub/Sub client: %w", err)
+	}
+	return &Notifier{client: client, topic: client.Topic(topicID)}, nil
+}
+
+// Notify publishes the notification and waits for Pub/Sub to accept it.
+func (n *Notifier) Notify(ctx context.Context, notification lease.Notification) error {
+	data, err := json.Marshal(notification)
+	if err != nil {
+		return fmt.Errorf("failed to encode notification: %w", err)
+	}
+
+	attrs := map[string]string{"event": notification.Event}
+	if notification.Lease != nil {
+		attrs["lease_id"] = notification.Lease.ID
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, publishTimeout)
+	defer cancel()
+
+	_, err = n.topic.Publish(ctx, &pubsub.Message{Data: data, Attributes: attrs}).Get(ctx)
+	return err
+}
+
+// Close flushes pending messages and closes the Pub/Sub client.
+func (n *Notifier) Close() error {
+	n.topic.Stop()
+	return n.client.Close()
+}
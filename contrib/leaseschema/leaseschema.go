@@ -0,0 +1,105 @@
+// Package leaseschema validates structured payloads against JSON Schemas, kept out of package lease so the library
+// does not depend on a JSON Schema implementation.
+package leaseschema
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+
+	"cloud.google.com/go/logging"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+
+	"github.com/carsonoid/talk-leased-logs/pkg/lease"
+)
+
+// Registry is a lease.Processor that validates structured payloads against a JSON Schema per log name.
+//   - string payloads and entries for log names without a schema are never validated
+//   - violations are counted and reported, and still shipped unless a quarantine is set
+type Registry struct {
+	schemas map[string]*jsonschema.Schema
+
+	mu         sync.Mutex
+	quarantine io.Writer
+
+	violations atomic.Int64
+}
+
+// NewRegistry creates an empty schema registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		schemas: make(map[string]*jsonschema.Schema),
+	}
+}
+
+// Register compiles the JSON Schema at path and uses it for entries with the given log name.
+func (r *Registry) Register(logName, path string) error {
+	schema, err := jsonschema.Compile(path)
+	if err != nil {
+		return fmt.Errorf("failed to compile schema for log %q: %w", logName, err)
+	}
+	r.schemas[logName] = schema
+	return nil
+}
+
+// SetQuarantine makes the registry drop invalid entries and write them to w instead, one JSON object per line.
+func (r *Registry) SetQuarantine(w io.Writer) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.quarantine = w
+}
+
+// Violations returns the number of entries that failed validation.
+func (r *Registry) Violations() int64 {
+	return r.violations.Load()
+}
+
+// Process validates the entry payload against the schema for its log name.
+func (r *Registry) Process(e *logging.Entry) bool {
+	schema, ok := r.schemas[e.LogName]
+	if !ok {
+		return true
+	}
+	if _, ok := e.Payload.(string); ok || e.Payload == nil {
+		return true
+	}
+
+	err := validatePayload(schema, e.Payload)
+	if err == nil {
+		return true
+	}
+
+	r.violations.Add(1)
+	lease.Diagnostics().Warn("schema violation", "log", e.LogName, "error", err)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.quarantine == nil {
+		return true
+	}
+
+	if werr := lease.WriteQuarantined(r.quarantine, *e, err.Error()); werr != nil {
+		lease.Diagnostics().Error("failed to write quarantined entry", "error", werr)
+	}
+	return false
+}
+
+// validatePayload validates an arbitrary payload by round-tripping it through JSON, as the schema library expects.
+func validatePayload(schema *jsonschema.Schema, payload any) error {
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return err
+	}
+
+	return schema.Validate(v)
+}
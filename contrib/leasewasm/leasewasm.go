@@ -0,0 +1,143 @@
+// Package leasewasm runs WebAssembly modules as processors, kept out of package lease so the library does not depend
+// on a WebAssembly runtime.
+package leasewasm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"cloud.google.com/go/logging"
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+
+	"github.com/carsonoid/talk-leased-logs/pkg/lease"
+)
+
+// Filter is a lease.Processor implemented by a WebAssembly module, so shipping policies can be distributed without recompiling.
+//   - the module exports its memory, alloc(size) ptr, and filter(ptr, len) result
+//   - filter receives the entry as JSON and returns the pointer and length of its JSON result, packed as ptr<<32 | len
+//   - the result has the same fields as the responses of processor exec plugins: entry, drop, and error
+//   - an optional free(ptr, size) export releases the memory of both the input and the result
+//   - WASI is available, and reactor modules are initialized by calling their _initialize export
+type Filter struct {
+	path string
+
+	mu      sync.Mutex
+	runtime wazero.Runtime
+	mod     api.Module
+	alloc   api.Function
+	filter  api.Function
+	free    api.Function
+}
+
+// NewFilter compiles and instantiates the WebAssembly module at path.
+func NewFilter(ctx context.Context, path string) (*Filter, error) {
+	code, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read wasm filter: %w", err)
+	}
+
+	r := wazero.NewRuntime(ctx)
+	wasi_snapshot_preview1.MustInstantiate(ctx, r)
+
+	cfg := wazero.NewModuleConfig().
+		WithStartFunctions("_initialize").
+		WithStderr(os.Stderr).
+		WithStdout(os.Stderr)
+	mod, err := r.InstantiateWithConfig(ctx, code, cfg)
+	if err != nil {
+		r.Close(ctx)
+		return nil, fmt.Errorf("failed to instantiate wasm filter %q: %w", path, err)
+	}
+
+	f := &Filter{
+		path:    path,
+		runtime: r,
+		mod:     mod,
+		alloc:   mod.ExportedFunction("alloc"),
+		filter:  mod.ExportedFunction("filter"),
+		free:    mod.ExportedFunction("free"),
+	}
+	if f.alloc == nil || f.filter == nil || mod.Memory() == nil {
+		r.Close(ctx)
+		return nil, fmt.Errorf("wasm filter %q must export memory, alloc, and filter", path)
+	}
+	return f, nil
+}
+
+// Process runs the entry through the module, replacing it with the returned entry or dropping it.
+//   - the entry is kept unchanged if the module fails, so a broken filter never loses entries
+func (f *Filter) Process(e *logging.Entry) bool {
+	entry, drop, err := f.call(*e)
+	if err != nil {
+		lease.Diagnostics().Error("failed to process entry with wasm filter", "filter", f.path, "error", err)
+		return true
+	}
+
+	if drop {
+		return false
+	}
+	if entry != nil {
+		*e = *entry
+	}
+	return true
+}
+
+// Close releases the module and its runtime.
+func (f *Filter) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.runtime.Close(context.Background())
+}
+
+// call passes the entry to the filter export and decodes its result.
+func (f *Filter) call(e logging.Entry) (entry *logging.Entry, drop bool, err error) {
+	in, err := lease.MarshalPluginEntry(e)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to encode entry: %w", err)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	ctx := context.Background()
+	mem := f.mod.Memory()
+
+	res, err := f.alloc.Call(ctx, uint64(len(in)))
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to allocate input: %w", err)
+	}
+	inPtr := uint32(res[0])
+	defer f.release(ctx, inPtr, uint32(len(in)))
+
+	if !mem.Write(inPtr, in) {
+		return nil, false, errors.New("input allocation is out of range")
+	}
+
+	res, err = f.filter.Call(ctx, uint64(inPtr), uint64(len(in)))
+	if err != nil {
+		return nil, false, fmt.Errorf("filter failed: %w", err)
+	}
+	outPtr, outLen := uint32(res[0]>>32), uint32(res[0])
+	defer f.release(ctx, outPtr, outLen)
+
+	out, ok := mem.Read(outPtr, outLen)
+	if !ok {
+		return nil, false, errors.New("filter result is out of range")
+	}
+	return lease.UnmarshalPluginResult(out)
+}
+
+// release frees memory allocated in the module, if it exports free.
+func (f *Filter) release(ctx context.Context, ptr, size uint32) {
+	if f.free == nil || size == 0 {
+		return
+	}
+	if _, err := f.free.Call(ctx, uint64(ptr), uint64(size)); err != nil {
+		lease.Diagnostics().Error("failed to free wasm filter memory", "error", err)
+	}
+}
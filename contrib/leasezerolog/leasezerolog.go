@@ -0,0 +1,86 @@
+// Package leasezerolog ships zerolog events through a lease manager, kept out of package lease so the library does
+// not depend on zerolog.
+package leasezerolog
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+
+	"cloud.google.com/go/logging"
+	"github.com/rs/zerolog"
+
+	"github.com/carsonoid/talk-leased-logs/pkg/lease"
+)
+
+// writer is a zerolog.LevelWriter that writes to stdout and ships events through the manager.
+type writer struct {
+	m *lease.Manager
+}
+
+// Writer returns a zerolog.LevelWriter that ships events like the slog handler returned by Manager.SlogLogger.
+//   - events are always written to stdout as is, unless they are shipped instead, see lease.WithShipOnly
+//   - the severity comes from the level zerolog passes along, so events are never parsed to route them
+//   - events are shipped as raw JSON payloads, and only decoded when processors need to see their fields
+//   - fatal and panic events flush the sinks, as zerolog exits or panics right after writing them
+func Writer(m *lease.Manager) zerolog.LevelWriter {
+	return &writer{m: m}
+}
+
+// Write ships an event written without a level, at DEFAULT severity.
+func (w *writer) Write(p []byte) (n int, err error) {
+	return w.WriteLevel(zerolog.NoLevel, p)
+}
+
+// WriteLevel writes an event to stdout, and ships it when the lease allows its level.
+func (w *writer) WriteLevel(l zerolog.Level, p []byte) (n int, err error) {
+	severity := getSeverity(l)
+	ship := w.m.Ships(severity)
+
+	n = len(p)
+	if w.m.PrintsLocally(severity, ship) {
+		n, err = os.Stdout.Write(p)
+		if err != nil {
+			return n, err
+		}
+	}
+
+	// zerolog reuses its buffers once the write returns
+	event := bytes.Clone(bytes.TrimSpace(p))
+	var payload any = json.RawMessage(event)
+	if len(event) == 0 || event[0] != '{' || !json.Valid(event) {
+		payload = string(event)
+	}
+
+	w.m.Log(logging.Entry{
+		Severity: severity,
+		Payload:  payload,
+	}, ship)
+
+	if l == zerolog.FatalLevel || l == zerolog.PanicLevel {
+		if err := w.m.Flush(); err != nil {
+			lease.Diagnostics().Error("failed to flush sinks", "error", err)
+		}
+	}
+	return n, nil
+}
+
+// getSeverity converts a zerolog.Level to a logging.Severity.
+func getSeverity(l zerolog.Level) logging.Severity {
+	switch l {
+	case zerolog.TraceLevel, zerolog.DebugLevel:
+		return logging.Debug
+	case zerolog.InfoLevel:
+		return logging.Info
+	case zerolog.WarnLevel:
+		return logging.Warning
+	case zerolog.ErrorLevel:
+		return logging.Error
+	case zerolog.FatalLevel:
+		return logging.Critical
+	case zerolog.PanicLevel:
+		return logging.Alert
+	default:
+		return logging.Default
+	}
+}
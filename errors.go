@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/alecthomas/kong"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/carsonoid/talk-leased-logs/internal/leaseconfig"
+)
+
+// Exit codes of the CLI, so automation wrapping it can branch on the kind of failure.
+const (
+	exitFailure  = 1
+	exitUsage    = 2
+	exitAuth     = 3
+	exitNotFound = 4
+	exitConflict = 5
+	exitTimeout  = 6
+)
+
+// errorKinds names each exit code in --json-errors output.
+var errorKinds = map[int]string{
+	exitFailure:  "failure",
+	exitUsage:    "usage",
+	exitAuth:     "auth",
+	exitNotFound: "not_found",
+	exitConflict: "conflict",
+	exitTimeout:  "timeout",
+}
+
+// exitError is an error with an explicit exit code.
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string {
+	return e.err.Error()
+}
+
+func (e *exitError) Unwrap() error {
+	return e.err
+}
+
+// withExitCode attaches an exit code to an error, overriding the code it would be classified as.
+func withExitCode(code int, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &exitError{code: code, err: err}
+}
+
+// exitCode classifies an error into one of the exit codes.
+//   - explicit codes from withExitCode win, then invalid flags and lease tokens, then gRPC status codes, then well-known
+//     error values
+func exitCode(err error) int {
+	var ee *exitError
+	if errors.As(err, &ee) {
+		return ee.code
+	}
+
+	var pe *kong.ParseError
+	var ue *leaseconfig.UsageError
+	if errors.As(err, &pe) || errors.As(err, &ue) {
+		return exitUsage
+	}
+	var te *leaseconfig.TokenError
+	if errors.As(err, &te) {
+		return exitAuth
+	}
+
+	switch status.Code(err) {
+	case codes.Unauthenticated, codes.PermissionDenied:
+		return exitAuth
+	case codes.NotFound:
+		return exitNotFound
+	case codes.AlreadyExists, codes.Aborted, codes.FailedPrecondition:
+		return exitConflict
+	case codes.DeadlineExceeded:
+		return exitTimeout
+	}
+
+	switch {
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, os.ErrDeadlineExceeded):
+		return exitTimeout
+	case errors.Is(err, os.ErrNotExist):
+		return exitNotFound
+	case strings.Contains(err.Error(), "could not find default credentials"):
+		// the google auth library does not export a sentinel for missing credentials
+		return exitAuth
+	}
+
+	return exitFailure
+}
+
+// jsonError is an error as printed with --json-errors.
+type jsonError struct {
+	Error    string `json:"error"`
+	Kind     string `json:"kind"`
+	ExitCode int    `json:"exitCode"`
+}
+
+// fatalIfErrorf reports err, prefixed by an optional message, and exits with its exit code.
+//   - with --json-errors, the error is printed to stderr as a single JSON object
+func fatalIfErrorf(k *kong.Kong, err error, args ...any) {
+	if err == nil {
+		return
+	}
+
+	msg := err.Error()
+	if len(args) > 0 {
+		msg = fmt.Sprintf(args[0].(string), args[1:]...) + ": " + msg
+	}
+	code := exitCode(err)
+
+	if cli.JSONErrors {
+		_ = json.NewEncoder(os.Stderr).Encode(jsonError{Error: msg, Kind: errorKinds[code], ExitCode: code})
+	} else {
+		k.Errorf("%s", msg)
+	}
+	k.Exit(code)
+}
@@ -0,0 +1,129 @@
+//go:build integration
+
+// Package integration runs end-to-end lease scenarios against the Firestore emulator.
+//
+// The tests are opt-in and excluded from regular builds by the integration build tag:
+//
+//	gcloud emulators firestore start --host-port=localhost:8086 &
+//	FIRESTORE_EMULATOR_HOST=localhost:8086 go test -tags integration ./integration
+//
+// Pass -start-emulator to have the tests start and stop the emulator themselves.
+package integration
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/firestore"
+)
+
+var (
+	projectID     = flag.String("project", "leased-logs-integration", "The project ID used with the emulator.")
+	database      = flag.String("database", "(default)", "The ID of the Firestore database holding the leases.")
+	startEmulator = flag.Bool("start-emulator", false, "Start the Firestore emulator with gcloud for the duration of the run.")
+)
+
+// fsClient is the Firestore client shared by all tests.
+var fsClient *firestore.Client
+
+func TestMain(m *testing.M) {
+	flag.Parse()
+	os.Exit(run(m))
+}
+
+// run sets up the emulator and the Firestore client, runs the tests, and returns the exit code.
+func run(m *testing.M) int {
+	ctx := context.Background()
+
+	if *startEmulator {
+		stop, err := runEmulator(ctx)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Failed to start emulator:", err)
+			return 1
+		}
+		defer stop()
+	}
+
+	if os.Getenv("FIRESTORE_EMULATOR_HOST") == "" {
+		fmt.Fprintln(os.Stderr, "FIRESTORE_EMULATOR_HOST must be set, or pass -start-emulator")
+		return 2
+	}
+
+	var err error
+	fsClient, err = firestore.NewClientWithDatabase(ctx, *projectID, *database)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to create firestore client:", err)
+		return 1
+	}
+	defer fsClient.Close()
+
+	return m.Run()
+}
+
+// harness holds the context and the lease document of the running test.
+type harness struct {
+	ctx    context.Context
+	docRef *firestore.DocumentRef
+}
+
+// newHarness returns a harness with a fresh lease document, whose context is canceled when the test ends so
+// background watchers stop with it.
+func newHarness(t *testing.T) *harness {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	name := strings.ReplaceAll(t.Name(), "/", "-")
+	return &harness{
+		ctx:    ctx,
+		docRef: fsClient.Collection("leases").Doc(fmt.Sprintf("it-%s-%d", name, time.Now().UnixNano())),
+	}
+}
+
+// runEmulator starts the Firestore emulator on a free port and points FIRESTORE_EMULATOR_HOST at it.
+func runEmulator(ctx context.Context) (func(), error) {
+	l, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		return nil, err
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	cmd := exec.CommandContext(ctx, "gcloud", "emulators", "firestore", "start", "--host-port="+addr)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	stop := func() {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+	}
+
+	// wait for the emulator to accept connections
+	deadline := time.Now().Add(30 * time.Second)
+	for {
+		conn, err := net.DialTimeout("tcp", addr, time.Second)
+		if err == nil {
+			conn.Close()
+			break
+		}
+		if time.Now().After(deadline) {
+			stop()
+			return nil, errors.New("timed out waiting for the emulator")
+		}
+		time.Sleep(250 * time.Millisecond)
+	}
+
+	os.Setenv("FIRESTORE_EMULATOR_HOST", addr)
+	return stop, nil
+}
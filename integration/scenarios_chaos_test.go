@@ -0,0 +1,101 @@
+//go:build integration && chaos
+
+package integration
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/carsonoid/talk-leased-logs/pkg/lease"
+)
+
+// withFaults injects faults until the returned function is called, and at the latest when the test ends.
+func withFaults(t *testing.T, f lease.Faults) func() {
+	lease.SetFaults(f)
+	reset := func() {
+		lease.SetFaults(lease.Faults{})
+	}
+	t.Cleanup(reset)
+	return reset
+}
+
+// TestChaosDroppedGrant checks that shipping fails closed when lease snapshots are lost, and recovers on the next one.
+func TestChaosDroppedGrant(t *testing.T) {
+	h := newHarness(t)
+	sink, write := newProbe(h)
+
+	reset := withFaults(t, lease.Faults{DropSnapshots: 1})
+
+	if _, err := h.docRef.Set(h.ctx, lease.Document{ExpireAt: time.Now().Add(time.Minute)}); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Second)
+	if probe(t, h, sink, write, time.Second) {
+		t.Fatal("entry shipped although the grant was never observed")
+	}
+
+	reset()
+	if _, err := h.docRef.Set(h.ctx, lease.Document{ExpireAt: time.Now().Add(time.Minute), Reason: "retry"}); err != nil {
+		t.Fatal(err)
+	}
+	if !probe(t, h, sink, write, 2*time.Second) {
+		t.Fatal("entry not shipped after the next snapshot was observed")
+	}
+}
+
+// TestChaosSinkErrors checks that failing sink writes do not block or break the application, and that shipping resumes.
+func TestChaosSinkErrors(t *testing.T) {
+	h := newHarness(t)
+	sink, write := newProbe(h)
+
+	if _, err := h.docRef.Set(h.ctx, lease.Document{ExpireAt: time.Now().Add(time.Minute)}); err != nil {
+		t.Fatal(err)
+	}
+	if !probe(t, h, sink, write, 2*time.Second) {
+		t.Fatal("entry not shipped while the lease was active")
+	}
+
+	reset := withFaults(t, lease.Faults{SinkErrors: 1})
+
+	start := time.Now()
+	if probe(t, h, sink, write, time.Second) {
+		t.Fatal("entry shipped although every sink write failed")
+	}
+	if took := time.Since(start); took > 2*time.Second {
+		t.Fatalf("write blocked for %s while the sink was failing", took)
+	}
+
+	reset()
+	if !probe(t, h, sink, write, time.Second) {
+		t.Fatal("entry not shipped after the sink recovered")
+	}
+}
+
+// TestChaosSlowSinkReplay checks that buffered entries are still replayed in order through a slow sink.
+func TestChaosSlowSinkReplay(t *testing.T) {
+	h := newHarness(t)
+	sink, write := newProbe(h, lease.WithReplayBuffer(10, time.Minute))
+
+	withFaults(t, lease.Faults{SinkDelay: 100 * time.Millisecond})
+
+	for i := range 3 {
+		write(fmt.Sprintf("buffered-%d", i))
+	}
+	if _, err := h.docRef.Set(h.ctx, lease.Document{ExpireAt: time.Now().Add(time.Minute)}); err != nil {
+		t.Fatal(err)
+	}
+
+	replayed := waitFor(h, 5*time.Second, func() bool {
+		return len(sink.payloads()) >= 3
+	})
+	if !replayed {
+		t.Fatal("timed out waiting for the buffered entries to be replayed")
+	}
+
+	for i, p := range sink.payloads()[:3] {
+		if want := fmt.Sprintf("buffered-%d", i); p != want {
+			t.Errorf("replayed entry %d is %q, want %q", i, p, want)
+		}
+	}
+}
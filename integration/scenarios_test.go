@@ -0,0 +1,97 @@
+//go:build integration
+
+package integration
+
+import (
+	"testing"
+	"time"
+
+	"github.com/carsonoid/talk-leased-logs/pkg/lease"
+)
+
+// TestGrantShipExpire checks that entries only ship between a lease grant and its expiry.
+func TestGrantShipExpire(t *testing.T) {
+	h := newHarness(t)
+	sink, write := newProbe(h)
+
+	if probe(t, h, sink, write, time.Second) {
+		t.Fatal("entry shipped before the lease was granted")
+	}
+
+	if _, err := h.docRef.Set(h.ctx, lease.Document{ExpireAt: time.Now().Add(3 * time.Second), User: "integration"}); err != nil {
+		t.Fatal(err)
+	}
+	if !probe(t, h, sink, write, 2*time.Second) {
+		t.Fatal("entry not shipped while the lease was active")
+	}
+
+	time.Sleep(3 * time.Second)
+	if probe(t, h, sink, write, time.Second) {
+		t.Fatal("entry shipped after the lease expired")
+	}
+}
+
+// TestTagsMismatch checks that leases tagged for other instances are ignored.
+func TestTagsMismatch(t *testing.T) {
+	h := newHarness(t)
+	sink, write := newProbe(h, lease.WithLabels(map[string]string{"service": "api"}))
+
+	_, err := h.docRef.Set(h.ctx, lease.Document{
+		ExpireAt: time.Now().Add(time.Minute),
+		Tags:     map[string]string{"service": "worker"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// give the watcher time to observe the lease before probing
+	time.Sleep(time.Second)
+	if probe(t, h, sink, write, time.Second) {
+		t.Fatal("entry shipped under a lease for another service")
+	}
+}
+
+// TestReplayOnGrant checks that buffered entries are shipped when a lease is granted.
+func TestReplayOnGrant(t *testing.T) {
+	h := newHarness(t)
+	sink, write := newProbe(h, lease.WithReplayBuffer(10, time.Minute))
+
+	write("before-grant")
+	if _, err := h.docRef.Set(h.ctx, lease.Document{ExpireAt: time.Now().Add(time.Minute)}); err != nil {
+		t.Fatal(err)
+	}
+
+	replayed := waitFor(h, 3*time.Second, func() bool {
+		for _, p := range sink.payloads() {
+			if p == "before-grant" {
+				return true
+			}
+		}
+		return false
+	})
+	if !replayed {
+		t.Fatal("timed out waiting for the buffered entry to be replayed")
+	}
+}
+
+// TestAllLeases checks that with AllLeases, entries only ship while every watched lease is active.
+func TestAllLeases(t *testing.T) {
+	h := newHarness(t)
+	incident := h.docRef.Parent.Doc(h.docRef.ID + "-incident")
+	sink, write := newProbe(h, lease.WithLeases(incident), lease.WithLeasePolicy(lease.AllLeases))
+
+	if _, err := h.docRef.Set(h.ctx, lease.Document{ExpireAt: time.Now().Add(time.Minute)}); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Second)
+	if probe(t, h, sink, write, time.Second) {
+		t.Fatal("entry shipped with only one of two leases active")
+	}
+
+	if _, err := incident.Set(h.ctx, lease.Document{ExpireAt: time.Now().Add(time.Minute)}); err != nil {
+		t.Fatal(err)
+	}
+	if !probe(t, h, sink, write, 2*time.Second) {
+		t.Fatal("entry not shipped with both leases active")
+	}
+}
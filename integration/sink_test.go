@@ -0,0 +1,99 @@
+//go:build integration
+
+package integration
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/logging"
+
+	"github.com/carsonoid/talk-leased-logs/pkg/lease"
+)
+
+// recordingSink is a lease.Sink that records every entry it receives.
+type recordingSink struct {
+	mu      sync.Mutex
+	entries []logging.Entry
+}
+
+// Log records the entry.
+func (s *recordingSink) Log(e logging.Entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries = append(s.entries, e)
+	return nil
+}
+
+// Flush does nothing, entries are recorded synchronously.
+func (s *recordingSink) Flush() error {
+	return nil
+}
+
+// payloads returns the string payloads of all recorded entries.
+func (s *recordingSink) payloads() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	out := make([]string, 0, len(s.entries))
+	for _, e := range s.entries {
+		out = append(out, fmt.Sprint(e.Payload))
+	}
+	return out
+}
+
+// newProbe creates a manager shipping to a recording sink, and a function writing INFO lines through it.
+func newProbe(h *harness, opts ...lease.Option) (*recordingSink, func(string)) {
+	sink := &recordingSink{}
+	opts = append([]lease.Option{lease.WithSink(sink, lease.Leased)}, opts...)
+	m := lease.NewManager(h.ctx, time.Now(), h.docRef, opts...)
+
+	info := m.LeveledWriter(logging.Info)
+	return sink, func(line string) {
+		fmt.Fprintln(info, line)
+	}
+}
+
+// waitFor polls cond until it is true or the timeout passes, and reports whether it became true.
+func waitFor(h *harness, timeout time.Duration, cond func() bool) bool {
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+
+	t := time.NewTicker(50 * time.Millisecond)
+	defer t.Stop()
+	for {
+		if cond() {
+			return true
+		}
+		select {
+		case <-h.ctx.Done():
+			return false
+		case <-deadline.C:
+			return false
+		case <-t.C:
+		}
+	}
+}
+
+// probe writes a line and reports whether the sink received it within the timeout.
+func probe(t *testing.T, h *harness, sink *recordingSink, write func(string), timeout time.Duration) bool {
+	t.Helper()
+
+	marker := fmt.Sprintf("probe-%d", time.Now().UnixNano())
+	write(marker)
+
+	shipped := waitFor(h, timeout, func() bool {
+		for _, p := range sink.payloads() {
+			if p == marker {
+				return true
+			}
+		}
+		return false
+	})
+	if err := h.ctx.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return shipped
+}
@@ -0,0 +1,293 @@
+package capture
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"cloud.google.com/go/logging"
+
+	"github.com/carsonoid/talk-leased-logs/pkg/lease"
+)
+
+// StructuredFDEnv is set in the environment of the command when structured logs are enabled.
+const StructuredFDEnv = "LEASED_LOGS_FD"
+
+// severityFDs are the severities exposed to the command when severity fds are enabled.
+var severityFDs = []logging.Severity{logging.Debug, logging.Info, logging.Warning, logging.Error}
+
+// Options configures how the output of a command is captured.
+type Options struct {
+	// StructuredFD passes fd 3 to the command for newline-delimited JSON logs. Ignored where commands can not inherit
+	// extra files, on Windows.
+	StructuredFD bool
+	// SeverityFDs passes one fd and one named pipe per severity to the command, advertised as LEASED_LOGS_<SEVERITY>_FD
+	// and LEASED_LOGS_<SEVERITY>_FIFO, with WARN as an alias of WARNING. Unix only.
+	SeverityFDs bool
+	// TTY runs the command under a pseudo-terminal, so it behaves like it does interactively, such as with line
+	// buffering and colors. Its stdout and stderr are merged, as on a terminal, and shipped as stdout. Unix only.
+	TTY bool
+	// ProjectID is the project holding the lease, advertised to the command as LEASE_PROJECT_ID.
+	ProjectID string
+	// Restart restarts the command once it exits, see ParseRestartPolicy.
+	Restart RestartPolicy
+	// Signals are forwarded to the command while it runs, DefaultSignals when nil.
+	Signals []os.Signal
+}
+
+// Run runs a command, shipping its output through the lease manager, and waits for it to exit.
+//   - stdout and stderr are always printed, unless the manager is ship-only, and shipped according to the lease
+//   - if the command exits abnormally, the shutdown buffer of the manager is shipped
+//   - the lease is described to the command by LEASE_ID, LEASE_ACTIVE_UNTIL, and LEASE_PROJECT_ID, as of each start
+//   - stdin is passed to the command, a terminal on stdin through a pipe, as the command could not read it from its
+//     own process group
+//   - the command runs in its own process group, and signals are forwarded to the group rather than terminating the
+//     caller, so it is never orphaned and its last output is still shipped
+//   - on Windows, the command shares the console of the caller, and is killed on SIGTERM
+//   - the command is restarted according to the restart policy, returning the error of its last run
+func Run(m *lease.Manager, opts Options, args []string) error {
+	if len(args) == 0 {
+		return errors.New("no command to capture")
+	}
+
+	signals := opts.Signals
+	if signals == nil {
+		signals = DefaultSignals
+	}
+	// catch signals before starting the command, so none terminates the caller in between
+	sigs := make(chan os.Signal, len(signals))
+	signal.Notify(sigs, signals...)
+	defer signal.Stop(sigs)
+
+	r := &runner{m: m, opts: opts, args: args, sigs: sigs, stdout: m.StdoutWriter(), stderr: m.StderrWriter()}
+	return r.supervise()
+}
+
+// runner runs a command, once or again according to the restart policy.
+type runner struct {
+	m    *lease.Manager
+	opts Options
+	args []string
+	sigs chan os.Signal
+	// stdout and stderr are shared by every run, so grouped lines are not split by a restart
+	stdout, stderr io.Writer
+	// stopping is set once a signal asking the command to stop was forwarded, so it is not restarted
+	stopping atomic.Bool
+}
+
+// run runs the command once and waits for it to exit.
+func (r *runner) run() error {
+	m, opts, args := r.m, r.opts, r.args
+	execCmd := exec.Command(args[0], args[1:]...)
+	var stdin io.WriteCloser
+	if !opts.TTY {
+		execCmd.Stdout = r.stdout
+		execCmd.Stderr = r.stderr
+		// a terminal would signal the command as well as the caller, which forwards signals itself
+		setProcessGroup(execCmd)
+
+		if isTerminal(os.Stdin) {
+			// reading a terminal from a background process group stops the command, relay it instead
+			w, err := execCmd.StdinPipe()
+			if err != nil {
+				return err
+			}
+			stdin = w
+		} else {
+			execCmd.Stdin = os.Stdin
+		}
+	}
+
+	pipes := &extraPipes{cmd: execCmd}
+	defer pipes.closeReaders()
+
+	if opts.StructuredFD && inheritsExtraFiles {
+		fd, err := pipes.add(m.StructuredWriter())
+		if err != nil {
+			return err
+		}
+		execCmd.Env = append(execCmd.Env, fmt.Sprintf("%s=%d", StructuredFDEnv, fd))
+	}
+
+	var named *fifos
+	if opts.SeverityFDs {
+		var err error
+		named, err = newFIFOs()
+		if err != nil {
+			return err
+		}
+		defer named.close()
+
+		for _, s := range severityFDs {
+			fd, err := pipes.add(leveledWriter(m, s))
+			if err != nil {
+				return err
+			}
+			path, err := named.add(strings.ToLower(s.String()), leveledWriter(m, s))
+			if err != nil {
+				return err
+			}
+			for _, name := range severityEnvNames(s) {
+				execCmd.Env = append(execCmd.Env,
+					fmt.Sprintf("LEASED_LOGS_%s_FD=%d", name, fd),
+					fmt.Sprintf("LEASED_LOGS_%s_FIFO=%s", name, path),
+				)
+			}
+		}
+	}
+
+	execCmd.Env = append(append(os.Environ(), leaseEnv(m, opts.ProjectID)...), execCmd.Env...)
+
+	var term *terminal
+	var err error
+	if opts.TTY {
+		term, err = startTerminal(execCmd, r.stdout)
+	} else {
+		err = execCmd.Start()
+	}
+	// close the parent copies of the write ends so reads end when the command exits
+	pipes.closeWriters()
+	if err != nil {
+		return err
+	}
+
+	if stdin != nil {
+		// the copy ends with stdin, or the first write once the command exited and Wait closed the pipe
+		go func() {
+			_, _ = io.Copy(stdin, os.Stdin)
+			stdin.Close()
+		}()
+	}
+	if term != nil {
+		restore := term.relayStdin()
+		defer restore()
+	}
+
+	exited := make(chan struct{})
+	go r.forwardSignals(execCmd.Process.Pid, term, exited)
+
+	err = execCmd.Wait()
+	close(exited)
+	if term != nil {
+		term.wait()
+	}
+	pipes.wait()
+	if named != nil {
+		named.close()
+	}
+
+	// the command failed, ship what led up to it before exiting
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		if shipErr := m.ShipShutdownBuffer(); shipErr != nil {
+			fmt.Fprintln(os.Stderr, "Failed to ship shutdown window:", shipErr)
+		}
+	}
+
+	return err
+}
+
+// forwardSignals sends the signals received by the caller to the process group of pid, until exited is closed.
+//   - with a terminal, SIGWINCH resizes it instead, which signals the command in turn
+func (r *runner) forwardSignals(pid int, term *terminal, exited <-chan struct{}) {
+	for {
+		select {
+		case <-exited:
+			return
+		case sig := <-r.sigs:
+			if isResize(sig) && term != nil {
+				term.resize()
+				continue
+			}
+			if slices.Contains(stopSignals, sig) {
+				r.stopping.Store(true)
+			}
+			if err := signalGroup(pid, sig); err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to forward %s: %s\n", sig, err)
+			}
+		}
+	}
+}
+
+// extraPipes passes pipes to a command as inherited file descriptors and copies everything read from them to a writer.
+type extraPipes struct {
+	cmd     *exec.Cmd
+	readers []*os.File
+	wg      sync.WaitGroup
+}
+
+// add creates a new pipe inherited by the command and returns its file descriptor number in the command.
+//   - dst is closed once the command closes its end of the pipe
+func (p *extraPipes) add(dst io.WriteCloser) (int, error) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return 0, fmt.Errorf("failed to create pipe: %w", err)
+	}
+
+	p.cmd.ExtraFiles = append(p.cmd.ExtraFiles, w)
+	p.readers = append(p.readers, r)
+
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		if _, err := io.Copy(dst, r); err != nil {
+			fmt.Fprintln(os.Stderr, "Failed to read from pipe:", err)
+		}
+		dst.Close()
+	}()
+
+	// extra files start at fd 3 in the command
+	return 2 + len(p.cmd.ExtraFiles), nil
+}
+
+// closeWriters closes the parent copies of the pipe write ends.
+func (p *extraPipes) closeWriters() {
+	for _, f := range p.cmd.ExtraFiles {
+		f.Close()
+	}
+}
+
+// closeReaders closes the read ends of all pipes.
+func (p *extraPipes) closeReaders() {
+	for _, r := range p.readers {
+		r.Close()
+	}
+}
+
+// wait blocks until everything has been copied from all pipes.
+func (p *extraPipes) wait() {
+	p.wg.Wait()
+}
+
+// leveledWriter returns a writer shipping lines at severity s like structured logs, and printing them like regular
+// output, closed once the command is done with it.
+func leveledWriter(m *lease.Manager, s logging.Severity) io.WriteCloser {
+	leveled := m.LeveledWriter(s)
+	return teeWriteCloser{
+		Writer: io.MultiWriter(m.LocalWriter(os.Stdout, s), leveled),
+		Closer: leveled,
+	}
+}
+
+// severityEnvNames returns the names of a severity in the environment variables advertising its fd and FIFO, with
+// WARN as an alias of WARNING.
+func severityEnvNames(s logging.Severity) []string {
+	name := strings.ToUpper(s.String())
+	if s == logging.Warning {
+		return []string{name, "WARN"}
+	}
+	return []string{name}
+}
+
+// teeWriteCloser combines a writer with the closer of one of its destinations.
+type teeWriteCloser struct {
+	io.Writer
+	io.Closer
+}
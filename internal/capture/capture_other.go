@@ -0,0 +1,38 @@
+//go:build !unix
+
+package capture
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// inheritsExtraFiles reports whether commands can inherit files beyond stdin, stdout, and stderr.
+const inheritsExtraFiles = false
+
+// DefaultSignals are the signals forwarded to the command when Options.Signals is nil.
+var DefaultSignals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+
+// setProcessGroup does nothing, the command shares the console, and so the interrupts, of the caller.
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// signalGroup kills the command for any signal but an interrupt, which the console already delivered to it.
+func signalGroup(pid int, sig os.Signal) error {
+	if sig == os.Interrupt {
+		return nil
+	}
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return nil
+	}
+	return p.Kill()
+}
+
+// isResize reports whether sig reports a resized terminal, which is never signaled.
+func isResize(sig os.Signal) bool {
+	return false
+}
+
+// reraise does nothing, as signals can not be raised, so Exit exits with 128 plus the signal number.
+func reraise(sig syscall.Signal) {}
@@ -0,0 +1,58 @@
+//go:build unix
+
+package capture
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"os/signal"
+	"slices"
+	"syscall"
+	"time"
+)
+
+// inheritsExtraFiles reports whether commands can inherit files beyond stdin, stdout, and stderr.
+const inheritsExtraFiles = true
+
+// DefaultSignals are the signals forwarded to the command when Options.Signals is nil.
+var DefaultSignals = []os.Signal{
+	syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP, syscall.SIGQUIT, syscall.SIGUSR1, syscall.SIGUSR2, syscall.SIGWINCH,
+}
+
+// reraisedSignals are the signals the Go runtime terminates the process with by default, and so can be raised again
+// to exit like the command did. Others, such as SIGQUIT, would dump goroutine stacks instead.
+var reraisedSignals = []syscall.Signal{
+	syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM, syscall.SIGUSR1, syscall.SIGUSR2, syscall.SIGALRM, syscall.SIGKILL,
+}
+
+// setProcessGroup starts the command in its own process group.
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// signalGroup sends sig to the process group led by pid, ignoring a group that already exited.
+func signalGroup(pid int, sig os.Signal) error {
+	err := syscall.Kill(-pid, sig.(syscall.Signal))
+	if errors.Is(err, syscall.ESRCH) {
+		return nil
+	}
+	return err
+}
+
+// isResize reports whether sig reports a resized terminal.
+func isResize(sig os.Signal) bool {
+	return sig == syscall.SIGWINCH
+}
+
+// reraise terminates the current process with sig, if the runtime terminates with it by default, and returns
+// otherwise.
+func reraise(sig syscall.Signal) {
+	if !slices.Contains(reraisedSignals, sig) {
+		return
+	}
+	signal.Reset(sig)
+	_ = syscall.Kill(os.Getpid(), sig)
+	// the runtime handles the signal on another thread, give it time to terminate the process
+	time.Sleep(time.Second)
+}
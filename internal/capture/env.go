@@ -0,0 +1,51 @@
+package capture
+
+import (
+	"strings"
+	"time"
+
+	"github.com/carsonoid/talk-leased-logs/pkg/lease"
+)
+
+// Environment variables describing the lease to the command, so lease-aware applications can adapt their own verbosity
+// without watching the lease themselves.
+const (
+	// LeaseIDEnv is the ID of the lease, or the IDs of all leases separated by commas
+	LeaseIDEnv = "LEASE_ID"
+	// LeaseActiveUntilEnv is the RFC 3339 time until which output is shipped when the command starts, or empty when it
+	// is not
+	LeaseActiveUntilEnv = "LEASE_ACTIVE_UNTIL"
+	// LeaseProjectIDEnv is the ID of the project holding the lease
+	LeaseProjectIDEnv = "LEASE_PROJECT_ID"
+)
+
+// leaseEnv returns the environment describing the lease to the command, as of now.
+//   - parent leases are left out of the lease IDs, as the command is not leased by them directly
+//   - shipping stays enabled until the latest expiry among the active leases and the initial lease time
+func leaseEnv(m *lease.Manager, projectID string) []string {
+	state := m.State()
+
+	var ids []string
+	var until time.Time
+	if state.Enabled && state.GuaranteedUntil.After(state.At) {
+		until = state.GuaranteedUntil
+	}
+	for _, l := range state.Leases {
+		if !l.Parent {
+			ids = append(ids, l.ID)
+		}
+		if state.Enabled && l.Active && l.ExpireAt != nil && l.ExpireAt.After(until) {
+			until = *l.ExpireAt
+		}
+	}
+
+	var activeUntil string
+	if !until.IsZero() {
+		activeUntil = until.UTC().Format(time.RFC3339)
+	}
+	return []string{
+		LeaseIDEnv + "=" + strings.Join(ids, ","),
+		LeaseActiveUntilEnv + "=" + activeUntil,
+		LeaseProjectIDEnv + "=" + projectID,
+	}
+}
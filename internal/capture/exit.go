@@ -0,0 +1,30 @@
+package capture
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// Exit exits the current process like the command Run returned err for did, so wrapping a command is transparent to
+// supervisors, such as systemd or Kubernetes, and scripts.
+//   - a command exiting with a code exits with the same code
+//   - a command terminated by a signal terminates the process with the same signal where possible, or exits with 128
+//     plus the signal number otherwise, like a shell reports it
+//   - Exit returns if err did not come from the command exiting
+func Exit(err error) {
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return
+	}
+
+	ws, ok := exitErr.Sys().(syscall.WaitStatus)
+	if !ok || !ws.Signaled() {
+		os.Exit(exitErr.ExitCode())
+	}
+
+	sig := ws.Signal()
+	reraise(sig)
+	os.Exit(128 + int(sig))
+}
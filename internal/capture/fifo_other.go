@@ -0,0 +1,22 @@
+//go:build !unix
+
+package capture
+
+import (
+	"errors"
+	"io"
+)
+
+// fifos are not supported, severity fds are not supported either, as commands can not inherit extra files.
+type fifos struct{}
+
+// newFIFOs fails, as named pipes are Unix only.
+func newFIFOs() (*fifos, error) {
+	return nil, errors.New("severity fifos are only supported on Unix")
+}
+
+func (f *fifos) add(name string, dst io.WriteCloser) (string, error) {
+	return "", errors.New("severity fifos are only supported on Unix")
+}
+
+func (f *fifos) close() {}
@@ -0,0 +1,76 @@
+//go:build unix
+
+package capture
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// fifoDrainTimeout is how long the FIFOs are still read once the command exited, for what it wrote just before.
+const fifoDrainTimeout = 100 * time.Millisecond
+
+// fifos are named pipes in a private temporary directory, copying everything written to them to a writer.
+//   - unlike inherited fds, they can be opened by path, such as by processes that close their inherited fds
+type fifos struct {
+	dir       string
+	files     []*os.File
+	wg        sync.WaitGroup
+	closeOnce sync.Once
+}
+
+// newFIFOs creates the directory of the named pipes, only accessible to the user.
+func newFIFOs() (*fifos, error) {
+	dir, err := os.MkdirTemp("", "leased-logs-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create fifo directory: %w", err)
+	}
+	return &fifos{dir: dir}, nil
+}
+
+// add creates a named pipe and returns its path.
+//   - dst is closed once the FIFOs are closed
+func (f *fifos) add(name string, dst io.WriteCloser) (string, error) {
+	path := filepath.Join(f.dir, name)
+	if err := syscall.Mkfifo(path, 0o600); err != nil {
+		return "", fmt.Errorf("failed to create fifo: %w", err)
+	}
+	// opened for reading and writing, so opening does not wait for a writer, and reads do not end when writers close it
+	file, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return "", fmt.Errorf("failed to open fifo: %w", err)
+	}
+	f.files = append(f.files, file)
+
+	f.wg.Add(1)
+	go func() {
+		defer f.wg.Done()
+		if _, err := io.Copy(dst, file); err != nil && !errors.Is(err, os.ErrDeadlineExceeded) && !errors.Is(err, os.ErrClosed) {
+			fmt.Fprintln(os.Stderr, "Failed to read from fifo:", err)
+		}
+		dst.Close()
+	}()
+
+	return path, nil
+}
+
+// close reads what is left in the named pipes, then closes and removes them.
+//   - close is safe to call more than once
+func (f *fifos) close() {
+	f.closeOnce.Do(func() {
+		for _, file := range f.files {
+			file.SetReadDeadline(time.Now().Add(fifoDrainTimeout))
+		}
+		f.wg.Wait()
+		for _, file := range f.files {
+			file.Close()
+		}
+		os.RemoveAll(f.dir)
+	})
+}
@@ -0,0 +1,85 @@
+//go:build unix
+
+package capture
+
+import (
+	"bytes"
+	"os"
+	"slices"
+	"sync"
+	"testing"
+
+	"cloud.google.com/go/logging"
+)
+
+// bufferCloser is an io.WriteCloser recording what is written and whether it was closed.
+type bufferCloser struct {
+	mu     sync.Mutex
+	buf    bytes.Buffer
+	closed bool
+}
+
+func (b *bufferCloser) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *bufferCloser) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	return nil
+}
+
+func TestFIFOs(t *testing.T) {
+	named, err := newFIFOs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dst := &bufferCloser{}
+	path, err := named.add("warning", dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// several writers in turn, as separate redirections of a shell script
+	for _, line := range []string{"first\n", "second\n"} {
+		w, err := os.OpenFile(path, os.O_WRONLY, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.WriteString(line); err != nil {
+			t.Fatal(err)
+		}
+		w.Close()
+	}
+
+	named.close()
+	named.close()
+
+	if got := dst.buf.String(); got != "first\nsecond\n" {
+		t.Errorf("read %q, want %q", got, "first\nsecond\n")
+	}
+	if !dst.closed {
+		t.Error("destination was not closed")
+	}
+	if _, err := os.Stat(named.dir); !os.IsNotExist(err) {
+		t.Errorf("fifo directory was not removed: %v", err)
+	}
+}
+
+func TestSeverityEnvNames(t *testing.T) {
+	tests := []struct {
+		severity logging.Severity
+		want     []string
+	}{
+		{logging.Info, []string{"INFO"}},
+		{logging.Warning, []string{"WARNING", "WARN"}},
+	}
+	for _, tt := range tests {
+		if got := severityEnvNames(tt.severity); !slices.Equal(got, tt.want) {
+			t.Errorf("severityEnvNames(%v) = %v, want %v", tt.severity, got, tt.want)
+		}
+	}
+}
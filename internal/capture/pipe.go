@@ -0,0 +1,35 @@
+package capture
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/carsonoid/talk-leased-logs/pkg/lease"
+)
+
+// Pipe ships everything read from stdin through the lease manager until it ends, like a leased tee, so the output of
+// any existing process can be piped in.
+//   - stdin is printed, unless the manager is ship-only, and shipped according to the lease, like the stdout of a
+//     command
+//   - SIGINT and SIGTERM stop reading, so what was read so far is still shipped
+func Pipe(m *lease.Manager) error {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sigs)
+
+	copied := make(chan error, 1)
+	go func() {
+		_, err := io.Copy(m.StdoutWriter(), os.Stdin)
+		copied <- err
+	}()
+
+	select {
+	case err := <-copied:
+		return err
+	case sig := <-sigs:
+		return fmt.Errorf("interrupted by %s", sig)
+	}
+}
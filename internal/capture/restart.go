@@ -0,0 +1,142 @@
+package capture
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// RestartMode controls when a command is restarted, see RestartPolicy.
+type RestartMode int
+
+const (
+	// RestartNo never restarts the command.
+	RestartNo RestartMode = iota
+	// RestartOnFailure restarts the command when it exits with a non-zero code or is terminated by a signal.
+	RestartOnFailure
+	// RestartAlways restarts the command whenever it exits.
+	RestartAlways
+)
+
+// RestartPolicy controls whether a command is restarted once it exits, so capture can supervise a flaky process.
+type RestartPolicy struct {
+	Mode RestartMode
+	// Max is the maximum number of restarts, unlimited when zero
+	Max int
+}
+
+const (
+	// restartBackoffMin and restartBackoffMax bound the delay before restarting a command
+	restartBackoffMin = time.Second
+	restartBackoffMax = time.Minute
+)
+
+// stopSignals are the forwarded signals asking the command to stop, after which it is not restarted.
+var stopSignals = []os.Signal{syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT}
+
+// ParseRestartPolicy converts "no", "always", or "on-failure", optionally followed by the maximum number of restarts
+// such as "on-failure:5", to a RestartPolicy.
+func ParseRestartPolicy(s string) (RestartPolicy, error) {
+	mode, limit, hasLimit := strings.Cut(s, ":")
+
+	var p RestartPolicy
+	switch mode {
+	case "no":
+		if hasLimit {
+			return p, fmt.Errorf("invalid restart policy %q, no takes no maximum", s)
+		}
+		return p, nil
+	case "on-failure":
+		p.Mode = RestartOnFailure
+	case "always":
+		p.Mode = RestartAlways
+	default:
+		return p, fmt.Errorf("unknown restart policy %q, must be no, always, or on-failure, optionally followed by :MAX", s)
+	}
+
+	if hasLimit {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 {
+			return p, fmt.Errorf("invalid maximum restarts %q in restart policy, must be a positive number", limit)
+		}
+		p.Max = n
+	}
+	return p, nil
+}
+
+// restarts reports whether the policy restarts a command that exited with err.
+func (p RestartPolicy) restarts(err error) bool {
+	switch p.Mode {
+	case RestartAlways:
+		return true
+	case RestartOnFailure:
+		return err != nil
+	default:
+		return false
+	}
+}
+
+// supervise runs the command, restarting it according to the restart policy, and returns the error of its last run.
+//   - restarts are delayed with exponential backoff from restartBackoffMin up to restartBackoffMax, which resets once
+//     a run lasted longer than restartBackoffMax
+//   - the command is not restarted once it could not be started, or after a signal asking it to stop was forwarded
+//   - restarts are logged through the manager, and giving up is logged as an error
+func (r *runner) supervise() error {
+	policy := r.opts.Restart
+	logger := r.m.SlogLogger()
+
+	var restarts, failures int
+	for {
+		start := time.Now()
+		err := r.run()
+
+		var exitErr *exec.ExitError
+		if !policy.restarts(err) || (err != nil && !errors.As(err, &exitErr)) || r.stopping.Load() {
+			return err
+		}
+		if policy.Max > 0 && restarts >= policy.Max {
+			logger.Error("command exited, giving up after the maximum number of restarts", "command", r.args[0], "exit", exitStatus(err), "restarts", restarts)
+			return err
+		}
+
+		if time.Since(start) > restartBackoffMax {
+			failures = 0
+		}
+		delay := restartBackoffMax
+		if failures < 16 {
+			delay = min(restartBackoffMin<<failures, restartBackoffMax)
+		}
+		failures++
+		restarts++
+		logger.Warn("command exited, restarting", "command", r.args[0], "exit", exitStatus(err), "restart", restarts, "delay", delay)
+
+		// a signal asking the command to stop while waiting ends supervision, others are dropped with nothing to get them
+		wait := time.NewTimer(delay)
+	waiting:
+		for {
+			select {
+			case <-wait.C:
+				break waiting
+			case sig := <-r.sigs:
+				if slices.Contains(stopSignals, sig) {
+					wait.Stop()
+					return err
+				}
+			}
+		}
+	}
+}
+
+// exitStatus describes how a command exited, such as "exit status 1" or "signal: killed".
+func exitStatus(err error) string {
+	if err == nil {
+		return "exit status 0"
+	}
+	return err.Error()
+}
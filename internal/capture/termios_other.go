@@ -0,0 +1,11 @@
+//go:build aix || linux || solaris || zos
+
+package capture
+
+import "golang.org/x/sys/unix"
+
+// ioctls reading and writing the attributes of a terminal
+const (
+	ioctlReadTermios  = unix.TCGETS
+	ioctlWriteTermios = unix.TCSETS
+)
@@ -0,0 +1,32 @@
+//go:build !unix
+
+package capture
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+)
+
+// terminal is the pseudo-terminal a command runs under, see Options.TTY, which is not supported on this platform.
+type terminal struct{}
+
+// startTerminal fails, pseudo-terminals are not supported on this platform.
+func startTerminal(cmd *exec.Cmd, dst io.Writer) (*terminal, error) {
+	return nil, fmt.Errorf("running a command in a terminal is not supported on %s", runtime.GOOS)
+}
+
+func (t *terminal) resize() {}
+
+func (t *terminal) relayStdin() (restore func()) {
+	return func() {}
+}
+
+func (t *terminal) wait() {}
+
+// isTerminal reports whether f is a terminal, which is never relayed on this platform, so stdin is passed as is.
+func isTerminal(f *os.File) bool {
+	return false
+}
@@ -0,0 +1,142 @@
+//go:build unix
+
+package capture
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"syscall"
+
+	"github.com/creack/pty"
+	"golang.org/x/sys/unix"
+)
+
+// eot is the character a terminal reads as the end of input, Ctrl-D.
+const eot = 0x04
+
+// terminal is the pseudo-terminal a command runs under, see Options.TTY.
+type terminal struct {
+	ptmx *os.File
+	done chan struct{}
+}
+
+// startTerminal starts the command with a new pseudo-terminal as its stdin, stdout, and stderr, and copies everything
+// it prints to dst.
+//   - the terminal starts with the size of the terminal on stdin, if any
+//   - CRLF line endings added by the terminal are converted back to LF
+func startTerminal(cmd *exec.Cmd, dst io.Writer) (*terminal, error) {
+	size, err := pty.GetsizeFull(os.Stdin)
+	if err != nil {
+		size = nil
+	}
+
+	// the command leads a new session with the terminal as its controlling terminal, which is also a new process group
+	ptmx, err := pty.StartWithAttrs(cmd, size, &syscall.SysProcAttr{Setsid: true, Setctty: true})
+	if err != nil {
+		return nil, fmt.Errorf("failed to start command in a terminal: %w", err)
+	}
+
+	t := &terminal{ptmx: ptmx, done: make(chan struct{})}
+	go func() {
+		defer close(t.done)
+		_, err := io.Copy(&crlfWriter{w: dst}, ptmx)
+		// reads fail with EIO once the command and its children closed the terminal
+		if err != nil && !errors.Is(err, syscall.EIO) {
+			fmt.Fprintln(os.Stderr, "Failed to read from terminal:", err)
+		}
+	}()
+	return t, nil
+}
+
+// resize sets the size of the terminal to the size of the terminal on stdin, which signals SIGWINCH to the command.
+func (t *terminal) resize() {
+	_ = pty.InheritSize(os.Stdin, t.ptmx)
+}
+
+// relayStdin copies stdin to the terminal, so the command reads it like it would interactively, and returns a function
+// restoring the terminal on stdin, if any.
+//   - a terminal on stdin is put in raw input mode, so keys such as Ctrl-C and Ctrl-D reach the command as typed
+//   - otherwise, the end of stdin is sent as Ctrl-D, as the terminal itself never ends
+func (t *terminal) relayStdin() (restore func()) {
+	restore = func() {}
+	if isTerminal(os.Stdin) {
+		r, err := rawInput(os.Stdin)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Failed to put stdin in raw mode:", err)
+		} else {
+			restore = r
+		}
+	}
+
+	go func() {
+		if _, err := io.Copy(t.ptmx, os.Stdin); err == nil {
+			_, _ = t.ptmx.Write([]byte{eot})
+		}
+	}()
+	return restore
+}
+
+// wait blocks until everything printed to the terminal has been copied, then closes it.
+func (t *terminal) wait() {
+	<-t.done
+	t.ptmx.Close()
+}
+
+// isTerminal reports whether f is a terminal.
+func isTerminal(f *os.File) bool {
+	_, err := unix.IoctlGetTermios(int(f.Fd()), ioctlReadTermios)
+	return err == nil
+}
+
+// rawInput puts the terminal f in raw input mode, without echo, line editing, or signals, and returns a function
+// restoring it.
+//   - output processing is kept, so output printed meanwhile still starts each line at the left margin
+func rawInput(f *os.File) (restore func(), err error) {
+	fd := int(f.Fd())
+	termios, err := unix.IoctlGetTermios(fd, ioctlReadTermios)
+	if err != nil {
+		return nil, err
+	}
+	saved := *termios
+
+	termios.Iflag &^= unix.IGNBRK | unix.BRKINT | unix.PARMRK | unix.ISTRIP | unix.INLCR | unix.IGNCR | unix.ICRNL | unix.IXON
+	termios.Lflag &^= unix.ECHO | unix.ECHONL | unix.ICANON | unix.ISIG | unix.IEXTEN
+	termios.Cc[unix.VMIN] = 1
+	termios.Cc[unix.VTIME] = 0
+	if err := unix.IoctlSetTermios(fd, ioctlWriteTermios, termios); err != nil {
+		return nil, err
+	}
+
+	return func() {
+		_ = unix.IoctlSetTermios(fd, ioctlWriteTermios, &saved)
+	}, nil
+}
+
+// crlfWriter is an io.Writer converting CRLF line endings to LF, so lines from a terminal do not end with CR.
+type crlfWriter struct {
+	w io.Writer
+	// cr is set when the last write ended with a CR, which is held back until the next write shows whether LF follows
+	cr bool
+}
+
+func (c *crlfWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	buf := make([]byte, 0, len(p)+1)
+	if c.cr && (len(p) == 0 || p[0] != '\n') {
+		buf = append(buf, '\r')
+	}
+	c.cr = len(p) > 0 && p[len(p)-1] == '\r'
+	if c.cr {
+		p = p[:len(p)-1]
+	}
+	buf = append(buf, bytes.ReplaceAll(p, []byte("\r\n"), []byte("\n"))...)
+
+	if _, err := c.w.Write(buf); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
@@ -0,0 +1,156 @@
+package identity
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"strings"
+
+	"google.golang.org/api/idtoken"
+)
+
+// Identity resolves the user performing a lease operation.
+type Identity interface {
+	// User returns the identity to stamp on lease operations.
+	User(ctx context.Context) (string, error)
+}
+
+// Config holds the settings needed to build any of the supported identity providers.
+type Config struct {
+	Kind string
+
+	// StaticUser is the user returned by the static provider.
+	StaticUser string
+
+	// OIDCTokenFile is a file containing a Google-signed OIDC ID token.
+	OIDCTokenFile string
+	// OIDCAudience is the audience the OIDC token must be issued for.
+	OIDCAudience string
+}
+
+// New creates the identity provider selected by cfg.Kind.
+//   - a static user is only accepted with the static provider, so it is never trusted by accident
+//   - the oidc provider requires an audience, as a token issued to any other client would be accepted without one
+func New(cfg Config) (Identity, error) {
+	if cfg.StaticUser != "" && cfg.Kind != "static" {
+		return nil, fmt.Errorf("a user can only be set with the static identity provider, not %q", cfg.Kind)
+	}
+
+	switch cfg.Kind {
+	case "os":
+		return OSUser{}, nil
+	case "gcloud":
+		return GCloud{}, nil
+	case "oidc":
+		if cfg.OIDCTokenFile == "" {
+			return nil, errors.New("oidc identity requires a token file")
+		}
+		if cfg.OIDCAudience == "" {
+			return nil, errors.New("oidc identity requires an audience")
+		}
+		return OIDC{TokenFile: cfg.OIDCTokenFile, Audience: cfg.OIDCAudience}, nil
+	case "static":
+		if cfg.StaticUser == "" {
+			return nil, errors.New("static identity requires a user")
+		}
+		return Static(cfg.StaticUser), nil
+	default:
+		return nil, fmt.Errorf("unknown identity provider %q", cfg.Kind)
+	}
+}
+
+// Verified reports whether the user returned by id was authenticated by Google, rather than asserted locally, so it can
+// be trusted for decisions such as approving a lease.
+//   - only OIDC is verified, the gcloud account is a local config value anyone can set
+func Verified(id Identity) bool {
+	switch id.(type) {
+	case OIDC:
+		return true
+	default:
+		return false
+	}
+}
+
+// Static is an Identity that always returns the same, unverified, user.
+type Static string
+
+// User returns the static user.
+func (s Static) User(_ context.Context) (string, error) {
+	return string(s), nil
+}
+
+// OSUser is an Identity that returns the operating system user running the process, which is not verified.
+type OSUser struct{}
+
+// User returns the current OS username, qualified with the hostname.
+func (OSUser) User(_ context.Context) (string, error) {
+	u, err := user.Current()
+	if err != nil {
+		return "", fmt.Errorf("failed to get os user: %w", err)
+	}
+
+	host, err := os.Hostname()
+	if err != nil {
+		return u.Username, nil
+	}
+
+	return u.Username + "@" + host, nil
+}
+
+// GCloud is an Identity that returns the active gcloud CLI account, which is not verified.
+type GCloud struct{}
+
+// User returns the account gcloud is currently authenticated as.
+func (GCloud) User(ctx context.Context) (string, error) {
+	out, err := exec.CommandContext(ctx, "gcloud", "config", "get-value", "account").Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to get gcloud account: %w", err)
+	}
+
+	account := strings.TrimSpace(string(out))
+	if account == "" || account == "(unset)" {
+		return "", errors.New("no active gcloud account")
+	}
+
+	return account, nil
+}
+
+// OIDC is an Identity that returns the email of a validated Google-signed OIDC ID token.
+type OIDC struct {
+	TokenFile string
+	Audience  string
+}
+
+// User validates the token in TokenFile and returns its email, or subject if no email is present.
+//   - the token must be issued for Audience, which must be set
+func (o OIDC) User(ctx context.Context) (string, error) {
+	// an empty audience would skip the audience check of idtoken.Validate
+	if o.Audience == "" {
+		return "", errors.New("oidc identity requires an audience")
+	}
+
+	token, err := os.ReadFile(o.TokenFile)
+	if err != nil {
+		return "", fmt.Errorf("failed to read oidc token: %w", err)
+	}
+
+	payload, err := idtoken.Validate(ctx, strings.TrimSpace(string(token)), o.Audience)
+	if err != nil {
+		return "", fmt.Errorf("failed to validate oidc token: %w", err)
+	}
+	if payload.Audience != o.Audience {
+		return "", fmt.Errorf("oidc token was issued for %q, not %q", payload.Audience, o.Audience)
+	}
+
+	if email, ok := payload.Claims["email"].(string); ok && email != "" {
+		if verified, ok := payload.Claims["email_verified"].(bool); ok && !verified {
+			return "", fmt.Errorf("oidc token email %q is not verified", email)
+		}
+		return email, nil
+	}
+
+	return payload.Subject, nil
+}
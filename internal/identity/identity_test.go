@@ -0,0 +1,96 @@
+package identity
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     Config
+		want    Identity
+		wantErr bool
+	}{
+		{name: "os", cfg: Config{Kind: "os"}, want: OSUser{}},
+		{name: "gcloud", cfg: Config{Kind: "gcloud"}, want: GCloud{}},
+		{name: "static", cfg: Config{Kind: "static", StaticUser: "alice"}, want: Static("alice")},
+		{name: "oidc", cfg: Config{Kind: "oidc", OIDCTokenFile: "token", OIDCAudience: "aud"}, want: OIDC{TokenFile: "token", Audience: "aud"}},
+		{name: "static without user", cfg: Config{Kind: "static"}, wantErr: true},
+		{name: "user without static", cfg: Config{Kind: "os", StaticUser: "alice"}, wantErr: true},
+		{name: "oidc without token file", cfg: Config{Kind: "oidc", OIDCAudience: "aud"}, wantErr: true},
+		{name: "oidc without audience", cfg: Config{Kind: "oidc", OIDCTokenFile: "token"}, wantErr: true},
+		{name: "unknown", cfg: Config{Kind: "ldap"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := New(tt.cfg)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("New() = %v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("New() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerified(t *testing.T) {
+	tests := []struct {
+		id   Identity
+		want bool
+	}{
+		{OSUser{}, false},
+		{Static("alice"), false},
+		{GCloud{}, false},
+		{OIDC{TokenFile: "token", Audience: "aud"}, true},
+	}
+	for _, tt := range tests {
+		if got := Verified(tt.id); got != tt.want {
+			t.Errorf("Verified(%#v) = %v, want %v", tt.id, got, tt.want)
+		}
+	}
+}
+
+func TestOIDCRejects(t *testing.T) {
+	dir := t.TempDir()
+	tokenFile := filepath.Join(dir, "token")
+	if err := os.WriteFile(tokenFile, []byte("not-a-jwt\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		id   OIDC
+	}{
+		{"no audience", OIDC{TokenFile: tokenFile}},
+		{"missing token file", OIDC{TokenFile: filepath.Join(dir, "missing"), Audience: "aud"}},
+		{"malformed token", OIDC{TokenFile: tokenFile, Audience: "aud"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if user, err := tt.id.User(context.Background()); err == nil {
+				t.Errorf("User() = %q, want an error", user)
+			}
+		})
+	}
+}
+
+func TestStatic(t *testing.T) {
+	user, err := Static("alice").User(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user != "alice" {
+		t.Errorf("User() = %q, want alice", user)
+	}
+}
@@ -0,0 +1,97 @@
+package leaseconfig
+
+import (
+	"regexp"
+	"time"
+
+	"github.com/carsonoid/talk-leased-logs/internal/capture"
+	"github.com/carsonoid/talk-leased-logs/pkg/lease"
+)
+
+// Capture holds the settings of capturing the output of a command, the flags of the capture command of the CLI and
+// the default section of the agent config file.
+type Capture struct {
+	// Naming is how settings are named in errors, set by each binary
+	Naming Naming `kong:"-" ini:"-"`
+
+	StructuredFD       bool          `help:"Pass fd 3 to the command for newline-delimited JSON logs, shipped separately from stdout and stderr. Unix only." name:"structured-fd" default:"true" negatable:"" ini:"structured_fd"`
+	ShutdownWindow     time.Duration `help:"Always keep the unshipped output of this last window, and ship it if the command exits abnormally. Disabled when zero." ini:"shutdown_window"`
+	ShutdownBufferSize int           `help:"The maximum number of entries kept for --shutdown-window." default:"10000" ini:"shutdown_buffer_size"`
+	JSONLines          bool          `help:"Parse stdout and stderr lines that are JSON records, such as those of zap, zerolog, or bunyan, into structured entries with their level, message, and time." name:"json-lines" ini:"json_lines"`
+	// SeverityPatterns are read from the [severity_patterns] section by the agent, most severe first
+	SeverityPatterns []string      `help:"Classify plain text stdout and stderr lines matching a regular expression at a severity, such as ERROR=^E\\d{4}. The first matching pattern wins." name:"severity-pattern" sep:"none" placeholder:"SEVERITY=REGEX" ini:"-"`
+	DetectSeverity   bool          `help:"Classify plain text stdout and stderr lines by common level conventions, such as ERROR: prefixes, level=warn, and glog headers, after any --severity-pattern." ini:"detect_severity"`
+	Multiline        bool          `help:"Group the continuation lines of stdout and stderr records, such as Java, Python, and Go stack traces, into a single entry." ini:"multiline"`
+	MultilineStart   string        `help:"Begin a new record with every line matching this regular expression, and group all other lines into it. Implies --multiline." placeholder:"REGEX" ini:"multiline_start"`
+	MultilineWait    time.Duration `help:"Ship a grouped record once no line followed it for this long." default:"1s" ini:"multiline_wait"`
+	MaxLineKiB       int           `help:"Ship at most this many KiB of text for each line of stdout, stderr, fd 3, and the severity fds, as Cloud Logging rejects entries over 256KiB. Lines are always cut at 1MiB when unlimited." name:"max-line-kib" default:"200" ini:"max_line_kib"`
+	LongLines        string        `help:"What happens to lines over --max-line-kib: truncate them, labeled truncated=true, or split them into several entries, labeled chunk=1/N." enum:"truncate,split" default:"truncate" ini:"long_lines"`
+	Timestamps       bool          `help:"Prepend the time to every printed stdout and stderr line, and stamp shipped entries with it." ini:"timestamps"`
+	StreamTag        bool          `help:"Prepend stdout or stderr to every printed line, and label shipped entries with it as stream." ini:"stream_tag"`
+	Prefix           string        `help:"Prepend this text to every printed stdout and stderr line, such as the name of the service, and label shipped entries with it as prefix." ini:"prefix"`
+	TTY              bool          `help:"Run the command under a pseudo-terminal, so it buffers, colors, and prompts like it does interactively. Its stdout and stderr are merged and shipped as stdout." name:"tty" ini:"tty"`
+	SeverityFDs      bool          `help:"Pass one fd and, on Unix, one named pipe per severity to the command, advertised as LEASED_LOGS_<SEVERITY>_FD and LEASED_LOGS_<SEVERITY>_FIFO, with WARN as an alias of WARNING, for leveled logs from shell scripts." name:"severity-fds" ini:"severity_fds"`
+	Restart          string        `help:"Restart the command once it exits: no, always, or on-failure, optionally followed by the maximum number of restarts, such as on-failure:5. Restarts back off exponentially up to a minute." default:"no" placeholder:"POLICY" ini:"restart"`
+}
+
+// name returns the name of a setting in errors.
+func (c *Capture) name(field string) string {
+	return settingName(c.Naming, c, field)
+}
+
+// Options converts the settings to the lease manager options shaping captured output.
+func (c *Capture) Options() ([]lease.Option, error) {
+	var opts []lease.Option
+	if c.ShutdownWindow > 0 {
+		opts = append(opts, lease.WithShutdownBuffer(c.ShutdownBufferSize, c.ShutdownWindow))
+	}
+	if c.JSONLines {
+		opts = append(opts, lease.WithJSONLines())
+	}
+	for _, s := range c.SeverityPatterns {
+		p, err := lease.ParseSeverityPattern(s)
+		if err != nil {
+			return nil, &UsageError{Err: err}
+		}
+		opts = append(opts, lease.WithSeverityPatterns(p))
+	}
+	if c.DetectSeverity {
+		opts = append(opts, lease.WithSeverityPatterns(lease.DefaultSeverityPatterns...))
+	}
+	if c.Timestamps || c.StreamTag || c.Prefix != "" {
+		opts = append(opts, lease.WithDecoration(lease.Decoration{Timestamps: c.Timestamps, Stream: c.StreamTag, Prefix: c.Prefix}))
+	}
+	if c.Multiline || c.MultilineStart != "" {
+		var start *regexp.Regexp
+		if c.MultilineStart != "" {
+			var err error
+			if start, err = regexp.Compile(c.MultilineStart); err != nil {
+				return nil, usageErrorf("invalid %s: %w", c.name("MultilineStart"), err)
+			}
+		}
+		opts = append(opts, lease.WithMultiline(start, c.MultilineWait))
+	}
+	if c.MaxLineKiB > 0 {
+		policy, err := lease.ParseLongLinePolicy(c.LongLines)
+		if err != nil {
+			return nil, &UsageError{Err: err}
+		}
+		opts = append(opts, lease.WithMaxLineSize(c.MaxLineKiB<<10, policy))
+	}
+	return opts, nil
+}
+
+// CaptureOptions returns how the output of the command is captured, with traces attributed to projectID.
+func (c *Capture) CaptureOptions(projectID string) (capture.Options, error) {
+	restart, err := capture.ParseRestartPolicy(c.Restart)
+	if err != nil {
+		return capture.Options{}, &UsageError{Err: err}
+	}
+	return capture.Options{
+		StructuredFD: c.StructuredFD,
+		SeverityFDs:  c.SeverityFDs,
+		TTY:          c.TTY,
+		ProjectID:    projectID,
+		Restart:      restart,
+	}, nil
+}
@@ -0,0 +1,181 @@
+// Package leaseconfig maps the settings of lease managers to lease options, shared by the leased-logs CLI and the
+// leasedlogd agent so both expose the same features.
+//
+// The settings are plain structs tagged for both binaries: kong tags make them the flags of the CLI, ini tags the keys
+// of the agent config file, and section tags the ini sections holding map settings. Defaults come from the default
+// tags for both, see Defaults.
+package leaseconfig
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Naming is how settings are named in errors, as the flags of the CLI or the keys of the agent config file.
+type Naming int
+
+const (
+	// Flags names settings by their kong flag, such as --lease-token-key.
+	Flags Naming = iota
+	// Keys names settings by their ini key or section, such as lease_token_key.
+	Keys
+)
+
+// settingName returns the name of a field of the settings struct v, as a flag or config key.
+func settingName(n Naming, v any, field string) string {
+	f, ok := reflect.TypeOf(v).Elem().FieldByName(field)
+	if !ok {
+		return field
+	}
+	if n == Keys {
+		if s := f.Tag.Get("section"); s != "" {
+			return "[" + s + "]"
+		}
+		return f.Tag.Get("ini")
+	}
+	if name := f.Tag.Get("name"); name != "" {
+		return "--" + name
+	}
+	return "--" + kebab(f.Name)
+}
+
+// kebab converts a Go field name to the flag name kong derives from it, such as SpoolSegmentMB to spool-segment-mb.
+func kebab(s string) string {
+	r := []rune(s)
+	var b strings.Builder
+	for i, c := range r {
+		if i > 0 && unicode.IsUpper(c) && (unicode.IsLower(r[i-1]) || i+1 < len(r) && unicode.IsLower(r[i+1])) {
+			b.WriteByte('-')
+		}
+		b.WriteRune(unicode.ToLower(c))
+	}
+	return b.String()
+}
+
+// UsageError is an error in the settings themselves, such as an invalid regular expression, rather than in the
+// environment they are used in.
+type UsageError struct {
+	Err error
+}
+
+func (e *UsageError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *UsageError) Unwrap() error {
+	return e.Err
+}
+
+// usageErrorf returns a UsageError formatted like fmt.Errorf.
+func usageErrorf(format string, args ...any) error {
+	return &UsageError{Err: fmt.Errorf(format, args...)}
+}
+
+// TokenError is a lease token that failed verification.
+type TokenError struct {
+	Err error
+}
+
+func (e *TokenError) Error() string {
+	return "failed to verify lease token: " + e.Err.Error()
+}
+
+func (e *TokenError) Unwrap() error {
+	return e.Err
+}
+
+// Defaults sets the fields of the settings struct v, such as a *Manager, to the values of their default tags, so the
+// agent starts from the same defaults kong applies to the flags of the CLI.
+//   - strings, bools, integers, durations, and comma-separated string slices are supported
+//   - panics on a default tag that can not be parsed, as kong would refuse it too
+func Defaults(v any) {
+	val := reflect.ValueOf(v).Elem()
+	t := val.Type()
+	for i := range t.NumField() {
+		def, ok := t.Field(i).Tag.Lookup("default")
+		if !ok {
+			continue
+		}
+		if err := setDefault(val.Field(i), def); err != nil {
+			panic(fmt.Sprintf("invalid default of %s: %v", t.Field(i).Name, err))
+		}
+	}
+}
+
+// setDefault parses def into the field.
+func setDefault(field reflect.Value, def string) error {
+	if field.Type() == reflect.TypeOf(time.Duration(0)) {
+		d, err := time.ParseDuration(def)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(d))
+		return nil
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(def)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(def)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(def, 10, 64)
+		if err != nil {
+			return err
+		}
+		field.SetInt(n)
+	case reflect.Slice:
+		if field.Type().Elem().Kind() != reflect.String {
+			return errors.New("only string slices are supported")
+		}
+		field.Set(reflect.ValueOf(strings.Split(def, ",")))
+	default:
+		return fmt.Errorf("unsupported kind %s", field.Kind())
+	}
+	return nil
+}
+
+// SetSections sets the map settings of the settings struct v, such as a *Manager, from the ini sections named by
+// their section tags, so the agent loads every section without listing them.
+//   - section returns the keys and values of a section, and false for a missing one, which leaves the setting as is
+//   - map[string]string and map[string]int settings are supported
+func SetSections(v any, section func(name string) (map[string]string, bool)) error {
+	val := reflect.ValueOf(v).Elem()
+	t := val.Type()
+	for i := range t.NumField() {
+		name := t.Field(i).Tag.Get("section")
+		if name == "" {
+			continue
+		}
+		kv, ok := section(name)
+		if !ok {
+			continue
+		}
+
+		switch m := val.Field(i).Addr().Interface().(type) {
+		case *map[string]string:
+			*m = kv
+		case *map[string]int:
+			*m = make(map[string]int, len(kv))
+			for k, v := range kv {
+				n, err := strconv.Atoi(v)
+				if err != nil {
+					return usageErrorf("invalid %s in [%s], must be an integer: %w", k, name, err)
+				}
+				(*m)[k] = n
+			}
+		default:
+			panic(fmt.Sprintf("unsupported type %s of section [%s]", t.Field(i).Type, name))
+		}
+	}
+	return nil
+}
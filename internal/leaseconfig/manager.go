@@ -0,0 +1,610 @@
+package leaseconfig
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"cloud.google.com/go/logging"
+	"google.golang.org/api/option"
+
+	"github.com/carsonoid/talk-leased-logs/contrib/leasecompress"
+	"github.com/carsonoid/talk-leased-logs/contrib/leaseenrich"
+	"github.com/carsonoid/talk-leased-logs/contrib/leaseparquet"
+	"github.com/carsonoid/talk-leased-logs/contrib/leaseprom"
+	"github.com/carsonoid/talk-leased-logs/contrib/leasepubsub"
+	"github.com/carsonoid/talk-leased-logs/contrib/leaseschema"
+	"github.com/carsonoid/talk-leased-logs/contrib/leasewasm"
+	"github.com/carsonoid/talk-leased-logs/pkg/lease"
+	"github.com/carsonoid/talk-leased-logs/pkg/spool"
+)
+
+// Manager holds the settings of a lease manager shipping logs, the global flags of the CLI and the default section of
+// the agent config file.
+type Manager struct {
+	// Naming is how settings are named in errors, set by each binary
+	Naming Naming `kong:"-" ini:"-"`
+
+	Labels map[string]string `help:"Labels describing this instance, leases with tags only apply when all tags match." env:"LEASED_LOGS_LABELS,LABELS" ini:"-" section:"labels"`
+
+	LogName          string            `help:"A Go template for the Cloud Logging log name, with .LeaseID, .Service and .Env (the service and env labels), and .Labels." default:"lease-{{.LeaseID}}" placeholder:"TEMPLATE" ini:"log_name"`
+	SeverityLogNames map[string]string `help:"Log name templates for entries at or above a severity, overriding --log-name. The highest severity an entry reaches wins." name:"severity-log-name" placeholder:"SEVERITY=TEMPLATE" ini:"-" section:"severity_log_names"`
+
+	LeasePolicy string `help:"How several --lease-id values combine, shipping while any or only while all of them are active." enum:"any,all" default:"any" ini:"lease_policy"`
+
+	WatchFailurePolicy string        `help:"What happens once a lease could not be watched for --watch-failure-after, such as during a Firestore outage: hold keeps the last state until the lease expires, open ships everything and closed stops shipping until the watch recovers." enum:"hold,open,closed" default:"hold" ini:"watch_failure_policy"`
+	WatchFailureAfter  time.Duration `help:"How long the last lease state is held while the lease cannot be watched, before --watch-failure-policy applies." default:"5m" ini:"watch_failure_after"`
+
+	LeaseStateSocket string `help:"Broadcast the watched leases on this Unix socket, for co-located processes to follow with --lease-state-from instead of each watching Firestore." placeholder:"PATH" ini:"lease_state_socket"`
+	LeaseStateFrom   string `help:"Follow the leases broadcast on this Unix socket by a co-located process, such as serve with --lease-state-socket, instead of watching Firestore." placeholder:"PATH" ini:"lease_state_from"`
+
+	ParentLeases []string `help:"Ancestor leases, such as a team or global lease, that enable shipping whenever they are active." name:"parent-lease" placeholder:"ID" ini:"parent_leases"`
+
+	RequireApproval bool `help:"Ignore leases that were not approved by a second user with lease approve." ini:"require_approval"`
+
+	LeaseToken     string `help:"A signed token from lease token, pre-authorizing shipping for its validity window without reaching Firestore." ini:"lease_token"`
+	LeaseTokenFile string `help:"A file containing a signed token from lease token, read instead of --lease-token." type:"existingfile" ini:"lease_token_file"`
+	LeaseTokenKey  string `help:"The ed25519 public key PEM file lease tokens are verified with." type:"existingfile" ini:"lease_token_key"`
+
+	StartupWindow time.Duration `help:"Ship everything, at every level, for this long after starting regardless of the lease." ini:"startup_window"`
+
+	AlwaysShipSeverity string `help:"Entries at or above this severity ship regardless of the lease." enum:"DEBUG,INFO,NOTICE,WARNING,ERROR,CRITICAL,ALERT,EMERGENCY" default:"ERROR" ini:"always_ship_severity"`
+
+	SampleRates  map[string]string `help:"Ship a random fraction of the entries at a severity even without a lease, such as INFO=0.01, for a statistical baseline." name:"sample-rate" placeholder:"SEVERITY=RATE" ini:"-" section:"sample_rates"`
+	SampleFirst  int               `help:"Ship the first N entries of every distinct message per --sample-window even without a lease." ini:"sample_first"`
+	SampleWindow time.Duration     `help:"The window --sample-first counts messages in." default:"1m" ini:"sample_window"`
+
+	GracePeriod time.Duration `help:"Keep shipping for this long after a lease expires, so output is not cut off mid-stack-trace." ini:"grace_period"`
+
+	HeartbeatInterval time.Duration `help:"Ship a heartbeat entry at this interval while the lease is active. Disabled when zero." ini:"heartbeat_interval"`
+
+	QueueSize    int    `help:"Queue up to this many entries between logging and shipping, so a slow sink does not stall the captured command. Ships synchronously when zero." default:"10000" ini:"queue_size"`
+	Backpressure string `help:"What happens once the queue is full: block the writer, or drop the oldest or newest entry." enum:"block,drop-oldest,drop-newest" default:"block" ini:"backpressure"`
+
+	DedupWindow time.Duration `help:"Collapse identical consecutive shipped messages within this window into one entry labeled repeat_count, for retry loops. Disabled when zero." ini:"dedup_window"`
+
+	RateLimitEntries  int    `help:"Cap the entries shipped per second, so a runaway loop under a lease cannot blow the logging budget. Disabled when zero." ini:"rate_limit_entries"`
+	RateLimitKiB      int    `help:"Cap the KiB shipped per second. Disabled when zero." name:"rate-limit-kib" ini:"rate_limit_kib"`
+	RateLimitOverflow string `help:"What happens to entries over --rate-limit-entries or --rate-limit-kib: drop them, sample one in 100, or buffer them and ship them as the limit allows." enum:"drop,sample,buffer" default:"drop" ini:"rate_limit_overflow"`
+
+	SuppressionSummary time.Duration `help:"Ship a summary of the entries suppressed without a lease at this interval, such as \"suppressed 12,304 entries in the last 5m\". Disabled when zero." ini:"suppression_summary"`
+
+	CorrelationID string `help:"The correlation ID attached to every entry shipped by this session, generated when empty." ini:"correlation_id"`
+
+	ShipOnly bool `help:"While a lease is active, do not also print output that is shipped, for containers whose stdout is already collected." ini:"ship_only"`
+
+	StdoutCollected   string `help:"Whether stdout is already collected, such as by a Kubernetes log agent, so only entries below --collected-severity are shipped. auto detects Kubernetes, Cloud Run, App Engine, and Cloud Functions." enum:"no,yes,auto" default:"no" ini:"stdout_collected"`
+	CollectedSeverity string `help:"Entries at or above this severity are left to the stdout collector when stdout is collected." enum:"DEBUG,INFO,NOTICE,WARNING,ERROR,CRITICAL,ALERT,EMERGENCY" default:"INFO" ini:"collected_severity"`
+
+	SlogSource bool `help:"Add the source file, line, and function of slog records to their output, and to the source location of shipped entries." ini:"slog_source"`
+
+	CostCenter  string            `help:"The cost_center label for shipped entries when the lease owner has no --cost-centers mapping, so ingestion spend can be attributed." ini:"cost_center"`
+	CostCenters map[string]string `help:"The cost_center label for entries shipped under a lease, by lease owner. Shipped entries also get a size_bucket label." placeholder:"OWNER=CENTER" ini:"-" section:"cost_centers"`
+
+	CloudLoggingPolicy string            `help:"When entries are shipped to Cloud Logging." enum:"leased,always" default:"leased" ini:"cloud_logging_policy"`
+	FileSinks          map[string]string `help:"Files to append entries to as JSON lines, with a policy deciding when each receives entries." name:"file-sink" placeholder:"PATH=leased|always" ini:"-" section:"file_sinks"`
+
+	CloudLoggingWorkers  int            `help:"The number of concurrent Cloud Logging write requests. Uses the client default when zero." ini:"cloud_logging_workers"`
+	CloudLoggingConnPool int            `help:"The number of gRPC connections to Cloud Logging. Uses the client default when zero." ini:"cloud_logging_conn_pool"`
+	CloudLoggingDelay    time.Duration  `help:"The longest Cloud Logging buffers entries before sending a batch, lower for low-volume services that need entries promptly. Uses the client default when zero." ini:"cloud_logging_delay"`
+	CloudLoggingBatch    int            `help:"The number of entries that triggers sending a Cloud Logging batch early. Uses the client default when zero." ini:"cloud_logging_batch"`
+	CloudLoggingBufferMB int            `help:"The MiB of entries Cloud Logging buffers before dropping them, higher for bursty capture output. Uses the client default when zero." name:"cloud-logging-buffer-mb" ini:"cloud_logging_buffer_mb"`
+	SinkWorkers          map[string]int `help:"Ship to a sink from a pool of workers, by sink name (cloud-logging or a file sink path)." placeholder:"SINK=N" ini:"-" section:"sink_workers"`
+	SinkMaxInFlight      map[string]int `help:"The maximum entries queued or in flight for a sink with workers, by sink name." placeholder:"SINK=N" ini:"-" section:"sink_max_in_flight"`
+	SinkBandwidth        map[string]int `help:"Cap the KiB per second shipped to a sink, by sink name, so leased bursts do not saturate constrained links. Writes wait for bandwidth unless the sink has workers to queue them." placeholder:"SINK=KIB" ini:"-" section:"sink_bandwidth"`
+
+	SinkPlugins      map[string]string `help:"Exec plugins to ship entries to, with a policy deciding when each receives entries." name:"sink-plugin" placeholder:"PATH=leased|always" ini:"-" section:"sink_plugins"`
+	ProcessorPlugins []string          `help:"Exec plugins that modify or drop entries before they are shipped, in order." name:"processor-plugin" placeholder:"PATH" ini:"processor_plugins"`
+	WASMFilters      []string          `help:"WebAssembly modules that modify or drop entries before they are shipped, in order." name:"wasm-filter" placeholder:"PATH" type:"existingfile" ini:"wasm_filters"`
+
+	ArchiveURL   string        `help:"Archive the raw stdout and stderr bytes captured while leased to this gs://BUCKET/PREFIX or local directory, gzipped and chunked by time." name:"archive-url" placeholder:"gs://BUCKET/PREFIX|DIR" ini:"archive_url"`
+	ArchiveChunk time.Duration `help:"How much captured output each --archive-url object holds." default:"5m" ini:"archive_chunk"`
+
+	ParquetURL string `help:"Write leased entries as hourly Parquet files to this gs://BUCKET/PREFIX or local directory, for analytics." name:"parquet-url" placeholder:"gs://BUCKET/PREFIX|DIR" ini:"parquet_url"`
+
+	Webhooks      []string `help:"URLs to POST a JSON notification to when a lease starts, an active lease is extended, and a lease stops." name:"webhook" placeholder:"URL" ini:"webhooks"`
+	WebhookSecret string   `help:"The secret --webhook bodies are signed with, as an HMAC-SHA256 in the X-Leased-Logs-Signature header." ini:"webhook_secret"`
+	EventsTopic   string   `help:"A Pub/Sub topic, by ID or full name, to publish an event to for every recorded lease change and every lease transition." placeholder:"TOPIC" ini:"events_topic"`
+	SlackWebhook  string   `help:"A Slack incoming webhook URL to post every recorded lease change and every lease transition to." placeholder:"URL" ini:"slack_webhook"`
+
+	RemoteWriteURL      string            `help:"A Prometheus remote-write endpoint to push lease state and shipping counters to, for fleet dashboards where instances cannot be scraped." placeholder:"URL" ini:"remote_write_url"`
+	RemoteWriteInterval time.Duration     `help:"How often to push to --remote-write-url." default:"30s" ini:"remote_write_interval"`
+	RemoteWriteHeaders  map[string]string `help:"Headers added to --remote-write-url requests, such as Authorization." name:"remote-write-header" placeholder:"NAME=VALUE" ini:"-" section:"remote_write_headers"`
+
+	DiagLevel string `help:"The lowest level of the diagnostics of the lease manager itself, such as lease transitions and sink failures." enum:"debug,info,warn,error" default:"info" ini:"diag_level"`
+	DiagFile  string `help:"Append the diagnostics of the lease manager to this file instead of stderr." placeholder:"PATH" ini:"diag_file"`
+
+	MetricsAddr string `help:"Serve Prometheus metrics of the lease manager at /metrics on this address, such as :9090." placeholder:"ADDR" ini:"metrics_addr"`
+
+	HashChain bool `help:"Link leased entries into a SHA-256 hash chain per lease session, recording the head in the lease status, for tamper-evidence." ini:"hash_chain"`
+
+	Quarantine string `help:"Append entries a sink rejects, such as for being too large, to this file with the reason instead of dropping them." ini:"quarantine"`
+
+	Schemas          map[string]string `help:"JSON Schema files to validate structured payloads against, by log name." name:"schema" placeholder:"LOG=PATH" ini:"-" section:"schemas"`
+	SchemaQuarantine string            `help:"Drop entries that fail schema validation and append them to this file instead of shipping them." ini:"schema_quarantine"`
+
+	ReplayBufferSize        int           `help:"How many recent unshipped entries to keep for shipping when a lease becomes active. Disabled when zero." ini:"replay_buffer_size"`
+	ReplayBufferAge         time.Duration `help:"The maximum age of buffered entries shipped when a lease becomes active." default:"10m" ini:"replay_buffer_age"`
+	ReplayBufferCompression string        `help:"Compress the replay buffer in memory, bounding it by --replay-buffer-mb instead of --replay-buffer-size, so it covers a longer window." enum:"none,snappy,lz4" default:"none" ini:"replay_buffer_compression"`
+	ReplayBufferMB          int           `help:"The memory budget of a compressed replay buffer in MiB." default:"16" ini:"replay_buffer_mb"`
+
+	SpoolDir        string        `help:"A directory to spool unshipped entries to, so they can be replayed when a lease is granted." ini:"spool_dir"`
+	SpoolSegmentMB  int64         `help:"Rotate spool segments once they reach this size in MiB." default:"8" ini:"spool_segment_mb"`
+	SpoolSegmentAge time.Duration `help:"Rotate spool segments once they reach this age." default:"10m" ini:"spool_segment_age"`
+	SpoolMaxMB      int64         `help:"Remove the oldest spool segments once the spool exceeds this size in MiB." default:"512" ini:"spool_max_mb"`
+	SpoolRetention  time.Duration `help:"Remove spool segments older than this." default:"24h" ini:"spool_retention"`
+
+	GeoIPDB        string `help:"A MaxMind GeoIP2 or GeoLite2 City database used to add a geo field for IP addresses." name:"geoip-db" type:"existingfile" ini:"geoip_db"`
+	GeoIPField     string `help:"The field containing IP addresses to enrich with --geoip-db." name:"geoip-field" default:"ip" ini:"geoip_field"`
+	UserAgentField string `help:"A field containing user agents to enrich with a device field." ini:"user_agent_field"`
+
+	HashFields       []string `help:"Fields to replace with a keyed hash before shipping." ini:"hash_fields"`
+	HashKey          string   `help:"The secret key for --hash-fields, required with it. Use the same key on every instance, so equal values hash equally." env:"LEASED_LOGS_HASH_KEY,HASH_KEY" ini:"hash_key"`
+	TokenizeFields   []string `help:"Fields to replace with random per-process tokens before shipping, the same for a value while it is among the 100,000 most recently seen." ini:"tokenize_fields"`
+	TruncateIPFields []string `help:"Fields containing IP addresses to truncate to their /24 (IPv4) or /48 (IPv6) before shipping." name:"truncate-ip-fields" ini:"truncate_ip_fields"`
+}
+
+// cloudLoggingSinkName is the name of the Cloud Logging sink in per-sink settings.
+const cloudLoggingSinkName = "cloud-logging"
+
+// name returns the name of a setting in errors.
+func (c *Manager) name(field string) string {
+	return settingName(c.Naming, c, field)
+}
+
+// SetDiagnostics sends the diagnostics of the lease package at or above the diagnostics level to the diagnostics file,
+// or to stderr when it is empty.
+func (c *Manager) SetDiagnostics() error {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(c.DiagLevel)); err != nil {
+		return usageErrorf("invalid %s: %w", c.name("DiagLevel"), err)
+	}
+	w := os.Stderr
+	if c.DiagFile != "" {
+		f, err := os.OpenFile(c.DiagFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return fmt.Errorf("failed to open diagnostics file: %w", err)
+		}
+		w = f
+	}
+	lease.SetDiagnostics(slog.New(slog.NewTextHandler(w, &slog.HandlerOptions{Level: l})))
+	return nil
+}
+
+// ClientOptions returns the options of the Cloud Logging client.
+func (c *Manager) ClientOptions() []option.ClientOption {
+	var opts []option.ClientOption
+	if c.CloudLoggingConnPool > 0 {
+		opts = append(opts, option.WithGRPCConnectionPool(c.CloudLoggingConnPool))
+	}
+	return opts
+}
+
+// NewManager creates a lease manager watching the given leases, the first of which names the log, and starts serving
+// its metrics and lease state if configured.
+//   - extra options are applied after the options from the settings
+//   - traces are attributed to projectID
+func (c *Manager) NewManager(ctx context.Context, logClient *logging.Client, guaranteedUntil time.Time, projectID string, leases []*firestore.DocumentRef, extra ...lease.Option) (*lease.Manager, error) {
+	opts, err := c.Options(ctx, logClient, projectID, leases)
+	if err != nil {
+		return nil, err
+	}
+	opts = append(opts, extra...)
+
+	m := lease.NewManager(ctx, guaranteedUntil, leases[0], opts...)
+	// count the asynchronous write errors of the client, which it would otherwise only print
+	logClient.OnError = m.HandleError
+	if c.MetricsAddr != "" {
+		go serveMetrics(c.MetricsAddr, m)
+	}
+	if c.LeaseStateSocket != "" {
+		go func() {
+			if err := m.ServeLeaseState(c.LeaseStateSocket); err != nil {
+				lease.Diagnostics().Error("failed to serve lease state", "error", err)
+			}
+		}()
+	}
+	return m, nil
+}
+
+// serveMetrics serves the Prometheus metrics of the manager at /metrics on addr.
+func serveMetrics(addr string, m *lease.Manager) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", leaseprom.Handler(m))
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		lease.Diagnostics().Error("failed to serve metrics", "error", err)
+	}
+}
+
+// Options converts the settings to lease manager options, for the given leases, the first of which names the log.
+func (c *Manager) Options(ctx context.Context, logClient *logging.Client, projectID string, leases []*firestore.DocumentRef) ([]lease.Option, error) {
+	leaseID := leases[0].ID
+	logName, err := lease.ExecuteLogNameTemplate(c.LogName, leaseID, c.Labels)
+	if err != nil {
+		return nil, &UsageError{Err: err}
+	}
+
+	correlationID := c.CorrelationID
+	if correlationID == "" {
+		correlationID, err = lease.NewCorrelationID()
+		if err != nil {
+			return nil, err
+		}
+	}
+	fmt.Fprintf(os.Stderr, "=== CORRELATION ID %s | filter: labels.correlation_id=%q\n", correlationID, correlationID)
+
+	leasePolicy, err := lease.ParseLeasePolicy(c.LeasePolicy)
+	if err != nil {
+		return nil, &UsageError{Err: err}
+	}
+	watchFailurePolicy, err := lease.ParseWatchFailurePolicy(c.WatchFailurePolicy)
+	if err != nil {
+		return nil, &UsageError{Err: err}
+	}
+
+	opts := []lease.Option{
+		lease.WithLabels(c.Labels),
+		lease.WithLeasePolicy(leasePolicy),
+		lease.WithWatchFailurePolicy(watchFailurePolicy, c.WatchFailureAfter),
+		lease.WithLogName(logName),
+		lease.WithCorrelationID(correlationID),
+		lease.WithTraceProject(projectID),
+	}
+
+	// additional leases are watched alongside the first one
+	if len(leases) > 1 {
+		opts = append(opts, lease.WithLeases(leases[1:]...))
+	}
+	for _, id := range c.ParentLeases {
+		opts = append(opts, lease.WithParentLeases(leases[0].Parent.Doc(id)))
+	}
+
+	sinks, err := c.sinkOptions(ctx, logClient, leaseID, logName)
+	if err != nil {
+		return nil, err
+	}
+	opts = append(opts, sinks...)
+
+	if c.RequireApproval {
+		opts = append(opts, lease.WithRequireApproval())
+	}
+	if c.LeaseStateFrom != "" {
+		opts = append(opts, lease.WithLeaseStateFrom(c.LeaseStateFrom))
+	}
+	if c.LeaseToken != "" || c.LeaseTokenFile != "" {
+		token, err := c.leaseToken()
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, lease.WithLeaseToken(token))
+	}
+	if c.StartupWindow > 0 {
+		opts = append(opts, lease.WithStartupWindow(c.StartupWindow))
+	}
+	opts = append(opts, lease.WithAlwaysShipSeverity(logging.ParseSeverity(c.AlwaysShipSeverity)))
+	if len(c.SampleRates) > 0 {
+		rates, err := lease.ParseSampleRates(c.SampleRates)
+		if err != nil {
+			return nil, &UsageError{Err: err}
+		}
+		opts = append(opts, lease.WithSamplers(rates))
+	}
+	if c.SampleFirst > 0 {
+		opts = append(opts, lease.WithSamplers(lease.NewFirstNSampler(c.SampleFirst, c.SampleWindow)))
+	}
+	if c.GracePeriod > 0 {
+		opts = append(opts, lease.WithGracePeriod(c.GracePeriod))
+	}
+
+	if c.HeartbeatInterval > 0 {
+		opts = append(opts, lease.WithHeartbeat(c.HeartbeatInterval))
+	}
+	if c.SuppressionSummary > 0 {
+		opts = append(opts, lease.WithSuppressionSummary(c.SuppressionSummary))
+	}
+	if c.QueueSize > 0 {
+		backpressure, err := lease.ParseBackpressurePolicy(c.Backpressure)
+		if err != nil {
+			return nil, &UsageError{Err: err}
+		}
+		opts = append(opts, lease.WithQueue(c.QueueSize, backpressure))
+	}
+	if c.DedupWindow > 0 {
+		opts = append(opts, lease.WithDedup(c.DedupWindow))
+	}
+	if c.RateLimitEntries > 0 || c.RateLimitKiB > 0 {
+		overflow, err := lease.ParseRateLimitOverflow(c.RateLimitOverflow)
+		if err != nil {
+			return nil, &UsageError{Err: err}
+		}
+		opts = append(opts, lease.WithRateLimit(c.RateLimitEntries, c.RateLimitKiB<<10, overflow))
+	}
+
+	if c.ShipOnly {
+		opts = append(opts, lease.WithShipOnly())
+	}
+	collector := ""
+	switch c.StdoutCollected {
+	case "no", "":
+	case "yes":
+		collector = "configuration"
+	case "auto":
+		collector = lease.DetectStdoutCollector()
+	default:
+		return nil, usageErrorf("unknown %s %q, must be no, yes, or auto", c.name("StdoutCollected"), c.StdoutCollected)
+	}
+	if collector != "" {
+		fmt.Fprintf(os.Stderr, "=== STDOUT COLLECTED by %s | shipping only entries below %s\n", collector, c.CollectedSeverity)
+		opts = append(opts, lease.WithCollectedStdout(logging.ParseSeverity(c.CollectedSeverity)))
+	}
+	if c.SlogSource {
+		opts = append(opts, lease.WithSlogSource())
+	}
+	if c.CostCenter != "" || len(c.CostCenters) > 0 {
+		opts = append(opts, lease.WithCostAttribution(c.CostCenters, c.CostCenter))
+	}
+
+	if c.ReplayBufferCompression != "" && c.ReplayBufferCompression != "none" {
+		comp, err := leasecompress.Parse(c.ReplayBufferCompression)
+		if err != nil {
+			return nil, &UsageError{Err: err}
+		}
+		opts = append(opts, lease.WithCompressedReplayBuffer(c.ReplayBufferMB<<20, c.ReplayBufferAge, comp))
+	} else if c.ReplayBufferSize > 0 {
+		opts = append(opts, lease.WithReplayBuffer(c.ReplayBufferSize, c.ReplayBufferAge))
+	}
+
+	if c.SpoolDir != "" {
+		sp, err := spool.Open(c.SpoolDir, spool.Options{
+			MaxSegmentBytes: c.SpoolSegmentMB << 20,
+			MaxSegmentAge:   c.SpoolSegmentAge,
+			MaxTotalBytes:   c.SpoolMaxMB << 20,
+			Retention:       c.SpoolRetention,
+		})
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, lease.WithSpool(sp))
+	}
+
+	if c.HashChain {
+		opts = append(opts, lease.WithHashChain())
+	}
+
+	if c.RemoteWriteURL != "" {
+		opts = append(opts, lease.WithRemoteWrite(c.RemoteWriteURL, c.RemoteWriteInterval, c.RemoteWriteHeaders))
+	}
+
+	for _, url := range c.Webhooks {
+		opts = append(opts, lease.WithNotifier(lease.NewWebhookNotifier(url, c.WebhookSecret)))
+	}
+	if c.SlackWebhook != "" {
+		opts = append(opts, lease.WithNotifier(lease.NewSlackNotifier(c.SlackWebhook)))
+	}
+	if c.EventsTopic != "" {
+		notifier, err := leasepubsub.NewNotifier(ctx, projectID, c.EventsTopic)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, lease.WithNotifier(notifier))
+	}
+
+	if c.Quarantine != "" {
+		quarantine, err := os.OpenFile(c.Quarantine, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open quarantine: %w", err)
+		}
+		opts = append(opts, lease.WithQuarantine(quarantine))
+	}
+
+	processors, err := c.processorOptions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return append(opts, processors...), nil
+}
+
+// sinkOptions returns the sinks shipped entries are sent to: Cloud Logging, archives, Parquet files, file sinks, and
+// sink plugins.
+func (c *Manager) sinkOptions(ctx context.Context, logClient *logging.Client, leaseID, logName string) ([]lease.Option, error) {
+	cloudPolicy, err := lease.ParseSinkPolicy(c.CloudLoggingPolicy)
+	if err != nil {
+		return nil, &UsageError{Err: err}
+	}
+
+	loggerOpts := c.loggerOptions()
+	cloudLogging := lease.NewCloudLoggingSink(logClient.Logger(logName, loggerOpts...))
+
+	var opts []lease.Option
+	for sev, tmpl := range c.SeverityLogNames {
+		s, name, err := lease.ParseSeverityLogName(sev, tmpl, leaseID, c.Labels)
+		if err != nil {
+			return nil, &UsageError{Err: err}
+		}
+		opts = append(opts, lease.WithSeverityLogName(s, name))
+		cloudLogging.Route(name, logClient.Logger(name, loggerOpts...))
+	}
+	opts = append(opts, lease.WithSink(c.tuneSink(cloudLoggingSinkName, cloudLogging), cloudPolicy))
+
+	if c.ArchiveURL != "" {
+		store, err := lease.OpenObjectStore(ctx, c.ArchiveURL)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, lease.WithArchive(store, c.ArchiveChunk))
+	}
+	if c.ParquetURL != "" {
+		store, err := lease.OpenObjectStore(ctx, c.ParquetURL)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, lease.WithSink(c.tuneSink(c.ParquetURL, leaseparquet.NewSink(ctx, store)), lease.Leased))
+	}
+
+	for path, policyName := range c.FileSinks {
+		policy, err := lease.ParseSinkPolicy(policyName)
+		if err != nil {
+			return nil, usageErrorf("invalid policy for file sink %q: %w", path, err)
+		}
+		sink, err := lease.NewFileSink(path)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, lease.WithSink(c.tuneSink(path, sink), policy))
+	}
+
+	for path, policyName := range c.SinkPlugins {
+		policy, err := lease.ParseSinkPolicy(policyName)
+		if err != nil {
+			return nil, usageErrorf("invalid policy for sink plugin %q: %w", path, err)
+		}
+		plugin, err := startPlugin(path, lease.PluginSink)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, lease.WithSink(c.tuneSink(path, plugin), policy))
+	}
+	return opts, nil
+}
+
+// processorOptions returns the processors modifying entries before they are shipped, in order.
+func (c *Manager) processorOptions(ctx context.Context) ([]lease.Option, error) {
+	var opts []lease.Option
+
+	// enrich before anonymizing so lookups see the raw values
+	if c.GeoIPDB != "" {
+		geo, err := leaseenrich.NewGeoIP(c.GeoIPDB, c.GeoIPField)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, lease.WithProcessors(geo))
+	}
+	if c.UserAgentField != "" {
+		opts = append(opts, lease.WithProcessors(leaseenrich.UserAgent(c.UserAgentField)))
+	}
+
+	// anonymize before validating so quarantined entries never contain raw values
+	if len(c.HashFields) > 0 {
+		// a key per process would hash the same value differently on every instance and after every restart
+		if c.HashKey == "" {
+			return nil, usageErrorf("%s requires %s, the same on every instance", c.name("HashFields"), c.name("HashKey"))
+		}
+		opts = append(opts, lease.WithProcessors(lease.HashFields([]byte(c.HashKey), c.HashFields...)))
+	}
+	if len(c.TokenizeFields) > 0 {
+		opts = append(opts, lease.WithProcessors(lease.TokenizeFields(c.TokenizeFields...)))
+	}
+	if len(c.TruncateIPFields) > 0 {
+		opts = append(opts, lease.WithProcessors(lease.TruncateIPFields(c.TruncateIPFields...)))
+	}
+
+	// plugins and filters only see anonymized entries, and their output is still validated
+	for _, path := range c.ProcessorPlugins {
+		plugin, err := startPlugin(path, lease.PluginProcessor)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, lease.WithProcessors(plugin))
+	}
+	for _, path := range c.WASMFilters {
+		filter, err := leasewasm.NewFilter(ctx, path)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, lease.WithProcessors(filter))
+	}
+
+	if len(c.Schemas) > 0 {
+		schemas := leaseschema.NewRegistry()
+		for name, path := range c.Schemas {
+			if err := schemas.Register(name, path); err != nil {
+				return nil, err
+			}
+		}
+		if c.SchemaQuarantine != "" {
+			quarantine, err := os.OpenFile(c.SchemaQuarantine, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+			if err != nil {
+				return nil, fmt.Errorf("failed to open schema quarantine: %w", err)
+			}
+			schemas.SetQuarantine(quarantine)
+		}
+		opts = append(opts, lease.WithProcessors(schemas))
+	}
+
+	return opts, nil
+}
+
+// loggerOptions returns the batching options of the Cloud Logging loggers.
+func (c *Manager) loggerOptions() []logging.LoggerOption {
+	var opts []logging.LoggerOption
+	if c.CloudLoggingWorkers > 0 {
+		opts = append(opts, logging.ConcurrentWriteLimit(c.CloudLoggingWorkers))
+	}
+	if c.CloudLoggingDelay > 0 {
+		opts = append(opts, logging.DelayThreshold(c.CloudLoggingDelay))
+	}
+	if c.CloudLoggingBatch > 0 {
+		opts = append(opts, logging.EntryCountThreshold(c.CloudLoggingBatch))
+	}
+	if c.CloudLoggingBufferMB > 0 {
+		opts = append(opts, logging.BufferedByteLimit(c.CloudLoggingBufferMB<<20))
+	}
+	return opts
+}
+
+// tuneSink paces a sink if a bandwidth cap is configured for it, then wraps it in a worker pool if workers or an
+// in-flight limit are.
+func (c *Manager) tuneSink(name string, sink lease.Sink) lease.Sink {
+	if kib := c.SinkBandwidth[name]; kib > 0 {
+		sink = lease.NewPacedSink(sink, kib<<10, 0)
+	}
+
+	workers, maxInFlight := c.SinkWorkers[name], c.SinkMaxInFlight[name]
+	if workers == 0 && maxInFlight == 0 {
+		return sink
+	}
+	return lease.NewConcurrentSink(sink, workers, maxInFlight)
+}
+
+// leaseToken reads and verifies the lease token from the token or token file settings.
+func (c *Manager) leaseToken() (*lease.Token, error) {
+	if c.LeaseTokenKey == "" {
+		return nil, usageErrorf("%s is required to verify lease tokens", c.name("LeaseTokenKey"))
+	}
+	key, err := lease.LoadTokenVerifyKey(c.LeaseTokenKey)
+	if err != nil {
+		return nil, err
+	}
+
+	raw := c.LeaseToken
+	if c.LeaseTokenFile != "" {
+		b, err := os.ReadFile(c.LeaseTokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read lease token: %w", err)
+		}
+		raw = string(b)
+	}
+
+	token, err := lease.ParseToken(raw, key)
+	if err != nil {
+		return nil, &TokenError{Err: err}
+	}
+	return token, nil
+}
+
+// startPlugin starts an exec plugin and checks that it supports the capability it is used for.
+func startPlugin(path, capability string) (*lease.ExecPlugin, error) {
+	plugin, err := lease.StartExecPlugin(path)
+	if err != nil {
+		return nil, err
+	}
+	if !plugin.Supports(capability) {
+		plugin.Close()
+		return nil, fmt.Errorf("plugin %q does not support being used as a %s", path, capability)
+	}
+	return plugin, nil
+}
@@ -2,26 +2,69 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"os"
+	"slices"
+	"strings"
 	"time"
 
 	"cloud.google.com/go/firestore"
 	"cloud.google.com/go/logging"
 	"github.com/alecthomas/kong"
 	"gopkg.in/ini.v1"
+
+	"github.com/carsonoid/talk-leased-logs/internal/capture"
+	"github.com/carsonoid/talk-leased-logs/internal/identity"
+	"github.com/carsonoid/talk-leased-logs/internal/leaseconfig"
 )
 
 var cli struct {
-	Debug     bool     `help:"Enable debug mode."`
-	ProjectID string   `help:"The ID of the project to work with" env:"PROJECT_ID"`
-	LeaseID   string   `help:"The ID of the lease to work with." required:"" env:"LEASE_ID" short:"l"`
-	Lease     LeaseCmd `cmd:"" help:"Work with log leasing"`
-	Capture   Capture  `cmd:"" help:"Capture logs"`
-	SlogDemo  SlogDemo `cmd:"" help:"Run the slog demo"`
+	Debug      bool     `help:"Enable debug mode."`
+	JSONErrors bool     `help:"Print errors to stderr as JSON objects with their kind and exit code." name:"json-errors"`
+	ProjectID  string   `help:"The ID of the project to work with" env:"LEASED_LOGS_PROJECT_ID,PROJECT_ID"`
+	Database   string   `help:"The ID of the Firestore database holding the leases, for projects using named databases." default:"(default)"`
+	LeaseIDs   []string `help:"The ID of the lease to work with, required by all commands working with a single lease. Commands shipping logs accept several, combined by --lease-policy." name:"lease-id" env:"LEASED_LOGS_LEASE_ID,LEASE_ID" short:"l"`
+
+	leaseconfig.Manager `embed:""`
+
+	Identity      string `help:"How to identify the user performing lease operations." enum:"os,gcloud,oidc,static" default:"os" env:"LEASED_LOGS_IDENTITY,IDENTITY"`
+	User          string `help:"The user to stamp on lease operations, requires --identity=static."`
+	OIDCTokenFile string `help:"A file containing a Google-signed OIDC ID token, for --identity=oidc." name:"oidc-token-file"`
+	OIDCAudience  string `help:"The audience the OIDC ID token must be issued for, for --identity=oidc." name:"oidc-audience"`
+
+	Lease       LeaseCmd    `cmd:"" help:"Work with log leasing"`
+	Capture     Capture     `cmd:"" help:"Capture logs"`
+	Serve       Serve       `cmd:"" help:"Watch the lease once and serve a local API for other processes to query it and ship logs"`
+	SlogDemo    SlogDemo    `cmd:"" help:"Run the slog demo"`
+	LogrusDemo  LogrusDemo  `cmd:"" help:"Run the logrus demo"`
+	ZerologDemo ZerologDemo `cmd:"" help:"Run the zerolog demo"`
 }
 
+// envPrefix prefixes the environment variables of every flag.
+const envPrefix = "LEASED_LOGS"
+
+// leasesCollection is the Firestore collection holding all lease documents.
+const leasesCollection = "leases"
+
+// leaseOptionalCommands are the commands that do not work with a single lease, and so do not require a lease ID.
+var leaseOptionalCommands = []string{"lease list"}
+
+// multiLeaseCommands are the commands that ship logs, and so accept several lease IDs.
+var multiLeaseCommands = []string{"capture", "serve", "slog-demo", "logrus-demo", "zerolog-demo"}
+
 func main() {
-	kctx := kong.Parse(&cli)
+	// every flag can also be set from a LEASED_LOGS_ environment variable, flags take precedence over the environment
+	parser := kong.Must(&cli, kong.DefaultEnvars(envPrefix))
+	kctx, err := parser.Parse(os.Args[1:])
+	fatalIfErrorf(parser, err)
+
+	if len(cli.LeaseIDs) == 0 && !slices.Contains(leaseOptionalCommands, kctx.Command()) {
+		fatalIfErrorf(parser, withExitCode(exitUsage, errors.New("missing flags: --lease-id=STRING")))
+	}
+	if len(cli.LeaseIDs) > 1 && !slices.Contains(multiLeaseCommands, strings.Fields(kctx.Command())[0]) {
+		fatalIfErrorf(parser, withExitCode(exitUsage, errors.New("only capture and the demo commands accept several --lease-id values")))
+	}
 
 	if cli.ProjectID == "" {
 		// try to get default project ID from terraform state file
@@ -32,22 +75,43 @@ func main() {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
+	// resolve the identity provider, the identity itself is only looked up when a command needs it
+	ident, err := identity.New(identity.Config{
+		Kind:          cli.Identity,
+		StaticUser:    cli.User,
+		OIDCTokenFile: cli.OIDCTokenFile,
+		OIDCAudience:  cli.OIDCAudience,
+	})
+	fatalIfErrorf(parser, withExitCode(exitUsage, err), "Failed to create identity provider")
+	kctx.BindTo(ident, (*identity.Identity)(nil))
+
 	// create a GCP cloud logging client using the project ID and default credentials
-	logClient, err := logging.NewClient(ctx, cli.ProjectID)
-	kctx.FatalIfErrorf(err, "Failed to create logging client")
+	logClient, err := logging.NewClient(ctx, cli.ProjectID, cli.ClientOptions()...)
+	fatalIfErrorf(parser, err, "Failed to create logging client")
 	defer logClient.Close()
 
-	// create a Firestore client using the project ID and default credentials
-	fsClient, err := firestore.NewClient(ctx, cli.ProjectID)
-	kctx.FatalIfErrorf(err, "Failed to create firestore client")
+	// create a Firestore client using the project ID, database, and default credentials
+	fsClient, err := firestore.NewClientWithDatabase(ctx, cli.ProjectID, cli.Database)
+	fatalIfErrorf(parser, err, "Failed to create firestore client")
 
 	// make a document reference to the lease document
 	// this does not fetch the doc but can be used to interact with it later
-	docRef := fsClient.Collection("leases").Doc(cli.LeaseID)
+	// it is nil for commands that do not work with a single lease
+	docRef := fsClient.Collection(leasesCollection).Doc(leaseID())
 
 	// run sub-commands passing the firestore client, log client, and docRef for use
 	err = kctx.Run(fsClient, logClient, docRef)
-	kctx.FatalIfErrorf(err)
+	// a captured command that failed exits the CLI like it did, rather than as an error of the CLI itself
+	capture.Exit(err)
+	fatalIfErrorf(parser, err)
+}
+
+// leaseID returns the first lease ID, the lease commands that work with a single lease operate on.
+func leaseID() string {
+	if len(cli.LeaseIDs) == 0 {
+		return ""
+	}
+	return cli.LeaseIDs[0]
 }
 
 func getProjectIDFromTerraform() string {
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"cloud.google.com/go/logging"
+
+	"github.com/carsonoid/talk-leased-logs/pkg/lease"
+)
+
+// newManager creates a lease manager for the current leases using the global flags.
+//   - extra options are applied after the options from the flags
+func newManager(ctx context.Context, logClient *logging.Client, guaranteedUntil time.Time, docRef *firestore.DocumentRef, extra ...lease.Option) (*lease.Manager, error) {
+	if err := cli.SetDiagnostics(); err != nil {
+		return nil, err
+	}
+
+	// additional leases are watched alongside the first one
+	leases := []*firestore.DocumentRef{docRef}
+	for _, id := range cli.LeaseIDs[1:] {
+		leases = append(leases, docRef.Parent.Doc(id))
+	}
+	return cli.Manager.NewManager(ctx, logClient, guaranteedUntil, cli.ProjectID, leases, extra...)
+}
@@ -0,0 +1,25 @@
+package lease
+
+import (
+	"cloud.google.com/go/logging"
+)
+
+// Ships reports whether an entry of the severity is shipped right now, because the lease ships its severity, during
+// the startup window, or at the always-ship severity and above, for integrations with other logging libraries, such as
+// the logrus and zerolog ones.
+func (m *Manager) Ships(s logging.Severity) bool {
+	return m.shouldShip(s)
+}
+
+// PrintsLocally reports whether an integration writing its own local output should still print output of the
+// severity, shipped when ship is true, false when WithShipOnly or WithCollectedStdout leave it to the sinks.
+func (m *Manager) PrintsLocally(s logging.Severity, ship bool) bool {
+	return !m.localSuppressed(s, ship)
+}
+
+// Log routes an entry written through an integration like the loggers and writers of the manager.
+//   - leased sinks receive the entry when ship is true, see Ships
+//   - entries not shipped are kept in the replay buffers and spool, if enabled
+func (m *Manager) Log(e logging.Entry, ship bool) {
+	m.log(e, ship)
+}
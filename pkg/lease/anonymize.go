@@ -0,0 +1,120 @@
+package lease
+
+import (
+	"container/list"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"sync"
+
+	"cloud.google.com/go/logging"
+)
+
+// HashFields returns a Processor that replaces the configured fields with a keyed SHA-256 hash.
+//   - equal values hash equally for the same key, so hashed fields can still be grouped and counted
+//   - the key prevents recovering values by hashing guesses, keep it secret and stable across instances and restarts,
+//     a key generated per process would hash the same value differently on every instance
+func HashFields(key []byte, fields ...string) Processor {
+	return ProcessorFunc(func(e *logging.Entry) bool {
+		for _, field := range fields {
+			replaceField(e, field, func(v string) string {
+				mac := hmac.New(sha256.New, key)
+				mac.Write([]byte(v))
+				return "sha256:" + hex.EncodeToString(mac.Sum(nil))
+			})
+		}
+		return true
+	})
+}
+
+// maxTokens is the number of values a Tokenizer remembers the tokens of.
+const maxTokens = 100_000
+
+// Tokenizer is a Processor that replaces the configured fields with random tokens.
+//   - the same value maps to the same token while it is among the maxTokens most recently seen values, less recently
+//     seen values are forgotten and get a new token when seen again, so memory stays bounded for unbounded values
+//   - unlike hashes, tokens carry no information about the value outside of this process
+type Tokenizer struct {
+	fields []string
+
+	mu sync.Mutex
+	// tokens indexes the elements of recent, most recently seen first, holding a tokenEntry each
+	tokens map[string]*list.Element
+	recent *list.List
+}
+
+// tokenEntry is a value and its token, in the recent list of a Tokenizer.
+type tokenEntry struct {
+	value, token string
+}
+
+// TokenizeFields creates a Tokenizer for the configured fields.
+func TokenizeFields(fields ...string) *Tokenizer {
+	return &Tokenizer{
+		fields: fields,
+		tokens: make(map[string]*list.Element),
+		recent: list.New(),
+	}
+}
+
+// Process replaces the configured fields with their tokens.
+func (t *Tokenizer) Process(e *logging.Entry) bool {
+	for _, field := range t.fields {
+		replaceField(e, field, t.token)
+	}
+	return true
+}
+
+// token returns the token for a value, creating it on first use and forgetting the least recently seen value once
+// maxTokens are remembered.
+func (t *Tokenizer) token(v string) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if el, ok := t.tokens[v]; ok {
+		t.recent.MoveToFront(el)
+		return el.Value.(*tokenEntry).token
+	}
+
+	if t.recent.Len() >= maxTokens {
+		oldest := t.recent.Back()
+		t.recent.Remove(oldest)
+		delete(t.tokens, oldest.Value.(*tokenEntry).value)
+	}
+
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	tok := "tok_" + hex.EncodeToString(b)
+	t.tokens[v] = t.recent.PushFront(&tokenEntry{value: v, token: tok})
+	return tok
+}
+
+// TruncateIPFields returns a Processor that replaces IP addresses in the configured fields with their network.
+//   - IPv4 addresses are truncated to their /24 and IPv6 addresses to their /48
+//   - values that are not IP addresses are left untouched
+func TruncateIPFields(fields ...string) Processor {
+	return ProcessorFunc(func(e *logging.Entry) bool {
+		for _, field := range fields {
+			replaceField(e, field, truncateIP)
+		}
+		return true
+	})
+}
+
+// truncateIP returns the /24 or /48 network containing an IP address.
+func truncateIP(v string) string {
+	ip := net.ParseIP(v)
+	if ip == nil {
+		return v
+	}
+
+	mask := net.CIDRMask(48, 128)
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+		mask = net.CIDRMask(24, 32)
+	}
+
+	return (&net.IPNet{IP: ip.Mask(mask), Mask: mask}).String()
+}
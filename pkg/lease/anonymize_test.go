@@ -0,0 +1,56 @@
+package lease
+
+import (
+	"strconv"
+	"testing"
+
+	"cloud.google.com/go/logging"
+)
+
+// field runs the processor on an entry with field set to v and returns the replaced value.
+func field(p Processor, v string) string {
+	e := logging.Entry{Payload: map[string]any{"email": v}}
+	p.Process(&e)
+	return e.Payload.(map[string]any)["email"].(string)
+}
+
+func TestHashFields(t *testing.T) {
+	a := HashFields([]byte("key"), "email")
+	b := HashFields([]byte("key"), "email")
+	other := HashFields([]byte("other key"), "email")
+
+	if field(a, "alice@example.com") != field(b, "alice@example.com") {
+		t.Error("the same key hashed a value differently")
+	}
+	if field(a, "alice@example.com") == field(other, "alice@example.com") {
+		t.Error("different keys hashed a value equally")
+	}
+	if field(a, "alice@example.com") == field(a, "bob@example.com") {
+		t.Error("different values hashed equally")
+	}
+}
+
+func TestTokenizerForgetsLeastRecentlySeen(t *testing.T) {
+	tok := TokenizeFields("email")
+
+	first := field(tok, "first")
+	kept := field(tok, "kept")
+	for i := range maxTokens - 2 {
+		field(tok, strconv.Itoa(i))
+	}
+	// seeing kept again makes first the least recently seen value
+	if field(tok, "kept") != kept {
+		t.Fatal("a remembered value got a new token")
+	}
+	field(tok, "new")
+
+	if got := len(tok.tokens); got != maxTokens {
+		t.Errorf("remembered %d tokens, want %d", got, maxTokens)
+	}
+	if field(tok, "kept") != kept {
+		t.Error("a recently seen value got a new token")
+	}
+	if field(tok, "first") == first {
+		t.Error("the least recently seen value kept its token")
+	}
+}
@@ -0,0 +1,229 @@
+package lease
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/storage"
+)
+
+// ObjectStore stores archived chunks of raw output.
+type ObjectStore interface {
+	// Put stores data as the object with the given name.
+	Put(ctx context.Context, name string, data []byte) error
+}
+
+// GCSStore is an ObjectStore writing objects to a Cloud Storage bucket under a prefix.
+type GCSStore struct {
+	bucket *storage.BucketHandle
+	prefix string
+}
+
+// NewGCSStore creates a GCSStore for a gs://BUCKET/PREFIX URL.
+func NewGCSStore(client *storage.Client, url string) (*GCSStore, error) {
+	rest, ok := strings.CutPrefix(url, "gs://")
+	if !ok {
+		return nil, fmt.Errorf("invalid archive URL %q, must be gs://BUCKET/PREFIX", url)
+	}
+	bucket, prefix, _ := strings.Cut(rest, "/")
+	if bucket == "" {
+		return nil, fmt.Errorf("invalid archive URL %q, missing bucket", url)
+	}
+	return &GCSStore{bucket: client.Bucket(bucket), prefix: prefix}, nil
+}
+
+// Put uploads data as an object.
+func (s *GCSStore) Put(ctx context.Context, name string, data []byte) error {
+	w := s.bucket.Object(path.Join(s.prefix, name)).NewWriter(ctx)
+	w.ContentType = mime.TypeByExtension(path.Ext(name))
+	if _, err := w.Write(data); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+// DirStore is an ObjectStore writing objects as files under a local directory.
+type DirStore struct {
+	dir string
+}
+
+// NewDirStore creates a DirStore writing under dir.
+func NewDirStore(dir string) *DirStore {
+	return &DirStore{dir: dir}
+}
+
+// Put writes data to the file of the object, creating its parent directories.
+func (s *DirStore) Put(_ context.Context, name string, data []byte) error {
+	p := filepath.Join(s.dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(p), 0o700); err != nil {
+		return err
+	}
+	return os.WriteFile(p, data, 0o600)
+}
+
+// OpenObjectStore opens a GCSStore for a gs://BUCKET/PREFIX URL, or a DirStore for any other path.
+func OpenObjectStore(ctx context.Context, url string) (ObjectStore, error) {
+	if !strings.HasPrefix(url, "gs://") {
+		return NewDirStore(url), nil
+	}
+
+	client, err := storage.NewClient(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create storage client: %w", err)
+	}
+	return NewGCSStore(client, url)
+}
+
+// maxArchiveChunkBytes rotates archive chunks early once this much compressed output is buffered.
+const maxArchiveChunkBytes = 8 << 20
+
+// WithArchive archives the raw stdout and stderr bytes written while the lease is enabled to store.
+//   - output is gzipped and split into one object per stream and chunk of time
+//   - objects are named LEASE/INSTANCE/STREAM/START.gz, with START the UTC time the chunk began
+//   - chunk defaults to 5 minutes
+func WithArchive(store ObjectStore, chunk time.Duration) Option {
+	if chunk <= 0 {
+		chunk = 5 * time.Minute
+	}
+	return func(m *Manager) {
+		m.archive = &archiver{
+			m:      m,
+			store:  store,
+			chunk:  chunk,
+			chunks: make(map[string]*archiveChunk),
+		}
+	}
+}
+
+// archiver buffers raw output per stream and uploads it in compressed chunks.
+type archiver struct {
+	m     *Manager
+	store ObjectStore
+	chunk time.Duration
+	// leaseID is the primary lease, used in object names
+	leaseID string
+
+	mu     sync.Mutex
+	ctx    context.Context
+	chunks map[string]*archiveChunk
+
+	uploads sync.WaitGroup
+}
+
+// archiveChunk is the compressed output of one stream since start.
+type archiveChunk struct {
+	start time.Time
+	buf   bytes.Buffer
+	gz    *gzip.Writer
+}
+
+// run rotates chunks once they are older than the chunk duration, until ctx is done.
+func (a *archiver) run(ctx context.Context) {
+	a.mu.Lock()
+	a.ctx = ctx
+	a.mu.Unlock()
+
+	t := time.NewTicker(a.chunk)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-t.C:
+			a.mu.Lock()
+			for stream, c := range a.chunks {
+				if now.Sub(c.start) >= a.chunk {
+					a.rotate(stream)
+				}
+			}
+			a.mu.Unlock()
+		}
+	}
+}
+
+// writer returns an io.Writer archiving everything written to it while the lease is enabled as the given stream.
+func (a *archiver) writer(stream string) io.Writer {
+	return archiveWriter{a: a, stream: stream}
+}
+
+// archiveWriter is the io.Writer of a single archived stream.
+type archiveWriter struct {
+	a      *archiver
+	stream string
+}
+
+func (w archiveWriter) Write(p []byte) (int, error) {
+	if !w.a.m.enabled.Load() {
+		return len(p), nil
+	}
+
+	w.a.mu.Lock()
+	defer w.a.mu.Unlock()
+
+	c, ok := w.a.chunks[w.stream]
+	if !ok {
+		c = &archiveChunk{start: time.Now().UTC()}
+		c.gz = gzip.NewWriter(&c.buf)
+		w.a.chunks[w.stream] = c
+	}
+	if _, err := c.gz.Write(p); err != nil {
+		// archiving must never interrupt the captured output
+		diag().Error("failed to archive output", "error", err)
+		return len(p), nil
+	}
+	if c.buf.Len() >= maxArchiveChunkBytes {
+		w.a.rotate(w.stream)
+	}
+	return len(p), nil
+}
+
+// rotate closes the current chunk of a stream and uploads it in the background, a.mu must be held.
+func (a *archiver) rotate(stream string) {
+	c, ok := a.chunks[stream]
+	if !ok {
+		return
+	}
+	delete(a.chunks, stream)
+
+	if err := c.gz.Close(); err != nil {
+		diag().Error("failed to archive output", "error", err)
+		return
+	}
+
+	ctx := a.ctx
+	if ctx == nil || ctx.Err() != nil {
+		// uploads still finish while shutting down
+		ctx = context.Background()
+	}
+	name := path.Join(a.leaseID, a.m.instanceID, stream, c.start.Format("20060102T150405.000000000Z")+".gz")
+
+	a.uploads.Add(1)
+	go func() {
+		defer a.uploads.Done()
+		if err := a.store.Put(ctx, name, c.buf.Bytes()); err != nil {
+			diag().Error("failed to upload archive", "name", name, "error", err)
+		}
+	}()
+}
+
+// flush uploads all open chunks and waits for every upload to finish.
+func (a *archiver) flush() {
+	a.mu.Lock()
+	for stream := range a.chunks {
+		a.rotate(stream)
+	}
+	a.mu.Unlock()
+
+	a.uploads.Wait()
+}
@@ -0,0 +1,98 @@
+package lease
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+
+	"cloud.google.com/go/logging"
+	"golang.org/x/time/rate"
+)
+
+// PacedSink is a Sink that caps the bytes per second shipped to another sink with a token bucket.
+//   - Log waits until the bucket holds enough bytes for the entry, wrap the sink in a ConcurrentSink to queue bursts instead
+//   - entries larger than the burst are charged in burst-sized chunks, waiting for as many full buckets, rather than
+//     being refused, so they never exceed the cap
+//   - the cap applies to the estimated encoded size of entries, independent of how many entries are shipped
+type PacedSink struct {
+	sink    Sink
+	limiter *rate.Limiter
+	burst   int
+}
+
+// NewPacedSink creates a PacedSink shipping at most bytesPerSecond to sink, allowing bursts of up to burst bytes.
+//   - burst defaults to one second of bandwidth
+func NewPacedSink(sink Sink, bytesPerSecond, burst int) *PacedSink {
+	if burst < 1 {
+		burst = bytesPerSecond
+	}
+	return &PacedSink{
+		sink:    sink,
+		limiter: rate.NewLimiter(rate.Limit(bytesPerSecond), burst),
+		burst:   burst,
+	}
+}
+
+// Log waits for bandwidth for the entry, then ships it to the underlying sink.
+//   - entries the underlying sink rejects up front are returned as errors without using bandwidth
+func (s *PacedSink) Log(e logging.Entry) error {
+	if err := s.ValidateEntry(e); err != nil {
+		return err
+	}
+
+	if err := s.wait(entrySize(e)); err != nil {
+		return err
+	}
+	return s.sink.Log(e)
+}
+
+// wait blocks until n bytes of bandwidth are available, taking them from the bucket at most burst bytes at a time.
+func (s *PacedSink) wait(n int) error {
+	for n > 0 {
+		chunk := min(n, s.burst)
+		if err := s.limiter.WaitN(context.Background(), chunk); err != nil {
+			return err
+		}
+		n -= chunk
+	}
+	return nil
+}
+
+// ValidateEntry validates the entry with the underlying sink, if it is an EntryValidator.
+func (s *PacedSink) ValidateEntry(e logging.Entry) error {
+	if v, ok := s.sink.(EntryValidator); ok {
+		return v.ValidateEntry(e)
+	}
+	return nil
+}
+
+// Flush flushes the underlying sink.
+func (s *PacedSink) Flush() error {
+	return s.sink.Flush()
+}
+
+// Close closes the underlying sink, if it is an io.Closer.
+func (s *PacedSink) Close() error {
+	if c, ok := s.sink.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// entrySize estimates the encoded size of an entry from its payload and labels.
+func entrySize(e logging.Entry) int {
+	size := len(e.LogName)
+	for k, v := range e.Labels {
+		size += len(k) + len(v)
+	}
+
+	switch p := e.Payload.(type) {
+	case nil:
+	case string:
+		size += len(p)
+	default:
+		b, _ := json.Marshal(p)
+		size += len(b)
+	}
+	return size
+}
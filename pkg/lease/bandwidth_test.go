@@ -0,0 +1,48 @@
+package lease
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/logging"
+)
+
+func TestPacedSinkWithinBurst(t *testing.T) {
+	sink := &recordingSink{}
+	s := NewPacedSink(sink, 1000, 100)
+
+	start := time.Now()
+	if err := s.Log(logging.Entry{Payload: strings.Repeat("x", 100)}); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Errorf("entry within the burst waited %v", elapsed)
+	}
+	if got := len(sink.payloads()); got != 1 {
+		t.Errorf("shipped %d entries, want 1", got)
+	}
+}
+
+func TestPacedSinkChargesLargeEntries(t *testing.T) {
+	sink := &recordingSink{}
+	s := NewPacedSink(sink, 1000, 100)
+
+	// 300 bytes at 1000 bytes per second with a burst of 100 takes the full bucket and two more refills of 100ms
+	start := time.Now()
+	if err := s.Log(logging.Entry{Payload: strings.Repeat("x", 300)}); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 180*time.Millisecond {
+		t.Errorf("entry of three bursts waited %v, want at least 200ms", elapsed)
+	}
+
+	// the bucket is empty after the large entry, so the next entry waits as well
+	start = time.Now()
+	if err := s.Log(logging.Entry{Payload: strings.Repeat("x", 50)}); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 30*time.Millisecond {
+		t.Errorf("entry after a large entry waited %v, want at least 50ms", elapsed)
+	}
+}
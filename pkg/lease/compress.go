@@ -0,0 +1,170 @@
+package lease
+
+import (
+	"bytes"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/logging"
+)
+
+// Compressor compresses blocks of buffered entries in memory, see WithCompressedReplayBuffer and the compressors of
+// the leasecompress package.
+type Compressor interface {
+	// Compress returns the compressed block, or nil if src does not compress.
+	Compress(src []byte) []byte
+	// Decompress returns the original block of rawLen bytes.
+	Decompress(src []byte, rawLen int) ([]byte, error)
+}
+
+// WithCompressedReplayBuffer keeps recent unshipped entries like WithReplayBuffer, compressed in memory by c.
+//   - the buffer is bounded by maxBytes of compressed data rather than a number of entries, dropping the oldest blocks
+//     first, so the same memory covers a much longer window
+//   - entries are buffered as JSON, so only the fields written by file sinks survive the round trip
+func WithCompressedReplayBuffer(maxBytes int, maxAge time.Duration, c Compressor) Option {
+	return func(m *Manager) {
+		if maxBytes > 0 {
+			m.buffer = newCompressedBuffer(maxBytes, maxAge, c)
+		}
+	}
+}
+
+// entryBuffer holds recent unshipped entries until they are drained.
+type entryBuffer interface {
+	// add buffers an entry, possibly dropping older ones.
+	add(e logging.Entry)
+	// drain empties the buffer, returning all entries within the max age from oldest to newest.
+	drain() []logging.Entry
+	// bytes estimates the memory held by buffered entries.
+	bytes() int
+}
+
+// compressedBlockSize is the size of a block of encoded entries before it is compressed.
+const compressedBlockSize = 64 << 10
+
+// compressedBlock is a sealed block of newline-delimited JSON entries.
+type compressedBlock struct {
+	data []byte
+	// rawLen is the size of the block before compression, compressed is false for blocks that did not compress
+	rawLen     int
+	compressed bool
+	newest     time.Time
+}
+
+// compressedBuffer is an entryBuffer compressing entries in blocks, bounded by their compressed size.
+type compressedBuffer struct {
+	c        Compressor
+	maxBytes int
+	maxAge   time.Duration
+
+	mu     sync.Mutex
+	open   bytes.Buffer
+	newest time.Time
+	blocks []compressedBlock
+	size   int
+}
+
+func newCompressedBuffer(maxBytes int, maxAge time.Duration, c Compressor) *compressedBuffer {
+	return &compressedBuffer{
+		c:        c,
+		maxBytes: maxBytes,
+		maxAge:   maxAge,
+	}
+}
+
+// add encodes an entry into the open block, sealing it once it is full.
+//   - entries are stamped with the current time if they have no timestamp, so they keep it when replayed
+func (b *compressedBuffer) add(e logging.Entry) {
+	line, err := json.Marshal(newJSONEntry(e))
+	if err != nil {
+		diag().Error("failed to buffer entry", "error", err)
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.open.Write(line)
+	b.open.WriteByte('\n')
+	b.newest = time.Now()
+	if b.open.Len() >= compressedBlockSize {
+		b.seal()
+	}
+}
+
+// seal compresses the open block and drops the oldest blocks beyond the size and age limits.
+func (b *compressedBuffer) seal() {
+	if b.open.Len() == 0 {
+		return
+	}
+
+	raw := b.open.Bytes()
+	block := compressedBlock{rawLen: len(raw), newest: b.newest}
+	if data := b.c.Compress(raw); data != nil && len(data) < len(raw) {
+		block.data, block.compressed = data, true
+	} else {
+		block.data = bytes.Clone(raw)
+	}
+	b.open.Reset()
+
+	b.blocks = append(b.blocks, block)
+	b.size += len(block.data)
+
+	cutoff := time.Time{}
+	if b.maxAge > 0 {
+		cutoff = time.Now().Add(-b.maxAge)
+	}
+	for len(b.blocks) > 1 && (b.size > b.maxBytes || b.blocks[0].newest.Before(cutoff)) {
+		b.size -= len(b.blocks[0].data)
+		b.blocks = b.blocks[1:]
+	}
+}
+
+// bytes returns the size of the compressed blocks and the open block.
+func (b *compressedBuffer) bytes() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.size + b.open.Len()
+}
+
+// drain empties the buffer, returning all entries within maxAge from oldest to newest.
+func (b *compressedBuffer) drain() []logging.Entry {
+	b.mu.Lock()
+	b.seal()
+	blocks := b.blocks
+	b.blocks, b.size = nil, 0
+	b.mu.Unlock()
+
+	cutoff := time.Time{}
+	if b.maxAge > 0 {
+		cutoff = time.Now().Add(-b.maxAge)
+	}
+
+	var out []logging.Entry
+	for _, block := range blocks {
+		raw := block.data
+		if block.compressed {
+			var err error
+			raw, err = b.c.Decompress(block.data, block.rawLen)
+			if err != nil {
+				diag().Error("failed to decompress buffered entries", "error", err)
+				continue
+			}
+		}
+
+		dec := json.NewDecoder(bytes.NewReader(raw))
+		for dec.More() {
+			var je jsonEntry
+			if err := dec.Decode(&je); err != nil {
+				diag().Error("failed to decode buffered entry", "error", err)
+				break
+			}
+			if je.Timestamp.Before(cutoff) {
+				continue
+			}
+			out = append(out, je.entry())
+		}
+	}
+	return out
+}
@@ -0,0 +1,160 @@
+package lease
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+
+	"cloud.google.com/go/logging"
+)
+
+// errSinkClosed is returned by ConcurrentSink.Log once the sink is closed.
+var errSinkClosed = errors.New("sink is closed")
+
+// ConcurrentSink is a Sink that ships entries to another sink from a pool of workers.
+//   - at most maxInFlight entries are queued or being shipped, Log blocks once the limit is reached
+//   - entries may be shipped out of order when there is more than one worker
+//   - Log only returns the errors of queueing the entry, the errors of the workers are reported to the Manager, which
+//     counts them and quarantines rejected entries, and are counted by Failed
+type ConcurrentSink struct {
+	sink  Sink
+	queue chan logging.Entry
+	// onFailure receives the entries the workers failed to ship and their errors, see NewManager
+	onFailure func(logging.Entry, error)
+
+	mu      sync.Mutex
+	idle    *sync.Cond
+	pending int
+	closed  bool
+	// workers tracks the workers, which exit once Close closes the queue
+	workers sync.WaitGroup
+
+	failed atomic.Int64
+}
+
+// NewConcurrentSink creates a ConcurrentSink shipping to sink with the given number of workers.
+//   - workers defaults to 1 and maxInFlight to the number of workers
+func NewConcurrentSink(sink Sink, workers, maxInFlight int) *ConcurrentSink {
+	if workers < 1 {
+		workers = 1
+	}
+	if maxInFlight < workers {
+		maxInFlight = workers
+	}
+
+	s := &ConcurrentSink{
+		sink:  sink,
+		queue: make(chan logging.Entry, maxInFlight-workers),
+	}
+	s.idle = sync.NewCond(&s.mu)
+
+	s.workers.Add(workers)
+	for range workers {
+		go s.work()
+	}
+
+	return s
+}
+
+// Log queues the entry for a worker, blocking while maxInFlight entries are in flight.
+//   - entries the underlying sink rejects up front are returned as errors instead of being queued
+func (s *ConcurrentSink) Log(e logging.Entry) error {
+	if err := s.ValidateEntry(e); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return errSinkClosed
+	}
+	s.pending++
+	s.mu.Unlock()
+
+	s.queue <- e
+	return nil
+}
+
+// ValidateEntry validates the entry with the underlying sink, if it is an EntryValidator.
+func (s *ConcurrentSink) ValidateEntry(e logging.Entry) error {
+	if v, ok := s.sink.(EntryValidator); ok {
+		return v.ValidateEntry(e)
+	}
+	return nil
+}
+
+// Flush waits for all queued entries to be shipped, then flushes the underlying sink.
+func (s *ConcurrentSink) Flush() error {
+	s.mu.Lock()
+	for s.pending > 0 {
+		s.idle.Wait()
+	}
+	s.mu.Unlock()
+
+	return s.sink.Flush()
+}
+
+// Close waits for all queued entries to be shipped and the workers to exit, then closes the underlying sink, if it
+// is an io.Closer.
+//   - entries logged after Close are refused with an error
+func (s *ConcurrentSink) Close() error {
+	s.mu.Lock()
+	wasClosed := s.closed
+	s.closed = true
+	for s.pending > 0 {
+		s.idle.Wait()
+	}
+	s.mu.Unlock()
+
+	if wasClosed {
+		return nil
+	}
+	// nothing is pending and Log refuses new entries, so nothing sends to the queue anymore
+	close(s.queue)
+	s.workers.Wait()
+
+	if c, ok := s.sink.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// Pending returns the number of entries queued or being shipped.
+func (s *ConcurrentSink) Pending() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.pending
+}
+
+// Failed returns the number of entries the workers failed to ship.
+func (s *ConcurrentSink) Failed() int64 {
+	return s.failed.Load()
+}
+
+// setOnFailure reports the entries the workers fail to ship, and the errors, to f instead of the diagnostics.
+func (s *ConcurrentSink) setOnFailure(f func(logging.Entry, error)) {
+	s.onFailure = f
+}
+
+// work ships queued entries to the underlying sink.
+func (s *ConcurrentSink) work() {
+	defer s.workers.Done()
+	for e := range s.queue {
+		if err := s.sink.Log(e); err != nil {
+			s.failed.Add(1)
+			if s.onFailure != nil {
+				s.onFailure(e, err)
+			} else {
+				diag().Error("failed to ship entry", "error", err)
+			}
+		}
+
+		s.mu.Lock()
+		s.pending--
+		if s.pending == 0 {
+			s.idle.Broadcast()
+		}
+		s.mu.Unlock()
+	}
+}
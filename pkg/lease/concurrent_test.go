@@ -0,0 +1,43 @@
+package lease
+
+import (
+	"runtime"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/logging"
+)
+
+func TestConcurrentSinkClose(t *testing.T) {
+	before := runtime.NumGoroutine()
+
+	sink := &recordingSink{}
+	s := NewConcurrentSink(sink, 4, 16)
+	for range 10 {
+		if err := s.Log(logging.Entry{Payload: "x"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := len(sink.payloads()); got != 10 {
+		t.Errorf("shipped %d entries before Close returned, want 10", got)
+	}
+	if err := s.Log(logging.Entry{Payload: "late"}); err != errSinkClosed {
+		t.Errorf("Log() after Close = %v, want %v", err, errSinkClosed)
+	}
+	if err := s.Close(); err != nil {
+		t.Errorf("second Close() = %v", err)
+	}
+
+	// the workers exit with Close, give the runtime a moment to reap them
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := runtime.NumGoroutine(); got > before {
+		t.Errorf("%d goroutines after Close, want at most %d", got, before)
+	}
+}
@@ -0,0 +1,49 @@
+package lease
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+)
+
+// controlMaxBody bounds the body of a single request submitting entries to the control API.
+const controlMaxBody = 32 << 20
+
+// ControlHandler returns an http.Handler for other processes on the host to log through the manager, sharing its
+// lease watch rather than each opening their own, see the serve command.
+//   - GET /v1/state serves the State of the manager as JSON, so clients can tell whether their entries ship
+//   - POST /v1/entries ships newline-delimited JSON records like StructuredWriter, and responds with the number of
+//     entries accepted
+//   - entries are shipped while the lease ships their severity, or at any time at ERROR level or above, and are never
+//     written locally
+//   - requests are not authenticated, and entries carry no identity of their sender
+func (m *Manager) ControlHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/state", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, m.State())
+	})
+	mux.HandleFunc("POST /v1/entries", func(w http.ResponseWriter, r *http.Request) {
+		var accepted int
+		lines := m.newLineWriter(func(line []byte, truncated bool) {
+			if m.logRecord(line, truncated) {
+				accepted++
+			}
+		})
+
+		_, err := io.Copy(lines, http.MaxBytesReader(w, r.Body, controlMaxBody))
+		lines.Close()
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]any{"accepted": accepted, "error": err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"accepted": accepted})
+	})
+	return mux
+}
+
+// writeJSON writes v as the JSON response with the given status.
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,66 @@
+package lease
+
+import (
+	"cloud.google.com/go/logging"
+)
+
+// costAttribution labels shipped entries for attributing ingestion spend, see WithCostAttribution.
+type costAttribution struct {
+	// costCenters maps lease owners to their cost center
+	costCenters map[string]string
+	fallback    string
+}
+
+// WithCostAttribution labels every shipped entry with size_bucket and cost_center labels, so ingestion spend can be
+// attributed to the teams holding leases.
+//   - cost_center is looked up by the owner of the active lease in costCenters, falling back to defaultCostCenter
+//   - entries shipped without an active lease, such as errors, are attributed to defaultCostCenter
+//   - size_bucket is the estimated size of the entry, such as "1k-4k", before the labels are added
+func WithCostAttribution(costCenters map[string]string, defaultCostCenter string) Option {
+	return func(m *Manager) {
+		m.cost = &costAttribution{costCenters: costCenters, fallback: defaultCostCenter}
+	}
+}
+
+// attributeCost returns the entry with cost attribution labels, without modifying the labels of the original entry.
+func (m *Manager) attributeCost(e logging.Entry) logging.Entry {
+	costCenter := m.cost.fallback
+	if src := m.activeSource(); src != nil {
+		if lease := src.lease.Load(); lease != nil {
+			owner := lease.Owner
+			if owner == "" {
+				owner = lease.User
+			}
+			if c, ok := m.cost.costCenters[owner]; ok {
+				costCenter = c
+			}
+		}
+	}
+
+	e = withLabel(e, "size_bucket", sizeBucket(entrySize(e)))
+	if costCenter != "" {
+		e.Labels["cost_center"] = costCenter
+	}
+	return e
+}
+
+// sizeBuckets are the upper bounds of the size_bucket labels, the last bucket has no bound.
+var sizeBuckets = []struct {
+	max   int
+	label string
+}{
+	{1 << 10, "lt1k"},
+	{4 << 10, "1k-4k"},
+	{16 << 10, "4k-16k"},
+	{64 << 10, "16k-64k"},
+}
+
+// sizeBucket returns the size_bucket label for an entry of the given size.
+func sizeBucket(size int) string {
+	for _, b := range sizeBuckets {
+		if size < b.max {
+			return b.label
+		}
+	}
+	return "ge64k"
+}
@@ -0,0 +1,106 @@
+package lease
+
+import (
+	"io"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/logging"
+)
+
+// decorationTimeLayout is the layout of the timestamps prepended to decorated lines.
+const decorationTimeLayout = "2006-01-02T15:04:05.000Z07:00"
+
+// Decoration configures what is prepended to the lines of StdoutWriter and StderrWriter printed locally, and labeled on
+// the entries they ship, see WithDecoration.
+type Decoration struct {
+	// Timestamps prepends the time each line started, which is also the timestamp of its entry
+	Timestamps bool
+	// Stream prepends the name of the stream, stdout or stderr, which is also the stream label of its entry
+	Stream bool
+	// Prefix prepends this text, such as the name of the service, which is also the prefix label of its entry
+	Prefix string
+}
+
+// WithDecoration decorates the lines of StdoutWriter and StderrWriter, helping tell apart the output of several
+// captures multiplexed into one terminal.
+//   - local lines are printed as "<time> <stream> <prefix> <line>", leaving out what is not enabled
+//   - shipped entries are stamped and labeled with the same information instead, and keep their text as is
+func WithDecoration(d Decoration) Option {
+	return func(m *Manager) {
+		m.decoration = &d
+	}
+}
+
+// decoratedWriter returns an io.Writer printing the output of a stream to w, prepending the decoration to each line.
+func (m *Manager) decoratedWriter(w io.Writer, stream string) io.Writer {
+	if m.decoration == nil {
+		return w
+	}
+	return &decoratedWriter{w: w, d: *m.decoration, stream: stream, bol: true}
+}
+
+// decoratedWriter is an io.Writer prepending a decoration to the start of every line written to it.
+type decoratedWriter struct {
+	mu     sync.Mutex
+	w      io.Writer
+	d      Decoration
+	stream string
+	// bol is set when the next byte starts a new line
+	bol bool
+}
+
+func (w *decoratedWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	out := make([]byte, 0, len(p)+64)
+	for _, b := range p {
+		if w.bol {
+			out = w.appendDecoration(out)
+		}
+		out = append(out, b)
+		w.bol = b == '\n'
+	}
+
+	if _, err := w.w.Write(out); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// appendDecoration appends the decoration of a line starting now to b.
+func (w *decoratedWriter) appendDecoration(b []byte) []byte {
+	if w.d.Timestamps {
+		b = time.Now().AppendFormat(b, decorationTimeLayout)
+		b = append(b, ' ')
+	}
+	if w.d.Stream {
+		b = append(b, w.stream...)
+		b = append(b, ' ')
+	}
+	if w.d.Prefix != "" {
+		b = append(b, w.d.Prefix...)
+		b = append(b, ' ')
+	}
+	return b
+}
+
+// logStream ships an entry written to the given stream, such as stdout, stamping and labeling it with the decoration.
+//   - text over the maximum line size is truncated or split, see WithMaxLineSize
+func (m *Manager) logStream(e logging.Entry, stream string) {
+	if d := m.decoration; d != nil && stream != "" {
+		if d.Timestamps && e.Timestamp.IsZero() {
+			e.Timestamp = time.Now()
+		}
+		if d.Stream {
+			e = withLabel(e, "stream", stream)
+		}
+		if d.Prefix != "" {
+			e = withLabel(e, "prefix", d.Prefix)
+		}
+	}
+	for _, e := range m.limitLine(e) {
+		m.log(e, m.shouldShip(e.Severity))
+	}
+}
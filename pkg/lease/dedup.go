@@ -0,0 +1,92 @@
+package lease
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/logging"
+)
+
+// deduper collapses identical consecutive shipped entries, see WithDedup.
+type deduper struct {
+	window time.Duration
+
+	mu sync.Mutex
+	// key identifies the last shipped entry, and last is its latest repeat
+	key     string
+	last    logging.Entry
+	first   time.Time
+	repeats int
+	timer   *time.Timer
+}
+
+// WithDedup collapses identical consecutive shipped entries within the given window, to cut the volume of retry loops.
+//   - entries are identical when their severity, log name, and message match, other payload fields are not compared
+//   - the first entry ships right away, its repeats ship as a single entry labeled repeat_count with the number of
+//     repeats, once a different entry is shipped or the window ends
+//   - the collapsed entry is the last repeat, so its timestamp and payload are the latest ones
+func WithDedup(window time.Duration) Option {
+	return func(m *Manager) {
+		m.dedup = &deduper{window: window}
+	}
+}
+
+// dedupKey returns the key identical entries share.
+func dedupKey(e logging.Entry) string {
+	return e.Severity.String() + "\x00" + e.LogName + "\x00" + entryMessage(e)
+}
+
+// shipDeduped ships an entry, unless it repeats the last one within the window.
+func (m *Manager) shipDeduped(e logging.Entry) {
+	d := m.dedup
+	key := dedupKey(e)
+	now := time.Now()
+
+	d.mu.Lock()
+	if key == d.key && now.Sub(d.first) < d.window {
+		d.repeats++
+		d.last = e
+		if d.timer == nil {
+			d.timer = time.AfterFunc(d.window-now.Sub(d.first), m.flushDedup)
+		}
+		d.mu.Unlock()
+		return
+	}
+	collapsed, ok := d.take()
+	d.key, d.first = key, now
+	d.mu.Unlock()
+
+	if ok {
+		m.shipLimited(collapsed, true)
+	}
+	m.shipLimited(e, true)
+}
+
+// flushDedup ships the collapsed repeats of the last entry, if there are any.
+//   - the next identical entry starts a new window and ships right away
+func (m *Manager) flushDedup() {
+	d := m.dedup
+	d.mu.Lock()
+	collapsed, ok := d.take()
+	d.key = ""
+	d.mu.Unlock()
+
+	if ok {
+		m.shipLimited(collapsed, true)
+	}
+}
+
+// take returns the collapsed entry for the repeats, and resets them, with mu held.
+func (d *deduper) take() (logging.Entry, bool) {
+	if d.timer != nil {
+		d.timer.Stop()
+		d.timer = nil
+	}
+	if d.repeats == 0 {
+		return logging.Entry{}, false
+	}
+	e := withLabel(d.last, "repeat_count", strconv.Itoa(d.repeats))
+	d.repeats, d.last = 0, logging.Entry{}
+	return e, true
+}
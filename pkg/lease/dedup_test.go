@@ -0,0 +1,59 @@
+package lease
+
+import (
+	"testing"
+	"time"
+
+	"cloud.google.com/go/logging"
+)
+
+func TestDedup(t *testing.T) {
+	sink := &recordingSink{}
+	m := newTestManager(t, WithSink(sink, Leased), WithDedup(time.Hour))
+
+	for _, p := range []string{"retrying", "retrying", "retrying", "connected", "retrying"} {
+		m.log(logging.Entry{Severity: logging.Info, Payload: p}, true)
+	}
+	// a different severity is a different entry
+	m.log(logging.Entry{Severity: logging.Warning, Payload: "retrying"}, true)
+	m.log(logging.Entry{Severity: logging.Warning, Payload: "retrying"}, true)
+	m.Close()
+
+	want := []struct {
+		payload string
+		repeats string
+	}{
+		{"retrying", ""},
+		{"retrying", "2"},
+		{"connected", ""},
+		{"retrying", ""},
+		{"retrying", ""},
+		{"retrying", "1"},
+	}
+	if len(sink.entries) != len(want) {
+		t.Fatalf("shipped %q, want %d entries", sink.payloads(), len(want))
+	}
+	for i, w := range want {
+		e := sink.entries[i]
+		if e.Payload != w.payload || e.Labels["repeat_count"] != w.repeats {
+			t.Errorf("entry %d = %q with repeat_count %q, want %q with %q", i, e.Payload, e.Labels["repeat_count"], w.payload, w.repeats)
+		}
+	}
+}
+
+func TestDedupWindow(t *testing.T) {
+	sink := &recordingSink{}
+	m := newTestManager(t, WithSink(sink, Leased), WithDedup(20*time.Millisecond))
+
+	m.log(logging.Entry{Severity: logging.Info, Payload: "retrying"}, true)
+	m.log(logging.Entry{Severity: logging.Info, Payload: "retrying"}, true)
+
+	// the repeats ship once the window ends, without waiting for a different entry
+	time.Sleep(100 * time.Millisecond)
+	if got := len(sink.payloads()); got != 2 {
+		t.Fatalf("shipped %d entries, want 2", got)
+	}
+	if got := sink.entries[1].Labels["repeat_count"]; got != "1" {
+		t.Errorf("repeat_count = %q, want %q", got, "1")
+	}
+}
@@ -0,0 +1,45 @@
+package lease
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"sync/atomic"
+)
+
+// diagnostics is the logger for the diagnostics of the package itself, see SetDiagnostics.
+var diagnostics atomic.Pointer[slog.Logger]
+
+func init() {
+	diagnostics.Store(slog.New(slog.NewTextHandler(os.Stderr, nil)))
+}
+
+// SetDiagnostics replaces the logger the package reports its own diagnostics to, such as lease transitions and sink
+// failures, which defaults to text at INFO on stderr.
+//   - lease transitions are logged at INFO, ignored leases and tokens at WARN, and failures at ERROR
+//   - a nil logger discards diagnostics
+func SetDiagnostics(l *slog.Logger) {
+	if l == nil {
+		l = slog.New(discardHandler{})
+	}
+	diagnostics.Store(l)
+}
+
+// Diagnostics returns the logger the package reports its own diagnostics to, for packages extending the manager, such
+// as sinks and processors built on other libraries, to report theirs alongside.
+func Diagnostics() *slog.Logger {
+	return diagnostics.Load()
+}
+
+// diag returns the logger for diagnostics.
+func diag() *slog.Logger {
+	return diagnostics.Load()
+}
+
+// discardHandler is a slog.Handler discarding every record.
+type discardHandler struct{}
+
+func (discardHandler) Enabled(context.Context, slog.Level) bool  { return false }
+func (discardHandler) Handle(context.Context, slog.Record) error { return nil }
+func (h discardHandler) WithAttrs([]slog.Attr) slog.Handler      { return h }
+func (h discardHandler) WithGroup(string) slog.Handler           { return h }
@@ -0,0 +1,43 @@
+// Package lease ships logs to Cloud Logging only while a lease allows it.
+//
+// A Manager watches a Firestore lease document and enables shipping while the lease has not expired. Everything
+// written through the Manager is printed locally, and is shipped to its sinks only while leased, so services can log
+// verbosely without paying to store it until someone asks for it. WithShipOnly stops printing what is shipped.
+//
+// Create a Manager with NewManager and configure it with functional options:
+//   - WithSink adds destinations for shipped entries, such as a CloudLoggingSink or a FileSink
+//   - WithLeases, WithParentLeases, and WithLeasePolicy combine several lease documents
+//   - WithLabels, WithInstanceID, and WithProcessors shape the shipped entries
+//   - WithReplayBuffer, WithShutdownBuffer, and WithSpool keep recent entries to ship once a lease starts
+//
+// Entries are written with SlogLogger, StdLogger, the writers such as StdoutWriter, or directly with Write.
+// HTTPMiddleware and the gRPC server interceptors log requests. Integrations that would pull in more dependencies, such
+// as logrus and zerolog loggers, Prometheus metrics, and Parquet sinks, live in the packages under contrib, built on
+// Ships, PrintsLocally, and Log.
+//
+// Embedding the Manager in a service:
+//
+//	client, err := logging.NewClient(ctx, projectID)
+//	if err != nil {
+//		return err
+//	}
+//	defer client.Close()
+//
+//	m := lease.NewManager(ctx, time.Now().Add(time.Minute), fsClient.Collection("leases").Doc("my-service"),
+//		lease.WithSink(lease.NewCloudLoggingSink(client.Logger("my-service")), lease.Leased),
+//		lease.WithLabels(map[string]string{"service": "my-service"}),
+//	)
+//	defer m.Close()
+//
+//	logger := m.SlogLogger()
+//	logger.Info("started", "port", 8080)
+//
+// Capturing existing output instead of using slog:
+//
+//	log.SetOutput(m.StderrWriter())
+//	cmd.Stdout = m.StdoutWriter()
+//
+// Lease documents live in the leases collection, keyed by lease id, and are read as a Document. The Manager reports
+// its state to the status subcollection of each lease document, and changes made by the CLI are recorded in the
+// history subcollection.
+package lease
@@ -0,0 +1,86 @@
+package lease
+
+import (
+	"fmt"
+	"log/slog"
+	"runtime"
+	"runtime/debug"
+)
+
+// reportedErrorEventType marks payloads as error events for Error Reporting, even without a stack trace.
+const reportedErrorEventType = "type.googleapis.com/google.devtools.clouderrorreporting.v1beta1.ReportedErrorEvent"
+
+// errorValue converts an error to a payload object with its message and type.
+//   - errors wrapping others, with fmt.Errorf %w or errors.Join, also list the message and type of every error in the
+//     chain, outermost first
+func errorValue(err error) map[string]any {
+	v := map[string]any{
+		"message": err.Error(),
+		"type":    fmt.Sprintf("%T", err),
+	}
+
+	var chain []any
+	queue := []error{err}
+	for len(queue) > 0 {
+		e := queue[0]
+		queue = queue[1:]
+		if e == nil {
+			continue
+		}
+		chain = append(chain, map[string]any{"message": e.Error(), "type": fmt.Sprintf("%T", e)})
+
+		switch u := e.(type) {
+		case interface{ Unwrap() error }:
+			queue = append(queue, u.Unwrap())
+		case interface{ Unwrap() []error }:
+			queue = append(queue, u.Unwrap()...)
+		}
+	}
+	if len(chain) > 1 {
+		v["chain"] = chain
+	}
+	return v
+}
+
+// recordError returns the first error among attrs, outside of groups, or nil.
+func recordError(attrs []slog.Attr) error {
+	for _, a := range attrs {
+		v := a.Value.Resolve()
+		if v.Kind() != slog.KindAny {
+			continue
+		}
+		if err, ok := v.Any().(error); ok {
+			return err
+		}
+	}
+	return nil
+}
+
+// reportError makes a payload of a record at ERROR or above with an error attribute an Error Reporting event.
+//   - the payload is marked as a ReportedErrorEvent, with the report location of the record when known
+//   - the stack of the logging goroutine is added as stack_trace when stack is set, so the event groups by it
+//   - the service label of the manager names the service in the serviceContext
+func (m *Manager) reportError(payload map[string]any, err error, pc uintptr, stack bool) {
+	payload["@type"] = reportedErrorEventType
+	if msg, ok := payload["message"].(string); ok && msg != err.Error() {
+		payload["message"] = msg + ": " + err.Error()
+	}
+
+	if pc != 0 {
+		f, _ := runtime.CallersFrames([]uintptr{pc}).Next()
+		payload["context"] = map[string]any{
+			"reportLocation": map[string]any{
+				"filePath":     f.File,
+				"lineNumber":   f.Line,
+				"functionName": f.Function,
+			},
+		}
+	}
+	if stack {
+		// Error Reporting parses Go stacks that follow the error message, like a panic
+		payload["stack_trace"] = err.Error() + "\n\n" + string(debug.Stack())
+	}
+	if service := m.labels["service"]; service != "" {
+		payload["serviceContext"] = map[string]any{"service": service}
+	}
+}
@@ -0,0 +1,118 @@
+package lease_test
+
+import (
+	"context"
+	"crypto/ed25519"
+	"fmt"
+	"log"
+	"net/http"
+	"os/exec"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"cloud.google.com/go/logging"
+
+	"github.com/carsonoid/talk-leased-logs/pkg/lease"
+)
+
+// Embedding the manager in a service, shipping to Cloud Logging while the lease of the service is active.
+func Example() {
+	ctx := context.Background()
+
+	fsClient, err := firestore.NewClient(ctx, "my-project")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer fsClient.Close()
+
+	logClient, err := logging.NewClient(ctx, "my-project")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer logClient.Close()
+
+	// ship everything for the first minute, so startup problems are never missed
+	m := lease.NewManager(ctx, time.Now().Add(time.Minute), fsClient.Collection("leases").Doc("my-service"),
+		lease.WithSink(lease.NewCloudLoggingSink(logClient.Logger("my-service")), lease.Leased),
+		lease.WithLabels(map[string]string{"service": "my-service"}),
+	)
+	// closed before the logging client, so the last entries are shipped
+	defer m.Close()
+
+	logger := m.SlogLogger()
+	logger.Info("started", "port", 8080)
+}
+
+func ExampleManager_SlogLoggerWithOptions() {
+	var m *lease.Manager // from lease.NewManager
+
+	logger := m.SlogLoggerWithOptions(lease.SlogOptions{AddSource: true, ErrorStacks: true})
+	logger.WithGroup("req").Info("handled", "path", "/checkout", "status", 200)
+}
+
+func ExampleManager_StdoutWriter() {
+	var m *lease.Manager // from lease.NewManager
+
+	cmd := exec.Command("./legacy-service")
+	cmd.Stdout = m.StdoutWriter()
+	cmd.Stderr = m.StderrWriter()
+	if err := cmd.Run(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func ExampleManager_HTTPMiddleware() {
+	var m *lease.Manager // from lease.NewManager
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/checkout", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	log.Fatal(http.ListenAndServe(":8080", m.HTTPMiddleware(mux)))
+}
+
+// Protecting a slow sink, so bursts while leased neither stall logging nor saturate the link.
+func ExampleNewConcurrentSink() {
+	var fsDoc *firestore.DocumentRef // the lease document
+
+	file, err := lease.NewFileSink("/var/log/leased.jsonl")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// at most 64KiB per second, shipped by 2 workers with up to 1000 entries in flight
+	sink := lease.NewConcurrentSink(lease.NewPacedSink(file, 64<<10, 0), 2, 1000)
+
+	m := lease.NewManager(context.Background(), time.Time{}, fsDoc,
+		lease.WithSink(sink, lease.Leased),
+		lease.WithQueue(10000, lease.BackpressureDropOldest),
+		lease.WithRateLimit(500, 0, lease.RateLimitSample),
+	)
+	defer m.Close()
+}
+
+func ExampleSignToken() {
+	// in practice, the key is loaded with LoadTokenSigningKey and LoadTokenVerifyKey
+	priv := ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize))
+	pub := priv.Public().(ed25519.PublicKey)
+
+	start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	s, err := lease.SignToken(lease.Token{
+		ID:        "t-1",
+		LeaseID:   "checkout",
+		User:      "alice@example.com",
+		Reason:    "firestore outage",
+		NotBefore: start,
+		ExpireAt:  start.Add(time.Hour),
+	}, priv)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	t, err := lease.ParseToken(s, pub)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(t.LeaseID, t.User, t.Valid(start.Add(30*time.Minute)), t.Valid(start.Add(2*time.Hour)))
+	// Output: checkout alice@example.com true false
+}
@@ -0,0 +1,100 @@
+//go:build chaos
+
+package lease
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// faultsEnv configures the fault points of chaos builds, for example "drop-snapshots=0.5,sink-delay=200ms,sink-errors=0.1".
+const faultsEnv = "LEASED_LOGS_FAULTS"
+
+// Faults configures the fault points compiled in with the chaos build tag.
+//   - probabilities are between 0 and 1, the zero value injects no faults
+type Faults struct {
+	// DropSnapshots is the probability that a lease snapshot is ignored as if it was never received.
+	DropSnapshots float64
+	// SinkDelay delays every sink write.
+	SinkDelay time.Duration
+	// SinkErrors is the probability that a sink write fails with a quota error instead of being shipped.
+	SinkErrors float64
+}
+
+var faults atomic.Pointer[Faults]
+
+func init() {
+	v := os.Getenv(faultsEnv)
+	if v == "" {
+		return
+	}
+
+	f, err := ParseFaults(v)
+	if err != nil {
+		diag().Error("failed to parse faults", "env", faultsEnv, "error", err)
+		return
+	}
+	SetFaults(f)
+}
+
+// SetFaults replaces the faults injected by the manager.
+func SetFaults(f Faults) {
+	faults.Store(&f)
+}
+
+// ParseFaults parses a comma-separated list of key=value fault settings.
+func ParseFaults(s string) (Faults, error) {
+	var f Faults
+	for _, kv := range strings.Split(s, ",") {
+		k, v, ok := strings.Cut(strings.TrimSpace(kv), "=")
+		if !ok {
+			return f, fmt.Errorf("invalid fault %q, must be key=value", kv)
+		}
+
+		var err error
+		switch k {
+		case "drop-snapshots":
+			f.DropSnapshots, err = strconv.ParseFloat(v, 64)
+		case "sink-delay":
+			f.SinkDelay, err = time.ParseDuration(v)
+		case "sink-errors":
+			f.SinkErrors, err = strconv.ParseFloat(v, 64)
+		default:
+			return f, fmt.Errorf("unknown fault %q", k)
+		}
+		if err != nil {
+			return f, fmt.Errorf("invalid value for fault %q: %w", k, err)
+		}
+	}
+	return f, nil
+}
+
+// dropSnapshot reports whether the next lease snapshot should be dropped.
+func dropSnapshot() bool {
+	f := faults.Load()
+	return f != nil && rand.Float64() < f.DropSnapshots
+}
+
+// sinkFault delays a sink write and reports whether it should fail instead of being shipped.
+func sinkFault() error {
+	f := faults.Load()
+	if f == nil {
+		return nil
+	}
+
+	if f.SinkDelay > 0 {
+		time.Sleep(f.SinkDelay)
+	}
+	if rand.Float64() < f.SinkErrors {
+		return status.Error(codes.ResourceExhausted, "injected fault: quota exceeded")
+	}
+	return nil
+}
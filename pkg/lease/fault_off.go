@@ -0,0 +1,13 @@
+//go:build !chaos
+
+package lease
+
+// dropSnapshot never drops snapshots outside of chaos builds.
+func dropSnapshot() bool {
+	return false
+}
+
+// sinkFault never injects sink faults outside of chaos builds.
+func sinkFault() error {
+	return nil
+}
@@ -0,0 +1,156 @@
+package lease
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"cloud.google.com/go/logging"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// UnaryServerInterceptor returns a gRPC interceptor that logs the method, status code, and duration of every unary RPC.
+//   - server-side failures are logged at ERROR and so always ship, client errors at WARNING, and successes at INFO
+//   - while a lease is active, the request and response messages are added to the entry
+//   - entries are never written locally
+func (m *Manager) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		start := time.Now()
+		resp, err := handler(ctx, req)
+
+		payload := rpcPayload(info.FullMethod, err, time.Since(start))
+		if m.enabled.Load() {
+			payload["request"] = messagePayload(req)
+			if err == nil {
+				payload["response"] = messagePayload(resp)
+			}
+		}
+		m.logRPC(start, err, payload)
+
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor returns a gRPC interceptor that logs the method, status code, and duration of every stream.
+//   - stream entries also count the messages received and sent
+//   - while a lease is active, every message is logged as its own DEBUG entry as it is received or sent
+//   - entries are never written locally
+func (m *Manager) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start := time.Now()
+		ls := &leasedStream{ServerStream: ss, m: m, method: info.FullMethod}
+		err := handler(srv, ls)
+
+		payload := rpcPayload(info.FullMethod, err, time.Since(start))
+		payload["received"] = ls.received
+		payload["sent"] = ls.sent
+		m.logRPC(start, err, payload)
+
+		return err
+	}
+}
+
+// logRPC logs an RPC entry at a severity derived from its status code.
+func (m *Manager) logRPC(start time.Time, err error, payload map[string]any) {
+	severity := rpcSeverity(status.Code(err))
+	m.log(logging.Entry{
+		Timestamp: start,
+		Severity:  severity,
+		Payload:   payload,
+	}, m.shouldShip(severity))
+}
+
+// rpcPayload returns the payload describing a finished RPC.
+func rpcPayload(method string, err error, d time.Duration) map[string]any {
+	code := status.Code(err)
+	payload := map[string]any{
+		"message":  fmt.Sprintf("%s %s", method, code),
+		"method":   method,
+		"code":     code.String(),
+		"duration": d.String(),
+	}
+	if err != nil {
+		payload["error"] = status.Convert(err).Message()
+	}
+	return payload
+}
+
+// rpcSeverity maps a status code to a severity, ERROR for codes that point at the server rather than the caller.
+func rpcSeverity(code codes.Code) logging.Severity {
+	switch code {
+	case codes.OK:
+		return logging.Info
+	case codes.Canceled, codes.InvalidArgument, codes.NotFound, codes.AlreadyExists, codes.PermissionDenied,
+		codes.Unauthenticated, codes.FailedPrecondition, codes.OutOfRange, codes.ResourceExhausted:
+		return logging.Warning
+	default:
+		return logging.Error
+	}
+}
+
+// messagePayload converts a message to a JSON value for a payload, or describes its type if it is not a proto message.
+func messagePayload(msg any) any {
+	pm, ok := msg.(proto.Message)
+	if !ok {
+		return fmt.Sprintf("%T", msg)
+	}
+	b, err := protojson.Marshal(pm)
+	if err != nil {
+		return fmt.Sprintf("%T: %v", msg, err)
+	}
+	var v any
+	if err := json.Unmarshal(b, &v); err != nil {
+		return string(b)
+	}
+	return v
+}
+
+// leasedStream is a grpc.ServerStream counting messages, and logging them while a lease is active.
+type leasedStream struct {
+	grpc.ServerStream
+	m        *Manager
+	method   string
+	received int
+	sent     int
+}
+
+// RecvMsg receives a message, logging it while a lease is active.
+func (s *leasedStream) RecvMsg(msg any) error {
+	err := s.ServerStream.RecvMsg(msg)
+	if err == nil {
+		s.received++
+		s.logMessage("received", msg)
+	}
+	return err
+}
+
+// SendMsg sends a message, logging it while a lease is active.
+func (s *leasedStream) SendMsg(msg any) error {
+	err := s.ServerStream.SendMsg(msg)
+	if err == nil {
+		s.sent++
+		s.logMessage("sent", msg)
+	}
+	return err
+}
+
+// logMessage logs a single stream message, only while a lease is active.
+func (s *leasedStream) logMessage(direction string, msg any) {
+	if !s.m.enabled.Load() {
+		return
+	}
+	s.m.log(logging.Entry{
+		Severity: logging.Debug,
+		Payload: map[string]any{
+			"message":   fmt.Sprintf("%s %s message", s.method, direction),
+			"method":    s.method,
+			"direction": direction,
+			"body":      messagePayload(msg),
+		},
+	}, s.m.shouldShip(logging.Debug))
+}
@@ -0,0 +1,272 @@
+package lease
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"cloud.google.com/go/logging"
+)
+
+// Labels attached to chained entries.
+const (
+	ChainSessionLabel = "chain_session"
+	ChainSeqLabel     = "chain_seq"
+	ChainHashLabel    = "chain_hash"
+)
+
+// chainReportInterval is how often the chain head is recorded in the lease status while shipping.
+const chainReportInterval = time.Minute
+
+// WithHashChain links every entry shipped to leased sinks into a SHA-256 hash chain, for tamper-evidence.
+//   - a new chain starts with a random session ID every time the lease becomes active
+//   - the hash of each entry is SHA-256(previous hash + JSON of the entry without chain labels), the session ID standing
+//     in for the previous hash of the first entry, with the JSON as written by FileSink
+//   - entries are labeled with the session, their sequence number from 1, and their hash
+//   - the chain head is recorded in the lease status when leases change, every minute, and when the session ends
+func WithHashChain() Option {
+	return func(m *Manager) {
+		m.chain = &hashChain{}
+	}
+}
+
+// hashChain is the hash chain of the current lease session.
+type hashChain struct {
+	mu      sync.Mutex
+	session string
+	seq     int64
+	head    []byte
+}
+
+// ChainHead is the last link of a hash chain.
+type ChainHead struct {
+	Session string
+	Seq     int64
+	Hash    string
+}
+
+// start begins a new chain with a new session ID.
+func (c *hashChain) start() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.startLocked()
+}
+
+// startLocked is start with c.mu held.
+func (c *hashChain) startLocked() error {
+	session, err := NewCorrelationID()
+	if err != nil {
+		return err
+	}
+	c.session = session
+	c.seq = 0
+	c.head = []byte(session)
+	return nil
+}
+
+// link appends the entry to the chain and returns it with the chain labels.
+func (c *hashChain) link(e logging.Entry) (logging.Entry, error) {
+	// the timestamp is part of the hash, so it must be the one that ships
+	if e.Timestamp.IsZero() {
+		e.Timestamp = time.Now().UTC()
+	}
+	b, err := chainBytes(e)
+	if err != nil {
+		return e, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// entries that always ship can arrive before any lease was active
+	if c.session == "" {
+		if err := c.startLocked(); err != nil {
+			return e, err
+		}
+	}
+
+	h := sha256.New()
+	h.Write(c.head)
+	h.Write(b)
+	c.head = h.Sum(nil)
+	c.seq++
+
+	e = withLabel(e, ChainSessionLabel, c.session)
+	e = withLabel(e, ChainSeqLabel, strconv.FormatInt(c.seq, 10))
+	return withLabel(e, ChainHashLabel, hex.EncodeToString(c.head)), nil
+}
+
+// snapshot returns the current head of the chain.
+func (c *hashChain) snapshot() ChainHead {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return ChainHead{Session: c.session, Seq: c.seq, Hash: hex.EncodeToString(c.head)}
+}
+
+// chainBytes returns the hashed representation of an entry, its JSON without chain labels.
+//   - the JSON is canonicalized, with sorted object keys, so entries read back from JSON hash the same
+func chainBytes(e logging.Entry) ([]byte, error) {
+	je := newJSONEntry(e)
+	if len(je.Labels) > 0 {
+		labels := make(map[string]string, len(je.Labels))
+		for k, v := range je.Labels {
+			if !strings.HasPrefix(k, "chain_") {
+				labels[k] = v
+			}
+		}
+		je.Labels = labels
+	}
+
+	b, err := json.Marshal(je)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return json.Marshal(v)
+}
+
+// VerifyChainFile verifies the hash chains of the entries in a file written by FileSink, one per session.
+//   - entries without chain labels are skipped
+//   - returns the head of every session, in the order sessions first appear
+func VerifyChainFile(r io.Reader) ([]ChainHead, error) {
+	var sessions []string
+	bySession := make(map[string][]logging.Entry)
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64<<10), 16<<20)
+	for line := 1; scanner.Scan(); line++ {
+		var je jsonEntry
+		if err := json.Unmarshal(scanner.Bytes(), &je); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		session := je.Labels[ChainSessionLabel]
+		if session == "" {
+			continue
+		}
+		if _, ok := bySession[session]; !ok {
+			sessions = append(sessions, session)
+		}
+		bySession[session] = append(bySession[session], je.entry())
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	heads := make([]ChainHead, 0, len(sessions))
+	for _, session := range sessions {
+		head, err := VerifyChain(bySession[session])
+		if err != nil {
+			return heads, fmt.Errorf("session %s: %w", session, err)
+		}
+		heads = append(heads, head)
+	}
+	return heads, nil
+}
+
+// VerifyChain checks that entries form an unbroken hash chain from the start of their session.
+//   - entries may be in any order, they are sorted by sequence number as concurrent entries may ship out of order
+//   - returns the head of the chain, which can be compared to the head recorded in the lease status
+func VerifyChain(entries []logging.Entry) (ChainHead, error) {
+	entries = slices.Clone(entries)
+	slices.SortStableFunc(entries, func(a, b logging.Entry) int {
+		x, _ := strconv.ParseInt(a.Labels[ChainSeqLabel], 10, 64)
+		y, _ := strconv.ParseInt(b.Labels[ChainSeqLabel], 10, 64)
+		return cmp.Compare(x, y)
+	})
+
+	var head ChainHead
+	var prev []byte
+	for i, e := range entries {
+		session, seq := e.Labels[ChainSessionLabel], e.Labels[ChainSeqLabel]
+		if i == 0 {
+			head.Session = session
+			prev = []byte(session)
+		}
+		if session != head.Session {
+			return head, fmt.Errorf("entry %d belongs to session %q, not %q", i, session, head.Session)
+		}
+		if seq != strconv.Itoa(i+1) {
+			return head, fmt.Errorf("entry %d has sequence number %q, entries are missing or out of order", i, seq)
+		}
+
+		b, err := chainBytes(e)
+		if err != nil {
+			return head, err
+		}
+		h := sha256.New()
+		h.Write(prev)
+		h.Write(b)
+		prev = h.Sum(nil)
+
+		if hash := hex.EncodeToString(prev); hash != e.Labels[ChainHashLabel] {
+			return head, fmt.Errorf("entry %d does not match its hash, it was modified", i)
+		}
+		head.Seq = int64(i + 1)
+		head.Hash = hex.EncodeToString(prev)
+	}
+	return head, nil
+}
+
+// startChain begins a new chain session when the lease becomes active.
+func (m *Manager) startChain() {
+	if m.chain == nil {
+		return
+	}
+	if err := m.chain.start(); err != nil {
+		diag().Error("failed to start hash chain", "error", err)
+		return
+	}
+	diag().Info("hash chain started", "session", m.chain.snapshot().Session)
+}
+
+// reportChain records the chain head in the status of every watched lease, leaving the rest of the status untouched.
+func (m *Manager) reportChain(ctx context.Context) {
+	if m.chain == nil {
+		return
+	}
+
+	head := m.chain.snapshot()
+	if head.Session == "" {
+		return
+	}
+	for _, src := range m.sources {
+		_, err := StatusCollection(src.docRef).Doc(m.instanceID).Set(ctx, map[string]any{
+			"Chain": head,
+		}, firestore.MergeAll)
+		if err != nil {
+			diag().Error("failed to report hash chain head", "error", err)
+		}
+	}
+}
+
+// reportChainPeriodically records the chain head while the lease is active, until ctx is done.
+func (m *Manager) reportChainPeriodically(ctx context.Context) {
+	t := time.NewTicker(chainReportInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			if m.enabled.Load() {
+				m.reportChain(ctx)
+			}
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package lease
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"cloud.google.com/go/logging"
+)
+
+// WithHeartbeat ships a low-volume heartbeat entry at the given interval while the lease is active.
+//   - heartbeats make a silent leased process distinguishable from a broken pipeline
+func WithHeartbeat(interval time.Duration) Option {
+	return func(m *Manager) {
+		m.heartbeatInterval = interval
+	}
+}
+
+// heartbeat ships heartbeat entries while the lease is active, until the context is canceled.
+func (m *Manager) heartbeat(ctx context.Context) {
+	t := time.NewTicker(m.heartbeatInterval)
+	defer t.Stop()
+
+	host, _ := os.Hostname()
+	var lastShipped int64
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+
+		shipped := m.shipped.Load()
+		if !m.enabled.Load() {
+			lastShipped = shipped
+			continue
+		}
+
+		m.log(logging.Entry{
+			Severity: logging.Info,
+			Labels:   map[string]string{"heartbeat": "true"},
+			Payload: map[string]any{
+				"message":          "leased logging heartbeat",
+				"host":             host,
+				"pid":              os.Getpid(),
+				"instance":         m.instanceID,
+				"shipped":          shipped,
+				"shippedSinceLast": shipped - lastShipped,
+				"interval":         m.heartbeatInterval.String(),
+			},
+		}, true)
+		lastShipped = shipped
+	}
+}
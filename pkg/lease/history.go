@@ -0,0 +1,37 @@
+package lease
+
+import (
+	"time"
+
+	"cloud.google.com/go/firestore"
+)
+
+// History actions recorded for changes to a lease.
+const (
+	HistoryExtend  = "extend"
+	HistoryRenew   = "renew"
+	HistoryExpire  = "expire"
+	HistoryRevoke  = "revoke"
+	HistoryRequest = "request"
+	HistoryApprove = "approve"
+)
+
+// HistoryEntry records a single change made to a lease, for auditing who enabled shipping and why.
+type HistoryEntry struct {
+	Action     string
+	User       string
+	Reason     string
+	Scope      string
+	Tags       map[string]string
+	GrantID    string
+	FollowUpOf string
+	Duration   time.Duration
+	ExpireAt   time.Time
+	At         time.Time
+}
+
+// HistoryCollection returns the history subcollection of a lease document.
+//   - entries are never removed, so the history outlives the lease document itself
+func HistoryCollection(docRef *firestore.DocumentRef) *firestore.CollectionRef {
+	return docRef.Collection("history")
+}
@@ -0,0 +1,87 @@
+package lease
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"cloud.google.com/go/logging"
+)
+
+// HTTPMiddleware returns an http.Handler that writes a structured access log entry for every request served by next.
+//   - entries carry the httpRequest field, and the method, path, status, and latency in the payload
+//   - 5xx responses are logged at ERROR and so always ship, 4xx at WARNING, and everything else at INFO
+//   - full access logs ship only while the lease ships their severity, entries are never written locally
+func (m *Manager) HTTPMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+		latency := time.Since(start)
+
+		severity := logging.Info
+		switch {
+		case rec.status >= 500:
+			severity = logging.Error
+		case rec.status >= 400:
+			severity = logging.Warning
+		}
+
+		m.log(logging.Entry{
+			Timestamp: start,
+			Severity:  severity,
+			HTTPRequest: &logging.HTTPRequest{
+				Request:      r,
+				RequestSize:  max(r.ContentLength, 0),
+				Status:       rec.status,
+				ResponseSize: rec.size,
+				Latency:      latency,
+				RemoteIP:     r.RemoteAddr,
+			},
+			Payload: map[string]any{
+				"message": fmt.Sprintf("%s %s %d", r.Method, r.URL.Path, rec.status),
+				"method":  r.Method,
+				"path":    r.URL.Path,
+				"status":  rec.status,
+				"latency": latency.String(),
+			},
+		}, m.shouldShip(severity))
+	})
+}
+
+// statusRecorder is an http.ResponseWriter recording the status and size of the response.
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	size        int64
+	wroteHeader bool
+}
+
+// WriteHeader records the status before writing it.
+func (r *statusRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Write records the size of the body before writing it.
+func (r *statusRecorder) Write(p []byte) (int, error) {
+	r.wroteHeader = true
+	n, err := r.ResponseWriter.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+// Flush flushes the underlying writer, if it supports flushing, for streaming handlers.
+func (r *statusRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the underlying writer, for http.ResponseController.
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
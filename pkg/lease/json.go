@@ -0,0 +1,158 @@
+package lease
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/logging"
+)
+
+// StructuredWriter returns an io.WriteCloser that parses newline-delimited JSON log records into structured entries.
+//   - level, msg and time fields are mapped onto the entry, remaining fields become the JSON payload
+//   - entries are shipped while the lease is enabled, or at any time at ERROR level or above
+//   - lines that are not JSON objects are shipped as plain text at DEFAULT level
+//   - records are never written locally, Close flushes a trailing partial line
+//   - lines over the maximum line size ship as plain text, truncated or split, see WithMaxLineSize
+func (m *Manager) StructuredWriter() io.WriteCloser {
+	return m.newLineWriter(func(line []byte, truncated bool) {
+		m.logRecord(line, truncated)
+	})
+}
+
+// logRecord ships a line of newline-delimited JSON as an entry, or as plain text at DEFAULT level if it is not a JSON
+// object, and reports whether the line was shipped, as blank lines are skipped.
+func (m *Manager) logRecord(line []byte, truncated bool) bool {
+	if len(bytes.TrimSpace(line)) == 0 {
+		return false
+	}
+
+	// truncated records can not be decoded, they ship as text
+	e, ok := ParseJSONRecord(line)
+	if !ok || truncated {
+		e = logging.Entry{Payload: string(line)}
+	}
+
+	m.logLine(e, truncated)
+	return true
+}
+
+// WithJSONLines parses the lines written to StdoutWriter and StderrWriter that are JSON objects, such as the records of
+// zap, zerolog, or bunyan, into structured entries like StructuredWriter does, rather than shipping them as text.
+//   - each line ships as its own entry, rather than each write
+//   - records without a level keep the severity of the stream, INFO for stdout and ERROR for stderr
+//   - other lines ship as plain text at the severity of the stream, like without the option
+func WithJSONLines() Option {
+	return func(m *Manager) {
+		m.jsonLines = true
+	}
+}
+
+// ParseJSONRecord parses a single JSON log record, as written by zap, zerolog, bunyan, slog and friends.
+//   - returns false if the line is not a JSON object
+func ParseJSONRecord(line []byte) (logging.Entry, bool) {
+	dec := json.NewDecoder(bytes.NewReader(line))
+	dec.UseNumber()
+
+	var fields map[string]any
+	if err := dec.Decode(&fields); err != nil || fields == nil {
+		return logging.Entry{}, false
+	}
+
+	var e logging.Entry
+	for _, key := range []string{"level", "severity", "lvl"} {
+		if v, ok := fields[key]; ok {
+			e.Severity = parseLevel(v)
+			delete(fields, key)
+			break
+		}
+	}
+
+	for _, key := range []string{"time", "timestamp", "ts"} {
+		if v, ok := fields[key]; ok {
+			if ts, ok := parseTime(v); ok {
+				e.Timestamp = ts
+				delete(fields, key)
+			}
+			break
+		}
+	}
+
+	// cloud logging displays jsonPayload.message as the summary line
+	for _, key := range []string{"msg", "message"} {
+		if v, ok := fields[key]; ok {
+			delete(fields, key)
+			fields["message"] = v
+			break
+		}
+	}
+
+	e.Payload = fields
+	return e, true
+}
+
+// parseLevel converts a textual or bunyan-style numeric level to a logging.Severity.
+func parseLevel(v any) logging.Severity {
+	switch l := v.(type) {
+	case json.Number:
+		n, err := l.Int64()
+		if err != nil {
+			return logging.Default
+		}
+		switch {
+		case n >= 60:
+			return logging.Critical
+		case n >= 50:
+			return logging.Error
+		case n >= 40:
+			return logging.Warning
+		case n >= 30:
+			return logging.Info
+		default:
+			return logging.Debug
+		}
+	case string:
+		switch strings.ToLower(l) {
+		case "trace", "debug":
+			return logging.Debug
+		case "info":
+			return logging.Info
+		case "notice":
+			return logging.Notice
+		case "warn", "warning":
+			return logging.Warning
+		case "error", "err":
+			return logging.Error
+		case "fatal", "panic", "dpanic", "critical", "crit":
+			return logging.Critical
+		case "alert":
+			return logging.Alert
+		case "emergency":
+			return logging.Emergency
+		}
+		return logging.ParseSeverity(l)
+	default:
+		return logging.Default
+	}
+}
+
+// parseTime converts an RFC 3339 string or a unix timestamp in seconds to a time.Time.
+func parseTime(v any) (time.Time, bool) {
+	switch t := v.(type) {
+	case string:
+		ts, err := time.Parse(time.RFC3339Nano, t)
+		return ts, err == nil
+	case json.Number:
+		f, err := strconv.ParseFloat(t.String(), 64)
+		if err != nil {
+			return time.Time{}, false
+		}
+		sec := int64(f)
+		return time.Unix(sec, int64((f-float64(sec))*1e9)), true
+	default:
+		return time.Time{}, false
+	}
+}
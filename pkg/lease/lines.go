@@ -0,0 +1,112 @@
+package lease
+
+import (
+	"bytes"
+	"io"
+	"sync"
+
+	"cloud.google.com/go/logging"
+)
+
+// LeveledWriter returns an io.WriteCloser that ships each line written to it as an entry of the given severity.
+//   - lines are shipped while the lease is enabled, or at any time at ERROR level or above
+//   - lines are never written locally, Close flushes a trailing partial line
+//   - lines over the maximum line size are truncated or split, see WithMaxLineSize
+func (m *Manager) LeveledWriter(s logging.Severity) io.WriteCloser {
+	return m.newLineWriter(func(line []byte, truncated bool) {
+		m.logLine(logging.Entry{
+			Severity: s,
+			Payload:  string(line),
+		}, truncated)
+	})
+}
+
+// logLine ships an entry read from a line, labeled truncated=true if the line writer cut it, and limited to the
+// maximum line size.
+func (m *Manager) logLine(e logging.Entry, truncated bool) {
+	if truncated {
+		e = withLabel(e, "truncated", "true")
+	}
+	for _, e := range m.limitLine(e) {
+		m.log(e, m.shouldShip(e.Severity))
+	}
+}
+
+const (
+	// maxBufferedLine bounds the partial line held by line writers of managers without WithMaxLineSize.
+	maxBufferedLine = 1 << 20
+	// maxSplitChunks bounds the chunks LongLineSplit splits the lines of line writers into, the rest is truncated.
+	maxSplitChunks = 16
+)
+
+// lineBufferSize returns the longest partial line a line writer holds before truncating it.
+//   - lines only need to be held up to the maximum line size, or as many chunks of it as they are split into
+func (m *Manager) lineBufferSize() int {
+	switch {
+	case m.maxLineSize == nil:
+		return maxBufferedLine
+	case m.maxLineSize.policy == LongLineSplit:
+		return m.maxLineSize.size * maxSplitChunks
+	default:
+		return m.maxLineSize.size
+	}
+}
+
+// lineWriter is an io.WriteCloser that calls a function for every complete line written to it.
+//   - lines over max bytes are cut once they reach it, passed with truncated set, and the rest of them is discarded, so
+//     a process writing without newlines can not grow the buffer without bound
+type lineWriter struct {
+	mu         sync.Mutex
+	buf        []byte
+	max        int
+	discarding bool
+	onLine     func(line []byte, truncated bool)
+}
+
+// newLineWriter creates a lineWriter holding at most the line buffer size of the manager, see lineBufferSize.
+func (m *Manager) newLineWriter(onLine func(line []byte, truncated bool)) *lineWriter {
+	return &lineWriter{onLine: onLine, max: m.lineBufferSize()}
+}
+
+// Write buffers p and calls onLine for each complete line, without the trailing newline.
+func (lw *lineWriter) Write(p []byte) (n int, err error) {
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+
+	n = len(p)
+	for len(p) > 0 {
+		line, rest, complete := bytes.Cut(p, []byte("\n"))
+		p = rest
+
+		if !lw.discarding {
+			lw.buf = append(lw.buf, line[:min(len(line), lw.max+1-len(lw.buf))]...)
+			if len(lw.buf) > lw.max {
+				lw.onLine(lw.buf[:cutLine(string(lw.buf), lw.max)], true)
+				lw.buf = lw.buf[:0]
+				lw.discarding = true
+			}
+		}
+
+		if complete {
+			if !lw.discarding {
+				lw.onLine(bytes.TrimSuffix(lw.buf, []byte("\r")), false)
+			}
+			lw.buf = lw.buf[:0]
+			lw.discarding = false
+		}
+	}
+	return n, nil
+}
+
+// Close flushes any trailing partial line.
+func (lw *lineWriter) Close() error {
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+
+	if len(lw.buf) > 0 && !lw.discarding {
+		lw.onLine(lw.buf, false)
+	}
+	lw.buf = nil
+	lw.discarding = false
+	return nil
+}
@@ -0,0 +1,90 @@
+package lease
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"cloud.google.com/go/logging"
+)
+
+// collectLines returns a lineWriter holding at most max bytes, and the lines it passed on, with truncated ones
+// suffixed by " (truncated)".
+func collectLines(max int) (*lineWriter, *[]string) {
+	var lines []string
+	lw := &lineWriter{max: max, onLine: func(line []byte, truncated bool) {
+		s := string(line)
+		if truncated {
+			s += " (truncated)"
+		}
+		lines = append(lines, s)
+	}}
+	return lw, &lines
+}
+
+func TestLineWriter(t *testing.T) {
+	tests := []struct {
+		name   string
+		writes []string
+		want   []string
+	}{
+		{"lines", []string{"a\nb\n"}, []string{"a", "b"}},
+		{"split writes", []string{"he", "llo\r\nwor", "ld\n"}, []string{"hello", "world"}},
+		{"trailing partial line", []string{"a\nb"}, []string{"a", "b"}},
+		{"long line", []string{"abcdefghij\nok\n"}, []string{"abcdefgh (truncated)", "ok"}},
+		{"long line over writes", []string{"abcd", "efgh", "ijkl", "mnop\nok\n"}, []string{"abcdefgh (truncated)", "ok"}},
+		{"long trailing partial line", []string{strings.Repeat("x", 100)}, []string{"xxxxxxxx (truncated)"}},
+		{"exactly max", []string{"abcdefgh\n"}, []string{"abcdefgh"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lw, lines := collectLines(8)
+			for _, w := range tt.writes {
+				n, err := lw.Write([]byte(w))
+				if err != nil || n != len(w) {
+					t.Fatalf("Write() = %d, %v, want %d, nil", n, err, len(w))
+				}
+				if len(lw.buf) > lw.max {
+					t.Fatalf("buffered %d bytes, over the maximum of %d", len(lw.buf), lw.max)
+				}
+			}
+			lw.Close()
+
+			if !slices.Equal(*lines, tt.want) {
+				t.Errorf("lines %q, want %q", *lines, tt.want)
+			}
+		})
+	}
+}
+
+func TestLineWriterCutsBetweenCharacters(t *testing.T) {
+	lw, lines := collectLines(8)
+	lw.Write([]byte("abcdefgé\n"))
+
+	if want := []string{"abcdefg (truncated)"}; !slices.Equal(*lines, want) {
+		t.Errorf("lines %q, want %q", *lines, want)
+	}
+}
+
+func TestLeveledWriterLongLines(t *testing.T) {
+	sink := &recordingSink{}
+	m := newTestManager(t, WithSink(sink, Leased), WithMaxLineSize(4, LongLineSplit))
+
+	w := m.LeveledWriter(logging.Info)
+	w.Write([]byte("abcdefghij\n" + strings.Repeat("x", 100) + "\n"))
+	w.Close()
+
+	payloads := sink.payloads()
+	// the first line is split, the second line is truncated after as many chunks as lines are split into
+	if got := len(payloads); got != 3+maxSplitChunks {
+		t.Fatalf("shipped %d entries, want %d", got, 3+maxSplitChunks)
+	}
+	if got, want := payloads[:3], []any{"abcd", "efgh", "ij"}; !slices.Equal(got, want) {
+		t.Errorf("split line into %v, want %v", got, want)
+	}
+	last := sink.entries[len(sink.entries)-1]
+	if last.Labels["truncated"] != "true" || last.Labels["chunk"] != "16/16" {
+		t.Errorf("truncated line labeled %v, want truncated=true and chunk=16/16", last.Labels)
+	}
+}
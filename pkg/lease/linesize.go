@@ -0,0 +1,96 @@
+package lease
+
+import (
+	"fmt"
+	"strconv"
+	"unicode/utf8"
+
+	"cloud.google.com/go/logging"
+)
+
+// LongLinePolicy controls what happens to the lines of StdoutWriter and StderrWriter longer than the maximum line
+// size, see WithMaxLineSize.
+type LongLinePolicy int
+
+const (
+	// LongLineTruncate ships the start of a long line, labeled truncated=true.
+	LongLineTruncate LongLinePolicy = iota
+	// LongLineSplit ships a long line as several entries, labeled with their position such as chunk=1/3.
+	LongLineSplit
+)
+
+// ParseLongLinePolicy converts "truncate" or "split" to a LongLinePolicy.
+func ParseLongLinePolicy(s string) (LongLinePolicy, error) {
+	switch s {
+	case "truncate":
+		return LongLineTruncate, nil
+	case "split":
+		return LongLineSplit, nil
+	default:
+		return LongLineTruncate, fmt.Errorf("unknown long line policy %q, must be truncate or split", s)
+	}
+}
+
+// maxLineSize bounds the text of shipped lines, see WithMaxLineSize.
+type maxLineSize struct {
+	size   int
+	policy LongLinePolicy
+}
+
+// WithMaxLineSize bounds the text shipped for each line written to StdoutWriter, StderrWriter, and the line writers,
+// such as StructuredWriter and LeveledWriter, to size bytes, as Cloud Logging rejects entries over 256KiB, such as a
+// process dumping a megabyte line.
+//   - policy decides whether longer lines are truncated or split into several entries, both labeled as such
+//   - long lines ship as plain text, even when they are JSON records, see WithJSONLines
+//   - lines are cut between characters, and printed locally as they are
+func WithMaxLineSize(size int, policy LongLinePolicy) Option {
+	return func(m *Manager) {
+		m.maxLineSize = &maxLineSize{size: max(size, utf8.UTFMax), policy: policy}
+	}
+}
+
+// longLine reports whether a line is over the maximum line size, if any.
+func (m *Manager) longLine(line []byte) bool {
+	return m.maxLineSize != nil && len(line) > m.maxLineSize.size
+}
+
+// limitLine returns the entries shipping e within the maximum line size, e itself unless its text is over it.
+func (m *Manager) limitLine(e logging.Entry) []logging.Entry {
+	text, ok := e.Payload.(string)
+	if m.maxLineSize == nil || !ok || len(text) <= m.maxLineSize.size {
+		return []logging.Entry{e}
+	}
+
+	if m.maxLineSize.policy == LongLineTruncate {
+		e.Payload = text[:cutLine(text, m.maxLineSize.size)]
+		return []logging.Entry{withLabel(e, "truncated", "true")}
+	}
+
+	var chunks []string
+	for len(text) > 0 {
+		i := cutLine(text, m.maxLineSize.size)
+		chunks = append(chunks, text[:i])
+		text = text[i:]
+	}
+	entries := make([]logging.Entry, len(chunks))
+	for i, chunk := range chunks {
+		e.Payload = chunk
+		entries[i] = withLabel(e, "chunk", strconv.Itoa(i+1)+"/"+strconv.Itoa(len(chunks)))
+	}
+	return entries
+}
+
+// cutLine returns where to cut text to at most size bytes, without splitting a UTF-8 encoded character.
+func cutLine(text string, size int) int {
+	if len(text) <= size {
+		return len(text)
+	}
+	i := size
+	for i > 0 && !utf8.RuneStart(text[i]) {
+		i--
+	}
+	if i == 0 {
+		return size
+	}
+	return i
+}
@@ -0,0 +1,188 @@
+package lease
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"sync"
+
+	"cloud.google.com/go/logging"
+)
+
+// WithShipOnly stops writing output locally while a lease is active and the output is shipped, for containers whose
+// stdout is already collected by another agent and would otherwise be ingested twice.
+//   - output the lease does not ship, such as entries below its MinSeverity, is still written locally
+//   - without an active lease everything is written locally, including entries that always ship such as errors
+//   - applies to every writer and logger of the manager except the logrus hook, where logrus writes the output itself
+func WithShipOnly() Option {
+	return func(m *Manager) {
+		m.shipOnly = true
+	}
+}
+
+// WithCollectedStdout ships only the delta the collector of stdout does not already have, for hosts such as Kubernetes
+// nodes or Cloud Run where stdout is collected, so the same entries are not paid for twice.
+//   - entries at or above from are left to the collector: they are written locally and never shipped to leased sinks,
+//     buffered, or replayed, even at severities that always ship
+//   - entries below from are shipped under the lease as usual, and are not written locally while they are shipped
+func WithCollectedStdout(from logging.Severity) Option {
+	return func(m *Manager) {
+		m.collected = true
+		m.collectedFrom = from
+	}
+}
+
+// DetectStdoutCollector returns the platform collecting the stdout of this process, or an empty string if none is
+// recognized, from the environment variables the platforms set.
+func DetectStdoutCollector() string {
+	for _, c := range []struct{ env, name string }{
+		{"KUBERNETES_SERVICE_HOST", "kubernetes"},
+		{"K_SERVICE", "cloud run"},
+		{"GAE_SERVICE", "app engine"},
+		{"FUNCTION_TARGET", "cloud functions"},
+	} {
+		if os.Getenv(c.env) != "" {
+			return c.name
+		}
+	}
+	return ""
+}
+
+// leftToCollector reports whether entries of the severity are left to the stdout collector, see WithCollectedStdout.
+func (m *Manager) leftToCollector(s logging.Severity) bool {
+	return m.collected && s >= m.collectedFrom
+}
+
+// localSuppressed reports whether output of the severity, shipped when ship is true, should not be written locally.
+func (m *Manager) localSuppressed(s logging.Severity, ship bool) bool {
+	if !ship || !m.enabled.Load() {
+		return false
+	}
+	if m.collected {
+		return !m.leftToCollector(s)
+	}
+	return m.shipOnly
+}
+
+// LocalWriter returns an io.Writer that writes output of the given severity to w, unless WithShipOnly or
+// WithCollectedStdout suppress it because it is shipped instead.
+//   - writes that are suppressed are discarded and reported as written
+func (m *Manager) LocalWriter(w io.Writer, s logging.Severity) io.Writer {
+	if !m.shipOnly && !m.collected {
+		return w
+	}
+	return &localWriter{m: m, w: w, severity: s}
+}
+
+// streamLocalWriter returns the LocalWriter of the named stream of StdoutWriter or StderrWriter.
+//   - when lines are classified, see WithJSONLines and WithSeverityPatterns, each line is suppressed by its own severity
+//     rather than that of the stream, so a line that is not shipped is never hidden too
+func (m *Manager) streamLocalWriter(w io.Writer, s logging.Severity) io.Writer {
+	if (!m.shipOnly && !m.collected) || (!m.jsonLines && len(m.severityPatterns) == 0) {
+		return m.LocalWriter(w, s)
+	}
+
+	lw := &localLineWriter{m: m, w: w, severity: s, max: m.lineBufferSize()}
+	m.streamLinesMu.Lock()
+	m.streamLines = append(m.streamLines, lw)
+	m.streamLinesMu.Unlock()
+	return lw
+}
+
+// localWriter is an io.Writer that discards writes while they are shipped in ship-only mode.
+type localWriter struct {
+	m        *Manager
+	w        io.Writer
+	severity logging.Severity
+}
+
+// Write writes p to the underlying writer, unless it is shipped instead.
+func (w *localWriter) Write(p []byte) (int, error) {
+	if w.m.localSuppressed(w.severity, w.m.shouldShip(w.severity)) {
+		return len(p), nil
+	}
+	return w.w.Write(p)
+}
+
+// localLineWriter is an io.Writer that discards the lines written to it that are shipped in ship-only mode, deciding
+// by the severity each line is classified at.
+//   - a partial line is held back until its newline, or until it reaches max bytes, when it is decided by its start and
+//     the rest of it follows the same decision
+type localLineWriter struct {
+	m        *Manager
+	w        io.Writer
+	severity logging.Severity
+	max      int
+
+	mu      sync.Mutex
+	partial []byte
+	// decided is set while the rest of a long line follows the decision made for its start, suppressing it if suppress
+	decided  bool
+	suppress bool
+}
+
+// Write writes the complete lines of p that are not shipped instead to the underlying writer.
+func (w *localLineWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	n := len(p)
+	var out []byte
+	for len(p) > 0 {
+		i := bytes.IndexByte(p, '\n')
+		line := p
+		if i >= 0 {
+			line, p = p[:i+1], p[i+1:]
+		} else {
+			p = nil
+		}
+
+		if !w.decided {
+			w.partial = append(w.partial, line...)
+			if i < 0 && len(w.partial) <= w.max {
+				continue
+			}
+			line, w.partial = w.partial, nil
+			w.suppress = w.suppressed(line)
+			w.decided = true
+		}
+		if !w.suppress {
+			out = append(out, line...)
+		}
+		if i >= 0 {
+			w.decided = false
+		}
+	}
+
+	if len(out) > 0 {
+		if _, err := w.w.Write(out); err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// suppressed reports whether a line should not be written locally, as it is shipped at the severity it is classified at.
+func (w *localLineWriter) suppressed(line []byte) bool {
+	line = bytes.TrimRight(line, "\r\n")
+	s := w.severity
+	if len(bytes.TrimSpace(line)) > 0 {
+		s = w.m.parseLine(line, w.severity).Severity
+	}
+	return w.m.localSuppressed(s, w.m.shouldShip(s))
+}
+
+// Close writes a trailing partial line, unless it is shipped instead.
+func (w *localLineWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	line := w.partial
+	w.partial = nil
+	w.decided = false
+	if len(line) == 0 || w.suppressed(line) {
+		return nil
+	}
+	_, err := w.w.Write(line)
+	return err
+}
@@ -0,0 +1,46 @@
+package lease
+
+import (
+	"bytes"
+	"slices"
+	"testing"
+
+	"cloud.google.com/go/logging"
+)
+
+func TestShipOnlySuppressesLinesByTheirSeverity(t *testing.T) {
+	sink := &recordingSink{}
+	m := newTestManager(t, WithSink(sink, Leased), WithShipOnly(), WithSeverityPatterns(DefaultSeverityPatterns...))
+	setTestLease(m, &Document{MinSeverity: "INFO"})
+
+	var local bytes.Buffer
+	w := m.streamLocalWriter(&local, logging.Info)
+	ship := m.streamWriter(logging.Info, "stdout")
+	for _, p := range []string{"DEBUG: cache miss\nINFO: req", "uest served\nDEBUG: tr", "ailing"} {
+		w.Write([]byte(p))
+		ship.Write([]byte(p))
+	}
+	m.Close()
+
+	// debug lines are not shipped under an INFO lease, so they must still be written locally
+	if got, want := local.String(), "DEBUG: cache miss\nDEBUG: trailing"; got != want {
+		t.Errorf("wrote %q locally, want %q", got, want)
+	}
+	if got, want := sink.payloads(), []any{"INFO: request served"}; !slices.Equal(got, want) {
+		t.Errorf("shipped %v, want %v", got, want)
+	}
+}
+
+func TestShipOnlySuppressesLongLinesByTheirStart(t *testing.T) {
+	m := newTestManager(t, WithShipOnly(), WithSeverityPatterns(DefaultSeverityPatterns...), WithMaxLineSize(8, LongLineTruncate))
+	setTestLease(m, &Document{MinSeverity: "INFO"})
+
+	var local bytes.Buffer
+	w := m.streamLocalWriter(&local, logging.Info)
+	w.Write([]byte("INFO: a very long line\nDEBUG: a very"))
+	w.Write([]byte(" long line\n"))
+
+	if got, want := local.String(), "DEBUG: a very long line\n"; got != want {
+		t.Errorf("wrote %q locally, want %q", got, want)
+	}
+}
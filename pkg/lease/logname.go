@@ -0,0 +1,61 @@
+package lease
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"cloud.google.com/go/logging"
+)
+
+// DefaultLogNameTemplate is the log name template used when none is configured.
+const DefaultLogNameTemplate = "lease-{{.LeaseID}}"
+
+// LogNameData is the data available to log name templates.
+type LogNameData struct {
+	LeaseID string
+	// Service and Env are the "service" and "env" labels of the instance, empty when unset.
+	Service string
+	Env     string
+	Labels  map[string]string
+}
+
+// ParseSeverityLogName parses a severity and renders its log name template, for WithSeverityLogName.
+func ParseSeverityLogName(severity, text, leaseID string, labels map[string]string) (logging.Severity, string, error) {
+	s := logging.ParseSeverity(severity)
+	if s == logging.Default {
+		return s, "", fmt.Errorf("invalid severity %q for log name %q", severity, text)
+	}
+	name, err := ExecuteLogNameTemplate(text, leaseID, labels)
+	return s, name, err
+}
+
+// validLogName matches the log IDs accepted by Cloud Logging.
+var validLogName = regexp.MustCompile(`^[A-Za-z0-9/_.\-]{1,512}$`)
+
+// ExecuteLogNameTemplate renders a log name template, such as "{{.Service}}-{{.Env}}-lease", for a lease and instance labels.
+//   - the result must be a valid Cloud Logging log ID, so templates can not produce names that are rejected on write
+func ExecuteLogNameTemplate(text, leaseID string, labels map[string]string) (string, error) {
+	tmpl, err := template.New("log-name").Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("invalid log name template: %w", err)
+	}
+
+	var sb strings.Builder
+	err = tmpl.Execute(&sb, LogNameData{
+		LeaseID: leaseID,
+		Service: labels["service"],
+		Env:     labels["env"],
+		Labels:  labels,
+	})
+	if err != nil {
+		return "", fmt.Errorf("invalid log name template: %w", err)
+	}
+
+	name := sb.String()
+	if !validLogName.MatchString(name) {
+		return "", fmt.Errorf("log name template %q produced %q, log names may only contain letters, digits, and /_-. characters", text, name)
+	}
+	return name, nil
+}
@@ -0,0 +1,764 @@
+package lease
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"reflect"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"cloud.google.com/go/logging"
+
+	"github.com/carsonoid/talk-leased-logs/pkg/spool"
+)
+
+// Document represents a Firestore document representing a lease.
+type Document struct {
+	ExpireAt time.Time
+	User     string
+	Reason   string
+
+	// Scope is a free-text description of the logs requested by the lease.
+	Scope string
+
+	// Tags restrict the lease to managers whose labels contain every tag.
+	// Tags are also attached as labels to all entries shipped under the lease.
+	Tags map[string]string
+
+	// GrantID identifies a single extension of the lease.
+	GrantID string
+	// FollowUpOf links the grant to an earlier grant of the same investigation.
+	FollowUpOf string
+
+	// ReplaySince asks managers to also ship the entries they did not ship since this time,
+	// from their spool or replay buffer.
+	ReplaySince time.Time
+
+	// Revoked marks the document as a tombstone of a lease that was revoked early.
+	// Managers stop shipping immediately, even before their guaranteedUntil time.
+	// User and Reason record who revoked the lease and why.
+	Revoked   bool
+	RevokedAt time.Time
+
+	// Schedules are recurring windows during which the lease is active, in addition to ExpireAt.
+	Schedules []Schedule
+
+	// Pending marks a lease requested with a two-phase approval, which is inactive until it is approved.
+	// RequestedDuration is how long the lease lasts once approved, and ApprovedBy and ApprovedAt record the approval.
+	// RequestedBy is the verified identity that requested the lease, which can not approve it.
+	Pending           bool
+	RequestedDuration time.Duration
+	RequestedBy       string
+	ApprovedBy        string
+	ApprovedAt        time.Time
+
+	// MinSeverity is the lowest severity, such as "DEBUG" or "WARNING", shipped while the lease is active.
+	// Every severity ships when empty. Entries at or above the manager's always-ship severity ship regardless.
+	MinSeverity string
+
+	// Holders are everyone currently extending the lease, so concurrent extensions do not hide each other.
+	// User and Reason are those of the latest extension.
+	Holders []Holder
+
+	// Owner is the user the lease belongs to. While it is active, other users must take it over explicitly to change it.
+	Owner string
+
+	// SessionID is shared by every host capturing under the lease, and SessionStart is when the session started.
+	// Hosts ship a start marker when they join a session, see JoinSession.
+	SessionID    string
+	SessionStart time.Time
+}
+
+// HeldByOther returns the owner of the lease, and whether the lease is active and owned by someone other than user.
+//   - leases written before owners were recorded are owned by their User
+func (d *Document) HeldByOther(user string, now time.Time) (string, bool) {
+	owner := d.Owner
+	if owner == "" {
+		owner = d.User
+	}
+	if d.Revoked || d.Pending {
+		return owner, false
+	}
+	if until, _ := d.ActiveUntil(now); !until.After(now) {
+		return owner, false
+	}
+	return owner, owner != user
+}
+
+// Holder is a user holding a lease open, and the expiry they asked for.
+type Holder struct {
+	User     string
+	Reason   string
+	GrantID  string
+	ExpireAt time.Time
+}
+
+// AddHolder records h as a holder of the lease.
+//   - replaces the previous entry of the same user
+//   - drops holders whose expiry passed before now
+func (d *Document) AddHolder(h Holder, now time.Time) {
+	holders := make([]Holder, 0, len(d.Holders)+1)
+	for _, prev := range d.Holders {
+		if prev.User == h.User || !prev.ExpireAt.After(now) {
+			continue
+		}
+		holders = append(holders, prev)
+	}
+	d.Holders = append(holders, h)
+}
+
+// Matches reports whether the lease applies to a manager with the given labels.
+//   - a lease without tags matches every manager
+func (d *Document) Matches(labels map[string]string) bool {
+	for k, v := range d.Tags {
+		if labels[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// minSeverity returns the lowest severity shipped under the lease.
+func (d *Document) minSeverity() logging.Severity {
+	if d.MinSeverity == "" {
+		return logging.Default
+	}
+	return logging.ParseSeverity(d.MinSeverity)
+}
+
+// labels returns the labels attached to every entry shipped under the lease.
+func (d *Document) labels() map[string]string {
+	labels := make(map[string]string, len(d.Tags)+3)
+	for k, v := range d.Tags {
+		labels[k] = v
+	}
+	if d.GrantID != "" {
+		labels["grant_id"] = d.GrantID
+	}
+	if d.FollowUpOf != "" {
+		labels["follow_up_of"] = d.FollowUpOf
+	}
+	if d.SessionID != "" {
+		labels["session_id"] = d.SessionID
+	}
+	return labels
+}
+
+// Status is written by each manager instance to the status subcollection of the lease document.
+//   - it records which lease expiry the instance last observed, so lease operations can confirm they took effect
+type Status struct {
+	Instance         string
+	Host             string
+	PID              int
+	Labels           map[string]string
+	ObservedExpireAt time.Time
+	// Active is whether this lease enables shipping on the instance, regardless of the other leases it watches
+	Active    bool
+	UpdatedAt time.Time
+
+	// Chain is the head of the hash chain of the instance, see WithHashChain.
+	Chain *ChainHead `firestore:",omitempty"`
+}
+
+// StatusCollection returns the status subcollection of a lease document.
+func StatusCollection(docRef *firestore.DocumentRef) *firestore.CollectionRef {
+	return docRef.Collection("status")
+}
+
+// Manager handles one or more lease documents and manages the lease state.
+type Manager struct {
+	sinks           []routedSink
+	guaranteedUntil time.Time
+	labels          map[string]string
+	instanceID      string
+	logName         string
+	// severityLogNames override logName by severity, highest first
+	severityLogNames []severityLogName
+	processors       []Processor
+	commonLabels     map[string]string
+	startupWindow    time.Duration
+	alwaysShip       logging.Severity
+	gracePeriod      time.Duration
+	startupUntil     time.Time
+
+	heartbeatInterval time.Duration
+
+	enabled atomic.Bool
+
+	// cancel stops the background goroutines tracked by background, see Close
+	cancel     context.CancelFunc
+	background sync.WaitGroup
+	closeOnce  sync.Once
+	closeErr   error
+
+	// sources are the watched lease documents, combined by leasePolicy
+	sources     []*leaseSource
+	extraLeases []*firestore.DocumentRef
+	// parentLeases are ancestor leases, see WithParentLeases
+	parentLeases []*firestore.DocumentRef
+	leasePolicy  LeasePolicy
+	// watchFailurePolicy applies once a lease could not be watched for watchFailureAfter
+	watchFailurePolicy WatchFailurePolicy
+	watchFailureAfter  time.Duration
+	// leaseStateFrom follows the leases watched by another process on this Unix socket, see WithLeaseStateFrom
+	leaseStateFrom string
+	// requireApproval ignores leases that were not approved by a second user
+	requireApproval bool
+	updateMu        sync.Mutex
+
+	// token pre-authorizes one of the leases without Firestore, see WithLeaseToken
+	//   - tokenTimer applies a token that is not valid yet, and tokenRevoked is set once a revocation voids the token
+	token        *Token
+	tokenMu      sync.Mutex
+	tokenTimer   *time.Timer
+	tokenRevoked bool
+
+	// chain links shipped entries for tamper-evidence, see WithHashChain
+	chain *hashChain
+
+	// notifiers are told about lease transitions, see WithNotifier
+	notifiers     []Notifier
+	notifications chan queuedNotification
+
+	// archive stores the raw output written while leased, see WithArchive
+	archive *archiver
+
+	// quarantine receives entries rejected by sinks, see WithQuarantine
+	quarantine   io.Writer
+	quarantineMu sync.Mutex
+	quarantined  atomic.Int64
+
+	// shipOnly stops writing shipped output locally while leased, see WithShipOnly
+	shipOnly bool
+	// collected leaves entries at or above collectedFrom to the stdout collector, see WithCollectedStdout
+	collected     bool
+	collectedFrom logging.Severity
+	// jsonLines parses JSON records in StdoutWriter and StderrWriter output, see WithJSONLines
+	jsonLines bool
+	// severityPatterns classify text lines of StdoutWriter and StderrWriter output, see WithSeverityPatterns
+	severityPatterns []SeverityPattern
+	// decoration decorates the lines of StdoutWriter and StderrWriter output, see WithDecoration
+	decoration *Decoration
+	// multiline groups the lines of StdoutWriter and StderrWriter output into records, see WithMultiline
+	multiline *multiline
+	// streamLines hold the partial lines of StdoutWriter and StderrWriter output parsed into lines, flushed on Close
+	streamLinesMu sync.Mutex
+	streamLines   []io.Closer
+	// maxLineSize bounds the text shipped for lines of StdoutWriter and StderrWriter output, see WithMaxLineSize
+	maxLineSize *maxLineSize
+
+	// traceProject qualifies the trace IDs of entries, see WithTraceProject
+	traceProject string
+
+	// slogSource adds source locations to SlogLogger output, see WithSlogSource
+	slogSource bool
+
+	// samplers pick entries to ship without a lease, see WithSamplers
+	samplers []Sampler
+
+	// cost labels shipped entries for attributing ingestion spend, see WithCostAttribution
+	cost *costAttribution
+
+	// remoteWrite pushes lease state to Prometheus, see WithRemoteWrite
+	remoteWrite *remoteWriter
+
+	// timeline holds recent lease transitions, see State
+	timeline   []TimelineEvent
+	timelineMu sync.Mutex
+
+	// shipped counts the entries shipped to leased sinks
+	shipped atomic.Int64
+	// suppressed counts the entries not shipped to leased sinks, and their estimated size
+	suppressed      atomic.Int64
+	suppressedBytes atomic.Int64
+	// sinkErrors counts the errors sinks failed to ship entries with, see HandleError
+	sinkErrors atomic.Int64
+	onError    func(error)
+	// queue decouples logging from shipping, see WithQueue
+	queue *entryQueue
+	// dropped counts the entries dropped by the backpressure policy of the queue
+	dropped atomic.Int64
+	// dedup collapses identical consecutive shipped entries, see WithDedup
+	dedup *deduper
+	// rateLimit caps the entries shipped per second, and rateLimited counts the entries it dropped
+	rateLimit   *rateLimiter
+	rateLimited atomic.Int64
+	// summaryInterval is how often suppression is summarized, see WithSuppressionSummary
+	summaryInterval time.Duration
+
+	// buffer holds recent unshipped entries, replayed when the lease becomes active
+	buffer entryBuffer
+	// spool persists unshipped entries to disk, replayed with ReplayFrom
+	spool *spool.Spool
+	// shutdownBuffer holds recent unshipped entries, shipped by ShipShutdownBuffer
+	shutdownBuffer *ringBuffer
+
+	replayMu        sync.Mutex
+	replayedThrough time.Time
+	lastReplaySince time.Time
+	// replaying tracks the replays running in the background, replayRunMu runs them one at a time
+	replaying    sync.WaitGroup
+	replayRunMu  sync.Mutex
+	replayClosed bool
+}
+
+// Option configures optional Manager behavior.
+type Option func(*Manager)
+
+// WithLabels sets the labels describing this manager instance.
+//   - leases with tags only apply to managers whose labels match every tag
+func WithLabels(labels map[string]string) Option {
+	return func(m *Manager) {
+		m.labels = labels
+	}
+}
+
+// WithInstanceID sets the ID this instance reports itself as in the lease status subcollection.
+//   - defaults to the hostname and process ID
+func WithInstanceID(id string) Option {
+	return func(m *Manager) {
+		m.instanceID = id
+	}
+}
+
+// WithCorrelationID attaches a correlation_id label to every entry, so all entries of a session can be found together.
+func WithCorrelationID(id string) Option {
+	return func(m *Manager) {
+		if m.commonLabels == nil {
+			m.commonLabels = make(map[string]string)
+		}
+		m.commonLabels["correlation_id"] = id
+	}
+}
+
+// NewCorrelationID returns a random ID for WithCorrelationID.
+func NewCorrelationID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate correlation ID: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// WithStartupWindow ships every entry, at every level, for the given duration after the manager is created.
+//   - unlike guaranteedUntil, the window does not enable the lease and cannot be shortened by lease changes
+func WithStartupWindow(d time.Duration) Option {
+	return func(m *Manager) {
+		m.startupWindow = d
+	}
+}
+
+// WithAlwaysShipSeverity ships entries at or above the given severity regardless of the lease, ERROR by default.
+func WithAlwaysShipSeverity(s logging.Severity) Option {
+	return func(m *Manager) {
+		m.alwaysShip = s
+	}
+}
+
+// WithGracePeriod keeps shipping for the given duration after a lease expires.
+//   - avoids cutting off output mid-stack-trace when a lease expires during active debugging
+//   - the grace period is never applied to guaranteedUntil
+func WithGracePeriod(d time.Duration) Option {
+	return func(m *Manager) {
+		m.gracePeriod = d
+	}
+}
+
+// WithRequireApproval ignores leases that were not approved by a second user, see Document.Pending.
+func WithRequireApproval() Option {
+	return func(m *Manager) {
+		m.requireApproval = true
+	}
+}
+
+// NewManager creates a new lease watcher.
+//   - guaranteedUntil is the time until which the lease is guaranteed to be active
+//   - if guaranteedUntil is in the past, the lease is disabled immediately
+//   - if guaranteedUntil is in the future, the lease is enabled until that time
+//   - the lease documents are watched until the context is canceled
+//   - additional lease documents set with WithLeases are combined with docRef by the lease policy
+//   - parent lease documents set with WithParentLeases enable shipping on their own
+//   - entries are shipped to the sinks configured with WithSink
+func NewManager(ctx context.Context, guaranteedUntil time.Time, docRef *firestore.DocumentRef, opts ...Option) *Manager {
+	lw := &Manager{
+		guaranteedUntil: guaranteedUntil,
+		alwaysShip:      logging.Error,
+
+		enabled: atomic.Bool{},
+	}
+
+	for _, opt := range opts {
+		opt(lw)
+	}
+
+	for _, s := range lw.sinks {
+		if a, ok := s.sink.(asyncErrorSink); ok {
+			a.setOnFailure(lw.asyncShipFailed)
+		}
+	}
+
+	if lw.instanceID == "" {
+		lw.instanceID = defaultInstanceID()
+	}
+
+	// queued before the guaranteed window enables shipping below
+	lw.notifications = make(chan queuedNotification, notifyQueueSize)
+
+	if lw.startupWindow > 0 {
+		lw.startupUntil = time.Now().Add(lw.startupWindow)
+	}
+
+	for _, ref := range append([]*firestore.DocumentRef{docRef}, lw.extraLeases...) {
+		lw.sources = append(lw.sources, &leaseSource{m: lw, docRef: ref, guaranteedUntil: guaranteedUntil})
+	}
+	for _, ref := range lw.parentLeases {
+		lw.sources = append(lw.sources, &leaseSource{m: lw, docRef: ref, guaranteedUntil: guaranteedUntil, parent: true})
+	}
+
+	if guaranteedUntil.After(time.Now().UTC()) {
+		for _, src := range lw.sources {
+			src.expireAfter(guaranteedUntil)
+		}
+	}
+
+	if lw.token != nil {
+		lw.applyToken()
+	}
+
+	ctx, lw.cancel = context.WithCancel(ctx)
+
+	for _, src := range lw.sources {
+		lw.goBackground(ctx, src.watchWithRetry)
+	}
+
+	if lw.heartbeatInterval > 0 {
+		lw.goBackground(ctx, lw.heartbeat)
+	}
+
+	if len(lw.notifiers) > 0 {
+		lw.goBackground(ctx, lw.sendNotifications)
+	}
+
+	if lw.chain != nil {
+		lw.goBackground(ctx, lw.reportChainPeriodically)
+	}
+
+	if lw.remoteWrite != nil {
+		lw.goBackground(ctx, lw.pushRemoteWrite)
+	}
+
+	if lw.summaryInterval > 0 {
+		lw.goBackground(ctx, lw.summarizeSuppression)
+	}
+
+	if lw.queue != nil {
+		// runs until Close, entries logged after Close are shipped directly
+		go lw.processQueue()
+	}
+
+	if lw.rateLimit != nil && lw.rateLimit.queue != nil {
+		lw.goBackground(ctx, lw.shipRateLimitBuffer)
+	}
+
+	if lw.archive != nil {
+		lw.archive.leaseID = docRef.ID
+		lw.goBackground(ctx, lw.archive.run)
+	}
+
+	return lw
+}
+
+// goBackground runs f in a goroutine that Close cancels and waits for.
+func (m *Manager) goBackground(ctx context.Context, f func(context.Context)) {
+	m.background.Add(1)
+	go func() {
+		defer m.background.Done()
+		f(ctx)
+	}()
+}
+
+// Close flushes the sinks, then stops watching the leases and the background work of the manager, waits for it, and
+// flushes what it shipped while stopping.
+//   - call Close before closing the clients the sinks use, such as on SIGINT or SIGTERM, so the last entries are not lost
+//   - entries logged after Close are still shipped to sinks, but the lease is no longer watched
+//   - sinks, processors and notifiers that are an io.Closer, such as exec plugins and WebAssembly filters, are closed
+//     last, sinks and processors no longer receive entries logged after Close
+//   - the spool is closed last too, entries logged after Close are no longer spooled
+//   - Close is safe to call more than once, later calls return the result of the first
+func (m *Manager) Close() error {
+	m.closeOnce.Do(func() {
+		m.stopToken()
+		m.waitReplays()
+		m.flushStreamLines()
+		if m.multiline != nil {
+			m.flushMultiline()
+		}
+		if m.queue != nil {
+			m.queue.close()
+		}
+		if m.dedup != nil {
+			m.flushDedup()
+		}
+		m.closeErr = m.Flush()
+		m.cancel()
+		m.background.Wait()
+		if err := m.Flush(); m.closeErr == nil {
+			m.closeErr = err
+		}
+		if err := m.closeExtensions(); m.closeErr == nil {
+			m.closeErr = err
+		}
+	})
+	return m.closeErr
+}
+
+// closeExtensions closes the sinks, processors and notifiers that are an io.Closer, such as exec plugins, each once,
+// and the spool.
+func (m *Manager) closeExtensions() error {
+	var closed []io.Closer
+	var errs []error
+	closeOnce := func(v any) {
+		c, ok := v.(io.Closer)
+		if !ok {
+			return
+		}
+		// a plugin used as both a sink and a processor is only closed once
+		if reflect.TypeOf(c).Comparable() {
+			if slices.Contains(closed, c) {
+				return
+			}
+			closed = append(closed, c)
+		}
+		if err := c.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	for _, s := range m.sinks {
+		closeOnce(s.sink)
+	}
+	for _, p := range m.processors {
+		closeOnce(p)
+	}
+	for _, n := range m.notifiers {
+		closeOnce(n)
+	}
+	if m.spool != nil {
+		closeOnce(m.spool)
+	}
+	return errors.Join(errs...)
+}
+
+// defaultInstanceID returns an instance ID built from the hostname and process ID.
+func defaultInstanceID() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	return fmt.Sprintf("%s-%d", host, os.Getpid())
+}
+
+// shouldShip reports whether an entry of the given severity should be shipped right now.
+//   - everything ships during the startup window
+//   - while the lease is enabled, everything at or above the MinSeverity of the active leases ships
+//   - the always-ship severity and above, ERROR by default, always ship
+func (m *Manager) shouldShip(s logging.Severity) bool {
+	if s >= m.alwaysShip || time.Now().Before(m.startupUntil) {
+		return true
+	}
+	return m.enabled.Load() && s >= m.minSeverity()
+}
+
+// enable enables the lease, replaying unshipped entries when it was previously disabled.
+func (m *Manager) enable() {
+	if !m.enabled.Swap(true) {
+		m.startChain()
+		m.replay()
+	}
+}
+
+func (m *Manager) disable() {
+	if m.enabled.Swap(false) {
+		if m.chain != nil {
+			// the final head of the session, reported in the background as the lock is held
+			go m.reportChain(context.Background())
+		}
+	}
+}
+
+// log processes an entry and routes it to the sinks, or queues it for the shipping goroutine, see WithQueue.
+func (m *Manager) log(e logging.Entry, ship bool) {
+	if m.queue != nil && m.enqueue(e, ship) {
+		return
+	}
+	m.logNow(e, ship)
+}
+
+// logNow processes an entry and routes it to the sinks, attaching common labels and the labels of the current lease.
+//   - always sinks receive every entry, leased sinks only receive the entry when ship is true
+//   - labels already set on the entry take precedence over common labels, which take precedence over lease labels
+//   - processors may modify or drop the entry before it is shipped
+//   - entries not shipped to leased sinks are kept in the replay buffers and spool, if enabled
+//   - entries that would not be shipped are shipped anyway when a sampler picks them
+func (m *Manager) logNow(e logging.Entry, ship bool) {
+	if !ship && len(m.samplers) > 0 && !m.leftToCollector(e.Severity) && m.sampled(e) {
+		ship = true
+		e = withLabel(e, "sampled", "true")
+	}
+	if !ship {
+		m.suppressed.Add(1)
+		m.suppressedBytes.Add(int64(entrySize(e)))
+	}
+	if !ship && !m.keepsUnshipped() {
+		return
+	}
+
+	leaseLabels := m.leaseLabels()
+	if len(leaseLabels) > 0 || len(m.commonLabels) > 0 {
+		labels := make(map[string]string, len(leaseLabels)+len(m.commonLabels)+len(e.Labels))
+		for _, src := range []map[string]string{leaseLabels, m.commonLabels, e.Labels} {
+			for k, v := range src {
+				labels[k] = v
+			}
+		}
+		e.Labels = labels
+	}
+
+	e.LogName = m.logNameFor(e.Severity)
+	if !m.process(&e) {
+		return
+	}
+
+	if m.leftToCollector(e.Severity) {
+		m.send(e, Always)
+		return
+	}
+
+	if ship {
+		if m.cost != nil {
+			e = m.attributeCost(e)
+		}
+		if m.dedup != nil {
+			m.shipDeduped(e)
+			return
+		}
+		m.shipLimited(e, true)
+		return
+	}
+
+	if m.buffer != nil {
+		m.buffer.add(e)
+	}
+	if m.shutdownBuffer != nil {
+		m.shutdownBuffer.add(e)
+	}
+	if m.spool != nil {
+		m.spoolEntry(e)
+	}
+	m.send(e, Always)
+}
+
+// keepsUnshipped reports whether entries that are not shipped to leased sinks are still used.
+func (m *Manager) keepsUnshipped() bool {
+	return m.hasAlwaysSinks() || m.buffer != nil || m.shutdownBuffer != nil || m.spool != nil
+}
+
+// send ships an entry to every sink configured with one of the given policies.
+func (m *Manager) send(e logging.Entry, policies ...SinkPolicy) {
+	if m.chain != nil && slices.Contains(policies, Leased) {
+		linked, err := m.chain.link(e)
+		if err != nil {
+			diag().Error("failed to link entry into hash chain", "error", err)
+		}
+		e = linked
+	}
+
+	for _, s := range m.sinks {
+		if !slices.Contains(policies, s.policy) {
+			continue
+		}
+		err := sinkFault()
+		if err == nil {
+			err = s.sink.Log(e)
+		}
+		s.health.record(err)
+		if err != nil {
+			m.sinkError(err)
+			m.shipFailed(e, err)
+		}
+	}
+}
+
+// Write writes a log message directly to the logger if the lease is active
+//   - if the lease is not active, the message is discarded
+func (m *Manager) Write(p []byte) (n int, err error) {
+	return m.severityWriter(logging.Info).Write(p)
+}
+
+// StdoutWriter returns an io.Writer that writes to both stdout and the logger.
+//   - it always writes to stdout, unless the output is shipped instead, see WithShipOnly
+//   - it ships to the logger only when the lease is enabled or the initial lease time has not yet expired
+//   - logs are all written as INFO level, unless lines are parsed, see WithJSONLines and WithSeverityPatterns
+//   - lines are decorated with WithDecoration
+func (m *Manager) StdoutWriter() io.Writer {
+	return io.MultiWriter(m.streamLocalWriter(m.decoratedWriter(os.Stdout, "stdout"), logging.Info), m.streamWriter(logging.Info, "stdout"), m.archiveWriter("stdout"))
+}
+
+// StderrWriter returns an io.Writer that writes to both stderr and the logger.
+//   - it always writes all messages to stderr and the logger, regardless of the lease state
+//   - messages are not written to stderr while they are shipped instead, see WithShipOnly
+//   - logs are all written as ERROR level, unless lines are parsed, see WithJSONLines and WithSeverityPatterns
+//   - lines are decorated with WithDecoration
+func (m *Manager) StderrWriter() io.Writer {
+	return io.MultiWriter(m.streamLocalWriter(m.decoratedWriter(os.Stderr, "stderr"), logging.Error), m.streamWriter(logging.Error, "stderr"), m.archiveWriter("stderr"))
+}
+
+// archiveWriter returns an io.Writer archiving raw output as the given stream, or discarding it without an archive.
+func (m *Manager) archiveWriter(stream string) io.Writer {
+	if m.archive == nil {
+		return io.Discard
+	}
+	return m.archive.writer(stream)
+}
+
+// severityWriter returns an io.Writer that ships each write as a single entry of the given severity.
+//   - entries are shipped while the lease is enabled, or at any time at ERROR level or above
+func (m *Manager) severityWriter(s logging.Severity) io.Writer {
+	return &severityWriter{m: m, severity: s}
+}
+
+// SlogLogger returns a slog.Logger that writes to both stdout and the logger.
+//   - always logs to stdout, unless the record is shipped instead, see WithShipOnly
+//   - logs to the logger only when the lease is enabled or the initial lease time has not yet expired
+//   - source locations are added to both when the manager was created WithSlogSource
+//   - use SlogLoggerWithOptions to set a minimum level, rewrite attributes, or write JSON locally
+func (m *Manager) SlogLogger() *slog.Logger {
+	return m.SlogLoggerWithOptions(SlogOptions{})
+}
+
+// severityWriter is an io.Writer that ships each write as a single entry of a fixed severity.
+//   - writes are shipped while the lease is enabled, or at any time at ERROR level or above
+type severityWriter struct {
+	m        *Manager
+	severity logging.Severity
+	// stream names the output stream written, if any, see WithDecoration
+	stream string
+}
+
+// Write ships p as a single entry.
+func (sw *severityWriter) Write(p []byte) (n int, err error) {
+	sw.m.logStream(logging.Entry{
+		Severity: sw.severity,
+		Payload:  string(p),
+	}, sw.stream)
+	return len(p), nil
+}
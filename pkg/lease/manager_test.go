@@ -0,0 +1,82 @@
+package lease
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"cloud.google.com/go/logging"
+)
+
+// newTestManager creates a manager guaranteed to ship for an hour, watching a lease on an unreachable Firestore
+// emulator so tests never depend on a real lease.
+func newTestManager(t *testing.T, opts ...Option) *Manager {
+	t.Helper()
+	return newTestManagerUntil(t, time.Now().Add(time.Hour), opts...)
+}
+
+// newTestManagerUntil creates a manager like newTestManager, guaranteed to ship until guaranteedUntil.
+func newTestManagerUntil(t *testing.T, guaranteedUntil time.Time, opts ...Option) *Manager {
+	t.Helper()
+
+	t.Setenv("FIRESTORE_EMULATOR_HOST", "127.0.0.1:1")
+	prev := Diagnostics()
+	SetDiagnostics(nil)
+	t.Cleanup(func() { SetDiagnostics(prev) })
+
+	ctx := context.Background()
+	client, err := firestore.NewClient(ctx, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := NewManager(ctx, guaranteedUntil, client.Collection("leases").Doc("test"), opts...)
+	t.Cleanup(func() {
+		m.Close()
+		client.Close()
+	})
+	return m
+}
+
+// recordingSink is a Sink recording the payloads of the entries it receives.
+//   - while block is set, Log signals started and waits for block to be closed
+type recordingSink struct {
+	block   chan struct{}
+	started chan struct{}
+
+	mu      sync.Mutex
+	entries []logging.Entry
+}
+
+func (s *recordingSink) Log(e logging.Entry) error {
+	if s.block != nil {
+		s.started <- struct{}{}
+		<-s.block
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries = append(s.entries, e)
+	return nil
+}
+
+func (s *recordingSink) Flush() error {
+	return nil
+}
+
+// payloads returns the payloads of the recorded entries, in order.
+func (s *recordingSink) payloads() []any {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	payloads := make([]any, 0, len(s.entries))
+	for _, e := range s.entries {
+		payloads = append(payloads, e.Payload)
+	}
+	return payloads
+}
+
+// setTestLease sets the lease observed by a manager from newTestManager, as if its watcher had received it.
+func setTestLease(m *Manager, lease *Document) {
+	m.sources[0].lease.Store(lease)
+}
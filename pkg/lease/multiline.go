@@ -0,0 +1,152 @@
+package lease
+
+import (
+	"bytes"
+	"regexp"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/logging"
+)
+
+// multilineMaxLines caps the lines grouped into a single record, further lines begin a new one.
+const multilineMaxLines = 1000
+
+// multilineContinuation matches the continuation lines of common stack traces: indented lines, Java causes and
+// omitted frames, and the goroutine headers, frames, and creators of Go panics.
+var multilineContinuation = regexp.MustCompile(`^(?:\s|Caused by: |\.\.\. \d+ (?:more|common frames omitted)|goroutine \d+ \[|created by |[\w.\-/]+(?:\.\(\*?\w+\))?\.\w+\(.*\)$)`)
+
+// multiline groups the continuation lines of records, see WithMultiline.
+type multiline struct {
+	start *regexp.Regexp
+	wait  time.Duration
+
+	mu     sync.Mutex
+	groups []*lineGroup
+}
+
+// WithMultiline groups the lines written to StdoutWriter and StderrWriter into records, such as a log line and the
+// stack trace following it, shipping each record as a single entry.
+//   - a line matching start begins a new record, other lines continue the current one
+//   - without start, the lines of Java, Python, and Go stack traces continue the current record, including indented
+//     lines, and every other line begins a new one
+//   - a record ships once the next one begins, once no line followed it for wait, or on Close
+//   - records are parsed and classified like single lines, see WithJSONLines and WithSeverityPatterns
+func WithMultiline(start *regexp.Regexp, wait time.Duration) Option {
+	return func(m *Manager) {
+		m.multiline = &multiline{start: start, wait: wait}
+	}
+}
+
+// newGroup returns a lineGroup shipping the records of the named stream at the given severity, flushed on Close.
+func (ml *multiline) newGroup(m *Manager, s logging.Severity, stream string) *lineGroup {
+	g := &lineGroup{m: m, ml: ml, severity: s, stream: stream}
+	ml.mu.Lock()
+	ml.groups = append(ml.groups, g)
+	ml.mu.Unlock()
+	return g
+}
+
+// flushMultiline ships the records still being grouped.
+func (m *Manager) flushMultiline() {
+	m.multiline.mu.Lock()
+	groups := m.multiline.groups
+	m.multiline.mu.Unlock()
+
+	for _, g := range groups {
+		g.mu.Lock()
+		g.flushLocked()
+		g.mu.Unlock()
+	}
+}
+
+// lineGroup groups the lines of a single stream into records.
+type lineGroup struct {
+	m        *Manager
+	ml       *multiline
+	severity logging.Severity
+	stream   string
+
+	mu    sync.Mutex
+	lines [][]byte
+	// partial is a line without its newline yet
+	partial []byte
+	timer   *time.Timer
+}
+
+// write adds the complete lines of p to the records, holding back a trailing partial line until its newline.
+func (g *lineGroup) write(p []byte) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.partial = append(g.partial, p...)
+	for {
+		i := bytes.IndexByte(g.partial, '\n')
+		if i < 0 {
+			break
+		}
+		g.addLocked(bytes.TrimSuffix(g.partial[:i], []byte("\r")))
+		g.partial = g.partial[i+1:]
+	}
+
+	if g.timer == nil {
+		g.timer = time.AfterFunc(g.ml.wait, g.expire)
+	} else {
+		g.timer.Reset(g.ml.wait)
+	}
+}
+
+// addLocked adds a line to the current record, or ships the current record and begins a new one with it.
+func (g *lineGroup) addLocked(line []byte) {
+	blank := len(bytes.TrimSpace(line)) == 0
+	if len(g.lines) == 0 && blank {
+		return
+	}
+	if len(g.lines) > 0 && !blank && (g.begins(line) || len(g.lines) >= multilineMaxLines) {
+		g.shipLocked()
+	}
+	g.lines = append(g.lines, bytes.Clone(line))
+}
+
+// begins reports whether a line begins a new record.
+func (g *lineGroup) begins(line []byte) bool {
+	if g.ml.start != nil {
+		return g.ml.start.Match(line)
+	}
+	if multilineContinuation.Match(line) {
+		return false
+	}
+	// the exception ending a Python traceback follows its indented source lines
+	last := g.lines[len(g.lines)-1]
+	return !(bytes.HasPrefix(g.lines[0], []byte("Traceback ")) && len(last) > 0 && (last[0] == ' ' || last[0] == '\t'))
+}
+
+// expire ships the current record once nothing followed it for the wait.
+func (g *lineGroup) expire() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.flushLocked()
+}
+
+// flushLocked ships the current record, ending it with the partial line, if any.
+func (g *lineGroup) flushLocked() {
+	if partial := g.partial; len(partial) > 0 {
+		g.partial = nil
+		g.addLocked(partial)
+	}
+	g.shipLocked()
+}
+
+// shipLocked ships the current record, without its trailing blank lines.
+func (g *lineGroup) shipLocked() {
+	for len(g.lines) > 0 && len(bytes.TrimSpace(g.lines[len(g.lines)-1])) == 0 {
+		g.lines = g.lines[:len(g.lines)-1]
+	}
+	if len(g.lines) == 0 {
+		return
+	}
+
+	e := g.m.parseLine(bytes.Join(g.lines, []byte("\n")), g.severity)
+	g.lines = nil
+	g.m.logStream(e, g.stream)
+}
@@ -0,0 +1,56 @@
+package lease
+
+import (
+	"regexp"
+	"slices"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/logging"
+)
+
+func TestMultiline(t *testing.T) {
+	sink := &recordingSink{}
+	m := newTestManager(t, WithSink(sink, Leased), WithMultiline(nil, time.Hour))
+
+	w := m.streamWriter(logging.Info, "stderr")
+	for _, p := range []string{
+		"request failed\n",
+		"java.lang.IllegalStateException: closed\n\tat com.example.Pool.get(Pool.java:42)\n",
+		"\tat com.example.Handler.serve(Handler.java:7)\nCaused by: java.io.IOException: reset\n",
+		"\t... 3 more\n\n",
+		"panic: boom\n\ngoroutine 1 [running]:\nmain.main()\n\t/src/main.go:5 +0x1d\n",
+		"retrying",
+	} {
+		w.Write([]byte(p))
+	}
+	if got := len(sink.payloads()); got != 2 {
+		t.Fatalf("shipped %d records before Close, want 2", got)
+	}
+	m.Close()
+
+	want := []any{
+		"request failed",
+		"java.lang.IllegalStateException: closed\n\tat com.example.Pool.get(Pool.java:42)\n\tat com.example.Handler.serve(Handler.java:7)\nCaused by: java.io.IOException: reset\n\t... 3 more",
+		"panic: boom\n\ngoroutine 1 [running]:\nmain.main()\n\t/src/main.go:5 +0x1d",
+		"retrying",
+	}
+	if got := sink.payloads(); !slices.Equal(got, want) {
+		t.Errorf("shipped %q, want %q", got, want)
+	}
+}
+
+func TestMultilineStart(t *testing.T) {
+	sink := &recordingSink{}
+	m := newTestManager(t, WithSink(sink, Leased), WithMultiline(regexp.MustCompile(`^\d{4}-`), 20*time.Millisecond))
+
+	w := m.streamWriter(logging.Info, "stdout")
+	w.Write([]byte("2024-01-01 first\nsecond line\n2024-01-01 next\nmore\n"))
+
+	// the last record ships once nothing followed it for the wait
+	time.Sleep(100 * time.Millisecond)
+	want := []any{"2024-01-01 first\nsecond line", "2024-01-01 next\nmore"}
+	if got := sink.payloads(); !slices.Equal(got, want) {
+		t.Errorf("shipped %q, want %q", got, want)
+	}
+}
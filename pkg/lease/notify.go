@@ -0,0 +1,296 @@
+package lease
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Notification events, sent when a lease starts, when an active lease is extended, and when it stops.
+const (
+	NotifyStart  = "start"
+	NotifyExtend = "extend"
+	NotifyExpire = "expire"
+)
+
+// Notification describes a transition of a lease document.
+type Notification struct {
+	Event string `json:"event"`
+	// Instance is the manager instance that sent the notification, one per transition across every instance.
+	Instance string            `json:"instance"`
+	Labels   map[string]string `json:"labels,omitempty"`
+	// Lease is the lease that changed, as last seen while it was active for expire events.
+	Lease *NotificationLease `json:"lease,omitempty"`
+	At    time.Time          `json:"at"`
+}
+
+// NotificationLease is the lease a notification is about.
+type NotificationLease struct {
+	ID       string            `json:"id"`
+	User     string            `json:"user,omitempty"`
+	Reason   string            `json:"reason,omitempty"`
+	Scope    string            `json:"scope,omitempty"`
+	Tags     map[string]string `json:"tags,omitempty"`
+	GrantID  string            `json:"grantId,omitempty"`
+	ExpireAt time.Time         `json:"expireAt"`
+}
+
+// Notifier is told about lease transitions.
+type Notifier interface {
+	Notify(ctx context.Context, n Notification) error
+}
+
+const (
+	// notifyQueueSize is the number of notifications queued before new ones are dropped.
+	notifyQueueSize = 100
+	// notifyDrainTimeout bounds how long Close keeps sending the notifications still queued.
+	notifyDrainTimeout = 10 * time.Second
+)
+
+// WithNotifier sends lease transitions to n.
+//   - notifications are sent in order from a background goroutine, so slow notifiers never block shipping
+//   - only transitions of lease documents are notified, not the startup or guaranteed windows of the manager
+//   - each transition is claimed in the notifications subcollection of the lease, so only one of the instances
+//     watching it sends it, and restarted instances do not send it again
+//   - notifications still queued are sent by Close
+func WithNotifier(n Notifier) Option {
+	return func(m *Manager) {
+		m.notifiers = append(m.notifiers, n)
+	}
+}
+
+// queuedNotification is a notification waiting to be sent, once claimed by creating the claim document.
+type queuedNotification struct {
+	Notification
+	claim *firestore.DocumentRef
+}
+
+// notificationCollection returns the collection recording the transitions of a lease that were notified.
+func notificationCollection(docRef *firestore.DocumentRef) *firestore.CollectionRef {
+	return docRef.Collection("notifications")
+}
+
+// notifyLease queues the notifications for the transition of the lease document of s since it was last notified.
+//   - a lease starts when its document becomes active in a new session, or a new scheduled window of one
+//   - it is extended when the end of its active period moves out, and expires when it is no longer active, including
+//     when a new session replaces it
+//   - transitions are keyed by the lease session, so every instance claims the same transition
+func (s *leaseSource) notifyLease(lease *Document) {
+	if len(s.m.notifiers) == 0 {
+		return
+	}
+
+	now := time.Now()
+	var key string
+	var until time.Time
+	if lease != nil && !lease.Revoked && !lease.Pending {
+		until, _ = lease.ActiveUntil(now)
+		if until.After(now) {
+			key = cmp.Or(lease.SessionID, lease.GrantID, "lease")
+			if !lease.ExpireAt.After(now) {
+				// every scheduled window of the same session starts again
+				key += "-" + strconv.FormatInt(until.Unix(), 10)
+			}
+		}
+	}
+
+	s.notifyMu.Lock()
+	defer s.notifyMu.Unlock()
+
+	switch {
+	case key != "" && key == s.notifiedKey:
+		if until.After(s.notifiedUntil) {
+			s.notifiedUntil = until
+			s.notifiedLease = lease
+			s.queueNotification(NotifyExtend, lease, fmt.Sprintf("%s-%s-%d", NotifyExtend, key, until.UnixMicro()))
+		}
+	case key != s.notifiedKey:
+		if s.notifiedKey != "" {
+			s.queueNotification(NotifyExpire, s.notifiedLease, NotifyExpire+"-"+s.notifiedKey)
+		}
+		if key != "" {
+			s.queueNotification(NotifyStart, lease, NotifyStart+"-"+key)
+		}
+		s.notifiedKey, s.notifiedUntil, s.notifiedLease = key, until, lease
+	}
+}
+
+// queueNotification queues a notification of the event for every notifier, claimed as claimKey.
+func (s *leaseSource) queueNotification(event string, lease *Document, claimKey string) {
+	m := s.m
+	q := queuedNotification{
+		Notification: Notification{
+			Event:    event,
+			Instance: m.instanceID,
+			Labels:   m.labels,
+			At:       time.Now().UTC(),
+		},
+		claim: notificationCollection(s.docRef).Doc(claimKey),
+	}
+	if lease != nil {
+		q.Lease = &NotificationLease{
+			ID:       s.docRef.ID,
+			User:     lease.User,
+			Reason:   lease.Reason,
+			Scope:    lease.Scope,
+			Tags:     lease.Tags,
+			GrantID:  lease.GrantID,
+			ExpireAt: lease.ExpireAt,
+		}
+	}
+
+	select {
+	case m.notifications <- q:
+	default:
+		diag().Error("failed to notify, too many notifications queued", "event", event)
+	}
+}
+
+// activeSource returns the first active lease with a document, or nil if there is none.
+func (m *Manager) activeSource() *leaseSource {
+	for _, src := range m.sources {
+		if src.active.Load() && src.lease.Load() != nil {
+			return src
+		}
+	}
+	return nil
+}
+
+// sendNotifications sends queued notifications to every notifier until ctx is done, then sends those still queued.
+func (m *Manager) sendNotifications(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			m.drainNotifications()
+			return
+		case q := <-m.notifications:
+			m.sendNotification(ctx, q)
+		}
+	}
+}
+
+// drainNotifications sends the notifications still queued, for up to notifyDrainTimeout.
+func (m *Manager) drainNotifications() {
+	ctx, cancel := context.WithTimeout(context.Background(), notifyDrainTimeout)
+	defer cancel()
+
+	for {
+		select {
+		case q := <-m.notifications:
+			m.sendNotification(ctx, q)
+		default:
+			return
+		}
+	}
+}
+
+// sendNotification sends a notification to every notifier, unless another instance already claimed it.
+//   - a claim that can not be recorded is reported and the notification sent anyway, a duplicate beats none
+func (m *Manager) sendNotification(ctx context.Context, q queuedNotification) {
+	_, err := q.claim.Create(ctx, map[string]any{"instance": m.instanceID, "at": q.At})
+	switch {
+	case status.Code(err) == codes.AlreadyExists:
+		return
+	case err != nil:
+		diag().Error("failed to claim notification", "event", q.Event, "error", err)
+	}
+
+	for _, notifier := range m.notifiers {
+		if err := notifier.Notify(ctx, q.Notification); err != nil {
+			diag().Error("failed to notify", "event", q.Event, "error", err)
+		}
+	}
+}
+
+// WebhookSignatureHeader carries the HMAC-SHA256 signature of webhook bodies, as "sha256=<hex>".
+const WebhookSignatureHeader = "X-Leased-Logs-Signature"
+
+// WebhookNotifier is a Notifier that POSTs notifications as JSON to a URL.
+//   - bodies are signed with HMAC-SHA256 when a secret is set, see WebhookSignatureHeader
+//   - failed requests, network errors and 429 or 5xx responses, are retried with exponential backoff
+type WebhookNotifier struct {
+	url     string
+	secret  []byte
+	client  *http.Client
+	retries int
+}
+
+// NewWebhookNotifier creates a WebhookNotifier posting to url, signing bodies with secret unless it is empty.
+func NewWebhookNotifier(url, secret string) *WebhookNotifier {
+	return &WebhookNotifier{
+		url:     url,
+		secret:  []byte(secret),
+		client:  &http.Client{Timeout: 10 * time.Second},
+		retries: 3,
+	}
+}
+
+// Notify POSTs the notification, retrying failed attempts.
+func (w *WebhookNotifier) Notify(ctx context.Context, n Notification) error {
+	body, err := json.Marshal(n)
+	if err != nil {
+		return fmt.Errorf("failed to encode notification: %w", err)
+	}
+	return w.send(ctx, body)
+}
+
+// send POSTs a JSON body, retrying failed attempts.
+func (w *WebhookNotifier) send(ctx context.Context, body []byte) error {
+	backoff := time.Second
+	for attempt := 0; ; attempt++ {
+		retry, err := w.post(ctx, body)
+		if err == nil {
+			return nil
+		}
+		if !retry || attempt == w.retries {
+			return fmt.Errorf("webhook %q: %w", w.url, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// post sends a single request, reporting whether a failure is worth retrying.
+func (w *WebhookNotifier) post(ctx context.Context, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if len(w.secret) > 0 {
+		mac := hmac.New(sha256.New, w.secret)
+		mac.Write(body)
+		req.Header.Set(WebhookSignatureHeader, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests, resp.StatusCode >= 500:
+		return true, fmt.Errorf("unexpected status %s", resp.Status)
+	case resp.StatusCode >= 300:
+		return false, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return false, nil
+}
@@ -0,0 +1,44 @@
+package lease
+
+import "cloud.google.com/go/logging"
+
+// WithOnError calls f with every error a sink fails to ship an entry with, such as to alert on a broken pipeline.
+//   - errors returned by sinks and the asynchronous errors reported with HandleError are both passed to f
+//   - f is called from the goroutine that hit the error, so it must be fast and safe for concurrent use
+func WithOnError(f func(error)) Option {
+	return func(m *Manager) {
+		m.onError = f
+	}
+}
+
+// HandleError reports an error a sink hit after Log returned, counting it in Stats and the metrics, and calling the
+// WithOnError callback.
+//   - set it as the OnError of the logging.Client a CloudLoggingSink writes with, whose errors are otherwise invisible
+//   - ConcurrentSink workers report the entries they fail to ship on their own, quarantining rejected ones
+func (m *Manager) HandleError(err error) {
+	m.sinkError(err)
+	if m.onError == nil {
+		diag().Error("failed to ship entries", "error", err)
+	}
+}
+
+// sinkError counts a sink error and passes it to the WithOnError callback.
+func (m *Manager) sinkError(err error) {
+	m.sinkErrors.Add(1)
+	if m.onError != nil {
+		m.onError(err)
+	}
+}
+
+// asyncErrorSink is a sink reporting the entries it fails to ship after Log returned, wired to asyncShipFailed by
+// NewManager.
+type asyncErrorSink interface {
+	setOnFailure(f func(logging.Entry, error))
+}
+
+// asyncShipFailed reports an entry a sink failed to ship after Log returned like one it failed to ship in Log, counting
+// the error and quarantining the entry if the sink rejected it.
+func (m *Manager) asyncShipFailed(e logging.Entry, err error) {
+	m.sinkError(err)
+	m.shipFailed(e, err)
+}
@@ -0,0 +1,256 @@
+package lease
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"slices"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/logging"
+)
+
+// PluginProtocolVersion is the version of the exec plugin protocol implemented by ExecPlugin.
+const PluginProtocolVersion = 1
+
+// maxPluginFrameBytes bounds the size of a single frame read from a plugin.
+const maxPluginFrameBytes = 16 << 20
+
+// pluginCallTimeout bounds how long a plugin may take to answer a request before it is killed, so a hung plugin never
+// blocks logging.
+const pluginCallTimeout = 10 * time.Second
+
+// Plugin capabilities announced in the handshake.
+const (
+	PluginSink      = "sink"
+	PluginProcessor = "processor"
+)
+
+// pluginHandshake is the first frame a plugin writes to stdout.
+type pluginHandshake struct {
+	Protocol     int      `json:"protocol"`
+	Capabilities []string `json:"capabilities"`
+}
+
+// pluginRequest is a frame written to the stdin of a plugin.
+//   - type is "log" to ship an entry, "process" to process an entry, or "flush" to flush buffered entries
+type pluginRequest struct {
+	ID    uint64     `json:"id"`
+	Type  string     `json:"type"`
+	Entry *jsonEntry `json:"entry,omitempty"`
+}
+
+// pluginResponse is a frame written by a plugin to stdout for every request, with the same id.
+//   - for "process" requests, entry replaces the entry unless drop is set, a missing entry keeps it unchanged
+type pluginResponse struct {
+	ID    uint64     `json:"id"`
+	Error string     `json:"error,omitempty"`
+	Entry *jsonEntry `json:"entry,omitempty"`
+	Drop  bool       `json:"drop,omitempty"`
+	// Rejected marks the error of a log request as a rejection of the entry itself, which is quarantined.
+	Rejected bool `json:"rejected,omitempty"`
+}
+
+// ExecPlugin is a Sink and Processor implemented by an external program, so sinks and processors can be added without forking.
+//   - frames are newline-delimited JSON objects, requests on the plugin's stdin and responses on its stdout
+//   - the plugin starts by writing a handshake with its protocol version and capabilities, "sink" and/or "processor"
+//   - every request is answered, in order, by a response with the same id before the next request is sent
+//   - the plugin's stderr is passed through to stderr
+//   - a plugin not answering within pluginCallTimeout is killed, later requests fail open like those to an exited plugin
+type ExecPlugin struct {
+	path         string
+	capabilities []string
+
+	mu     sync.Mutex
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout *bufio.Scanner
+	nextID uint64
+
+	closeOnce sync.Once
+	closeErr  error
+}
+
+// StartExecPlugin starts the plugin at path and waits for its handshake.
+func StartExecPlugin(path string, args ...string) (*ExecPlugin, error) {
+	cmd := exec.Command(path, args...)
+	cmd.Stderr = os.Stderr
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create plugin stdin: %w", err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create plugin stdout: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start plugin %q: %w", path, err)
+	}
+
+	p := &ExecPlugin{
+		path:   path,
+		cmd:    cmd,
+		stdin:  stdin,
+		stdout: bufio.NewScanner(stdout),
+	}
+	p.stdout.Buffer(make([]byte, 64*1024), maxPluginFrameBytes)
+
+	var hs pluginHandshake
+	if err := p.read(&hs); err != nil {
+		p.Close()
+		return nil, fmt.Errorf("failed to read handshake of plugin %q: %w", path, err)
+	}
+	if hs.Protocol != PluginProtocolVersion {
+		p.Close()
+		return nil, fmt.Errorf("plugin %q speaks protocol %d, want %d", path, hs.Protocol, PluginProtocolVersion)
+	}
+	p.capabilities = hs.Capabilities
+
+	return p, nil
+}
+
+// Supports reports whether the plugin announced the given capability.
+func (p *ExecPlugin) Supports(capability string) bool {
+	return slices.Contains(p.capabilities, capability)
+}
+
+// Log sends the entry to the plugin to be shipped.
+func (p *ExecPlugin) Log(e logging.Entry) error {
+	je := newJSONEntry(e)
+	resp, err := p.call("log", &je)
+	if err != nil && resp.Rejected {
+		return &RejectedError{Reason: resp.Error}
+	}
+	return err
+}
+
+// Flush asks the plugin to ship all buffered entries.
+func (p *ExecPlugin) Flush() error {
+	_, err := p.call("flush", nil)
+	return err
+}
+
+// Process sends the entry to the plugin, replacing it with the returned entry or dropping it.
+//   - the entry is kept unchanged if the plugin fails, so a broken plugin never loses entries
+func (p *ExecPlugin) Process(e *logging.Entry) bool {
+	je := newJSONEntry(*e)
+	resp, err := p.call("process", &je)
+	if err != nil {
+		diag().Error("failed to process entry with plugin", "plugin", p.path, "error", err)
+		return true
+	}
+
+	if resp.Drop {
+		return false
+	}
+	if resp.Entry != nil {
+		*e = resp.Entry.entry()
+	}
+	return true
+}
+
+// Close closes the plugin's stdin and waits for it to exit, killing it if it does not within pluginCallTimeout.
+//   - Close is safe to call more than once, later calls return the result of the first
+func (p *ExecPlugin) Close() error {
+	p.closeOnce.Do(func() {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+
+		kill := time.AfterFunc(pluginCallTimeout, p.kill)
+		defer kill.Stop()
+
+		p.stdin.Close()
+		p.closeErr = p.cmd.Wait()
+	})
+	return p.closeErr
+}
+
+// kill kills the plugin, which ends any pending read or write.
+func (p *ExecPlugin) kill() {
+	diag().Error("killing unresponsive plugin", "plugin", p.path, "timeout", pluginCallTimeout)
+	_ = p.cmd.Process.Kill()
+}
+
+// call sends a request and waits for its response.
+//   - the plugin is killed if it does not answer within pluginCallTimeout
+func (p *ExecPlugin) call(typ string, entry *jsonEntry) (pluginResponse, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	kill := time.AfterFunc(pluginCallTimeout, p.kill)
+	defer kill.Stop()
+
+	p.nextID++
+	req := pluginRequest{ID: p.nextID, Type: typ, Entry: entry}
+
+	line, err := json.Marshal(req)
+	if err != nil {
+		return pluginResponse{}, fmt.Errorf("failed to encode plugin request: %w", err)
+	}
+	if _, err := p.stdin.Write(append(line, '\n')); err != nil {
+		return pluginResponse{}, fmt.Errorf("failed to write to plugin: %w", err)
+	}
+
+	var resp pluginResponse
+	if err := p.read(&resp); err != nil {
+		return resp, err
+	}
+	if resp.ID != req.ID {
+		return resp, fmt.Errorf("plugin answered request %d with response %d", req.ID, resp.ID)
+	}
+	if resp.Error != "" {
+		return resp, errors.New(resp.Error)
+	}
+	return resp, nil
+}
+
+// read decodes the next frame from the plugin's stdout.
+func (p *ExecPlugin) read(v any) error {
+	if !p.stdout.Scan() {
+		if err := p.stdout.Err(); err != nil {
+			return fmt.Errorf("failed to read from plugin: %w", err)
+		}
+		return errors.New("plugin exited")
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(p.stdout.Bytes()))
+	dec.UseNumber()
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("failed to decode plugin frame: %w", err)
+	}
+	return nil
+}
+
+// MarshalPluginEntry encodes an entry as the entry of exec plugin frames, for processors speaking the plugin format over
+// another transport, such as WebAssembly filters.
+func MarshalPluginEntry(e logging.Entry) ([]byte, error) {
+	return json.Marshal(newJSONEntry(e))
+}
+
+// UnmarshalPluginResult decodes the result of processing an entry, with the entry, drop, and error fields of the
+// responses of exec plugins.
+//   - entry is the entry replacing the processed one, nil to keep it unchanged
+//   - the error field is returned as the error
+func UnmarshalPluginResult(b []byte) (entry *logging.Entry, drop bool, err error) {
+	var resp pluginResponse
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	if err := dec.Decode(&resp); err != nil {
+		return nil, false, fmt.Errorf("failed to decode result: %w", err)
+	}
+	if resp.Error != "" {
+		return nil, false, errors.New(resp.Error)
+	}
+	if resp.Entry != nil {
+		e := resp.Entry.entry()
+		entry = &e
+	}
+	return entry, resp.Drop, nil
+}
@@ -0,0 +1,137 @@
+package lease
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	"cloud.google.com/go/logging"
+)
+
+// Processor transforms or filters entries before they are shipped.
+type Processor interface {
+	// Process may modify the entry in place, returning false drops the entry.
+	Process(e *logging.Entry) bool
+}
+
+// ProcessorFunc adapts a function to the Processor interface.
+type ProcessorFunc func(e *logging.Entry) bool
+
+// Process calls f(e).
+func (f ProcessorFunc) Process(e *logging.Entry) bool {
+	return f(e)
+}
+
+// WithProcessors appends processors that run, in order, on every entry before it is shipped.
+func WithProcessors(processors ...Processor) Option {
+	return func(m *Manager) {
+		m.processors = append(m.processors, processors...)
+	}
+}
+
+// WithLogName sets the log name entries are stamped with while they are processed.
+//   - the log name is available to processors in Entry.LogName and removed before shipping
+func WithLogName(name string) Option {
+	return func(m *Manager) {
+		m.logName = name
+	}
+}
+
+// severityLogName is a log name used for entries at or above a severity.
+type severityLogName struct {
+	min  logging.Severity
+	name string
+}
+
+// WithSeverityLogName stamps entries at or above min with name instead of the WithLogName log name.
+//   - with several, the one with the highest severity the entry reaches wins
+func WithSeverityLogName(min logging.Severity, name string) Option {
+	return func(m *Manager) {
+		m.severityLogNames = append(m.severityLogNames, severityLogName{min: min, name: name})
+		slices.SortFunc(m.severityLogNames, func(a, b severityLogName) int {
+			return int(b.min) - int(a.min)
+		})
+	}
+}
+
+// logNameFor returns the log name of an entry with the given severity.
+func (m *Manager) logNameFor(s logging.Severity) string {
+	for _, l := range m.severityLogNames {
+		if s >= l.min {
+			return l.name
+		}
+	}
+	return m.logName
+}
+
+// process runs all processors on the entry, returning false if any of them dropped it.
+//   - raw JSON payloads are decoded first, so processors only ever see map payloads
+func (m *Manager) process(e *logging.Entry) bool {
+	if raw, ok := e.Payload.(json.RawMessage); ok && len(m.processors) > 0 {
+		var fields map[string]any
+		if err := json.Unmarshal(raw, &fields); err == nil {
+			e.Payload = fields
+		}
+	}
+
+	for _, p := range m.processors {
+		if !p.Process(e) {
+			return false
+		}
+	}
+	return true
+}
+
+// replaceField replaces the value of a label and of a top-level string field of a map payload, wherever key is present.
+func replaceField(e *logging.Entry, key string, replace func(string) string) {
+	if v, ok := e.Labels[key]; ok {
+		e.Labels[key] = replace(v)
+	}
+	if payload, ok := e.Payload.(map[string]any); ok {
+		if v, ok := payload[key].(string); ok {
+			payload[key] = replace(v)
+		}
+	}
+}
+
+// FieldValue returns the value of a label, or of a top-level string field of a map payload, for processors reading a
+// field wherever the entry carries it.
+func FieldValue(e *logging.Entry, key string) (string, bool) {
+	if v, ok := e.Labels[key]; ok {
+		return v, true
+	}
+	if payload, ok := e.Payload.(map[string]any); ok {
+		if v, ok := payload[key].(string); ok {
+			return v, true
+		}
+	}
+	return "", false
+}
+
+// SetStructuredField adds a structured field to the entry, for processors enriching entries.
+//   - map payloads get the fields nested under key
+//   - other entries get one "key.field" label per field
+func SetStructuredField(e *logging.Entry, key string, fields map[string]any) {
+	if payload, ok := e.Payload.(map[string]any); ok {
+		payload[key] = fields
+		return
+	}
+
+	if e.Labels == nil {
+		e.Labels = make(map[string]string, len(fields))
+	}
+	for k, v := range fields {
+		e.Labels[key+"."+k] = fmt.Sprint(v)
+	}
+}
+
+// withLabel returns the entry with an added label, without modifying the labels of the original entry.
+func withLabel(e logging.Entry, key, value string) logging.Entry {
+	labels := make(map[string]string, len(e.Labels)+1)
+	for k, v := range e.Labels {
+		labels[k] = v
+	}
+	labels[key] = value
+	e.Labels = labels
+	return e
+}
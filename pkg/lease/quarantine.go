@@ -0,0 +1,106 @@
+package lease
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"unicode/utf8"
+
+	"cloud.google.com/go/logging"
+)
+
+// RejectedError is returned by sinks that will never accept an entry, such as one that is too large, as opposed to
+// failing to ship it for now.
+type RejectedError struct {
+	Reason string
+}
+
+func (e *RejectedError) Error() string {
+	return "entry rejected: " + e.Reason
+}
+
+// EntryValidator is implemented by sinks that can reject entries before shipping them.
+//   - wrapping sinks, such as ConcurrentSink, use it to reject entries before they are queued
+type EntryValidator interface {
+	// ValidateEntry returns a RejectedError if the sink would reject the entry.
+	ValidateEntry(e logging.Entry) error
+}
+
+// WithQuarantine writes entries rejected by a sink to w, one JSON object per line with the rejection reason,
+// instead of dropping them.
+func WithQuarantine(w io.Writer) Option {
+	return func(m *Manager) {
+		m.quarantine = w
+	}
+}
+
+// Quarantined returns the number of entries written to the quarantine.
+func (m *Manager) Quarantined() int64 {
+	return m.quarantined.Load()
+}
+
+// shipFailed reports an entry a sink failed to ship, and quarantines it if the sink rejected it.
+func (m *Manager) shipFailed(e logging.Entry, err error) {
+	var rejected *RejectedError
+	if !errors.As(err, &rejected) || m.quarantine == nil {
+		diag().Error("failed to ship entry", "error", err)
+		return
+	}
+
+	m.quarantineMu.Lock()
+	defer m.quarantineMu.Unlock()
+	if werr := WriteQuarantined(m.quarantine, e, rejected.Reason); werr != nil {
+		diag().Error("failed to quarantine entry", "error", werr)
+		return
+	}
+	m.quarantined.Add(1)
+}
+
+// WriteQuarantined writes an entry and the reason it was not shipped to w as a line of JSON, in the format of
+// WithQuarantine, for processors quarantining the entries they drop.
+func WriteQuarantined(w io.Writer, e logging.Entry, reason string) error {
+	quarantined := newJSONEntry(e)
+	quarantined.Reason = reason
+	line, err := json.Marshal(quarantined)
+	if err != nil {
+		return fmt.Errorf("failed to encode quarantined entry: %w", err)
+	}
+	_, err = w.Write(append(line, '\n'))
+	return err
+}
+
+// maxCloudLoggingEntrySize is the largest entry Cloud Logging accepts.
+const maxCloudLoggingEntrySize = 256 << 10
+
+// ValidateEntry rejects entries Cloud Logging would refuse, which would otherwise fail the whole batch they are sent in.
+//   - the size is estimated from the payload and labels, so entries close to the limit may still be refused
+func (s *CloudLoggingSink) ValidateEntry(e logging.Entry) error {
+	size := 0
+	for k, v := range e.Labels {
+		if !utf8.ValidString(k) || !utf8.ValidString(v) {
+			return &RejectedError{Reason: fmt.Sprintf("label %q is not valid UTF-8", k)}
+		}
+		size += len(k) + len(v)
+	}
+
+	switch p := e.Payload.(type) {
+	case nil:
+	case string:
+		if !utf8.ValidString(p) {
+			return &RejectedError{Reason: "payload is not valid UTF-8"}
+		}
+		size += len(p)
+	default:
+		b, err := json.Marshal(p)
+		if err != nil {
+			return &RejectedError{Reason: fmt.Sprintf("payload can not be encoded: %v", err)}
+		}
+		size += len(b)
+	}
+
+	if size > maxCloudLoggingEntrySize {
+		return &RejectedError{Reason: fmt.Sprintf("entry is about %d bytes, Cloud Logging accepts at most %d", size, maxCloudLoggingEntrySize)}
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+package lease
+
+import (
+	"fmt"
+	"sync"
+
+	"cloud.google.com/go/logging"
+)
+
+// BackpressurePolicy controls what logging does once the queue of a manager is full, see WithQueue.
+type BackpressurePolicy int
+
+const (
+	// BackpressureBlock waits for room in the queue, so nothing is lost but a slow sink eventually slows the writer.
+	BackpressureBlock BackpressurePolicy = iota
+	// BackpressureDropOldest drops the oldest queued entry to make room for the new one.
+	BackpressureDropOldest
+	// BackpressureDropNewest drops the new entry.
+	BackpressureDropNewest
+)
+
+// ParseBackpressurePolicy converts "block", "drop-oldest", or "drop-newest" to a BackpressurePolicy.
+func ParseBackpressurePolicy(s string) (BackpressurePolicy, error) {
+	switch s {
+	case "block":
+		return BackpressureBlock, nil
+	case "drop-oldest":
+		return BackpressureDropOldest, nil
+	case "drop-newest":
+		return BackpressureDropNewest, nil
+	default:
+		return BackpressureBlock, fmt.Errorf("unknown backpressure policy %q, must be block, drop-oldest, or drop-newest", s)
+	}
+}
+
+// queuedEntry is an entry waiting for the shipping goroutine, with whether it ships to leased sinks.
+type queuedEntry struct {
+	e    logging.Entry
+	ship bool
+}
+
+// entryQueue is the bounded queue between logging and shipping, see WithQueue.
+type entryQueue struct {
+	entries chan queuedEntry
+	policy  BackpressurePolicy
+
+	mu      sync.Mutex
+	idle    *sync.Cond
+	pending int
+
+	// closeMu is held for reading while sending to entries, so close never closes it under a sender
+	closeMu sync.RWMutex
+	closed  bool
+	// done is closed once processQueue returns
+	done chan struct{}
+}
+
+// WithQueue decouples logging from shipping with a queue of up to size entries, shipped by a single goroutine, so a
+// slow sink does not stall the writers, such as the stdout of a captured command.
+//   - once the queue is full, policy decides whether logging blocks or entries are dropped, counted in Stats as Dropped
+//   - entries ship in the order they were logged
+//   - Flush and Close ship the queued entries first
+func WithQueue(size int, policy BackpressurePolicy) Option {
+	return func(m *Manager) {
+		q := &entryQueue{entries: make(chan queuedEntry, max(size, 1)), policy: policy, done: make(chan struct{})}
+		q.idle = sync.NewCond(&q.mu)
+		m.queue = q
+	}
+}
+
+// enqueue queues an entry for the shipping goroutine, applying the backpressure policy once the queue is full.
+//   - returns false without queueing the entry once the queue is closed, see Manager.Close
+func (m *Manager) enqueue(e logging.Entry, ship bool) bool {
+	q := m.queue
+	q.closeMu.RLock()
+	defer q.closeMu.RUnlock()
+	if q.closed {
+		return false
+	}
+
+	qe := queuedEntry{e: e, ship: ship}
+	q.add(1)
+
+	switch q.policy {
+	case BackpressureDropNewest:
+		select {
+		case q.entries <- qe:
+		default:
+			q.add(-1)
+			m.dropped.Add(1)
+		}
+	case BackpressureDropOldest:
+		for {
+			select {
+			case q.entries <- qe:
+				return true
+			default:
+			}
+			select {
+			case <-q.entries:
+				q.add(-1)
+				m.dropped.Add(1)
+			default:
+			}
+		}
+	default:
+		q.entries <- qe
+	}
+	return true
+}
+
+// processQueue ships queued entries until the queue is closed.
+func (m *Manager) processQueue() {
+	defer close(m.queue.done)
+	for qe := range m.queue.entries {
+		m.logNow(qe.e, qe.ship)
+		m.queue.add(-1)
+	}
+}
+
+// close closes the queue once the queued entries are shipped and waits for processQueue to return.
+//   - later entries are no longer queued, see enqueue
+func (q *entryQueue) close() {
+	q.wait()
+	q.closeMu.Lock()
+	if !q.closed {
+		q.closed = true
+		close(q.entries)
+	}
+	q.closeMu.Unlock()
+	<-q.done
+}
+
+// add changes the number of entries queued or being shipped, waking wait once there are none.
+func (q *entryQueue) add(n int) {
+	q.mu.Lock()
+	q.pending += n
+	if q.pending == 0 {
+		q.idle.Broadcast()
+	}
+	q.mu.Unlock()
+}
+
+// wait waits until no entries are queued or being shipped.
+func (q *entryQueue) wait() {
+	q.mu.Lock()
+	for q.pending > 0 {
+		q.idle.Wait()
+	}
+	q.mu.Unlock()
+}
+
+// len returns the number of entries queued or being shipped.
+func (q *entryQueue) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.pending
+}
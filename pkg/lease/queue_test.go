@@ -0,0 +1,84 @@
+package lease
+
+import (
+	"slices"
+	"testing"
+
+	"cloud.google.com/go/logging"
+)
+
+func TestQueueBackpressure(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy BackpressurePolicy
+		want   []any
+	}{
+		{"drop newest", BackpressureDropNewest, []any{"1", "2", "3"}},
+		{"drop oldest", BackpressureDropOldest, []any{"1", "4", "5"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sink := &recordingSink{block: make(chan struct{}), started: make(chan struct{}, 5)}
+			m := newTestManager(t, WithSink(sink, Leased), WithQueue(2, tt.policy))
+
+			// the first entry is being shipped, the next two fill the queue, and the last two overflow it
+			m.log(logging.Entry{Severity: logging.Info, Payload: "1"}, true)
+			<-sink.started
+			for _, p := range []string{"2", "3", "4", "5"} {
+				m.log(logging.Entry{Severity: logging.Info, Payload: p}, true)
+			}
+			close(sink.block)
+			if err := m.Flush(); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := sink.payloads(); !slices.Equal(got, tt.want) {
+				t.Errorf("shipped %v, want %v", got, tt.want)
+			}
+			if got := m.Stats().Dropped; got != 2 {
+				t.Errorf("dropped %d entries, want 2", got)
+			}
+		})
+	}
+}
+
+func TestQueueBlock(t *testing.T) {
+	sink := &recordingSink{}
+	m := newTestManager(t, WithSink(sink, Leased), WithQueue(1, BackpressureBlock))
+
+	for _, p := range []string{"1", "2", "3", "4"} {
+		m.log(logging.Entry{Severity: logging.Info, Payload: p}, true)
+	}
+	if err := m.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := sink.payloads(), []any{"1", "2", "3", "4"}; !slices.Equal(got, want) {
+		t.Errorf("shipped %v, want %v", got, want)
+	}
+	if got := m.Stats().Dropped; got != 0 {
+		t.Errorf("dropped %d entries, want 0", got)
+	}
+}
+
+func TestQueueClose(t *testing.T) {
+	sink := &recordingSink{}
+	m := newTestManager(t, WithSink(sink, Leased), WithQueue(4, BackpressureBlock))
+
+	m.log(logging.Entry{Severity: logging.Info, Payload: "before"}, true)
+	if err := m.Close(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-m.queue.done:
+	default:
+		t.Fatal("queue still processed after Close")
+	}
+
+	// shipped directly, as nothing processes the queue anymore
+	m.log(logging.Entry{Severity: logging.Info, Payload: "after"}, true)
+	if got, want := sink.payloads(), []any{"before", "after"}; !slices.Equal(got, want) {
+		t.Errorf("shipped %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,177 @@
+package lease
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"cloud.google.com/go/logging"
+	"golang.org/x/time/rate"
+)
+
+// RateLimitOverflow controls what happens to shipped entries over the rate limit, see WithRateLimit.
+type RateLimitOverflow int
+
+const (
+	// RateLimitDrop drops entries over the limit.
+	RateLimitDrop RateLimitOverflow = iota
+	// RateLimitSample ships one in every rateLimitSampleEvery entries over the limit, labeled rate_limit_sample=true.
+	RateLimitSample
+	// RateLimitBuffer queues entries over the limit and ships them as the limit allows, dropping them once the queue
+	// is full.
+	RateLimitBuffer
+)
+
+const (
+	// rateLimitSampleEvery is the share of entries over the limit shipped by RateLimitSample
+	rateLimitSampleEvery = 100
+	// rateLimitBufferSize is the number of entries over the limit queued by RateLimitBuffer
+	rateLimitBufferSize = 10000
+)
+
+// ParseRateLimitOverflow converts "drop", "sample", or "buffer" to a RateLimitOverflow.
+func ParseRateLimitOverflow(s string) (RateLimitOverflow, error) {
+	switch s {
+	case "drop":
+		return RateLimitDrop, nil
+	case "sample":
+		return RateLimitSample, nil
+	case "buffer":
+		return RateLimitBuffer, nil
+	default:
+		return RateLimitDrop, fmt.Errorf("unknown rate limit overflow %q, must be drop, sample, or buffer", s)
+	}
+}
+
+// rateLimiter caps the entries and bytes shipped per second, see WithRateLimit.
+type rateLimiter struct {
+	entries *rate.Limiter
+	bytes   *rate.Limiter
+	// burst is the burst of bytes, larger entries only need a full bucket
+	burst    int
+	overflow RateLimitOverflow
+
+	// overflowed counts the entries over the limit, for sampling
+	overflowed atomic.Int64
+	queue      chan logging.Entry
+}
+
+// WithRateLimit caps the entries and bytes shipped per second with token buckets, so a runaway loop under a lease
+// cannot blow the logging budget.
+//   - a limit of zero is not enforced, bursts of up to one second of either limit are allowed
+//   - the limit applies to every entry shipped to leased sinks, including errors shipped without a lease
+//   - sinks with the Always policy, such as local files, receive every entry, as they do without a lease
+//   - entries over the limit are dropped, sampled, or buffered by overflow, and counted in Stats as RateLimited
+func WithRateLimit(entriesPerSecond, bytesPerSecond int, overflow RateLimitOverflow) Option {
+	return func(m *Manager) {
+		l := &rateLimiter{overflow: overflow, burst: bytesPerSecond}
+		if entriesPerSecond > 0 {
+			l.entries = rate.NewLimiter(rate.Limit(entriesPerSecond), entriesPerSecond)
+		}
+		if bytesPerSecond > 0 {
+			l.bytes = rate.NewLimiter(rate.Limit(bytesPerSecond), bytesPerSecond)
+		}
+		if overflow == RateLimitBuffer {
+			l.queue = make(chan logging.Entry, rateLimitBufferSize)
+		}
+		m.rateLimit = l
+	}
+}
+
+// allow reports whether the entry is within the limit, using up its tokens only if it is.
+func (l *rateLimiter) allow(e logging.Entry) bool {
+	now := time.Now()
+	var entries, bytes *rate.Reservation
+	if l.entries != nil {
+		entries = l.entries.ReserveN(now, 1)
+	}
+	if l.bytes != nil {
+		bytes = l.bytes.ReserveN(now, min(entrySize(e), l.burst))
+	}
+
+	if (entries == nil || entries.DelayFrom(now) == 0) && (bytes == nil || bytes.DelayFrom(now) == 0) {
+		return true
+	}
+	if entries != nil {
+		entries.CancelAt(now)
+	}
+	if bytes != nil {
+		bytes.CancelAt(now)
+	}
+	return false
+}
+
+// wait waits until the entry is within the limit.
+func (l *rateLimiter) wait(ctx context.Context, e logging.Entry) error {
+	if l.entries != nil {
+		if err := l.entries.Wait(ctx); err != nil {
+			return err
+		}
+	}
+	if l.bytes != nil {
+		return l.bytes.WaitN(ctx, min(entrySize(e), l.burst))
+	}
+	return nil
+}
+
+// shipLimited ships an entry to leased sinks, unless it is over the rate limit and the overflow policy holds it back,
+// and to always sinks if always is set.
+//   - replayed entries are not shipped to always sinks, which received them when they were logged
+func (m *Manager) shipLimited(e logging.Entry, always bool) {
+	policies := []SinkPolicy{Leased}
+	if always {
+		policies = append(policies, Always)
+	}
+
+	l := m.rateLimit
+	if l == nil || l.allow(e) {
+		m.shipped.Add(1)
+		m.send(e, policies...)
+		return
+	}
+
+	if always {
+		m.send(e, Always)
+	}
+	switch l.overflow {
+	case RateLimitSample:
+		if l.overflowed.Add(1)%rateLimitSampleEvery == 1 {
+			m.shipped.Add(1)
+			m.send(withLabel(e, "rate_limit_sample", "true"), Leased)
+			return
+		}
+	case RateLimitBuffer:
+		select {
+		case l.queue <- e:
+			return
+		default:
+		}
+	}
+	m.rateLimited.Add(1)
+}
+
+// shipRateLimitBuffer ships the entries buffered over the rate limit to leased sinks as it allows, until the context is
+// canceled.
+//   - entries still buffered once the context is canceled are shipped right away, so Close does not lose them
+func (m *Manager) shipRateLimitBuffer(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			for {
+				select {
+				case e := <-m.rateLimit.queue:
+					m.shipped.Add(1)
+					m.send(e, Leased)
+				default:
+					return
+				}
+			}
+		case e := <-m.rateLimit.queue:
+			// an error means the context was canceled while waiting, the entry ships with the rest of the buffer
+			_ = m.rateLimit.wait(ctx, e)
+			m.shipped.Add(1)
+			m.send(e, Leased)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package lease
+
+import (
+	"strings"
+	"testing"
+
+	"cloud.google.com/go/logging"
+)
+
+func TestRateLimitEntries(t *testing.T) {
+	sink := &recordingSink{}
+	m := newTestManager(t, WithSink(sink, Leased), WithRateLimit(2, 0, RateLimitDrop))
+
+	for range 5 {
+		m.log(logging.Entry{Severity: logging.Info, Payload: "entry"}, true)
+	}
+
+	if got := len(sink.payloads()); got != 2 {
+		t.Errorf("shipped %d entries, want 2", got)
+	}
+	if got := m.Stats().RateLimited; got != 3 {
+		t.Errorf("rate limited %d entries, want 3", got)
+	}
+}
+
+func TestRateLimitSkipsAlwaysSinks(t *testing.T) {
+	leased, always := &recordingSink{}, &recordingSink{}
+	m := newTestManager(t, WithSink(leased, Leased), WithSink(always, Always), WithRateLimit(2, 0, RateLimitDrop))
+
+	for range 5 {
+		m.log(logging.Entry{Severity: logging.Info, Payload: "entry"}, true)
+	}
+
+	if got := len(leased.payloads()); got != 2 {
+		t.Errorf("shipped %d entries to the leased sink, want 2", got)
+	}
+	if got := len(always.payloads()); got != 5 {
+		t.Errorf("shipped %d entries to the always sink, want all 5", got)
+	}
+}
+
+func TestRateLimitBytes(t *testing.T) {
+	m := &Manager{}
+	WithRateLimit(0, 100, RateLimitDrop)(m)
+	l := m.rateLimit
+
+	small := logging.Entry{Payload: strings.Repeat("x", 40)}
+	if !l.allow(small) || !l.allow(small) {
+		t.Fatal("entries within the burst were limited")
+	}
+	if l.allow(small) {
+		t.Error("entry over the burst was allowed")
+	}
+}
+
+func TestRateLimitLargeEntry(t *testing.T) {
+	m := &Manager{}
+	WithRateLimit(0, 100, RateLimitDrop)(m)
+	l := m.rateLimit
+
+	// entries larger than the burst only need a full bucket, rather than never shipping
+	if !l.allow(logging.Entry{Payload: strings.Repeat("x", 500)}) {
+		t.Error("entry larger than the burst was limited with a full bucket")
+	}
+	if l.allow(logging.Entry{Payload: "x"}) {
+		t.Error("entry was allowed with an empty bucket")
+	}
+}
+
+func TestRateLimitKeepsTokensOfLimitedEntries(t *testing.T) {
+	m := &Manager{}
+	WithRateLimit(1, 100, RateLimitDrop)(m)
+	l := m.rateLimit
+
+	if !l.allow(logging.Entry{Payload: "x"}) {
+		t.Fatal("first entry was limited")
+	}
+	// limited by the entry rate, so its bytes must not be used up
+	if l.allow(logging.Entry{Payload: strings.Repeat("x", 90)}) {
+		t.Fatal("entry over the entry rate was allowed")
+	}
+	if got := l.bytes.Tokens(); got < 98 {
+		t.Errorf("limited entry used up bytes, %v left", got)
+	}
+}
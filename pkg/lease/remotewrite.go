@@ -0,0 +1,207 @@
+package lease
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/klauspost/compress/snappy"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// remoteWriter pushes lease state and shipping counters with the Prometheus remote-write protocol, see WithRemoteWrite.
+type remoteWriter struct {
+	url      string
+	interval time.Duration
+	headers  map[string]string
+	client   *http.Client
+
+	// holders are the users last reported holding each lease, only used by the push goroutine
+	holders map[string]string
+}
+
+// WithRemoteWrite pushes lease state and shipping counters to a Prometheus remote-write endpoint at the given interval,
+// for fleets where the agents cannot be scraped.
+//   - every series carries the instance, and the labels of the manager with invalid characters replaced by underscores
+//   - leased_logs_lease_active is 1 for each watched lease currently active on the instance
+//   - leased_logs_lease_holder is 1 for the user holding each active lease, and 0 once for a user who stopped holding it
+//   - leased_logs_lease_expire_time_seconds is the expiry of each active lease
+//   - leased_logs_entries_shipped_total and leased_logs_entries_quarantined_total count entries since the start
+//   - headers are added to every request, such as Authorization for hosted endpoints
+func WithRemoteWrite(url string, interval time.Duration, headers map[string]string) Option {
+	return func(m *Manager) {
+		m.remoteWrite = &remoteWriter{
+			url:      url,
+			interval: interval,
+			headers:  headers,
+			client:   &http.Client{Timeout: 10 * time.Second},
+			holders:  make(map[string]string),
+		}
+	}
+}
+
+// pushRemoteWrite pushes samples at the remote-write interval until ctx is done, and once more after.
+func (m *Manager) pushRemoteWrite(ctx context.Context) {
+	t := time.NewTicker(m.remoteWrite.interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			// the last state, so dashboards do not show the instance leased until the series go stale
+			pushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := m.remoteWrite.push(pushCtx, m.remoteWriteSeries(true)); err != nil {
+				diag().Error("failed to push remote-write samples", "error", err)
+			}
+			return
+		case <-t.C:
+		}
+
+		if err := m.remoteWrite.push(ctx, m.remoteWriteSeries(false)); err != nil {
+			diag().Error("failed to push remote-write samples", "error", err)
+		}
+	}
+}
+
+// promSeries is a single remote-write sample with its labels.
+type promSeries struct {
+	labels map[string]string
+	value  float64
+}
+
+// remoteWriteSeries returns the current samples, reporting every lease inactive when stopping.
+func (m *Manager) remoteWriteSeries(stopping bool) []promSeries {
+	common := make(map[string]string, len(m.labels)+1)
+	for k, v := range m.labels {
+		common[promLabelName(k)] = v
+	}
+	common["instance"] = m.instanceID
+	series := func(name string, value float64, labels ...string) promSeries {
+		s := promSeries{labels: map[string]string{"__name__": name}, value: value}
+		for k, v := range common {
+			s.labels[k] = v
+		}
+		for i := 0; i+1 < len(labels); i += 2 {
+			if labels[i+1] != "" {
+				s.labels[labels[i]] = labels[i+1]
+			}
+		}
+		return s
+	}
+
+	var out []promSeries
+	for _, src := range m.sources {
+		id := src.docRef.ID
+		active := 0.0
+		var user string
+		lease := src.lease.Load()
+		if !stopping && src.active.Load() {
+			active = 1
+			if lease != nil {
+				user = lease.User
+				if !lease.ExpireAt.IsZero() {
+					out = append(out, series("leased_logs_lease_expire_time_seconds", float64(lease.ExpireAt.Unix()), "lease_id", id))
+				}
+			}
+		}
+		out = append(out, series("leased_logs_lease_active", active, "lease_id", id))
+
+		// zero the previous holder, so dashboards do not show them holding the lease until the series goes stale
+		if prev := m.remoteWrite.holders[id]; prev != "" && prev != user {
+			out = append(out, series("leased_logs_lease_holder", 0, "lease_id", id, "user", prev))
+		}
+		if user != "" {
+			out = append(out, series("leased_logs_lease_holder", 1, "lease_id", id, "user", user))
+		}
+		m.remoteWrite.holders[id] = user
+	}
+	out = append(out,
+		series("leased_logs_entries_shipped_total", float64(m.shipped.Load())),
+		series("leased_logs_entries_quarantined_total", float64(m.quarantined.Load())),
+	)
+	return out
+}
+
+// push sends samples as a snappy-compressed remote-write request.
+func (w *remoteWriter) push(ctx context.Context, series []promSeries) error {
+	body := snappy.Encode(nil, encodeWriteRequest(series, time.Now()))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	for k, v := range w.headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// encodeWriteRequest encodes samples as a prometheus.WriteRequest protobuf, without depending on the Prometheus module.
+//   - WriteRequest{timeseries: 1}, TimeSeries{labels: 1, samples: 2}, Label{name: 1, value: 2}, Sample{value: 1, timestamp: 2}
+//   - labels are sorted by name, as the protocol requires
+func encodeWriteRequest(series []promSeries, now time.Time) []byte {
+	var req []byte
+	for _, s := range series {
+		names := make([]string, 0, len(s.labels))
+		for k := range s.labels {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+
+		var ts []byte
+		for _, name := range names {
+			var label []byte
+			label = protowire.AppendTag(label, 1, protowire.BytesType)
+			label = protowire.AppendString(label, name)
+			label = protowire.AppendTag(label, 2, protowire.BytesType)
+			label = protowire.AppendString(label, s.labels[name])
+
+			ts = protowire.AppendTag(ts, 1, protowire.BytesType)
+			ts = protowire.AppendBytes(ts, label)
+		}
+
+		var sample []byte
+		sample = protowire.AppendTag(sample, 1, protowire.Fixed64Type)
+		sample = protowire.AppendFixed64(sample, math.Float64bits(s.value))
+		sample = protowire.AppendTag(sample, 2, protowire.VarintType)
+		sample = protowire.AppendVarint(sample, uint64(now.UnixMilli()))
+
+		ts = protowire.AppendTag(ts, 2, protowire.BytesType)
+		ts = protowire.AppendBytes(ts, sample)
+
+		req = protowire.AppendTag(req, 1, protowire.BytesType)
+		req = protowire.AppendBytes(req, ts)
+	}
+	return req
+}
+
+// invalidPromLabelChars matches characters not allowed in Prometheus label names.
+var invalidPromLabelChars = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+// promLabelName converts a manager label name to a valid Prometheus label name.
+func promLabelName(name string) string {
+	name = invalidPromLabelChars.ReplaceAllString(name, "_")
+	if name == "" || (name[0] >= '0' && name[0] <= '9') {
+		name = "_" + name
+	}
+	return name
+}
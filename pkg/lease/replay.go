@@ -0,0 +1,81 @@
+package lease
+
+import (
+	"time"
+
+	"cloud.google.com/go/logging"
+)
+
+// replay ships entries that were not shipped while the lease was inactive.
+//   - called when the lease becomes active, and when an active lease asks for a new replay window
+//   - the earliest ReplaySince window of the active leases is replayed from the spool if there is one, otherwise from the replay buffer
+//   - without a ReplaySince window, only the replay buffer is flushed
+//   - entries are never replayed twice, windows are clamped to the time of the previous replay
+//   - entries ship in the background, one replay at a time, so the lease watch is not held up by a long spool scan,
+//     and Close waits for them
+func (m *Manager) replay() {
+	m.replayMu.Lock()
+	defer m.replayMu.Unlock()
+
+	since := m.replaySince()
+	m.lastReplaySince = since
+
+	requested := !since.IsZero()
+	if since.Before(m.replayedThrough) {
+		since = m.replayedThrough
+	}
+	m.replayedThrough = time.Now()
+
+	// the buffer is drained right away, entries buffered after this replay belong to the next one
+	var buffered []logging.Entry
+	if m.buffer != nil {
+		buffered = m.buffer.drain()
+	}
+	// everything in the replay buffer is also in the spool
+	fromSpool := m.spool != nil && requested
+
+	run := func() {
+		m.replayRunMu.Lock()
+		defer m.replayRunMu.Unlock()
+
+		if !fromSpool {
+			m.replayBuffered(buffered, since)
+			return
+		}
+		if err := m.ReplayFrom(since); err != nil {
+			diag().Error("failed to replay lease window", "error", err)
+		}
+	}
+
+	// after Close, nothing waits for background replays anymore
+	if m.replayClosed {
+		run()
+		return
+	}
+	m.replaying.Add(1)
+	go func() {
+		defer m.replaying.Done()
+		run()
+	}()
+}
+
+// waitReplays waits for the replays running in the background, later replays run right away.
+func (m *Manager) waitReplays() {
+	m.replayMu.Lock()
+	m.replayClosed = true
+	m.replayMu.Unlock()
+	m.replaying.Wait()
+}
+
+// replayable reports whether an unshipped entry of the severity is replayed under the active leases, as it is at or
+// above their MinSeverity, or at or above the always-ship severity.
+func (m *Manager) replayable(s logging.Severity) bool {
+	return s >= m.alwaysShip || s >= m.minSeverity()
+}
+
+// requestsNewReplay reports whether a lease replay window has not been replayed yet.
+func (m *Manager) requestsNewReplay(since time.Time) bool {
+	m.replayMu.Lock()
+	defer m.replayMu.Unlock()
+	return !since.Equal(m.lastReplaySince)
+}
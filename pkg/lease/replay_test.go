@@ -0,0 +1,101 @@
+package lease
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/logging"
+
+	"github.com/carsonoid/talk-leased-logs/pkg/spool"
+)
+
+// unshipped are entries logged while no lease was active, at each severity a lease may ship from.
+var unshipped = []logging.Entry{
+	{Severity: logging.Debug, Payload: "debug"},
+	{Severity: logging.Info, Payload: "info"},
+	{Severity: logging.Warning, Payload: "warning"},
+	{Severity: logging.Error, Payload: "error"},
+}
+
+func TestReplayBufferRespectsMinSeverity(t *testing.T) {
+	sink := &recordingSink{}
+	m := newTestManager(t, WithSink(sink, Leased), WithReplayBuffer(10, 0))
+	setTestLease(m, &Document{MinSeverity: "WARNING"})
+
+	for _, e := range unshipped {
+		m.buffer.add(e)
+	}
+	m.replay()
+	m.Close()
+
+	if got, want := sink.payloads(), []any{"warning", "error"}; !slices.Equal(got, want) {
+		t.Errorf("replayed %v, want %v", got, want)
+	}
+}
+
+func TestReplayFromRespectsMinSeverity(t *testing.T) {
+	sp, err := spool.Open(t.TempDir(), spool.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink := &recordingSink{}
+	m := newTestManager(t, WithSink(sink, Leased), WithSpool(sp))
+	setTestLease(m, &Document{MinSeverity: "CRITICAL"})
+
+	start := time.Now()
+	for _, e := range unshipped {
+		e.Timestamp = time.Now()
+		m.spoolEntry(e)
+	}
+	if err := m.ReplayFrom(start); err != nil {
+		t.Fatal(err)
+	}
+
+	// errors are below the lease's CRITICAL, but at the default always-ship severity
+	if got, want := sink.payloads(), []any{"error"}; !slices.Equal(got, want) {
+		t.Errorf("replayed %v, want %v", got, want)
+	}
+}
+
+func TestReplayRunsInTheBackground(t *testing.T) {
+	sink := &recordingSink{block: make(chan struct{}), started: make(chan struct{}, 1)}
+	m := newTestManager(t, WithSink(sink, Leased), WithReplayBuffer(10, 0))
+	m.buffer.add(logging.Entry{Severity: logging.Info, Payload: "buffered"})
+
+	done := make(chan struct{})
+	go func() {
+		m.replay()
+		close(done)
+	}()
+	<-sink.started
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("replay blocked while the sink was shipping the replayed entry")
+	}
+
+	close(sink.block)
+	m.Close()
+	if got, want := sink.payloads(), []any{"buffered"}; !slices.Equal(got, want) {
+		t.Errorf("replayed %v, want %v", got, want)
+	}
+}
+
+func TestReplayIsRateLimited(t *testing.T) {
+	sink := &recordingSink{}
+	m := newTestManager(t, WithSink(sink, Leased), WithReplayBuffer(10, 0), WithRateLimit(2, 0, RateLimitDrop))
+
+	for range 5 {
+		m.buffer.add(logging.Entry{Severity: logging.Info, Payload: "buffered"})
+	}
+	m.replay()
+	m.Close()
+
+	if got := len(sink.payloads()); got != 2 {
+		t.Errorf("replayed %d entries, want 2", got)
+	}
+	if st := m.Stats(); st.Shipped != 2 || st.RateLimited != 3 {
+		t.Errorf("counted %d shipped and %d rate limited entries, want 2 and 3", st.Shipped, st.RateLimited)
+	}
+}
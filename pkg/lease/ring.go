@@ -0,0 +1,155 @@
+package lease
+
+import (
+	"sync"
+	"time"
+
+	"cloud.google.com/go/logging"
+)
+
+// WithReplayBuffer keeps up to size recent entries that were not shipped while the lease was inactive.
+//   - buffered entries no older than maxAge are shipped to leased sinks as soon as the lease becomes active
+//   - a maxAge of zero keeps entries regardless of their age
+func WithReplayBuffer(size int, maxAge time.Duration) Option {
+	return func(m *Manager) {
+		if size > 0 {
+			m.buffer = newRingBuffer(size, maxAge)
+		}
+	}
+}
+
+// WithShutdownBuffer keeps up to size unshipped entries from the last window, for shipping with ShipShutdownBuffer.
+//   - unlike the replay buffer, it is not shipped when the lease becomes active
+func WithShutdownBuffer(size int, window time.Duration) Option {
+	return func(m *Manager) {
+		if size > 0 {
+			m.shutdownBuffer = newRingBuffer(size, window)
+		}
+	}
+}
+
+// ShipShutdownBuffer ships the entries from the shutdown window to the leased sinks, labeled as shutdown capture,
+// and flushes all sinks.
+//   - use it when the process being logged terminates abnormally, so the termination sequence is never lost
+func (m *Manager) ShipShutdownBuffer() error {
+	if m.shutdownBuffer == nil {
+		return m.Flush()
+	}
+	// the last entries may still be queued, see WithQueue
+	if m.queue != nil {
+		m.queue.wait()
+	}
+
+	entries := m.shutdownBuffer.drain()
+	for _, e := range entries {
+		m.send(withLabel(e, "shutdown_capture", "true"), Leased)
+	}
+	if len(entries) > 0 {
+		diag().Info("shipped the shutdown window", "entries", len(entries))
+	}
+
+	return m.Flush()
+}
+
+// replayBuffered ships the entries drained from the replay buffer at or after since to the leased sinks, labeled as
+// replayed.
+//   - entries are rate limited like other shipped entries, see WithRateLimit
+//   - entries below the MinSeverity of the lease are dropped, see replayable
+func (m *Manager) replayBuffered(entries []logging.Entry, since time.Time) {
+	for _, e := range entries {
+		if e.Timestamp.Before(since) || !m.replayable(e.Severity) {
+			continue
+		}
+		m.shipLimited(withLabel(e, "replayed", "true"), false)
+	}
+}
+
+// ringBuffer is a bounded buffer of the most recent entries.
+type ringBuffer struct {
+	mu      sync.Mutex
+	entries []logging.Entry
+	next    int
+	full    bool
+	maxAge  time.Duration
+}
+
+func newRingBuffer(size int, maxAge time.Duration) *ringBuffer {
+	return &ringBuffer{
+		entries: make([]logging.Entry, size),
+		maxAge:  maxAge,
+	}
+}
+
+// add buffers an entry, overwriting the oldest entry when the buffer is full.
+//   - entries are stamped with the current time if they have no timestamp, so they keep it when replayed
+func (b *ringBuffer) add(e logging.Entry) {
+	if e.Timestamp.IsZero() {
+		e.Timestamp = time.Now()
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.entries[b.next] = e
+	b.next = (b.next + 1) % len(b.entries)
+	if b.next == 0 {
+		b.full = true
+	}
+}
+
+// len returns the number of buffered entries, including any older than maxAge.
+func (b *ringBuffer) len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.full {
+		return len(b.entries)
+	}
+	return b.next
+}
+
+// bytes estimates the size of the buffered entries, computed when called so adding entries stays cheap.
+func (b *ringBuffer) bytes() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	n := len(b.entries)
+	if !b.full {
+		n = b.next
+	}
+	size := 0
+	for _, e := range b.entries[:n] {
+		size += entrySize(e)
+	}
+	return size
+}
+
+// drain empties the buffer, returning all entries within maxAge from oldest to newest.
+func (b *ringBuffer) drain() []logging.Entry {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var ordered []logging.Entry
+	if b.full {
+		ordered = append(ordered, b.entries[b.next:]...)
+	}
+	ordered = append(ordered, b.entries[:b.next]...)
+
+	cutoff := time.Time{}
+	if b.maxAge > 0 {
+		cutoff = time.Now().Add(-b.maxAge)
+	}
+
+	out := make([]logging.Entry, 0, len(ordered))
+	for _, e := range ordered {
+		if e.Timestamp.Before(cutoff) {
+			continue
+		}
+		out = append(out, e)
+	}
+
+	clear(b.entries)
+	b.next = 0
+	b.full = false
+
+	return out
+}
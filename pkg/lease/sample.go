@@ -0,0 +1,110 @@
+package lease
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"strconv"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/logging"
+)
+
+// Sampler picks entries to ship without a lease, so a statistical baseline reaches the sinks between leases.
+type Sampler interface {
+	// Sample reports whether an entry that would not be shipped should be shipped anyway.
+	Sample(e logging.Entry) bool
+}
+
+// WithSamplers ships the entries any of the samplers picks even when they would not be shipped.
+//   - sampled entries are labeled sampled=true, so they can be told apart from the leased firehose
+func WithSamplers(samplers ...Sampler) Option {
+	return func(m *Manager) {
+		m.samplers = append(m.samplers, samplers...)
+	}
+}
+
+// sampled reports whether any sampler picks the entry.
+func (m *Manager) sampled(e logging.Entry) bool {
+	for _, s := range m.samplers {
+		if s.Sample(e) {
+			return true
+		}
+	}
+	return false
+}
+
+// RateSampler picks a random fraction of the entries at each severity, such as 0.01 of INFO.
+type RateSampler map[logging.Severity]float64
+
+// Sample picks the entry with the probability configured for its severity.
+func (r RateSampler) Sample(e logging.Entry) bool {
+	rate := r[e.Severity]
+	return rate > 0 && rand.Float64() < rate
+}
+
+// ParseSampleRates converts rates by severity name, such as {"INFO": "0.01"}, to a RateSampler.
+func ParseSampleRates(rates map[string]string) (RateSampler, error) {
+	r := make(RateSampler, len(rates))
+	for name, v := range rates {
+		rate, err := strconv.ParseFloat(v, 64)
+		if err != nil || rate < 0 || rate > 1 {
+			return nil, fmt.Errorf("invalid sample rate %q for %s, must be between 0 and 1", v, name)
+		}
+		r[logging.ParseSeverity(name)] = rate
+	}
+	return r, nil
+}
+
+// firstNMaxMessages bounds the distinct messages a FirstNSampler tracks per window.
+const firstNMaxMessages = 1000
+
+// FirstNSampler picks the first entries of every distinct message in each window of time.
+//   - messages are the message field of map payloads, or string payloads as is
+//   - once firstNMaxMessages distinct messages were seen in a window, new messages are not picked until the next one,
+//     so output with unique lines does not turn sampling into shipping everything
+type FirstNSampler struct {
+	n      int
+	window time.Duration
+
+	mu    sync.Mutex
+	start time.Time
+	seen  map[string]int
+}
+
+// NewFirstNSampler creates a FirstNSampler picking the first n entries of every message per window.
+func NewFirstNSampler(n int, window time.Duration) *FirstNSampler {
+	return &FirstNSampler{n: n, window: window}
+}
+
+// Sample picks the entry if fewer than n entries with its message were picked in the current window.
+func (f *FirstNSampler) Sample(e logging.Entry) bool {
+	msg := entryMessage(e)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if now := time.Now(); f.seen == nil || now.Sub(f.start) >= f.window {
+		f.start = now
+		f.seen = make(map[string]int)
+	}
+
+	count, ok := f.seen[msg]
+	if count >= f.n || (!ok && len(f.seen) >= firstNMaxMessages) {
+		return false
+	}
+	f.seen[msg] = count + 1
+	return true
+}
+
+// entryMessage returns the message field of map payloads, or string payloads as is.
+func entryMessage(e logging.Entry) string {
+	switch p := e.Payload.(type) {
+	case string:
+		return p
+	case map[string]any:
+		msg, _ := p["message"].(string)
+		return msg
+	}
+	return ""
+}
@@ -0,0 +1,96 @@
+package lease
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// cronParser parses standard five-field cron specs, descriptors such as @daily, and CRON_TZ= prefixes.
+var cronParser = cron.NewParser(cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+
+// Schedule is a recurring window during which a lease is active without anyone extending it.
+type Schedule struct {
+	// Cron is the cron spec of when each window opens, optionally prefixed with CRON_TZ=<zone>.
+	Cron string
+	// Duration is how long each window stays open.
+	Duration time.Duration
+}
+
+// ParseSchedule validates a cron spec and window duration.
+func ParseSchedule(spec string, d time.Duration) (Schedule, error) {
+	if d <= 0 {
+		return Schedule{}, fmt.Errorf("schedule %q must have a positive duration", spec)
+	}
+	if _, err := cronParser.Parse(spec); err != nil {
+		return Schedule{}, fmt.Errorf("invalid schedule %q: %w", spec, err)
+	}
+	return Schedule{Cron: spec, Duration: d}, nil
+}
+
+// window returns the end of the window open at now, zero if none is open, and the start of the next window.
+func (s Schedule) window(now time.Time) (end, next time.Time, err error) {
+	sched, err := cronParser.Parse(s.Cron)
+	if err != nil {
+		return end, next, err
+	}
+
+	// every window opening in the last Duration is still open, the latest one closes last
+	for t := sched.Next(now.Add(-s.Duration)); !t.IsZero() && !t.After(now); t = sched.Next(t) {
+		end = t.Add(s.Duration)
+	}
+	return end, sched.Next(now), nil
+}
+
+// ActiveUntil returns when the lease stops being active, the later of ExpireAt and the end of any open scheduled window,
+// and the start of the next scheduled window, zero if there are no schedules.
+//   - invalid schedules are reported and skipped
+func (d *Document) ActiveUntil(now time.Time) (until, next time.Time) {
+	until = d.ExpireAt
+	for _, s := range d.Schedules {
+		end, start, err := s.window(now)
+		if err != nil {
+			diag().Error("failed to parse lease schedule", "error", err)
+			continue
+		}
+		if end.After(until) {
+			until = end
+		}
+		if !start.IsZero() && (next.IsZero() || start.Before(next)) {
+			next = start
+		}
+	}
+	return until, next
+}
+
+// applyLease expires the lease once it and its open scheduled window end, and re-applies it when the next window opens.
+func (s *leaseSource) applyLease(lease *Document) {
+	until, next := lease.ActiveUntil(time.Now())
+	s.expireAfter(until.Add(s.m.gracePeriod))
+	s.scheduleNext(next)
+	s.notifyLease(lease)
+}
+
+// scheduleNext re-applies the current lease at the start of the next scheduled window, or stops doing so when next is zero.
+func (s *leaseSource) scheduleNext(next time.Time) {
+	s.scheduleMu.Lock()
+	defer s.scheduleMu.Unlock()
+
+	if s.scheduleTimer != nil {
+		s.scheduleTimer.Stop()
+		s.scheduleTimer = nil
+	}
+	if next.IsZero() {
+		return
+	}
+
+	s.scheduleTimer = time.AfterFunc(time.Until(next), func() {
+		lease := s.lease.Load()
+		if lease == nil || len(lease.Schedules) == 0 {
+			return
+		}
+		diag().Info("scheduled window opened", "lease", s.docRef.ID)
+		s.applyLease(lease)
+	})
+}
@@ -0,0 +1,76 @@
+package lease
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"time"
+
+	"cloud.google.com/go/logging"
+)
+
+// NewSessionID returns a random ID for a capture session.
+func NewSessionID() (string, error) {
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate session ID: %w", err)
+	}
+	return "s-" + hex.EncodeToString(b), nil
+}
+
+// JoinSession sets the capture session of the lease.
+//   - continues the session of prev while prev is still active, so every host keeps sharing it
+//   - starts a new session at now otherwise, or when prev is nil
+func (d *Document) JoinSession(prev *Document, now time.Time) error {
+	if prev != nil && prev.SessionID != "" && !prev.Revoked && !prev.Pending {
+		if until, _ := prev.ActiveUntil(now); until.After(now) {
+			d.SessionID = prev.SessionID
+			d.SessionStart = prev.SessionStart
+			return nil
+		}
+	}
+
+	id, err := NewSessionID()
+	if err != nil {
+		return err
+	}
+	d.SessionID = id
+	d.SessionStart = now
+	return nil
+}
+
+// markSession ships a start marker the first time the source sees an active lease of a new session.
+//   - serverTime is the Firestore read time of the lease, the gap to the local clock bounds the clock skew of the host
+//   - markers of every host share the session start, so their captures can be aligned against it
+func (s *leaseSource) markSession(lease *Document, serverTime time.Time) {
+	m := s.m
+	if lease.SessionID == "" || lease.SessionID == s.markedSession || !s.active.Load() || !m.enabled.Load() {
+		return
+	}
+	s.markedSession = lease.SessionID
+
+	now := time.Now().UTC()
+	host, _ := os.Hostname()
+	payload := map[string]any{
+		"message":      "leased capture session start",
+		"sessionId":    lease.SessionID,
+		"sessionStart": lease.SessionStart.Format(time.RFC3339Nano),
+		"joinedAt":     now.Format(time.RFC3339Nano),
+		"offset":       now.Sub(lease.SessionStart).String(),
+		"host":         host,
+		"pid":          os.Getpid(),
+		"instance":     m.instanceID,
+	}
+	if !serverTime.IsZero() {
+		payload["clockSkew"] = now.Sub(serverTime).String()
+	}
+
+	diag().Info("session start", "session", lease.SessionID, "started", lease.SessionStart, "lease", s.docRef.ID)
+	m.log(logging.Entry{
+		Timestamp: now,
+		Severity:  logging.Notice,
+		Labels:    map[string]string{"session_marker": "start"},
+		Payload:   payload,
+	}, true)
+}
@@ -0,0 +1,225 @@
+package lease
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"time"
+)
+
+// leaseStateHandshakeTimeout bounds how long a subscriber has to name the lease it follows once connected.
+const leaseStateHandshakeTimeout = 10 * time.Second
+
+// leaseSubscription is the first and only message a subscriber sends, naming the lease it follows.
+type leaseSubscription struct {
+	// Lease is the full path of the lease document, such as projects/p/databases/(default)/documents/leases/demo1
+	Lease string `json:"lease"`
+}
+
+// leaseStateEvent is a snapshot of a lease document broadcast to subscribers, see ServeLeaseState.
+type leaseStateEvent struct {
+	// Document is the lease document, nil when it does not exist
+	Document *Document `json:"document"`
+	ReadTime time.Time `json:"readTime"`
+	// Error is sent instead of snapshots when the lease is not watched by the broadcasting process
+	Error string `json:"error,omitempty"`
+}
+
+// WithLeaseStateFrom follows the leases watched by another process on the same host, such as an agent or the serve
+// command, through the Unix socket it serves with ServeLeaseState, rather than opening a Firestore snapshot stream per
+// process, for hosts running many sidecars.
+//   - every lease of the manager, including parent leases, must be watched by the broadcasting process
+//   - the raw lease documents are broadcast, so tags, approvals, and revocations still apply to each manager on its
+//     own
+//   - a broken connection is retried like a failing watch, and the watch failure policy applies meanwhile
+//   - lease status is still reported to Firestore, see StatusCollection
+func WithLeaseStateFrom(socket string) Option {
+	return func(m *Manager) {
+		m.leaseStateFrom = socket
+	}
+}
+
+// ServeLeaseState broadcasts the snapshots of the watched lease documents on a Unix socket at path, for managers
+// created WithLeaseStateFrom, until the listener fails.
+//   - a subscriber first receives the last snapshot of its lease, then every snapshot as it arrives
+//   - a slow subscriber skips to the latest snapshot, rather than holding up the others
+//   - a socket left behind by a previous process is replaced, one still served by a running process is an error
+//   - anyone able to connect to the socket can read the lease documents, restrict it with the permissions of its
+//     directory
+func (m *Manager) ServeLeaseState(path string) error {
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+		return fmt.Errorf("lease state is already served on %s", path)
+	}
+	if fi, err := os.Lstat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		if err := os.Remove(path); err != nil {
+			return fmt.Errorf("failed to remove stale lease state socket: %w", err)
+		}
+	}
+
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go m.serveLeaseStateConn(conn)
+	}
+}
+
+// serveLeaseStateConn broadcasts the snapshots of the lease a subscriber names to it, until it hangs up.
+func (m *Manager) serveLeaseStateConn(conn net.Conn) {
+	defer conn.Close()
+	enc := json.NewEncoder(conn)
+
+	var sub leaseSubscription
+	_ = conn.SetReadDeadline(time.Now().Add(leaseStateHandshakeTimeout))
+	if err := json.NewDecoder(conn).Decode(&sub); err != nil {
+		// ServeLeaseState connects without subscribing to check whether the socket is still served
+		if !errors.Is(err, io.EOF) {
+			diag().Warn("failed to read lease state subscription", "error", err)
+		}
+		return
+	}
+	_ = conn.SetReadDeadline(time.Time{})
+
+	src := m.sourceByPath(sub.Lease)
+	if src == nil {
+		_ = enc.Encode(leaseStateEvent{Error: fmt.Sprintf("lease %s is not watched by this process", sub.Lease)})
+		return
+	}
+	events := src.subscribe()
+	defer src.unsubscribe(events)
+
+	// the subscriber sends nothing more, so a read only returns once it hung up
+	closed := make(chan struct{})
+	go func() {
+		_, _ = io.Copy(io.Discard, conn)
+		close(closed)
+	}()
+
+	for {
+		select {
+		case ev := <-events:
+			if err := enc.Encode(ev); err != nil {
+				return
+			}
+		case <-closed:
+			return
+		}
+	}
+}
+
+// sourceByPath returns the watched lease with the given document path, nil if it is not watched.
+func (m *Manager) sourceByPath(path string) *leaseSource {
+	for _, src := range m.sources {
+		if src.docRef.Path == path {
+			return src
+		}
+	}
+	return nil
+}
+
+// received records a snapshot of the lease document, nil when it does not exist, and broadcasts it to subscribers.
+func (s *leaseSource) received(lease *Document, readTime time.Time) {
+	ev := &leaseStateEvent{ReadTime: readTime}
+	if lease != nil {
+		// the manager keeps using lease, subscribers are sent a copy
+		doc := *lease
+		ev.Document = &doc
+	}
+
+	s.sharedMu.Lock()
+	defer s.sharedMu.Unlock()
+	s.shared = ev
+	for events := range s.sharedTo {
+		sendLatest(events, ev)
+	}
+}
+
+// subscribe returns a channel receiving the last snapshot of the lease, if any, then every snapshot as it arrives.
+func (s *leaseSource) subscribe() chan *leaseStateEvent {
+	events := make(chan *leaseStateEvent, 1)
+
+	s.sharedMu.Lock()
+	defer s.sharedMu.Unlock()
+	if s.sharedTo == nil {
+		s.sharedTo = make(map[chan *leaseStateEvent]struct{})
+	}
+	s.sharedTo[events] = struct{}{}
+	if s.shared != nil {
+		events <- s.shared
+	}
+	return events
+}
+
+// unsubscribe stops broadcasting snapshots to a channel returned by subscribe.
+func (s *leaseSource) unsubscribe(events chan *leaseStateEvent) {
+	s.sharedMu.Lock()
+	defer s.sharedMu.Unlock()
+	delete(s.sharedTo, events)
+}
+
+// sendLatest sends ev to events, replacing a snapshot the subscriber has not received yet, as only the latest matters.
+func sendLatest(events chan *leaseStateEvent, ev *leaseStateEvent) {
+	select {
+	case events <- ev:
+	default:
+		select {
+		case <-events:
+		default:
+		}
+		events <- ev
+	}
+}
+
+// watchShared follows the snapshots of the lease broadcast on the socket set WithLeaseStateFrom, and updates the
+// lease state, like watch does for Firestore snapshots.
+func (s *leaseSource) watchShared(ctx context.Context) error {
+	diag().Info("watch shared lease state", "path", s.docRef.Path, "socket", s.m.leaseStateFrom)
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "unix", s.m.leaseStateFrom)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() {
+		conn.Close()
+	})
+	defer stop()
+
+	if err := json.NewEncoder(conn).Encode(leaseSubscription{Lease: s.docRef.Path}); err != nil {
+		return err
+	}
+
+	dec := json.NewDecoder(conn)
+	for {
+		var ev leaseStateEvent
+		if err := dec.Decode(&ev); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			if errors.Is(err, io.EOF) {
+				return errors.New("lease state socket closed")
+			}
+			return err
+		}
+		if ev.Error != "" {
+			return errors.New(ev.Error)
+		}
+
+		s.watchRecovered()
+		s.received(ev.Document, ev.ReadTime)
+		s.applySnapshot(ctx, ev.Document, ev.ReadTime)
+	}
+}
@@ -0,0 +1,323 @@
+package lease
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/logging"
+	"cloud.google.com/go/logging/apiv2/loggingpb"
+)
+
+// Sink receives shipped entries.
+type Sink interface {
+	// Log ships an entry, implementations may buffer entries until Flush is called.
+	Log(e logging.Entry) error
+	// Flush ships all buffered entries.
+	Flush() error
+}
+
+// SinkPolicy controls which entries a sink receives.
+type SinkPolicy int
+
+const (
+	// Leased sinks only receive entries while the lease is enabled, and entries that always ship such as errors.
+	Leased SinkPolicy = iota
+	// Always sinks receive every entry, regardless of the lease state.
+	Always
+)
+
+// ParseSinkPolicy converts "leased" or "always" to a SinkPolicy.
+func ParseSinkPolicy(s string) (SinkPolicy, error) {
+	switch s {
+	case "leased":
+		return Leased, nil
+	case "always":
+		return Always, nil
+	default:
+		return Leased, fmt.Errorf("unknown sink policy %q, must be leased or always", s)
+	}
+}
+
+// routedSink is a sink with the policy it was configured with.
+type routedSink struct {
+	sink   Sink
+	policy SinkPolicy
+	health *sinkHealth
+}
+
+// WithSink adds a sink that receives entries according to its policy.
+func WithSink(s Sink, policy SinkPolicy) Option {
+	return func(m *Manager) {
+		m.sinks = append(m.sinks, routedSink{sink: s, policy: policy, health: &sinkHealth{}})
+	}
+}
+
+// hasAlwaysSinks reports whether any sink receives entries regardless of the lease state.
+func (m *Manager) hasAlwaysSinks() bool {
+	for _, s := range m.sinks {
+		if s.policy == Always {
+			return true
+		}
+	}
+	return false
+}
+
+// Flush ships the queued entries, flushes all sinks, and uploads the open archive chunks, returning the first error
+// encountered.
+func (m *Manager) Flush() error {
+	if m.queue != nil {
+		m.queue.wait()
+	}
+	if m.archive != nil {
+		m.archive.flush()
+	}
+
+	var firstErr error
+	for _, s := range m.sinks {
+		if err := s.sink.Flush(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// CloudLoggingSink is a Sink that ships entries to a Cloud Logging logger.
+type CloudLoggingSink struct {
+	logger *logging.Logger
+	// routes are the loggers of other log names, see Route
+	routes map[string]*logging.Logger
+}
+
+// NewCloudLoggingSink creates a Sink that ships entries to logger.
+func NewCloudLoggingSink(logger *logging.Logger) *CloudLoggingSink {
+	return &CloudLoggingSink{logger: logger}
+}
+
+// Route ships entries stamped with logName, such as by WithSeverityLogName, to logger instead.
+//   - must be called before the sink is used
+func (s *CloudLoggingSink) Route(logName string, logger *logging.Logger) {
+	if s.routes == nil {
+		s.routes = make(map[string]*logging.Logger)
+	}
+	s.routes[logName] = logger
+}
+
+// Log queues the entry for shipping by the logger of its log name.
+//   - entries Cloud Logging would refuse are rejected, see ValidateEntry
+func (s *CloudLoggingSink) Log(e logging.Entry) error {
+	if err := s.ValidateEntry(e); err != nil {
+		return err
+	}
+
+	logger := s.logger
+	if l, ok := s.routes[e.LogName]; ok {
+		logger = l
+	}
+
+	// the logging client rejects entries with a log name set
+	e.LogName = ""
+	logger.Log(e)
+	return nil
+}
+
+// Flush blocks until all queued entries are shipped.
+func (s *CloudLoggingSink) Flush() error {
+	err := s.logger.Flush()
+	for _, l := range s.routes {
+		if ferr := l.Flush(); ferr != nil && err == nil {
+			err = ferr
+		}
+	}
+	return err
+}
+
+// FileSink is a Sink that appends entries to a file as newline-delimited JSON.
+type FileSink struct {
+	mu sync.Mutex
+	f  *os.File
+}
+
+// NewFileSink opens, or creates, the file at path for appending entries.
+func NewFileSink(path string) (*FileSink, error) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file sink: %w", err)
+	}
+	return &FileSink{f: f}, nil
+}
+
+// Log appends the entry to the file.
+func (s *FileSink) Log(e logging.Entry) error {
+	line, err := json.Marshal(newJSONEntry(e))
+	if err != nil {
+		return fmt.Errorf("failed to encode entry: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.f.Write(append(line, '\n'))
+	return err
+}
+
+// Flush syncs the file to disk.
+func (s *FileSink) Flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.f.Sync()
+}
+
+// jsonEntry is the JSON representation of an entry used when entries are written to files.
+type jsonEntry struct {
+	Timestamp time.Time         `json:"timestamp"`
+	LogName   string            `json:"logName,omitempty"`
+	Severity  string            `json:"severity"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	Payload   any               `json:"payload"`
+
+	HTTPRequest    *jsonHTTPRequest                  `json:"httpRequest,omitempty"`
+	Operation      *loggingpb.LogEntryOperation      `json:"operation,omitempty"`
+	SourceLocation *loggingpb.LogEntrySourceLocation `json:"sourceLocation,omitempty"`
+	Trace          string                            `json:"trace,omitempty"`
+	SpanID         string                            `json:"spanId,omitempty"`
+	TraceSampled   bool                              `json:"traceSampled,omitempty"`
+
+	// Reason is set when the entry was rejected rather than shipped.
+	Reason string `json:"reason,omitempty"`
+}
+
+// newJSONEntry converts an entry to its JSON representation.
+//   - entries without a timestamp are stamped with the current time
+func newJSONEntry(e logging.Entry) jsonEntry {
+	ts := e.Timestamp
+	if ts.IsZero() {
+		ts = time.Now().UTC()
+	}
+	return jsonEntry{
+		Timestamp: ts,
+		LogName:   e.LogName,
+		Severity:  e.Severity.String(),
+		Labels:    e.Labels,
+		Payload:   e.Payload,
+
+		HTTPRequest:    newJSONHTTPRequest(e.HTTPRequest),
+		Operation:      e.Operation,
+		SourceLocation: e.SourceLocation,
+		Trace:          e.Trace,
+		SpanID:         e.SpanID,
+		TraceSampled:   e.TraceSampled,
+	}
+}
+
+// entry converts the JSON representation back to an entry.
+func (je jsonEntry) entry() logging.Entry {
+	return logging.Entry{
+		Timestamp: je.Timestamp,
+		LogName:   je.LogName,
+		Severity:  logging.ParseSeverity(je.Severity),
+		Labels:    je.Labels,
+		Payload:   je.Payload,
+
+		HTTPRequest:    je.HTTPRequest.httpRequest(),
+		Operation:      je.Operation,
+		SourceLocation: je.SourceLocation,
+		Trace:          je.Trace,
+		SpanID:         je.SpanID,
+		TraceSampled:   je.TraceSampled,
+	}
+}
+
+// jsonHTTPRequest is the JSON representation of the HTTP request of an entry, named like the httpRequest of Cloud
+// Logging entries.
+type jsonHTTPRequest struct {
+	RequestMethod string `json:"requestMethod,omitempty"`
+	RequestURL    string `json:"requestUrl,omitempty"`
+	UserAgent     string `json:"userAgent,omitempty"`
+	Referer       string `json:"referer,omitempty"`
+	Protocol      string `json:"protocol,omitempty"`
+
+	RequestSize  int64  `json:"requestSize,omitempty"`
+	Status       int    `json:"status,omitempty"`
+	ResponseSize int64  `json:"responseSize,omitempty"`
+	Latency      string `json:"latency,omitempty"`
+	ServerIP     string `json:"serverIp,omitempty"`
+	RemoteIP     string `json:"remoteIp,omitempty"`
+
+	CacheLookup                    bool  `json:"cacheLookup,omitempty"`
+	CacheHit                       bool  `json:"cacheHit,omitempty"`
+	CacheValidatedWithOriginServer bool  `json:"cacheValidatedWithOriginServer,omitempty"`
+	CacheFillBytes                 int64 `json:"cacheFillBytes,omitempty"`
+}
+
+// newJSONHTTPRequest converts the HTTP request of an entry to its JSON representation, nil when r is nil.
+//   - only the parts of the request shipped by Cloud Logging are kept
+func newJSONHTTPRequest(r *logging.HTTPRequest) *jsonHTTPRequest {
+	if r == nil {
+		return nil
+	}
+	jr := &jsonHTTPRequest{
+		RequestSize:  r.RequestSize,
+		Status:       r.Status,
+		ResponseSize: r.ResponseSize,
+		ServerIP:     r.LocalIP,
+		RemoteIP:     r.RemoteIP,
+
+		CacheLookup:                    r.CacheLookup,
+		CacheHit:                       r.CacheHit,
+		CacheValidatedWithOriginServer: r.CacheValidatedWithOriginServer,
+		CacheFillBytes:                 r.CacheFillBytes,
+	}
+	if r.Latency > 0 {
+		jr.Latency = r.Latency.String()
+	}
+	if req := r.Request; req != nil {
+		jr.RequestMethod = req.Method
+		if req.URL != nil {
+			jr.RequestURL = req.URL.String()
+		}
+		jr.UserAgent = req.UserAgent()
+		jr.Referer = req.Referer()
+		jr.Protocol = req.Proto
+	}
+	return jr
+}
+
+// httpRequest converts the JSON representation back to the HTTP request of an entry, nil when jr is nil.
+//   - an unparsable URL or latency is dropped rather than failing the whole entry
+func (jr *jsonHTTPRequest) httpRequest() *logging.HTTPRequest {
+	if jr == nil {
+		return nil
+	}
+	r := &logging.HTTPRequest{
+		RequestSize:  jr.RequestSize,
+		Status:       jr.Status,
+		ResponseSize: jr.ResponseSize,
+		LocalIP:      jr.ServerIP,
+		RemoteIP:     jr.RemoteIP,
+
+		CacheLookup:                    jr.CacheLookup,
+		CacheHit:                       jr.CacheHit,
+		CacheValidatedWithOriginServer: jr.CacheValidatedWithOriginServer,
+		CacheFillBytes:                 jr.CacheFillBytes,
+	}
+	if d, err := time.ParseDuration(jr.Latency); err == nil {
+		r.Latency = d
+	}
+
+	// Cloud Logging requires a request with a URL
+	r.Request = &http.Request{Method: jr.RequestMethod, Proto: jr.Protocol, Header: http.Header{}, URL: &url.URL{}}
+	if u, err := url.Parse(jr.RequestURL); err == nil {
+		r.Request.URL = u
+	}
+	if jr.UserAgent != "" {
+		r.Request.Header.Set("User-Agent", jr.UserAgent)
+	}
+	if jr.Referer != "" {
+		r.Request.Header.Set("Referer", jr.Referer)
+	}
+	return r
+}
@@ -0,0 +1,86 @@
+package lease
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// SlackNotifier is a Notifier that posts lease transitions to a Slack incoming webhook, such as
+// "Verbose logging started for `checkout` by alice until 15:04 UTC: investigating 500s".
+//   - failed posts are retried like those of a WebhookNotifier
+type SlackNotifier struct {
+	webhook *WebhookNotifier
+}
+
+// NewSlackNotifier creates a SlackNotifier posting to the incoming webhook url.
+func NewSlackNotifier(url string) *SlackNotifier {
+	return &SlackNotifier{webhook: NewWebhookNotifier(url, "")}
+}
+
+// Notify posts the notification as a message.
+func (s *SlackNotifier) Notify(ctx context.Context, n Notification) error {
+	return s.Post(ctx, SlackText(n))
+}
+
+// Post posts a message, already escaped with SlackEscape where it holds user input.
+func (s *SlackNotifier) Post(ctx context.Context, text string) error {
+	body, err := json.Marshal(map[string]string{"text": text})
+	if err != nil {
+		return fmt.Errorf("failed to encode Slack message: %w", err)
+	}
+	return s.webhook.send(ctx, body)
+}
+
+// slackEscaper escapes the characters Slack treats as control characters in message text.
+var slackEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// SlackEscape escapes text for a Slack message, so user input such as lease reasons can not mention channels or
+// users, or inject links.
+func SlackEscape(text string) string {
+	return slackEscaper.Replace(text)
+}
+
+// SlackTarget describes a lease for a Slack message, as its escaped ID followed by its sorted tags, if any.
+func SlackTarget(leaseID string, tags map[string]string) string {
+	target := "`" + SlackEscape(leaseID) + "`"
+	if len(tags) > 0 {
+		pairs := make([]string, 0, len(tags))
+		for k, v := range tags {
+			pairs = append(pairs, SlackEscape(k+"="+v))
+		}
+		sort.Strings(pairs)
+		target += " (" + strings.Join(pairs, ", ") + ")"
+	}
+	return target
+}
+
+// SlackText describes a notification for humans, escaping every field taken from the lease.
+func SlackText(n Notification) string {
+	if n.Lease == nil {
+		return fmt.Sprintf("Lease %s on %s", SlackEscape(n.Event), SlackEscape(n.Instance))
+	}
+
+	target := SlackTarget(n.Lease.ID, n.Lease.Tags)
+	user := SlackEscape(n.Lease.User)
+	until := n.Lease.ExpireAt.UTC().Format("15:04 MST")
+
+	var msg string
+	switch n.Event {
+	case NotifyStart:
+		msg = fmt.Sprintf("Verbose logging started for %s by %s until %s", target, user, until)
+	case NotifyExtend:
+		msg = fmt.Sprintf("Verbose logging for %s by %s extended until %s", target, user, until)
+	case NotifyExpire:
+		msg = fmt.Sprintf("Verbose logging for %s by %s stopped", target, user)
+	default:
+		msg = fmt.Sprintf("Lease %s changed (%s)", target, SlackEscape(n.Event))
+	}
+
+	if n.Lease.Reason != "" {
+		msg += ": " + SlackEscape(n.Lease.Reason)
+	}
+	return msg
+}
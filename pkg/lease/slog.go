@@ -0,0 +1,284 @@
+package lease
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"runtime"
+	"slices"
+
+	"cloud.google.com/go/logging"
+	"cloud.google.com/go/logging/apiv2/loggingpb"
+)
+
+// SlogOptions configure the handler of SlogLoggerWithOptions.
+type SlogOptions struct {
+	// Level is the minimum level of records that are logged locally or shipped, every level when nil.
+	//   - records below it are dropped even at severities that always ship
+	Level slog.Leveler
+	// ReplaceAttr rewrites or drops attributes, as in slog.HandlerOptions, for both the local and the shipped output.
+	//   - it is only called with the built-in time, level, message, and source keys for the local output
+	ReplaceAttr func(groups []string, a slog.Attr) slog.Attr
+	// Severity maps record levels to severities, SlogSeverity when nil.
+	//   - delegate to SlogSeverity for the levels it does not override
+	Severity func(slog.Level) logging.Severity
+	// AddSource adds the source location of records, like WithSlogSource.
+	AddSource bool
+	// ErrorStacks adds the stack of the logging goroutine to records at ERROR or above with an error attribute.
+	ErrorStacks bool
+	// Handler writes the local output, such as a slog.JSONHandler, instead of a text handler on stdout.
+	//   - the handler is used as is, so ReplaceAttr and AddSource only apply to the shipped output, while Level still
+	//     drops records for both
+	//   - records the handler is not enabled for are still shipped
+	Handler slog.Handler
+}
+
+// SlogLoggerWithOptions returns a slog.Logger like SlogLogger, configured by opts.
+func (m *Manager) SlogLoggerWithOptions(opts SlogOptions) *slog.Logger {
+	addSource := opts.AddSource || m.slogSource
+	local := opts.Handler
+	if local == nil {
+		local = slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
+			AddSource:   addSource,
+			Level:       opts.Level,
+			ReplaceAttr: opts.ReplaceAttr,
+		})
+	}
+	severity := opts.Severity
+	if severity == nil {
+		severity = SlogSeverity
+	}
+	return slog.New(&slogger{
+		lw:           m,
+		stdoutLogger: local,
+		level:        opts.Level,
+		replaceAttr:  opts.ReplaceAttr,
+		severity:     severity,
+		addSource:    addSource,
+		errorStacks:  opts.ErrorStacks,
+	})
+}
+
+// slogger is a slog.Handler that writes to both stdout and the logger when enabled.
+type slogger struct {
+	lw           *Manager
+	stdoutLogger slog.Handler
+	// level and replaceAttr are from SlogOptions, nil when unset
+	level       slog.Leveler
+	replaceAttr func(groups []string, a slog.Attr) slog.Attr
+	// severity maps record levels to severities, SlogSeverity unless overridden
+	severity func(slog.Level) logging.Severity
+	// addSource sets the source location of shipped entries, see WithSlogSource
+	addSource bool
+	// errorStacks adds stacks to error events, see SlogOptions
+	errorStacks bool
+	// attrs are the attributes from WithAttrs, already nested in the groups that were open when they were added
+	attrs  []slog.Attr
+	groups []string
+}
+
+// Enabled reports whether records of the level are logged
+//   - returns true for every level at or above the configured Level, regardless of the lease, to always write to stdout
+func (s *slogger) Enabled(_ context.Context, l slog.Level) bool {
+	return s.level == nil || l >= s.level.Level()
+}
+
+// Handle writes a log record to both stdout and the logger when enabled.
+//   - the record is shipped as a structured payload, the message and attributes with groups as nested objects
+//   - labels are left to the manager, so attributes keep their types and do not count against label limits
+//   - records logged with a context holding an OpenTelemetry span are correlated with its trace
+//   - error attributes are expanded with their chain, and records at ERROR or above with one are reported as errors
+func (s *slogger) Handle(ctx context.Context, r slog.Record) error {
+	// only ship to leased sinks if the lease ships the severity, during the startup window, or it always ships
+	severity := s.severity(r.Level)
+	ship := s.lw.shouldShip(severity)
+
+	// log to stdout unless the record is shipped instead, the stdout handler applies attrs and groups itself
+	if !s.lw.localSuppressed(severity, ship) && s.stdoutLogger.Enabled(ctx, r.Level) {
+		if err := s.stdoutLogger.Handle(ctx, r); err != nil {
+			return err
+		}
+	}
+
+	payload := make(map[string]any, len(s.attrs)+r.NumAttrs()+1)
+	for _, a := range s.attrs {
+		s.addAttr(payload, nil, a)
+	}
+	var attrs []slog.Attr
+	r.Attrs(func(a slog.Attr) bool {
+		attrs = append(attrs, a)
+		return true
+	})
+	for _, a := range inGroups(s.groups, attrs) {
+		s.addAttr(payload, nil, a)
+	}
+	payload["message"] = r.Message
+
+	if severity >= logging.Error {
+		err := recordError(attrs)
+		if err == nil {
+			err = recordError(s.attrs)
+		}
+		if err != nil {
+			s.lw.reportError(payload, err, r.PC, s.errorStacks)
+		}
+	}
+
+	e := logging.Entry{
+		Timestamp: r.Time,
+		Severity:  severity,
+		Payload:   payload,
+	}
+	if s.addSource {
+		e.SourceLocation = sourceLocation(r.PC)
+	}
+	s.lw.setTrace(ctx, &e)
+	s.lw.log(e, ship)
+
+	return nil
+}
+
+// WithAttrs returns a new handler with additional attributes.
+func (s *slogger) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return s
+	}
+	c := *s
+	c.stdoutLogger = s.stdoutLogger.WithAttrs(attrs)
+	c.attrs = slices.Clone(s.attrs)
+	c.attrs = append(c.attrs, inGroups(s.groups, attrs)...)
+	return &c
+}
+
+// WithGroup returns a new handler with an additional group, qualifying the attributes added after it.
+func (s *slogger) WithGroup(g string) slog.Handler {
+	if g == "" {
+		return s
+	}
+	c := *s
+	c.stdoutLogger = s.stdoutLogger.WithGroup(g)
+	c.groups = slices.Clone(s.groups)
+	c.groups = append(c.groups, g)
+	return &c
+}
+
+// inGroups nests attrs in the groups, outermost first, or returns nil if there are no attrs so empty groups are dropped.
+func inGroups(groups []string, attrs []slog.Attr) []slog.Attr {
+	if len(attrs) == 0 {
+		return nil
+	}
+	for i := len(groups) - 1; i >= 0; i-- {
+		attrs = []slog.Attr{{Key: groups[i], Value: slog.GroupValue(attrs...)}}
+	}
+	return attrs
+}
+
+// WithSlogSource adds the source file, line, and function of slog records to the stdout output of SlogLogger, and
+// sets the SourceLocation of the entries it ships.
+func WithSlogSource() Option {
+	return func(m *Manager) {
+		m.slogSource = true
+	}
+}
+
+// sourceLocation returns the source location of a record's program counter, or nil if it has none.
+func sourceLocation(pc uintptr) *loggingpb.LogEntrySourceLocation {
+	if pc == 0 {
+		return nil
+	}
+	f, _ := runtime.CallersFrames([]uintptr{pc}).Next()
+	return &loggingpb.LogEntrySourceLocation{
+		File:     f.File,
+		Line:     int64(f.Line),
+		Function: f.Function,
+	}
+}
+
+// addAttr adds an attribute within groups to a payload object, nesting groups as objects.
+//   - empty attributes and empty groups are ignored, and groups without a key are inlined, as slog handlers do
+//   - attributes other than groups are passed through replaceAttr first
+func (s *slogger) addAttr(obj map[string]any, groups []string, a slog.Attr) {
+	a.Value = a.Value.Resolve()
+	if s.replaceAttr != nil && a.Value.Kind() != slog.KindGroup {
+		a = s.replaceAttr(groups, a)
+		a.Value = a.Value.Resolve()
+	}
+	if a.Equal(slog.Attr{}) {
+		return
+	}
+
+	if a.Value.Kind() != slog.KindGroup {
+		obj[a.Key] = attrValue(a.Value)
+		return
+	}
+
+	group := a.Value.Group()
+	if len(group) == 0 {
+		return
+	}
+	if a.Key == "" {
+		for _, ga := range group {
+			s.addAttr(obj, groups, ga)
+		}
+		return
+	}
+	nested, ok := obj[a.Key].(map[string]any)
+	if !ok {
+		nested = make(map[string]any, len(group))
+		obj[a.Key] = nested
+	}
+	groups = append(slices.Clip(groups), a.Key)
+	for _, ga := range group {
+		s.addAttr(nested, groups, ga)
+	}
+}
+
+// attrValue converts a resolved, non-group attribute value to a value that encodes to JSON.
+//   - durations are written as strings such as "1.5s", and errors as objects with their message, type, and chain
+//   - values that cannot be encoded are written as formatted with %+v
+func attrValue(v slog.Value) any {
+	switch v.Kind() {
+	case slog.KindDuration:
+		return v.Duration().String()
+	case slog.KindAny:
+		switch x := v.Any().(type) {
+		case error:
+			return errorValue(x)
+		default:
+			if _, err := json.Marshal(x); err != nil {
+				return fmt.Sprintf("%+v", x)
+			}
+			return x
+		}
+	default:
+		return v.Any()
+	}
+}
+
+// SlogSeverity converts a slog.Level to a logging.Severity by range, so custom levels keep a meaningful severity.
+//   - levels below INFO, including trace levels such as DEBUG-4, are DEBUG
+//   - INFO up to INFO+2 is INFO, and INFO+2 up to WARN is NOTICE
+//   - WARN up to ERROR is WARNING
+//   - ERROR up to ERROR+4 is ERROR, then CRITICAL, ALERT, and EMERGENCY from ERROR+8 up
+func SlogSeverity(l slog.Level) logging.Severity {
+	switch {
+	case l < slog.LevelInfo:
+		return logging.Debug
+	case l < slog.LevelInfo+2:
+		return logging.Info
+	case l < slog.LevelWarn:
+		return logging.Notice
+	case l < slog.LevelError:
+		return logging.Warning
+	case l < slog.LevelError+4:
+		return logging.Error
+	case l < slog.LevelError+8:
+		return logging.Critical
+	case l < slog.LevelError+12:
+		return logging.Alert
+	default:
+		return logging.Emergency
+	}
+}
@@ -0,0 +1,75 @@
+package lease
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"testing"
+)
+
+func TestSlogGroups(t *testing.T) {
+	tests := []struct {
+		name string
+		log  func(*slog.Logger)
+		want string
+	}{
+		{
+			name: "attrs",
+			log:  func(l *slog.Logger) { l.Info("hello", "user", "alice", "n", 1) },
+			want: `{"message":"hello","n":1,"user":"alice"}`,
+		},
+		{
+			name: "group",
+			log:  func(l *slog.Logger) { l.WithGroup("req").Info("hello", "path", "/", "status", 200) },
+			want: `{"message":"hello","req":{"path":"/","status":200}}`,
+		},
+		{
+			name: "attrs before and after a group",
+			log: func(l *slog.Logger) {
+				l.With("service", "api").WithGroup("req").With("id", "r1").Info("hello", "path", "/")
+			},
+			want: `{"message":"hello","req":{"id":"r1","path":"/"},"service":"api"}`,
+		},
+		{
+			name: "nested groups",
+			log:  func(l *slog.Logger) { l.WithGroup("a").WithGroup("b").Info("hello", "k", "v") },
+			want: `{"a":{"b":{"k":"v"}},"message":"hello"}`,
+		},
+		{
+			name: "group attribute",
+			log:  func(l *slog.Logger) { l.Info("hello", slog.Group("req", "path", "/")) },
+			want: `{"message":"hello","req":{"path":"/"}}`,
+		},
+		{
+			name: "empty group",
+			log:  func(l *slog.Logger) { l.WithGroup("req").Info("hello") },
+			want: `{"message":"hello"}`,
+		},
+		{
+			name: "inlined group",
+			log:  func(l *slog.Logger) { l.Info("hello", slog.Group("", "k", "v")) },
+			want: `{"k":"v","message":"hello"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sink := &recordingSink{}
+			m := newTestManager(t, WithSink(sink, Leased))
+
+			tt.log(m.SlogLoggerWithOptions(SlogOptions{Handler: slog.NewTextHandler(io.Discard, nil)}))
+
+			payloads := sink.payloads()
+			if len(payloads) != 1 {
+				t.Fatalf("shipped %d entries, want 1", len(payloads))
+			}
+			got, err := json.Marshal(payloads[0])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("payload %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,460 @@
+package lease
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"cloud.google.com/go/logging"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// LeasePolicy controls how the states of several watched leases combine.
+type LeasePolicy int
+
+const (
+	// AnyLease ships while any watched lease is active.
+	AnyLease LeasePolicy = iota
+	// AllLeases only ships while every watched lease is active.
+	AllLeases
+)
+
+// ParseLeasePolicy converts "any" or "all" to a LeasePolicy.
+func ParseLeasePolicy(s string) (LeasePolicy, error) {
+	switch s {
+	case "any":
+		return AnyLease, nil
+	case "all":
+		return AllLeases, nil
+	default:
+		return AnyLease, fmt.Errorf("unknown lease policy %q, must be any or all", s)
+	}
+}
+
+// WithLeases watches additional lease documents, combined with the lease passed to NewManager by the lease policy.
+func WithLeases(docRefs ...*firestore.DocumentRef) Option {
+	return func(m *Manager) {
+		m.extraLeases = append(m.extraLeases, docRefs...)
+	}
+}
+
+// WithParentLeases watches ancestor leases, such as a team or global lease, that enable shipping for all of their children.
+//   - shipping is enabled while any parent lease is active, regardless of the lease policy
+//   - parent leases still only apply when their tags match the labels of the manager
+func WithParentLeases(docRefs ...*firestore.DocumentRef) Option {
+	return func(m *Manager) {
+		m.parentLeases = append(m.parentLeases, docRefs...)
+	}
+}
+
+// WithLeasePolicy sets how several watched leases combine, AnyLease by default.
+func WithLeasePolicy(p LeasePolicy) Option {
+	return func(m *Manager) {
+		m.leasePolicy = p
+	}
+}
+
+// leaseSource is a single watched lease document and its state.
+type leaseSource struct {
+	m      *Manager
+	docRef *firestore.DocumentRef
+	// parent is set for ancestor leases, which enable shipping on their own
+	parent bool
+
+	// active reports whether this lease alone would enable shipping
+	active atomic.Bool
+	// lease is the last matching lease document, used to label shipped entries
+	lease atomic.Pointer[Document]
+	// reconnects counts the times the watch failed and was restarted
+	reconnects atomic.Int64
+	// markedSession is the last session a start marker was shipped for, only used by watch
+	markedSession string
+
+	expireMu        sync.Mutex
+	guaranteedUntil time.Time
+	expireTimer     *time.Timer
+
+	scheduleMu    sync.Mutex
+	scheduleTimer *time.Timer
+
+	// failTimer applies the watch failure policy while the watch fails, see WithWatchFailurePolicy
+	failMu    sync.Mutex
+	failTimer *time.Timer
+
+	// notifiedKey is the key of the lease transition last notified, active until notifiedUntil, see notifyLease
+	notifyMu      sync.Mutex
+	notifiedKey   string
+	notifiedUntil time.Time
+	notifiedLease *Document
+
+	// shared is the last snapshot, broadcast to the sharedTo subscribers, see ServeLeaseState
+	sharedMu sync.Mutex
+	shared   *leaseStateEvent
+	sharedTo map[chan *leaseStateEvent]struct{}
+}
+
+// update recomputes whether the manager is enabled from the state of every lease.
+func (m *Manager) update() {
+	m.updateMu.Lock()
+	defer m.updateMu.Unlock()
+
+	if m.leasesActive() {
+		m.enable()
+	} else {
+		m.disable()
+	}
+}
+
+// leasesActive reports whether any parent lease is active, or the manager's own leases are according to the lease policy.
+func (m *Manager) leasesActive() bool {
+	for _, src := range m.sources {
+		if src.parent && src.active.Load() {
+			return true
+		}
+	}
+	return m.ownLeasesActive()
+}
+
+// ownLeasesActive combines the state of the manager's own leases according to the lease policy.
+func (m *Manager) ownLeasesActive() bool {
+	for _, src := range m.sources {
+		if src.parent {
+			continue
+		}
+		active := src.active.Load()
+		if m.leasePolicy == AnyLease && active {
+			return true
+		}
+		if m.leasePolicy == AllLeases && !active {
+			return false
+		}
+	}
+	return m.leasePolicy == AllLeases
+}
+
+// minSeverity returns the lowest severity shipped under the active leases.
+//   - with AnyLease the most permissive lease wins, with AllLeases the strictest one
+//   - active parent leases always count as if combined with AnyLease
+func (m *Manager) minSeverity() logging.Severity {
+	var (
+		own, parents          logging.Severity
+		foundOwn, foundParent bool
+	)
+	for _, src := range m.sources {
+		if !src.active.Load() {
+			continue
+		}
+
+		sev := logging.Default
+		if lease := src.lease.Load(); lease != nil {
+			sev = lease.minSeverity()
+		}
+		switch {
+		case src.parent:
+			if !foundParent || sev < parents {
+				parents, foundParent = sev, true
+			}
+		case !foundOwn || (m.leasePolicy == AnyLease && sev < own) || (m.leasePolicy == AllLeases && sev > own):
+			own, foundOwn = sev, true
+		}
+	}
+
+	if foundParent && (!foundOwn || !m.ownLeasesActive() || parents < own) {
+		return parents
+	}
+	return own
+}
+
+// leaseLabels returns the labels of every active lease, earlier leases taking precedence.
+//   - lease_id is the ID of the first active lease, so entries shipped under a lease can be queried by it
+func (m *Manager) leaseLabels() map[string]string {
+	var labels map[string]string
+	for i := len(m.sources) - 1; i >= 0; i-- {
+		src := m.sources[i]
+		lease := src.lease.Load()
+		if lease == nil || !src.active.Load() {
+			continue
+		}
+		if labels == nil {
+			labels = make(map[string]string)
+		}
+		for k, v := range lease.labels() {
+			labels[k] = v
+		}
+		labels["lease_id"] = src.docRef.ID
+	}
+	return labels
+}
+
+// replaySince returns the earliest replay window requested by an active lease.
+func (m *Manager) replaySince() time.Time {
+	var since time.Time
+	for _, src := range m.sources {
+		lease := src.lease.Load()
+		if lease == nil || lease.ReplaySince.IsZero() || !src.active.Load() {
+			continue
+		}
+		if since.IsZero() || lease.ReplaySince.Before(since) {
+			since = lease.ReplaySince
+		}
+	}
+	return since
+}
+
+// revokeGuarantees drops the guaranteedUntil time of every lease, so a revocation stops shipping immediately.
+//   - the lease token is voided too, so a token that is not valid yet never enables shipping again
+func (m *Manager) revokeGuarantees() {
+	m.tokenMu.Lock()
+	defer m.tokenMu.Unlock()
+	m.revokeToken()
+
+	for _, src := range m.sources {
+		src.expireMu.Lock()
+		src.guaranteedUntil = time.Time{}
+		src.expireMu.Unlock()
+
+		if lease := src.lease.Load(); lease != nil {
+			src.applyLease(lease)
+		} else {
+			src.expire()
+		}
+	}
+}
+
+const (
+	// watchBackoffMin and watchBackoffMax bound the delay between retries of a failing lease watch
+	watchBackoffMin = time.Second
+	watchBackoffMax = 2 * time.Minute
+)
+
+// watchWithRetry watches the lease document for changes and updates the lease state.
+//   - runs until the context is canceled
+//   - reconnects immediately when a healthy stream is reset, such as by Firestore closing it
+//   - otherwise retries with exponential backoff and jitter, up to watchBackoffMax
+//   - a watch that stayed up for longer than watchBackoffMax resets the backoff
+func (s *leaseSource) watchWithRetry(ctx context.Context) {
+	var failures int
+	for {
+		start := time.Now()
+		err := s.watch(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		s.reconnects.Add(1)
+		s.watchFailed()
+		if time.Since(start) > watchBackoffMax {
+			failures = 0
+		}
+
+		if failures == 0 && transientWatchError(err) {
+			failures++
+			diag().Info("lease watch reset, reconnecting", "lease", s.docRef.ID, "error", err)
+			continue
+		}
+
+		delay := watchBackoff(failures)
+		failures++
+		diag().Error("failed to watch lease", "lease", s.docRef.ID, "error", err, "retryIn", delay)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay): // retry
+		}
+	}
+}
+
+// transientWatchError reports whether a watch ended by a stream reset, rather than a failure worth backing off from.
+func transientWatchError(err error) bool {
+	return err == nil || status.Code(err) == codes.Unavailable
+}
+
+// watchBackoff returns the delay before the next retry after the given number of consecutive failures.
+//   - the delay doubles from watchBackoffMin up to watchBackoffMax
+//   - half of it is random, so instances that failed together do not retry in lockstep
+func watchBackoff(failures int) time.Duration {
+	d := watchBackoffMax
+	if failures < 16 {
+		d = min(watchBackoffMin<<failures, watchBackoffMax)
+	}
+	return d/2 + rand.N(d/2+1)
+}
+
+// watch watches the lease document for changes and updates the lease state.
+//   - follows the lease state broadcast by another process instead, see WithLeaseStateFrom
+func (s *leaseSource) watch(ctx context.Context) error {
+	if s.m.leaseStateFrom != "" {
+		return s.watchShared(ctx)
+	}
+
+	diag().Info("watch lease", "path", s.docRef.Path)
+	iter := s.docRef.Snapshots(ctx)
+	defer iter.Stop()
+	for {
+		snapshot, err := iter.Next()
+		switch {
+		case err == io.EOF,
+			err == context.DeadlineExceeded,
+			err == context.Canceled:
+			return nil
+		case err != nil:
+			diag().Error("failed to get snapshot", "lease", s.docRef.ID, "error", err)
+			return err
+		}
+
+		if dropSnapshot() {
+			diag().Warn("snapshot dropped by injected fault", "lease", s.docRef.ID)
+			continue
+		}
+		s.watchRecovered()
+
+		var lease *Document
+		if snapshot.Exists() {
+			lease = &Document{}
+			if err := snapshot.DataTo(lease); err != nil {
+				diag().Error("failed to parse lease", "lease", s.docRef.ID, "error", err)
+				continue
+			}
+		}
+		s.received(lease, snapshot.ReadTime)
+		s.applySnapshot(ctx, lease, snapshot.ReadTime)
+	}
+}
+
+// applySnapshot updates the lease state from a snapshot of the lease document read at readTime, nil when the
+// document does not exist.
+func (s *leaseSource) applySnapshot(ctx context.Context, lease *Document, readTime time.Time) {
+	m := s.m
+
+	// if the snapshot does not yet exist, espire after the guaranteedUntil time
+	// for leases that are deleted after the guaranteedUntil time, this will disable the lease immediately
+	if lease == nil {
+		s.lease.Store(nil)
+		s.scheduleNext(time.Time{})
+		s.expire()
+		s.notifyLease(nil)
+		s.reportStatus(ctx, time.Time{})
+		return
+	}
+
+	// revocations apply to every instance, regardless of tags
+	if lease.Revoked {
+		diag().Info("lease revoked", "user", lease.User, "reason", lease.Reason, "grant", lease.GrantID, "lease", s.docRef.ID)
+		s.lease.Store(nil)
+		s.scheduleNext(time.Time{})
+		m.revokeGuarantees()
+		s.notifyLease(nil)
+		s.reportStatus(ctx, lease.ExpireAt)
+		return
+	}
+
+	// leases awaiting approval are treated as if they do not exist
+	if lease.Pending || (m.requireApproval && lease.ApprovedBy == "") {
+		diag().Warn("lease ignored, not approved", "user", lease.User, "reason", lease.Reason, "lease", s.docRef.ID)
+		s.lease.Store(nil)
+		s.scheduleNext(time.Time{})
+		s.expire()
+		s.notifyLease(nil)
+		s.reportStatus(ctx, time.Time{})
+		return
+	}
+
+	// leases scoped to other instances are treated as if they do not exist
+	if !lease.Matches(m.labels) {
+		diag().Warn("lease ignored, tags do not match", "tags", lease.Tags, "lease", s.docRef.ID)
+		s.lease.Store(nil)
+		s.scheduleNext(time.Time{})
+		s.expire()
+		s.notifyLease(nil)
+		s.reportStatus(ctx, time.Time{})
+		return
+	}
+
+	s.lease.Store(lease)
+	s.applyLease(lease)
+	s.markSession(lease, readTime)
+	if m.enabled.Load() && !lease.ReplaySince.IsZero() && m.requestsNewReplay(lease.ReplaySince) {
+		m.replay()
+	}
+	if m.gracePeriod > 0 && lease.ExpireAt.Before(time.Now()) && s.active.Load() {
+		diag().Info("lease in grace period", "stopsIn", time.Until(lease.ExpireAt.Add(m.gracePeriod)).Round(time.Millisecond*100), "lease", s.docRef.ID)
+	} else if lease.ExpireAt.After(m.guaranteedUntil) {
+		diag().Info("lease extended", "expiresIn", time.Until(lease.ExpireAt).Round(time.Millisecond*100), "user", lease.User, "reason", lease.Reason, "scope", lease.Scope, "tags", lease.Tags, "grant", lease.GrantID, "lease", s.docRef.ID)
+	}
+	s.reportStatus(ctx, lease.ExpireAt)
+}
+
+// reportStatus writes the observed lease expiry of this instance to the lease status subcollection.
+//   - failures are reported but otherwise ignored, status is informational only
+func (s *leaseSource) reportStatus(ctx context.Context, observedExpireAt time.Time) {
+	m := s.m
+
+	host, _ := os.Hostname()
+	st := Status{
+		Instance:         m.instanceID,
+		Host:             host,
+		PID:              os.Getpid(),
+		Labels:           m.labels,
+		ObservedExpireAt: observedExpireAt,
+		Active:           s.active.Load(),
+		UpdatedAt:        time.Now().UTC(),
+	}
+	if m.chain != nil {
+		if head := m.chain.snapshot(); head.Session != "" {
+			st.Chain = &head
+		}
+	}
+	_, err := StatusCollection(s.docRef).Doc(m.instanceID).Set(ctx, st)
+	if err != nil {
+		diag().Error("failed to report lease status", "lease", s.docRef.ID, "error", err)
+	}
+}
+
+// expire expires the lease after its guaranteedUntil time, immediately if that has passed.
+func (s *leaseSource) expire() {
+	s.expireAfter(time.Time{})
+}
+
+// expireAfter sets a new lease expiration time, resetting the lease timer
+//   - respects the guaranteedUntil time, even if the lease is shorter
+func (s *leaseSource) expireAfter(expire time.Time) {
+	s.expireMu.Lock()
+	defer s.expireMu.Unlock()
+
+	// ensure guaranteedUntil is always respected, even if the lease is shorter
+	if expire.Before(s.guaranteedUntil) {
+		expire = s.guaranteedUntil
+	}
+
+	// cancel the previous timer if it was unfired
+	if s.expireTimer != nil {
+		s.expireTimer.Stop()
+	}
+
+	// already expired, disable immediately
+	if expire.Before(time.Now().UTC()) {
+		diag().Info("lease expired", "lease", s.docRef.ID)
+		s.active.Store(false)
+		s.m.update()
+		s.notifyLease(s.lease.Load())
+		return
+	}
+
+	// enable and set a new timer
+	s.active.Store(true)
+	s.m.update()
+
+	s.expireTimer = time.AfterFunc(time.Until(expire), func() {
+		diag().Info("lease expired", "lease", s.docRef.ID)
+		s.active.Store(false)
+		s.m.update()
+		s.notifyLease(s.lease.Load())
+	})
+}
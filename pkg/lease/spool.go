@@ -0,0 +1,67 @@
+package lease
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"cloud.google.com/go/logging"
+
+	"github.com/carsonoid/talk-leased-logs/pkg/spool"
+)
+
+// WithSpool stores entries that were not shipped to leased sinks in sp, so they can be shipped later with ReplayFrom.
+//   - the manager owns sp and closes it on Close
+func WithSpool(sp *spool.Spool) Option {
+	return func(m *Manager) {
+		m.spool = sp
+	}
+}
+
+// spoolEntry appends an unshipped entry to the spool.
+func (m *Manager) spoolEntry(e logging.Entry) {
+	je := newJSONEntry(e)
+	data, err := json.Marshal(je)
+	if err != nil {
+		diag().Error("failed to encode spooled entry", "error", err)
+		return
+	}
+	// entries logged after Close are no longer spooled
+	if err := m.spool.Append(je.Timestamp, data); err != nil && !errors.Is(err, spool.ErrClosed) {
+		diag().Error("failed to spool entry", "error", err)
+	}
+}
+
+// ReplayFrom ships spooled entries with a timestamp at or after since to the leased sinks, labeled as replayed.
+//   - entries are rate limited like other shipped entries, see WithRateLimit
+//   - entries below the MinSeverity of the lease are skipped, unless they are at or above the always-ship severity
+//   - does nothing if no spool is configured
+func (m *Manager) ReplayFrom(since time.Time) error {
+	if m.spool == nil {
+		return nil
+	}
+
+	var replayed int
+	err := m.spool.Replay(since, func(_ time.Time, data []byte) error {
+		var je jsonEntry
+		if err := json.Unmarshal(data, &je); err != nil {
+			// skip records written by incompatible versions rather than aborting the replay
+			return nil
+		}
+
+		e := je.entry()
+		if !m.replayable(e.Severity) {
+			return nil
+		}
+		m.shipLimited(withLabel(e, "replayed", "true"), false)
+		replayed++
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to replay spool: %w", err)
+	}
+
+	diag().Info("replayed spooled entries", "entries", replayed, "since", since)
+	return nil
+}
@@ -0,0 +1,194 @@
+package lease
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// timelineSize is the number of recent lease transitions kept for State.
+const timelineSize = 50
+
+// State is a snapshot of the internal state of a manager, for debugging the manager itself.
+type State struct {
+	Instance        string            `json:"instance"`
+	Labels          map[string]string `json:"labels,omitempty"`
+	Enabled         bool              `json:"enabled"`
+	GuaranteedUntil time.Time         `json:"guaranteedUntil"`
+	StartupUntil    *time.Time        `json:"startupUntil,omitempty"`
+	Shipped         int64             `json:"shipped"`
+	Suppressed      int64             `json:"suppressed"`
+	Quarantined     int64             `json:"quarantined"`
+
+	Leases   []LeaseState    `json:"leases"`
+	Timeline []TimelineEvent `json:"timeline"`
+	Sinks    []SinkState     `json:"sinks"`
+
+	// ShutdownBuffered is the number of entries held by the shutdown buffer
+	ShutdownBuffered int `json:"shutdownBuffered"`
+	// Queued is the number of entries queued or being shipped by the shipping goroutine, see WithQueue
+	Queued int `json:"queued,omitempty"`
+	// ReplayBufferBytes and ShutdownBufferBytes estimate the size of the unshipped entries held by the buffers
+	ReplayBufferBytes   int `json:"replayBufferBytes,omitempty"`
+	ShutdownBufferBytes int `json:"shutdownBufferBytes,omitempty"`
+
+	At time.Time `json:"at"`
+}
+
+// LeaseState is the state of a single watched lease.
+type LeaseState struct {
+	ID       string     `json:"id"`
+	Parent   bool       `json:"parent,omitempty"`
+	Active   bool       `json:"active"`
+	User     string     `json:"user,omitempty"`
+	Reason   string     `json:"reason,omitempty"`
+	GrantID  string     `json:"grantId,omitempty"`
+	Session  string     `json:"sessionId,omitempty"`
+	ExpireAt *time.Time `json:"expireAt,omitempty"`
+	// Reconnects counts the times the watch of the lease failed and was restarted
+	Reconnects int64 `json:"reconnects,omitempty"`
+}
+
+// TimelineEvent is a lease transition, one of the Notify events.
+type TimelineEvent struct {
+	Event   string    `json:"event"`
+	LeaseID string    `json:"leaseId,omitempty"`
+	User    string    `json:"user,omitempty"`
+	At      time.Time `json:"at"`
+}
+
+// SinkState is the health of a single sink.
+type SinkState struct {
+	Sink   string `json:"sink"`
+	Policy string `json:"policy"`
+	Logged int64  `json:"logged"`
+	Failed int64  `json:"failed"`
+	// Queued is the number of entries queued or in flight, for sinks with workers
+	Queued      int        `json:"queued,omitempty"`
+	LastError   string     `json:"lastError,omitempty"`
+	LastErrorAt *time.Time `json:"lastErrorAt,omitempty"`
+}
+
+// sinkHealth counts the entries a sink accepted and rejected.
+type sinkHealth struct {
+	logged atomic.Int64
+	failed atomic.Int64
+
+	mu          sync.Mutex
+	lastError   string
+	lastErrorAt time.Time
+}
+
+// record counts the result of logging an entry to the sink.
+func (h *sinkHealth) record(err error) {
+	if err == nil {
+		h.logged.Add(1)
+		return
+	}
+	h.failed.Add(1)
+	h.mu.Lock()
+	h.lastError, h.lastErrorAt = err.Error(), time.Now()
+	h.mu.Unlock()
+}
+
+// recordTransition adds a lease transition to the timeline, dropping the oldest once it is full.
+func (m *Manager) recordTransition(event string, src *leaseSource) {
+	e := TimelineEvent{Event: event, At: time.Now().UTC()}
+	if src != nil {
+		e.LeaseID = src.docRef.ID
+		if lease := src.lease.Load(); lease != nil {
+			e.User = lease.User
+		}
+	}
+
+	m.timelineMu.Lock()
+	defer m.timelineMu.Unlock()
+	if len(m.timeline) == timelineSize {
+		m.timeline = append(m.timeline[:0], m.timeline[1:]...)
+	}
+	m.timeline = append(m.timeline, e)
+}
+
+// State returns a snapshot of the lease states, recent lease transitions, and sink health of the manager.
+func (m *Manager) State() State {
+	s := State{
+		Instance:        m.instanceID,
+		Labels:          m.labels,
+		Enabled:         m.enabled.Load(),
+		GuaranteedUntil: m.guaranteedUntil,
+		Shipped:         m.shipped.Load(),
+		Suppressed:      m.suppressed.Load(),
+		Quarantined:     m.quarantined.Load(),
+		At:              time.Now().UTC(),
+	}
+
+	if !m.startupUntil.IsZero() {
+		s.StartupUntil = &m.startupUntil
+	}
+
+	for _, src := range m.sources {
+		ls := LeaseState{ID: src.docRef.ID, Parent: src.parent, Active: src.active.Load(), Reconnects: src.reconnects.Load()}
+		if lease := src.lease.Load(); lease != nil {
+			ls.User = lease.User
+			ls.Reason = lease.Reason
+			ls.GrantID = lease.GrantID
+			ls.Session = lease.SessionID
+			if !lease.ExpireAt.IsZero() {
+				ls.ExpireAt = &lease.ExpireAt
+			}
+		}
+		s.Leases = append(s.Leases, ls)
+	}
+
+	m.timelineMu.Lock()
+	s.Timeline = append([]TimelineEvent(nil), m.timeline...)
+	m.timelineMu.Unlock()
+
+	for i, rs := range m.sinks {
+		ss := SinkState{
+			Sink:   fmt.Sprintf("%d:%T", i, rs.sink),
+			Policy: "leased",
+			Logged: rs.health.logged.Load(),
+			Failed: rs.health.failed.Load(),
+		}
+		if rs.policy == Always {
+			ss.Policy = "always"
+		}
+		if p, ok := rs.sink.(interface{ Pending() int }); ok {
+			ss.Queued = p.Pending()
+		}
+		rs.health.mu.Lock()
+		if ss.LastError = rs.health.lastError; ss.LastError != "" {
+			at := rs.health.lastErrorAt
+			ss.LastErrorAt = &at
+		}
+		rs.health.mu.Unlock()
+		s.Sinks = append(s.Sinks, ss)
+	}
+
+	if m.queue != nil {
+		s.Queued = m.queue.len()
+	}
+	if m.buffer != nil {
+		s.ReplayBufferBytes = m.buffer.bytes()
+	}
+	if m.shutdownBuffer != nil {
+		s.ShutdownBuffered = m.shutdownBuffer.len()
+		s.ShutdownBufferBytes = m.shutdownBuffer.bytes()
+	}
+
+	return s
+}
+
+// DumpState writes the State of the manager to w as indented JSON.
+func (m *Manager) DumpState(w io.Writer) error {
+	b, err := json.MarshalIndent(m.State(), "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode state: %w", err)
+	}
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
@@ -0,0 +1,126 @@
+package lease
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/logging"
+)
+
+// Stats counts the entries of a manager since it started.
+type Stats struct {
+	// Shipped is the number of entries shipped to leased sinks
+	Shipped int64
+	// Suppressed is the number of entries not shipped to leased sinks, because no lease allowed them
+	Suppressed int64
+	// SuppressedBytes is the estimated size of the suppressed entries
+	SuppressedBytes int64
+	// Quarantined is the number of entries rejected by sinks and quarantined
+	Quarantined int64
+	// Dropped is the number of entries dropped because the queue was full, see WithQueue
+	Dropped int64
+	// RateLimited is the number of entries dropped for being over the rate limit, see WithRateLimit
+	RateLimited int64
+	// SinkErrors is the number of errors sinks failed to ship entries with, including asynchronous ones
+	SinkErrors int64
+}
+
+// Stats returns the entries shipped and suppressed by the manager since it started, so operators know what they are
+// missing while unleased.
+func (m *Manager) Stats() Stats {
+	return Stats{
+		Shipped:         m.shipped.Load(),
+		Suppressed:      m.suppressed.Load(),
+		SuppressedBytes: m.suppressedBytes.Load(),
+		Quarantined:     m.quarantined.Load(),
+		Dropped:         m.dropped.Load(),
+		RateLimited:     m.rateLimited.Load(),
+		SinkErrors:      m.sinkErrors.Load(),
+	}
+}
+
+// WithSuppressionSummary ships a summary entry at the given interval, such as "suppressed 12,304 entries (3.1 MiB) in
+// the last 5m", whenever entries were suppressed during it.
+//   - summaries always ship, like errors, so they are seen without a lease
+func WithSuppressionSummary(interval time.Duration) Option {
+	return func(m *Manager) {
+		m.summaryInterval = interval
+	}
+}
+
+// summarizeSuppression ships suppression summaries until the context is canceled.
+func (m *Manager) summarizeSuppression(ctx context.Context) {
+	t := time.NewTicker(m.summaryInterval)
+	defer t.Stop()
+
+	last := m.Stats()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+
+		stats := m.Stats()
+		entries, bytes := stats.Suppressed-last.Suppressed, stats.SuppressedBytes-last.SuppressedBytes
+		last = stats
+		if entries == 0 {
+			continue
+		}
+
+		m.log(logging.Entry{
+			Severity: logging.Info,
+			Labels:   map[string]string{"suppression_summary": "true"},
+			Payload: map[string]any{
+				"message":         fmt.Sprintf("suppressed %s entries (%s) in the last %s", formatCount(entries), formatBytes(bytes), formatInterval(m.summaryInterval)),
+				"instance":        m.instanceID,
+				"suppressed":      entries,
+				"suppressedBytes": bytes,
+				"interval":        m.summaryInterval.String(),
+			},
+		}, true)
+	}
+}
+
+// formatCount formats n with thousands separators, such as 12,304.
+func formatCount(n int64) string {
+	s := strconv.FormatInt(n, 10)
+	var b strings.Builder
+	for i, c := range s {
+		if i > 0 && (len(s)-i)%3 == 0 {
+			b.WriteByte(',')
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+// formatBytes formats a size in bytes with a binary unit, such as 3.1 MiB.
+func formatBytes(n int64) string {
+	if n < 1<<10 {
+		return fmt.Sprintf("%d B", n)
+	}
+	v, unit := float64(n)/(1<<10), "KiB"
+	for _, u := range []string{"MiB", "GiB"} {
+		if v < 1<<10 {
+			break
+		}
+		v, unit = v/(1<<10), u
+	}
+	return fmt.Sprintf("%.1f %s", v, unit)
+}
+
+// formatInterval formats an interval without trailing zero units, such as 5m instead of 5m0s.
+func formatInterval(d time.Duration) string {
+	s := d.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = strings.TrimSuffix(s, "0s")
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
+	}
+	return s
+}
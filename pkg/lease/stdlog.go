@@ -0,0 +1,55 @@
+package lease
+
+import (
+	"io"
+	"log"
+	"os"
+	"regexp"
+
+	"cloud.google.com/go/logging"
+)
+
+// StdLogger returns a log.Logger that writes to stderr and ships every line at the given severity.
+//   - always writes to stderr, like the default logger, unless the line is shipped instead, see WithShipOnly
+//   - lines are shipped while the lease ships the severity, or at any time at ERROR level or above
+//   - shipped lines include the date and time prefix of the logger, clear it with SetFlags(0) if unwanted
+func (m *Manager) StdLogger(s logging.Severity) *log.Logger {
+	return log.New(io.MultiWriter(m.LocalWriter(os.Stderr, s), m.LeveledWriter(s)), "", log.LstdFlags)
+}
+
+// levelPrefix matches a conventional level prefix such as "ERROR:" or "[WARN]", after an optional std log header.
+var levelPrefix = regexp.MustCompile(`^(?:\d{4}/\d{2}/\d{2} )?(?:\d{2}:\d{2}:\d{2}(?:\.\d+)? )?(?:\S+:\d+: )?(?:\[([A-Za-z]+)\]|([A-Za-z]+):)\s`)
+
+// PrefixWriter returns an io.Writer that writes to stderr and ships each line at the severity named by its prefix.
+//   - lines are written to stderr once complete, unless they are shipped instead, see WithShipOnly
+//   - prefixes such as "ERROR:", "WARN:", or "[DEBUG]" are recognized after the date, time, and file of a std log header
+//   - lines without a recognized prefix are shipped at the fallback severity
+//   - use it as the output of the std logger, log.SetOutput(m.PrefixWriter(logging.Info)), to adopt leasing as is
+func (m *Manager) PrefixWriter(fallback logging.Severity) io.Writer {
+	return m.newLineWriter(func(line []byte, truncated bool) {
+		s := prefixSeverity(line, fallback)
+		if !m.localSuppressed(s, m.shouldShip(s)) {
+			os.Stderr.Write(append(line, '\n'))
+		}
+		m.logLine(logging.Entry{
+			Severity: s,
+			Payload:  string(line),
+		}, truncated)
+	})
+}
+
+// prefixSeverity returns the severity named by the level prefix of a line, or fallback without one.
+func prefixSeverity(line []byte, fallback logging.Severity) logging.Severity {
+	match := levelPrefix.FindSubmatch(line)
+	if match == nil {
+		return fallback
+	}
+	name := match[1]
+	if name == nil {
+		name = match[2]
+	}
+	if s := parseLevel(string(name)); s != logging.Default {
+		return s
+	}
+	return fallback
+}
@@ -0,0 +1,145 @@
+package lease
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"cloud.google.com/go/logging"
+)
+
+// SeverityPattern classifies the plain text lines matching Pattern at Severity, see WithSeverityPatterns.
+type SeverityPattern struct {
+	Pattern  *regexp.Regexp
+	Severity logging.Severity
+}
+
+// DefaultSeverityPatterns recognize common level conventions: prefixes such as "ERROR:", "[WARN]" or "INFO ", logfmt
+// fields such as level=warn, and glog headers such as E0102.
+var DefaultSeverityPatterns = []SeverityPattern{
+	{regexp.MustCompile(`(?i)^\[?(?:fatal|panic|crit|critical)\]?[:\s]|\blevel=(?:fatal|panic|crit|critical)\b|^F\d{4} `), logging.Critical},
+	{regexp.MustCompile(`(?i)^\[?(?:err|error)\]?[:\s]|\blevel=(?:err|error)\b|^E\d{4} `), logging.Error},
+	{regexp.MustCompile(`(?i)^\[?(?:warn|warning)\]?[:\s]|\blevel=(?:warn|warning)\b|^W\d{4} `), logging.Warning},
+	{regexp.MustCompile(`(?i)^\[?info\]?[:\s]|\blevel=info\b|^I\d{4} `), logging.Info},
+	{regexp.MustCompile(`(?i)^\[?(?:debug|trace)\]?[:\s]|\blevel=(?:debug|trace)\b`), logging.Debug},
+}
+
+// ParseSeverityPattern converts a rule such as "WARNING=^WARN" to a SeverityPattern.
+func ParseSeverityPattern(s string) (SeverityPattern, error) {
+	name, pattern, ok := strings.Cut(s, "=")
+	if !ok {
+		return SeverityPattern{}, fmt.Errorf("invalid severity pattern %q, must be SEVERITY=REGEX", s)
+	}
+	return NewSeverityPattern(name, pattern)
+}
+
+// NewSeverityPattern compiles a pattern classifying lines at the named severity.
+func NewSeverityPattern(severity, pattern string) (SeverityPattern, error) {
+	s := parseLevel(severity)
+	if s == logging.Default && !strings.EqualFold(severity, "default") {
+		return SeverityPattern{}, fmt.Errorf("unknown severity %q in severity pattern", severity)
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return SeverityPattern{}, fmt.Errorf("invalid severity pattern for %s: %w", severity, err)
+	}
+	return SeverityPattern{Pattern: re, Severity: s}, nil
+}
+
+// WithSeverityPatterns classifies the plain text lines written to StdoutWriter and StderrWriter by the first pattern
+// they match, rather than shipping stdout at INFO and stderr at ERROR.
+//   - each line ships as its own entry, rather than each write
+//   - lines matching no pattern keep the severity of the stream
+//   - patterns add up over several options, in order, use DefaultSeverityPatterns for common conventions
+func WithSeverityPatterns(patterns ...SeverityPattern) Option {
+	return func(m *Manager) {
+		m.severityPatterns = append(m.severityPatterns, patterns...)
+	}
+}
+
+// streamWriter returns an io.Writer shipping the output of the named stream, such as stdout, at the given severity.
+//   - each write ships as a single entry, unless lines are parsed, see WithJSONLines, WithSeverityPatterns, and
+//     WithMultiline
+func (m *Manager) streamWriter(s logging.Severity, stream string) io.Writer {
+	if m.multiline != nil {
+		return &streamLineWriter{m: m, severity: s, stream: stream, group: m.multiline.newGroup(m, s, stream)}
+	}
+	if !m.jsonLines && len(m.severityPatterns) == 0 {
+		return &severityWriter{m: m, severity: s, stream: stream}
+	}
+
+	lines := m.newLineWriter(func(line []byte, truncated bool) {
+		if len(bytes.TrimSpace(line)) == 0 {
+			return
+		}
+		e := m.parseLine(line, s)
+		if truncated {
+			e = withLabel(e, "truncated", "true")
+		}
+		m.logStream(e, stream)
+	})
+	m.streamLinesMu.Lock()
+	m.streamLines = append(m.streamLines, lines)
+	m.streamLinesMu.Unlock()
+	return &streamLineWriter{m: m, severity: s, stream: stream, lines: lines}
+}
+
+// flushStreamLines ships and writes locally the partial lines still held by the line writers of StdoutWriter and
+// StderrWriter.
+func (m *Manager) flushStreamLines() {
+	m.streamLinesMu.Lock()
+	lines := m.streamLines
+	m.streamLinesMu.Unlock()
+
+	for _, lw := range lines {
+		lw.Close()
+	}
+}
+
+// streamLineWriter is an io.Writer shipping each line written to it as an entry, parsed and classified by the options
+// of the manager.
+//   - a trailing partial line is held back until its newline, so records spanning several writes ship whole, and is
+//     bounded like the lines of LeveledWriter, see WithMaxLineSize
+//   - partial lines still held ship on Close
+//   - with a group, lines are grouped into records instead, see WithMultiline
+type streamLineWriter struct {
+	m        *Manager
+	severity logging.Severity
+	stream   string
+	lines    *lineWriter
+	group    *lineGroup
+}
+
+func (w *streamLineWriter) Write(p []byte) (n int, err error) {
+	if w.group != nil {
+		w.group.write(p)
+		return len(p), nil
+	}
+	return w.lines.Write(p)
+}
+
+// parseLine converts a line of output to an entry, a JSON record with WithJSONLines, or plain text classified by the
+// severity patterns, falling back to the severity of the stream.
+func (m *Manager) parseLine(line []byte, fallback logging.Severity) logging.Entry {
+	// only lines that look like objects are decoded, so plain text costs no more than without the option, and long
+	// lines are not, as they could not ship as a whole
+	if m.jsonLines && !m.longLine(line) && bytes.TrimSpace(line)[0] == '{' {
+		if e, ok := ParseJSONRecord(line); ok {
+			if e.Severity == logging.Default {
+				e.Severity = fallback
+			}
+			return e
+		}
+	}
+
+	e := logging.Entry{Severity: fallback, Payload: string(line)}
+	for _, p := range m.severityPatterns {
+		if p.Pattern.Match(line) {
+			e.Severity = p.Severity
+			break
+		}
+	}
+	return e
+}
@@ -0,0 +1,58 @@
+package lease
+
+import (
+	"strings"
+	"testing"
+
+	"cloud.google.com/go/logging"
+)
+
+func TestStreamWriterHoldsPartialLines(t *testing.T) {
+	sink := &recordingSink{}
+	m := newTestManager(t, WithSink(sink, Leased), WithJSONLines(), WithSeverityPatterns(DefaultSeverityPatterns...))
+
+	w := m.streamWriter(logging.Info, "stdout")
+	// a record and a classified line, each spanning two writes as pipe-sized chunks would
+	for _, p := range []string{`{"level":"warn","msg":"disk `, "almost full\"}\nERROR: conn", "ection reset\npartial"} {
+		w.Write([]byte(p))
+	}
+	if got := len(sink.payloads()); got != 2 {
+		t.Fatalf("shipped %d entries before Close, want 2", got)
+	}
+	m.Close()
+
+	if got := len(sink.entries); got != 3 {
+		t.Fatalf("shipped %d entries, want 3", got)
+	}
+	if e := sink.entries[0]; e.Severity != logging.Warning {
+		t.Errorf("record shipped at %s, want WARNING", e.Severity)
+	}
+	if p, ok := sink.entries[0].Payload.(map[string]any); !ok || p["message"] != "disk almost full" {
+		t.Errorf("record shipped as %#v, want a structured payload", sink.entries[0].Payload)
+	}
+	if e := sink.entries[1]; e.Severity != logging.Error || e.Payload != "ERROR: connection reset" {
+		t.Errorf("line shipped as %s %q, want ERROR %q", e.Severity, e.Payload, "ERROR: connection reset")
+	}
+	if e := sink.entries[2]; e.Payload != "partial" {
+		t.Errorf("trailing partial line shipped as %q, want %q", e.Payload, "partial")
+	}
+}
+
+func TestStreamWriterBoundsPartialLines(t *testing.T) {
+	sink := &recordingSink{}
+	m := newTestManager(t, WithSink(sink, Leased), WithJSONLines(), WithMaxLineSize(8, LongLineTruncate))
+
+	w := m.streamWriter(logging.Info, "stdout")
+	for range 10 {
+		w.Write([]byte(strings.Repeat("x", 100)))
+	}
+	w.Write([]byte("\nok\n"))
+
+	payloads := sink.payloads()
+	if len(payloads) != 2 || payloads[1] != "ok" {
+		t.Fatalf("shipped %q, want the truncated line and %q", payloads, "ok")
+	}
+	if e := sink.entries[0]; e.Labels["truncated"] != "true" || len(e.Payload.(string)) > 8 {
+		t.Errorf("long line shipped as %q labeled %v, want at most 8 bytes labeled truncated=true", e.Payload, e.Labels)
+	}
+}
@@ -0,0 +1,214 @@
+package lease
+
+import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// Token pre-authorizes a lease for a time window, for instances that can not reach Firestore.
+//   - tokens are signed with an ed25519 key out-of-band, and verified by instances with its public key
+//   - a token only applies to the lease it names, and to instances whose labels match its tags
+type Token struct {
+	ID        string            `json:"id"`
+	LeaseID   string            `json:"leaseId"`
+	User      string            `json:"user"`
+	Reason    string            `json:"reason,omitempty"`
+	Tags      map[string]string `json:"tags,omitempty"`
+	NotBefore time.Time         `json:"notBefore"`
+	ExpireAt  time.Time         `json:"expireAt"`
+}
+
+// tokenPrefix versions the token format.
+const tokenPrefix = "llt1."
+
+// SignToken encodes the token and signs it with key.
+//   - the result is "llt1.<claims>.<signature>", both base64url encoded, safe for files and environment variables
+func SignToken(t Token, key ed25519.PrivateKey) (string, error) {
+	claims, err := json.Marshal(t)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode token: %w", err)
+	}
+	payload := base64.RawURLEncoding.EncodeToString(claims)
+	sig := ed25519.Sign(key, []byte(tokenPrefix+payload))
+	return tokenPrefix + payload + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+// ParseToken verifies the signature of a token with key and decodes it.
+//   - surrounding whitespace is ignored, so tokens can be read from files as is
+//   - the validity window is not checked, see Token.Valid
+func ParseToken(s string, key ed25519.PublicKey) (*Token, error) {
+	s = strings.TrimSpace(s)
+	rest, ok := strings.CutPrefix(s, tokenPrefix)
+	if !ok {
+		return nil, errors.New("not a lease token")
+	}
+	payload, encodedSig, ok := strings.Cut(rest, ".")
+	if !ok {
+		return nil, errors.New("malformed lease token")
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(encodedSig)
+	if err != nil {
+		return nil, fmt.Errorf("malformed lease token signature: %w", err)
+	}
+	if !ed25519.Verify(key, []byte(tokenPrefix+payload), sig) {
+		return nil, errors.New("invalid lease token signature")
+	}
+
+	claims, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, fmt.Errorf("malformed lease token: %w", err)
+	}
+	var t Token
+	if err := json.Unmarshal(claims, &t); err != nil {
+		return nil, fmt.Errorf("malformed lease token: %w", err)
+	}
+	return &t, nil
+}
+
+// Valid reports whether now is within the validity window of the token.
+func (t *Token) Valid(now time.Time) bool {
+	return !now.Before(t.NotBefore) && now.Before(t.ExpireAt)
+}
+
+// LoadTokenSigningKey reads an ed25519 private key from a PKCS #8 PEM file, such as one from openssl genpkey.
+func LoadTokenSigningKey(path string) (ed25519.PrivateKey, error) {
+	der, err := readPEM(path, "PRIVATE KEY")
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse token signing key: %w", err)
+	}
+	edKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("token signing key is a %T, not an ed25519 key", key)
+	}
+	return edKey, nil
+}
+
+// LoadTokenVerifyKey reads an ed25519 public key from a PKIX PEM file, such as one from openssl pkey -pubout.
+func LoadTokenVerifyKey(path string) (ed25519.PublicKey, error) {
+	der, err := readPEM(path, "PUBLIC KEY")
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse token verify key: %w", err)
+	}
+	edKey, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("token verify key is a %T, not an ed25519 key", key)
+	}
+	return edKey, nil
+}
+
+// readPEM returns the contents of the first PEM block of the given type in a file.
+func readPEM(path, blockType string) ([]byte, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key: %w", err)
+	}
+	for {
+		var block *pem.Block
+		block, b = pem.Decode(b)
+		if block == nil {
+			return nil, fmt.Errorf("no %s PEM block in %s", blockType, path)
+		}
+		if block.Type == blockType {
+			return block.Bytes, nil
+		}
+	}
+}
+
+// WithLeaseToken guarantees shipping during the validity window of a pre-authorization token, without reaching Firestore.
+//   - the token must name the lease passed to NewManager or one set with WithLeases or WithParentLeases
+//   - tokens whose tags do not match the labels of the manager, or that already expired, are ignored
+//   - a revocation seen in Firestore still stops shipping immediately
+func WithLeaseToken(t *Token) Option {
+	return func(m *Manager) {
+		m.token = t
+	}
+}
+
+// applyToken guarantees the source named by the token until the token expires, starting when it becomes valid.
+func (m *Manager) applyToken() {
+	t := m.token
+	now := time.Now().UTC()
+
+	var src *leaseSource
+	for _, s := range m.sources {
+		if s.docRef.ID == t.LeaseID {
+			src = s
+			break
+		}
+	}
+	switch {
+	case src == nil:
+		diag().Warn("lease token ignored, lease is not watched", "lease", t.LeaseID, "token", t.ID)
+		return
+	case !now.Before(t.ExpireAt):
+		diag().Warn("lease token ignored, expired", "expireAt", t.ExpireAt, "token", t.ID)
+		return
+	case !(&Document{Tags: t.Tags}).Matches(m.labels):
+		diag().Warn("lease token ignored, tags do not match", "tags", t.Tags, "token", t.ID)
+		return
+	}
+
+	// tokenMu is held throughout, so a revocation either happens first and voids the token, or resets its guarantee
+	apply := func() {
+		m.tokenMu.Lock()
+		defer m.tokenMu.Unlock()
+		if m.tokenRevoked {
+			diag().Info("lease token ignored, lease was revoked", "token", t.ID, "lease", src.docRef.ID)
+			return
+		}
+
+		src.expireMu.Lock()
+		if t.ExpireAt.After(src.guaranteedUntil) {
+			src.guaranteedUntil = t.ExpireAt
+		}
+		src.expireMu.Unlock()
+
+		diag().Info("lease token accepted", "expiresIn", time.Until(t.ExpireAt).Round(time.Millisecond*100), "user", t.User, "reason", t.Reason, "token", t.ID, "lease", src.docRef.ID)
+		src.expireAfter(t.ExpireAt)
+	}
+
+	if now.Before(t.NotBefore) {
+		diag().Info("lease token pending", "notBefore", t.NotBefore, "token", t.ID)
+		m.tokenMu.Lock()
+		m.tokenTimer = time.AfterFunc(t.NotBefore.Sub(now), apply)
+		m.tokenMu.Unlock()
+		return
+	}
+	apply()
+}
+
+// revokeToken voids the lease token, stopping it from being applied once it becomes valid, with tokenMu held.
+func (m *Manager) revokeToken() {
+	m.tokenRevoked = true
+	if m.tokenTimer != nil {
+		m.tokenTimer.Stop()
+		m.tokenTimer = nil
+	}
+}
+
+// stopToken stops a lease token that is not valid yet from being applied after Close.
+func (m *Manager) stopToken() {
+	m.tokenMu.Lock()
+	defer m.tokenMu.Unlock()
+	if m.tokenTimer != nil {
+		m.tokenTimer.Stop()
+		m.tokenTimer = nil
+	}
+}
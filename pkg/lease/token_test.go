@@ -0,0 +1,127 @@
+package lease
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTokenRoundTrip(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Token{
+		ID:        "t1",
+		LeaseID:   "checkout",
+		User:      "alice",
+		Reason:    "incident",
+		Tags:      map[string]string{"env": "prod"},
+		NotBefore: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		ExpireAt:  time.Date(2024, 1, 1, 1, 0, 0, 0, time.UTC),
+	}
+
+	s, err := SignToken(want, priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ParseToken(" "+s+"\n", pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ID != want.ID || got.LeaseID != want.LeaseID || got.User != want.User || got.Tags["env"] != "prod" ||
+		!got.NotBefore.Equal(want.NotBefore) || !got.ExpireAt.Equal(want.ExpireAt) {
+		t.Errorf("parsed %+v, want %+v", got, want)
+	}
+}
+
+func TestParseTokenRejects(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherPub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := SignToken(Token{LeaseID: "checkout", User: "alice"}, priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, sig, _ := strings.Cut(strings.TrimPrefix(s, tokenPrefix), ".")
+	forged, err := SignToken(Token{LeaseID: "checkout", User: "mallory"}, priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	forgedPayload, _, _ := strings.Cut(strings.TrimPrefix(forged, tokenPrefix), ".")
+
+	tests := []struct {
+		name  string
+		token string
+		key   ed25519.PublicKey
+	}{
+		{"other key", s, otherPub},
+		{"no prefix", payload + "." + sig, pub},
+		{"no signature", tokenPrefix + payload, pub},
+		{"swapped payload", tokenPrefix + forgedPayload + "." + sig, pub},
+		{"malformed signature", tokenPrefix + payload + ".!", pub},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseToken(tt.token, tt.key); err == nil {
+				t.Error("token was accepted")
+			}
+		})
+	}
+}
+
+func TestTokenValid(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tok := Token{NotBefore: start, ExpireAt: start.Add(time.Hour)}
+
+	tests := []struct {
+		at   time.Time
+		want bool
+	}{
+		{start.Add(-time.Second), false},
+		{start, true},
+		{start.Add(59 * time.Minute), true},
+		{start.Add(time.Hour), false},
+	}
+	for _, tt := range tests {
+		if got := tok.Valid(tt.at); got != tt.want {
+			t.Errorf("Valid(%v) = %v, want %v", tt.at, got, tt.want)
+		}
+	}
+}
+
+func TestPendingTokenVoidedByRevocation(t *testing.T) {
+	tests := []struct {
+		name    string
+		revoke  bool
+		enabled bool
+	}{
+		{"applied once valid", false, true},
+		{"revoked before it is valid", true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tok := &Token{ID: "t1", LeaseID: "test", NotBefore: time.Now().Add(50 * time.Millisecond), ExpireAt: time.Now().Add(time.Hour)}
+			m := newTestManagerUntil(t, time.Time{}, WithLeaseToken(tok))
+			if m.enabled.Load() {
+				t.Fatal("shipping before the token is valid")
+			}
+
+			if tt.revoke {
+				m.revokeGuarantees()
+			}
+			time.Sleep(150 * time.Millisecond)
+
+			if got := m.enabled.Load(); got != tt.enabled {
+				t.Errorf("shipping = %v once the token is valid, want %v", got, tt.enabled)
+			}
+		})
+	}
+}
@@ -0,0 +1,32 @@
+package lease
+
+import (
+	"context"
+
+	"cloud.google.com/go/logging"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// WithTraceProject sets the project that trace IDs belong to, so entries correlated with a span link to the trace in
+// the Cloud Console as projects/PROJECT/traces/TRACE_ID.
+//   - without it, entries carry the bare trace ID
+func WithTraceProject(projectID string) Option {
+	return func(m *Manager) {
+		m.traceProject = projectID
+	}
+}
+
+// setTrace correlates an entry with the OpenTelemetry span in ctx, if there is a valid one.
+func (m *Manager) setTrace(ctx context.Context, e *logging.Entry) {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return
+	}
+
+	e.Trace = sc.TraceID().String()
+	if m.traceProject != "" {
+		e.Trace = "projects/" + m.traceProject + "/traces/" + e.Trace
+	}
+	e.SpanID = sc.SpanID().String()
+	e.TraceSampled = sc.IsSampled()
+}
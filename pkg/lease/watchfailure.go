@@ -0,0 +1,95 @@
+package lease
+
+import (
+	"fmt"
+	"time"
+)
+
+// WatchFailurePolicy controls the lease state while a lease cannot be watched, such as during a Firestore outage.
+type WatchFailurePolicy int
+
+const (
+	// WatchFailHold keeps the last known state of the lease, an active lease still expires at its expiry time.
+	WatchFailHold WatchFailurePolicy = iota
+	// WatchFailOpen treats the lease as active until the watch recovers, shipping everything rather than missing logs.
+	WatchFailOpen
+	// WatchFailClosed treats the lease as inactive until the watch recovers, so an outage never extends a lease.
+	WatchFailClosed
+)
+
+// ParseWatchFailurePolicy converts "hold", "open", or "closed" to a WatchFailurePolicy.
+func ParseWatchFailurePolicy(s string) (WatchFailurePolicy, error) {
+	switch s {
+	case "hold":
+		return WatchFailHold, nil
+	case "open":
+		return WatchFailOpen, nil
+	case "closed":
+		return WatchFailClosed, nil
+	default:
+		return WatchFailHold, fmt.Errorf("unknown watch failure policy %q, must be hold, open, or closed", s)
+	}
+}
+
+// String returns the name of the policy, as accepted by ParseWatchFailurePolicy.
+func (p WatchFailurePolicy) String() string {
+	switch p {
+	case WatchFailOpen:
+		return "open"
+	case WatchFailClosed:
+		return "closed"
+	default:
+		return "hold"
+	}
+}
+
+// WithWatchFailurePolicy sets what happens once a lease could not be watched for the given duration, WatchFailHold by
+// default.
+//   - the last known state is held until then, so WatchFailClosed holds an active lease for at most that long
+//   - the policy applies to each lease on its own, and ends with the first snapshot once the watch recovers
+func WithWatchFailurePolicy(p WatchFailurePolicy, after time.Duration) Option {
+	return func(m *Manager) {
+		m.watchFailurePolicy = p
+		m.watchFailureAfter = after
+	}
+}
+
+// watchFailed starts the failure timer of the policy, unless it is already running or applied.
+func (s *leaseSource) watchFailed() {
+	if s.m.watchFailurePolicy == WatchFailHold {
+		return
+	}
+
+	s.failMu.Lock()
+	defer s.failMu.Unlock()
+	if s.failTimer == nil {
+		s.failTimer = time.AfterFunc(s.m.watchFailureAfter, s.applyWatchFailurePolicy)
+	}
+}
+
+// watchRecovered stops the failure timer once the watch delivers a snapshot again.
+//   - the snapshot being processed sets the lease state again, replacing the state set by the policy
+func (s *leaseSource) watchRecovered() {
+	s.failMu.Lock()
+	defer s.failMu.Unlock()
+	if s.failTimer == nil {
+		return
+	}
+	if !s.failTimer.Stop() {
+		diag().Info("lease watch recovered", "lease", s.docRef.ID)
+	}
+	s.failTimer = nil
+}
+
+// applyWatchFailurePolicy sets the lease state according to the policy, after the watch failed for long enough.
+func (s *leaseSource) applyWatchFailurePolicy() {
+	s.expireMu.Lock()
+	if s.expireTimer != nil {
+		s.expireTimer.Stop()
+	}
+	s.active.Store(s.m.watchFailurePolicy == WatchFailOpen)
+	s.expireMu.Unlock()
+
+	diag().Warn("lease watch failing, applying the watch failure policy", "lease", s.docRef.ID, "policy", s.m.watchFailurePolicy.String(), "failingFor", s.m.watchFailureAfter)
+	s.m.update()
+}
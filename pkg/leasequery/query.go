@@ -0,0 +1,141 @@
+// Package leasequery builds queries for the entries shipped under a lease, for tools that retrieve leased output.
+//
+// Entries shipped under a lease carry a lease_id label, and grant_id and session_id labels for the grant and capture
+// session they were shipped under. A Query selects them by lease and time range, and renders the selection for Cloud
+// Logging, Loki, or Elasticsearch:
+//
+//	q := leasequery.Query{LeaseID: "checkout", Start: time.Now().Add(-time.Hour)}
+//	it := adminClient.Entries(ctx, logadmin.Filter(q.CloudLoggingFilter()))
+package leasequery
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/logging"
+)
+
+// Query selects the entries shipped under a lease.
+//   - zero fields do not restrict the selection, except LeaseID which is required
+type Query struct {
+	LeaseID   string
+	Start     time.Time
+	End       time.Time
+	GrantID   string
+	SessionID string
+
+	// MinSeverity selects entries at or above a severity, every severity when Default.
+	MinSeverity logging.Severity
+}
+
+// labels returns the labels every selected entry has, in a stable order.
+func (q Query) labels() [][2]string {
+	labels := [][2]string{{"lease_id", q.LeaseID}}
+	if q.GrantID != "" {
+		labels = append(labels, [2]string{"grant_id", q.GrantID})
+	}
+	if q.SessionID != "" {
+		labels = append(labels, [2]string{"session_id", q.SessionID})
+	}
+	return labels
+}
+
+// CloudLoggingFilter returns a Logging API filter, for logadmin.Filter or the Logs Explorer.
+func (q Query) CloudLoggingFilter() string {
+	var clauses []string
+	for _, l := range q.labels() {
+		clauses = append(clauses, fmt.Sprintf("labels.%s=%s", l[0], strconv.Quote(l[1])))
+	}
+	if !q.Start.IsZero() {
+		clauses = append(clauses, fmt.Sprintf("timestamp>=%s", strconv.Quote(q.Start.UTC().Format(time.RFC3339Nano))))
+	}
+	if !q.End.IsZero() {
+		clauses = append(clauses, fmt.Sprintf("timestamp<%s", strconv.Quote(q.End.UTC().Format(time.RFC3339Nano))))
+	}
+	if q.MinSeverity > logging.Default {
+		clauses = append(clauses, "severity>="+strings.ToUpper(q.MinSeverity.String()))
+	}
+	return strings.Join(clauses, " AND ")
+}
+
+// LogQL returns a Loki LogQL log query, for pipelines that ship the entry labels as stream labels.
+//   - the time range is not part of LogQL, pass LokiValues to query_range instead
+func (q Query) LogQL() string {
+	var matchers []string
+	for _, l := range q.labels() {
+		matchers = append(matchers, fmt.Sprintf("%s=%s", l[0], strconv.Quote(l[1])))
+	}
+	if q.MinSeverity > logging.Default {
+		matchers = append(matchers, fmt.Sprintf("severity=~%s", strconv.Quote(severityPattern(q.MinSeverity))))
+	}
+	return "{" + strings.Join(matchers, ", ") + "}"
+}
+
+// LokiValues returns the parameters of a Loki query_range request for the query, oldest entries first.
+func (q Query) LokiValues() url.Values {
+	v := url.Values{
+		"query":     {q.LogQL()},
+		"direction": {"forward"},
+	}
+	if !q.Start.IsZero() {
+		v.Set("start", strconv.FormatInt(q.Start.UnixNano(), 10))
+	}
+	if !q.End.IsZero() {
+		v.Set("end", strconv.FormatInt(q.End.UnixNano(), 10))
+	}
+	return v
+}
+
+// Elasticsearch returns an Elasticsearch query DSL body, for documents shaped like the JSON lines of a file sink.
+//   - labels are read from labels.<name>, the time from timestamp, and the severity from severity
+func (q Query) Elasticsearch() map[string]any {
+	var filters []any
+	for _, l := range q.labels() {
+		filters = append(filters, map[string]any{"term": map[string]any{"labels." + l[0]: l[1]}})
+	}
+
+	if !q.Start.IsZero() || !q.End.IsZero() {
+		r := map[string]any{"format": "strict_date_optional_time_nanos"}
+		if !q.Start.IsZero() {
+			r["gte"] = q.Start.UTC().Format(time.RFC3339Nano)
+		}
+		if !q.End.IsZero() {
+			r["lt"] = q.End.UTC().Format(time.RFC3339Nano)
+		}
+		filters = append(filters, map[string]any{"range": map[string]any{"timestamp": r}})
+	}
+
+	if q.MinSeverity > logging.Default {
+		filters = append(filters, map[string]any{"terms": map[string]any{"severity": severitiesFrom(q.MinSeverity)}})
+	}
+
+	return map[string]any{
+		"query": map[string]any{"bool": map[string]any{"filter": filters}},
+		"sort":  []any{map[string]any{"timestamp": "asc"}},
+	}
+}
+
+// severities are all named severities, from lowest to highest.
+var severities = []logging.Severity{
+	logging.Debug, logging.Info, logging.Notice, logging.Warning,
+	logging.Error, logging.Critical, logging.Alert, logging.Emergency,
+}
+
+// severitiesFrom returns the names of the severities at or above lowest.
+func severitiesFrom(lowest logging.Severity) []string {
+	var names []string
+	for _, s := range severities {
+		if s >= lowest {
+			names = append(names, s.String())
+		}
+	}
+	return names
+}
+
+// severityPattern returns a regular expression matching the names of the severities at or above lowest.
+func severityPattern(lowest logging.Severity) string {
+	return strings.Join(severitiesFrom(lowest), "|")
+}
@@ -0,0 +1,323 @@
+// Package spool persists log entries to rotating segment files on disk, so they survive restarts until replayed.
+package spool
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// headerSize is the size of the header preceding every record.
+//   - 4 bytes payload length, 4 bytes CRC-32C of timestamp and payload, 8 bytes unix nano timestamp
+const headerSize = 16
+
+// maxRecordBytes bounds the size of a single record, larger lengths can only come from corruption.
+const maxRecordBytes = 64 << 20
+
+// segmentExt is the file extension of spool segments.
+const segmentExt = ".seg"
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// ErrClosed is returned when appending to a closed spool.
+var ErrClosed = errors.New("spool is closed")
+
+// Options configures segment rotation and cleanup.
+type Options struct {
+	// MaxSegmentBytes rotates the active segment once it grows past this size.
+	MaxSegmentBytes int64
+	// MaxSegmentAge rotates the active segment once it is older than this.
+	MaxSegmentAge time.Duration
+	// MaxTotalBytes removes the oldest segments once all segments together exceed this size.
+	MaxTotalBytes int64
+	// Retention removes segments whose newest record is older than this.
+	Retention time.Duration
+}
+
+// Spool is an append-only, segmented, on-disk store of timestamped records.
+//   - records are checksummed, a corrupt or truncated record ends the replay of its segment but not of the spool
+//   - segments are named by the time they were created, so they sort oldest first
+type Spool struct {
+	dir     string
+	opts    Options
+	corrupt atomic.Int64
+
+	mu            sync.Mutex
+	active        *os.File
+	activeSize    int64
+	activeCreated time.Time
+	closed        bool
+}
+
+// Open opens, or creates, a spool in dir.
+//   - existing segments are kept for replay, new records are always written to a new segment
+func Open(dir string, opts Options) (*Spool, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create spool directory: %w", err)
+	}
+
+	s := &Spool{dir: dir, opts: opts}
+	if err := s.cleanup(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Append writes a record to the active segment, rotating and cleaning up segments as needed.
+func (s *Spool) Append(ts time.Time, data []byte) error {
+	if len(data) > maxRecordBytes {
+		return fmt.Errorf("spool record of %d bytes exceeds the %d byte limit", len(data), maxRecordBytes)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return ErrClosed
+	}
+	if s.shouldRotate() {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+
+	buf := make([]byte, headerSize+len(data))
+	binary.BigEndian.PutUint32(buf[0:4], uint32(len(data)))
+	binary.BigEndian.PutUint64(buf[8:16], uint64(ts.UnixNano()))
+	copy(buf[headerSize:], data)
+	binary.BigEndian.PutUint32(buf[4:8], crc32.Checksum(buf[8:], crcTable))
+
+	n, err := s.active.Write(buf)
+	s.activeSize += int64(n)
+	if err != nil {
+		return fmt.Errorf("failed to append to spool: %w", err)
+	}
+	return nil
+}
+
+// Replay calls fn, oldest first, for every record with a timestamp at or after since.
+//   - corrupt records are counted and skip the rest of their segment
+//   - an error returned by fn stops the replay and is returned
+//   - records appended while replaying are not replayed, and appending does not wait for the replay
+func (s *Spool) Replay(since time.Time, fn func(ts time.Time, data []byte) error) error {
+	s.mu.Lock()
+	segments, err := s.segments()
+	var activeName string
+	var activeSize int64
+	if s.active != nil {
+		activeName, activeSize = s.active.Name(), s.activeSize
+	}
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	for _, seg := range segments {
+		// the active segment is only read up to the records it held when the replay started
+		limit := int64(-1)
+		if seg == activeName {
+			limit = activeSize
+		}
+		if err := s.replaySegment(seg, limit, since, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Corrupt returns the number of corrupt records found while replaying.
+func (s *Spool) Corrupt() int64 {
+	return s.corrupt.Load()
+}
+
+// Close closes the active segment, appending afterwards returns ErrClosed.
+func (s *Spool) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closed = true
+	if s.active == nil {
+		return nil
+	}
+	err := s.active.Close()
+	s.active = nil
+	return err
+}
+
+// shouldRotate reports whether a new segment must be started before appending.
+func (s *Spool) shouldRotate() bool {
+	switch {
+	case s.active == nil:
+		return true
+	case s.opts.MaxSegmentBytes > 0 && s.activeSize >= s.opts.MaxSegmentBytes:
+		return true
+	case s.opts.MaxSegmentAge > 0 && time.Since(s.activeCreated) >= s.opts.MaxSegmentAge:
+		return true
+	default:
+		return false
+	}
+}
+
+// rotate closes the active segment, starts a new one, and cleans up old segments.
+func (s *Spool) rotate() error {
+	if s.active != nil {
+		if err := s.active.Close(); err != nil {
+			return fmt.Errorf("failed to close spool segment: %w", err)
+		}
+		s.active = nil
+	}
+
+	now := time.Now()
+	name := filepath.Join(s.dir, fmt.Sprintf("%020d%s", now.UnixNano(), segmentExt))
+	f, err := os.OpenFile(name, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to create spool segment: %w", err)
+	}
+
+	s.active = f
+	s.activeSize = 0
+	s.activeCreated = now
+
+	return s.cleanup()
+}
+
+// cleanup removes segments past the retention period, then the oldest segments until under the size limit.
+//   - the active segment is never removed
+func (s *Spool) cleanup() error {
+	segments, err := s.segments()
+	if err != nil {
+		return err
+	}
+
+	type segInfo struct {
+		path string
+		size int64
+	}
+	var kept []segInfo
+	var total int64
+	for _, seg := range segments {
+		if s.active != nil && seg == s.active.Name() {
+			continue
+		}
+
+		info, err := os.Stat(seg)
+		if err != nil {
+			continue
+		}
+
+		if s.opts.Retention > 0 && time.Since(info.ModTime()) > s.opts.Retention {
+			if err := os.Remove(seg); err != nil {
+				return fmt.Errorf("failed to remove expired spool segment: %w", err)
+			}
+			continue
+		}
+
+		kept = append(kept, segInfo{path: seg, size: info.Size()})
+		total += info.Size()
+	}
+
+	if s.opts.MaxTotalBytes <= 0 {
+		return nil
+	}
+
+	total += s.activeSize
+	for len(kept) > 0 && total > s.opts.MaxTotalBytes {
+		if err := os.Remove(kept[0].path); err != nil {
+			return fmt.Errorf("failed to remove spool segment: %w", err)
+		}
+		total -= kept[0].size
+		kept = kept[1:]
+	}
+	return nil
+}
+
+// segments returns the paths of all segments, oldest first.
+func (s *Spool) segments() ([]string, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list spool segments: %w", err)
+	}
+
+	var segments []string
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, segmentExt) {
+			continue
+		}
+		if _, err := strconv.ParseInt(strings.TrimSuffix(name, segmentExt), 10, 64); err != nil {
+			continue
+		}
+		segments = append(segments, filepath.Join(s.dir, name))
+	}
+
+	slices.Sort(segments)
+	return segments, nil
+}
+
+// replaySegment replays the records of a single segment, reading at most limit bytes of it unless limit is negative.
+//   - segments removed by cleanup since they were listed are skipped
+func (s *Spool) replaySegment(path string, limit int64, since time.Time, fn func(ts time.Time, data []byte) error) error {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open spool segment: %w", err)
+	}
+	defer f.Close()
+
+	var src io.Reader = f
+	if limit >= 0 {
+		src = io.LimitReader(f, limit)
+	}
+	r := bufio.NewReader(src)
+	header := make([]byte, headerSize)
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			if !errors.Is(err, io.EOF) {
+				// a partial header is a torn write at the end of the segment
+				s.corrupt.Add(1)
+			}
+			return nil
+		}
+
+		size := binary.BigEndian.Uint32(header[0:4])
+		sum := binary.BigEndian.Uint32(header[4:8])
+		if size > maxRecordBytes {
+			s.corrupt.Add(1)
+			return nil
+		}
+
+		data := make([]byte, size)
+		if _, err := io.ReadFull(r, data); err != nil {
+			s.corrupt.Add(1)
+			return nil
+		}
+
+		crc := crc32.Update(crc32.Checksum(header[8:16], crcTable), crcTable, data)
+		if crc != sum {
+			// lengths can no longer be trusted, skip the rest of the segment
+			s.corrupt.Add(1)
+			return nil
+		}
+
+		ts := time.Unix(0, int64(binary.BigEndian.Uint64(header[8:16])))
+		if ts.Before(since) {
+			continue
+		}
+		if err := fn(ts, data); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,268 @@
+package spool
+
+import (
+	"os"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// appendRecords appends the records "0" to "n-1" to s, stamped with the current time.
+func appendRecords(t *testing.T, s *Spool, n int) {
+	t.Helper()
+	for i := range n {
+		if err := s.Append(time.Now(), []byte(strconv.Itoa(i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// replayAll returns the data of every record in s.
+func replayAll(t *testing.T, s *Spool) []string {
+	t.Helper()
+	var records []string
+	err := s.Replay(time.Time{}, func(_ time.Time, data []byte) error {
+		records = append(records, string(data))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return records
+}
+
+// segmentPaths returns the segments in dir, oldest first.
+func segmentPaths(t *testing.T, dir string) []string {
+	t.Helper()
+	s := &Spool{dir: dir}
+	segments, err := s.segments()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return segments
+}
+
+func TestRotation(t *testing.T) {
+	// every record is headerSize plus one byte of data
+	const recordSize = headerSize + 1
+
+	tests := []struct {
+		name     string
+		opts     Options
+		records  int
+		segments int
+	}{
+		{"no limits", Options{}, 5, 1},
+		{"by size", Options{MaxSegmentBytes: 2 * recordSize}, 5, 3},
+		{"by size, one record each", Options{MaxSegmentBytes: 1}, 3, 3},
+		{"by age", Options{MaxSegmentAge: time.Nanosecond}, 3, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			s, err := Open(dir, tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer s.Close()
+
+			appendRecords(t, s, tt.records)
+
+			if got := len(segmentPaths(t, dir)); got != tt.segments {
+				t.Errorf("wrote %d segments, want %d", got, tt.segments)
+			}
+			if got, want := replayAll(t, s), []string{"0", "1", "2", "3", "4"}[:tt.records]; !slices.Equal(got, want) {
+				t.Errorf("replayed %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestCorruption(t *testing.T) {
+	const recordSize = headerSize + 1
+
+	tests := []struct {
+		name    string
+		corrupt func(t *testing.T, path string)
+		want    []string
+	}{
+		{
+			name: "torn write",
+			corrupt: func(t *testing.T, path string) {
+				if err := os.Truncate(path, 2*recordSize+headerSize/2); err != nil {
+					t.Fatal(err)
+				}
+			},
+			want: []string{"0", "1"},
+		},
+		{
+			name: "torn payload",
+			corrupt: func(t *testing.T, path string) {
+				if err := os.Truncate(path, 3*recordSize-1); err != nil {
+					t.Fatal(err)
+				}
+			},
+			want: []string{"0", "1"},
+		},
+		{
+			name: "flipped payload byte",
+			corrupt: func(t *testing.T, path string) {
+				// the rest of the segment is skipped, as lengths can no longer be trusted
+				flipByte(t, path, recordSize+headerSize)
+			},
+			want: []string{"0"},
+		},
+		{
+			name: "impossible length",
+			corrupt: func(t *testing.T, path string) {
+				flipByte(t, path, 0)
+			},
+			want: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			s, err := Open(dir, Options{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			appendRecords(t, s, 3)
+			s.Close()
+			tt.corrupt(t, segmentPaths(t, dir)[0])
+
+			// a second segment, which must still replay after the corrupt one
+			s, err = Open(dir, Options{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer s.Close()
+			if err := s.Append(time.Now(), []byte("next")); err != nil {
+				t.Fatal(err)
+			}
+
+			want := append(tt.want, "next")
+			if got := replayAll(t, s); !slices.Equal(got, want) {
+				t.Errorf("replayed %q, want %q", got, want)
+			}
+			if got := s.Corrupt(); got != 1 {
+				t.Errorf("counted %d corrupt records, want 1", got)
+			}
+		})
+	}
+}
+
+// flipByte inverts the byte at offset in the file at path.
+func flipByte(t *testing.T, path string, offset int) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[offset] ^= 0xff
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCleanup(t *testing.T) {
+	const recordSize = headerSize + 1
+
+	tests := []struct {
+		name string
+		opts Options
+		// age is how long ago the first two of the three segments were last written
+		age  time.Duration
+		want []string
+	}{
+		{"nothing to clean up", Options{Retention: time.Hour, MaxTotalBytes: 10 * recordSize}, 0, []string{"0", "1", "2"}},
+		{"retention", Options{Retention: time.Hour}, 2 * time.Hour, []string{"2"}},
+		{"within retention", Options{Retention: time.Hour}, 30 * time.Minute, []string{"0", "1", "2"}},
+		{"total size", Options{MaxTotalBytes: 2 * recordSize}, 0, []string{"1", "2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			// one record per segment
+			s, err := Open(dir, Options{MaxSegmentBytes: 1})
+			if err != nil {
+				t.Fatal(err)
+			}
+			appendRecords(t, s, 3)
+			s.Close()
+
+			if tt.age > 0 {
+				old := time.Now().Add(-tt.age)
+				for _, seg := range segmentPaths(t, dir)[:2] {
+					if err := os.Chtimes(seg, old, old); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+
+			// cleanup runs when the spool is opened
+			s, err = Open(dir, tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer s.Close()
+
+			if got := replayAll(t, s); !slices.Equal(got, tt.want) {
+				t.Errorf("kept %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReplayDoesNotBlockAppend(t *testing.T) {
+	s, err := Open(t.TempDir(), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	appendRecords(t, s, 2)
+
+	var replayed []string
+	err = s.Replay(time.Time{}, func(_ time.Time, data []byte) error {
+		replayed = append(replayed, string(data))
+
+		appended := make(chan error, 1)
+		go func() { appended <- s.Append(time.Now(), []byte("during")) }()
+		select {
+		case err := <-appended:
+			return err
+		case <-time.After(time.Second):
+			t.Fatal("Append blocked while replaying")
+			return nil
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// records appended during the replay are left for the next one
+	if want := []string{"0", "1"}; !slices.Equal(replayed, want) {
+		t.Errorf("replayed %q, want %q", replayed, want)
+	}
+	if got := len(replayAll(t, s)); got != 4 {
+		t.Errorf("spooled %d records, want 4", got)
+	}
+}
+
+func TestAppendAfterClose(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(dir, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	appendRecords(t, s, 1)
+	s.Close()
+
+	if err := s.Append(time.Now(), []byte("late")); err != ErrClosed {
+		t.Errorf("Append() after Close = %v, want %v", err, ErrClosed)
+	}
+	if got := len(segmentPaths(t, dir)); got != 1 {
+		t.Errorf("wrote %d segments, want 1", got)
+	}
+}